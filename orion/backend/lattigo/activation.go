@@ -0,0 +1,156 @@
+package main
+
+import (
+	"C"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// Transformer activations are smooth, so over the range their inputs are
+// known to lie in, a Chebyshev interpolant of modest degree approximates
+// them well. The interpolants are built here from the interval and degree
+// and cached, so that Python does not fit its own.
+var activationFunctions = map[string]func(float64) float64{
+	"gelu": func(x float64) float64 {
+		return 0.5 * x * (1 + math.Erf(x/math.Sqrt2))
+	},
+	"silu": func(x float64) float64 {
+		return x / (1 + math.Exp(-x))
+	},
+	"softplus": func(x float64) float64 {
+		return math.Max(x, 0) + math.Log1p(math.Exp(-math.Abs(x)))
+	},
+}
+
+type activationKey struct {
+	name   string
+	a, b   float64
+	degree int
+}
+
+var (
+	activationPolysMu sync.Mutex
+	activationPolys   = map[activationKey]bignum.Polynomial{}
+)
+
+// activationPolynomial returns the Chebyshev interpolant of the named
+// activation over [a, b].
+func activationPolynomial(name string, a, b float64, degree int) (bignum.Polynomial, error) {
+	fn, known := activationFunctions[name]
+	if !known {
+		return bignum.Polynomial{}, fmt.Errorf("unknown activation %q", name)
+	}
+	if err := checkActivationInterval(a, b, degree); err != nil {
+		return bignum.Polynomial{}, err
+	}
+
+	key := activationKey{name, a, b, degree}
+	activationPolysMu.Lock()
+	poly, exists := activationPolys[key]
+	activationPolysMu.Unlock()
+	if exists {
+		return poly, nil
+	}
+	poly = bignum.ChebyshevApproximation(fn, bignum.Interval{
+		Nodes: degree,
+		A:     *bignum.NewFloat(a, 128),
+		B:     *bignum.NewFloat(b, 128),
+	})
+	activationPolysMu.Lock()
+	activationPolys[key] = poly
+	activationPolysMu.Unlock()
+	return poly, nil
+}
+
+func checkActivationInterval(a, b float64, degree int) error {
+	if !(a < b) || math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return fmt.Errorf("invalid interval [%g, %g]", a, b)
+	}
+	if degree < 1 {
+		return fmt.Errorf("activation degree must be positive, got %d", degree)
+	}
+	return nil
+}
+
+// GetActivationDepth returns the levels an activation over [a, b] with the
+// given degree consumes, or -1 with the last error set.
+//
+//export GetActivationDepth
+func GetActivationDepth(a, b C.double, degree C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if err := checkActivationInterval(float64(a), float64(b), int(degree)); err != nil {
+		SetLastError(err)
+		return -1
+	}
+	// The depth only depends on the degree and interval, not the coefficients.
+	poly := bignum.NewPolynomial(
+		bignum.Chebyshev, make([]float64, int(degree)+1), [2]float64{float64(a), float64(b)})
+	return C.int(polynomialLevels(scheme, poly))
+}
+
+// EvaluateGELU approximates GELU on a ciphertext whose values lie in
+// [a, b] with a polynomial of the given degree. Returns the ID of the
+// result, or -1 with the last error set.
+//
+//export EvaluateGELU
+func EvaluateGELU(ciphertextID C.int, a, b C.double, degree C.int) C.int {
+	scheme := activeScheme.Load()
+	return evaluateActivation(scheme, "gelu", ciphertextID, a, b, degree)
+}
+
+// EvaluateSiLU approximates SiLU, as EvaluateGELU does GELU.
+//
+//export EvaluateSiLU
+func EvaluateSiLU(ciphertextID C.int, a, b C.double, degree C.int) C.int {
+	scheme := activeScheme.Load()
+	return evaluateActivation(scheme, "silu", ciphertextID, a, b, degree)
+}
+
+// EvaluateSoftplus approximates softplus, as EvaluateGELU does GELU.
+//
+//export EvaluateSoftplus
+func EvaluateSoftplus(ciphertextID C.int, a, b C.double, degree C.int) C.int {
+	scheme := activeScheme.Load()
+	return evaluateActivation(scheme, "softplus", ciphertextID, a, b, degree)
+}
+
+func evaluateActivation(
+	scheme *Scheme, name string, ciphertextID C.int, a, b C.double, degree C.int,
+) C.int {
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	poly, err := activationPolynomial(name, float64(a), float64(b), int(degree))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	ctOut, err := evaluateActivationPolynomial(scheme, ctIn, poly)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func evaluateActivationPolynomial(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, poly bignum.Polynomial,
+) (*rlwe.Ciphertext, error) {
+	if need := polynomialLevels(scheme, poly); ctIn.Level() < need {
+		return nil, fmt.Errorf(
+			"cannot evaluate an activation on a ciphertext at level %d: "+
+				"%d levels are needed", ctIn.Level(), need)
+	}
+	return evaluatePolynomial(scheme, ctIn, poly, scheme.Params.DefaultScale())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// The activations decrypt to within their interpolants' error of the
+// functions over the whole interval, endpoints and 0 included, and
+// consume the levels GetActivationDepth reports.
+func TestEvaluateActivations(t *testing.T) {
+	scheme := newTestScheme(t, deepTestParams)
+	slots := scheme.Params.MaxSlots()
+	maxLevel := scheme.Params.MaxLevel()
+	const a, b, degree = -6.0, 6.0, 31
+
+	x := intervalValues(slots, a, b)
+	for i, xi := range []float64{0, 1e-3, 0.5, 2} {
+		x[2*i], x[2*i+1] = xi, -xi
+	}
+	ctID := encryptValues(t, scheme, x, maxLevel)
+
+	for name, fn := range activationFunctions {
+		t.Run(name, func(t *testing.T) {
+			poly, err := activationPolynomial(name, a, b, degree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctOut, err := evaluateActivationPolynomial(scheme, RetrieveCiphertext(ctID), poly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := maxLevel - ctOut.Level(); got != polynomialLevels(scheme, poly) {
+				t.Errorf("%s consumed %d levels, want %d", name, got, polynomialLevels(scheme, poly))
+			}
+
+			got := decryptValues(t, scheme, PushCiphertext(ctOut))
+			for i, xi := range x {
+				if err := math.Abs(got[i] - fn(xi)); err > 1e-5 {
+					t.Errorf("%s(%g) = %g, off by %g", name, xi, got[i], err)
+				}
+			}
+
+			low := atLevel(scheme, RetrieveCiphertext(ctID), polynomialLevels(scheme, poly)-1)
+			if _, err := evaluateActivationPolynomial(scheme, low, poly); err == nil {
+				t.Errorf("evaluated %s without the levels it takes", name)
+			}
+		})
+	}
+
+	if _, err := activationPolynomial("tanh", a, b, degree); err == nil {
+		t.Error("approximated an unknown activation")
+	}
+	if _, err := activationPolynomial("gelu", b, a, degree); err == nil {
+		t.Error("approximated an activation over an empty interval")
+	}
+}
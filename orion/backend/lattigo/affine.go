@@ -0,0 +1,147 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+)
+
+// An affine map multiplies every slot by its own scale and adds its own
+// bias, as a folded BatchNorm does. Both are applied before a single
+// rescale, so the map costs one level. The encoded scale depends only on
+// the input's level, and the encoded bias also on its scale, so they are
+// kept per level and scale to spare repeated inferences the encoding.
+type affineMap struct {
+	scale, bias []float64
+	encoded     map[affineKey]affinePlaintexts
+}
+
+type affineKey struct {
+	level int
+	scale float64
+}
+
+type affinePlaintexts struct {
+	scale, bias *rlwe.Plaintext
+}
+
+var affineHeap = NewHeapAllocator()
+
+func RetrieveAffine(affineID int) *affineMap {
+	return affineHeap.Retrieve(affineID).(*affineMap)
+}
+
+// GenerateAffine registers the per-slot scale and bias of an affine map.
+// Slots past the end of either are multiplied by 0 or shifted by 0
+// respectively. Returns the map's handle, or -1 with the last error set.
+//
+//export GenerateAffine
+func GenerateAffine(
+	scalePtr *C.double, lenScale C.int,
+	biasPtr *C.double, lenBias C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	slots := scheme.Params.MaxSlots()
+	if int(lenScale) > slots || int(lenBias) > slots {
+		SetLastError(fmt.Errorf(
+			"cannot encode %d scales and %d biases into %d slots",
+			int(lenScale), int(lenBias), slots))
+		return -1
+	}
+
+	affine := &affineMap{
+		scale:   CArrayToSlice(scalePtr, lenScale, convertCDoubleToFloat),
+		bias:    CArrayToSlice(biasPtr, lenBias, convertCDoubleToFloat),
+		encoded: map[affineKey]affinePlaintexts{},
+	}
+	idx := affineHeap.Add(affine)
+	return C.int(idx)
+}
+
+//export DeleteAffine
+func DeleteAffine(affineID C.int) {
+	affineHeap.Delete(int(affineID))
+}
+
+// EvaluateAffine applies an affine map to a ciphertext, returning the ID
+// of the result one level below it at the same scale, or -1 with the last
+// error set.
+//
+//export EvaluateAffine
+func EvaluateAffine(ciphertextID, affineID C.int) C.int {
+	scheme := activeScheme.Load()
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	if !affineHeap.Exists(int(affineID)) {
+		SetLastError(fmt.Errorf("affine map %d does not exist", int(affineID)))
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+	affine := RetrieveAffine(int(affineID))
+
+	ctOut, err := affine.evaluate(scheme, ctIn)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func (a *affineMap) evaluate(scheme *Scheme, ctIn *rlwe.Ciphertext) (*rlwe.Ciphertext, error) {
+	level := ctIn.Level()
+	if level < scheme.Params.LevelsConsumedPerRescaling() {
+		return nil, fmt.Errorf(
+			"cannot apply an affine map to a ciphertext at level %d: "+
+				"no level left to rescale the product", level)
+	}
+
+	pts, err := a.plaintexts(scheme, level, ctIn.Scale)
+	if err != nil {
+		return nil, err
+	}
+
+	ctOut, err := scheme.Evaluator.MulNew(ctIn, pts.scale)
+	if err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Add(ctOut, pts.bias, ctOut); err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		return nil, err
+	}
+	return ctOut, nil
+}
+
+// plaintexts returns the map's scale and bias encoded for an input at
+// level with the given scale, encoding them on first use. The bias is
+// encoded at the scale of the product, so that adding it is exact.
+func (a *affineMap) plaintexts(
+	scheme *Scheme, level int, scale rlwe.Scale,
+) (affinePlaintexts, error) {
+	key := affineKey{level, scale.Float64()}
+	if pts, exists := a.encoded[key]; exists {
+		return pts, nil
+	}
+
+	scalePt, err := newMaskPlaintext(scheme, a.scale, level)
+	if err != nil {
+		return affinePlaintexts{}, err
+	}
+	biasPt := ckks.NewPlaintext(*scheme.Params, level)
+	biasPt.Scale = scale.Mul(scalePt.Scale)
+	if err := scheme.Encoder.Encode(a.bias, biasPt); err != nil {
+		return affinePlaintexts{}, err
+	}
+
+	pts := affinePlaintexts{scalePt, biasPt}
+	a.encoded[key] = pts
+	return pts, nil
+}
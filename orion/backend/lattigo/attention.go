@@ -0,0 +1,249 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// softmaxConfig describes how the softmax of the attention scores is
+// approximated. exp is applied to every score, after which each row is
+// divided by its sum, whose inverse is found by invIters Goldschmidt
+// iterations that converge for sums within [invMin, invMax].
+type softmaxConfig struct {
+	exp            bignum.Polynomial
+	invMin, invMax float64
+	invIters       int
+}
+
+// AttentionCiphertexts computes softmax(scale * Q K^T) V for the d x d
+// matrices Q, K and V, packed row-major and replicated across the slots as
+// for MatMulCiphertexts. The softmax exponentiates every score with the
+// polynomial expPolyID, which must approximate exp over the range of the
+// scaled scores, and normalizes each row by the inverse of its sum, which
+// must lie within [invMin, invMax]. Ciphertexts are bootstrapped with the
+// bootstrapper for btpSlots whenever a stage would otherwise run out of
+// levels; with btpSlots 0, the inputs must hold enough levels for the
+// whole block. Returns the ID of the output, or -1 with the last error
+// set.
+//
+//export AttentionCiphertexts
+func AttentionCiphertexts(
+	qID, kID, vID C.int,
+	dim C.int,
+	scale C.double,
+	expPolyID C.int,
+	invMin, invMax C.double,
+	invIters C.int,
+	btpSlots C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	for _, id := range []C.int{qID, kID, vID} {
+		if !ctHeap.Exists(int(id)) {
+			SetLastError(fmt.Errorf("ciphertext %d does not exist", int(id)))
+			return -1
+		}
+	}
+	if !polyHeap.Exists(int(expPolyID)) {
+		SetLastError(fmt.Errorf("polynomial %d does not exist", int(expPolyID)))
+		return -1
+	}
+	if invMin <= 0 || invMin >= invMax || invIters < 0 {
+		SetLastError(fmt.Errorf(
+			"invalid softmax normalization: range [%g, %g] with %d iterations",
+			float64(invMin), float64(invMax), int(invIters)))
+		return -1
+	}
+
+	softmax := softmaxConfig{
+		exp:      RetrievePoly(int(expPolyID)),
+		invMin:   float64(invMin),
+		invMax:   float64(invMax),
+		invIters: int(invIters),
+	}
+	ctOut, err := attentionCiphertexts(
+		scheme, RetrieveCiphertext(int(qID)),
+		RetrieveCiphertext(int(kID)),
+		RetrieveCiphertext(int(vID)),
+		int(dim), float64(scale), softmax, int(btpSlots))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func attentionCiphertexts(
+	scheme *Scheme,
+	ctQ, ctK, ctV *rlwe.Ciphertext,
+	d int, scale float64, softmax softmaxConfig, btpSlots int,
+) (*rlwe.Ciphertext, error) {
+	if err := checkMatMulDim(scheme, d); err != nil {
+		return nil, err
+	}
+	perRescale := scheme.Params.LevelsConsumedPerRescaling()
+
+	// Scores: scale * Q K^T.
+	var err error
+	if ctQ, err = ensureLevel(scheme, ctQ, 3*perRescale, btpSlots); err != nil {
+		return nil, err
+	}
+	if ctK, err = ensureLevel(scheme, ctK, 3*perRescale, btpSlots); err != nil {
+		return nil, err
+	}
+	ctScores, err := matMulCiphertexts(scheme, ctQ, ctK, d, true)
+	if err != nil {
+		return nil, err
+	}
+	if ctScores, err = ensureLevel(scheme, ctScores, perRescale, btpSlots); err != nil {
+		return nil, err
+	}
+	if err := mulConstantAndRescale(scheme, ctScores, scale); err != nil {
+		return nil, err
+	}
+
+	ctProbs, err := evaluateSoftmax(scheme, ctScores, d, softmax, btpSlots)
+	if err != nil {
+		return nil, err
+	}
+
+	// Output: softmax(scores) V.
+	if ctProbs, err = ensureLevel(scheme, ctProbs, 3*perRescale, btpSlots); err != nil {
+		return nil, err
+	}
+	if ctV, err = ensureLevel(scheme, ctV, 3*perRescale, btpSlots); err != nil {
+		return nil, err
+	}
+	return matMulCiphertexts(scheme, ctProbs, ctV, d, false)
+}
+
+// evaluateSoftmax applies the softmax to every row of the d x d matrices
+// replicated in ctIn.
+func evaluateSoftmax(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, d int, softmax softmaxConfig, btpSlots int,
+) (*rlwe.Ciphertext, error) {
+	perRescale := scheme.Params.LevelsConsumedPerRescaling()
+
+	ctIn, err := ensureLevel(scheme, ctIn, polynomialLevels(scheme, softmax.exp), btpSlots)
+	if err != nil {
+		return nil, err
+	}
+	ctExp, err := evaluatePolynomial(
+		scheme, ctIn, softmax.exp, scheme.Params.DefaultScale())
+	if err != nil {
+		return nil, err
+	}
+
+	// Summing each row and then normalizing costs a level for the mask,
+	// two for the scaling into (0, 1] and out of it, one per iteration
+	// and one more for the first, and one to multiply by the inverse.
+	levels := 4 + softmax.invIters
+	if softmax.invIters > 0 {
+		levels++
+	}
+	if ctExp, err = ensureLevel(scheme, ctExp, levels*perRescale, btpSlots); err != nil {
+		return nil, err
+	}
+	ctSums, err := rowSums(scheme, ctExp, d)
+	if err != nil {
+		return nil, err
+	}
+	ctInv, err := goldschmidtInverse(
+		scheme, ctSums, softmax.invMin, softmax.invMax, softmax.invIters)
+	if err != nil {
+		return nil, err
+	}
+
+	ctExp = atLevel(scheme, ctExp, ctInv.Level())
+	ctOut, err := scheme.Evaluator.MulRelinNew(ctExp, ctInv)
+	if err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		return nil, err
+	}
+	return ctOut, nil
+}
+
+// rowSums returns the sum of every row of the d x d matrices replicated in
+// ctIn, broadcast over the row. The sums are gathered in each row's first
+// column, which is masked out and then rotated across the row, at the cost
+// of one level.
+func rowSums(scheme *Scheme, ctIn *rlwe.Ciphertext, d int) (*rlwe.Ciphertext, error) {
+	ctSum, err := rotateAndSum(scheme, ctIn, 1, d)
+	if err != nil {
+		return nil, err
+	}
+
+	mask := make([]float64, scheme.Params.MaxSlots())
+	for i := 0; i < len(mask); i += d {
+		mask[i] = 1
+	}
+	plaintext, err := newMaskPlaintext(scheme, mask, ctSum.Level())
+	if err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Mul(ctSum, plaintext, ctSum); err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Rescale(ctSum, ctSum); err != nil {
+		return nil, err
+	}
+
+	return rotateAndSum(scheme, ctSum, -1, d)
+}
+
+// goldschmidtInverse approximates 1/x for x within [lo, hi]. x is first
+// scaled into [lo/hi, 1], where 1/x = prod_i (1 + (1 - x)^(2^i)), and each
+// iteration adds a factor, doubling the bits of precision.
+func goldschmidtInverse(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, lo, hi float64, iters int,
+) (*rlwe.Ciphertext, error) {
+	eval := scheme.Evaluator
+
+	// b = 1 - x/hi, and a = 1 + b.
+	ctB := ctIn.CopyNew()
+	if err := mulConstantAndRescale(scheme, ctB, -1/hi); err != nil {
+		return nil, err
+	}
+	if err := eval.Add(ctB, 1.0, ctB); err != nil {
+		return nil, err
+	}
+	ctA, err := eval.AddNew(ctB, 1.0)
+	if err != nil {
+		return nil, err
+	}
+
+	for range iters {
+		if err := eval.MulRelin(ctB, ctB, ctB); err != nil {
+			return nil, err
+		}
+		if err := eval.Rescale(ctB, ctB); err != nil {
+			return nil, err
+		}
+		factor, err := eval.AddNew(ctB, 1.0)
+		if err != nil {
+			return nil, err
+		}
+		ctA = atLevel(scheme, ctA, factor.Level())
+		if err := eval.MulRelin(ctA, factor, ctA); err != nil {
+			return nil, err
+		}
+		if err := eval.Rescale(ctA, ctA); err != nil {
+			return nil, err
+		}
+	}
+
+	// Undo the scaling of x, giving 1/x = (1/hi) / (x/hi).
+	if err := mulConstantAndRescale(scheme, ctA, 1/hi); err != nil {
+		return nil, err
+	}
+	return ctA, nil
+}
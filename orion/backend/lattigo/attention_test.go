@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// Encrypted attention decrypts to softmax(scale * Q K^T) V computed in the
+// clear.
+func TestAttentionCiphertexts(t *testing.T) {
+	scheme := newTestScheme(t, deepTestParams)
+	rng := rand.New(rand.NewPCG(31, 32))
+	slots := scheme.Params.MaxSlots()
+	maxLevel := scheme.Params.MaxLevel()
+	const d = 4
+	const scale = 0.5
+
+	// Entries within [-1/2, 1/2] keep the scaled scores within [-1/2, 1/2],
+	// and so the row sums of their exponentials within [2, 8].
+	matrix := func() [][]float64 {
+		m := randomMatrix(rng, d)
+		for _, row := range m {
+			for j := range row {
+				row[j] /= 2
+			}
+		}
+		return m
+	}
+	q, k, v := matrix(), matrix(), matrix()
+
+	softmax := softmaxConfig{
+		exp: bignum.ChebyshevApproximation(math.Exp, bignum.Interval{
+			Nodes: 16,
+			A:     *bignum.NewFloat(-1, 128),
+			B:     *bignum.NewFloat(1, 128),
+		}),
+		invMin:   2,
+		invMax:   8,
+		invIters: 5,
+	}
+
+	probs := matMul(q, k, true)
+	for _, row := range probs {
+		sum := 0.0
+		for j := range row {
+			row[j] = math.Exp(scale * row[j])
+			sum += row[j]
+		}
+		for j := range row {
+			row[j] /= sum
+		}
+	}
+	want := replicateMatrix(matMul(probs, v, false), slots)
+
+	encrypt := func(m [][]float64) int {
+		return encryptValues(t, scheme, replicateMatrix(m, slots), maxLevel)
+	}
+	ctQ := RetrieveCiphertext(encrypt(q))
+	ctK := RetrieveCiphertext(encrypt(k))
+	ctV := RetrieveCiphertext(encrypt(v))
+
+	ctOut, err := attentionCiphertexts(scheme, ctQ, ctK, ctV, d, scale, softmax, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := maxError(want, decryptValues(t, scheme, PushCiphertext(ctOut))); err > 1e-4 {
+		t.Errorf("attention differs from the expected one by up to %g", err)
+	}
+
+	// Without a bootstrapper, inputs that lack the levels are rejected.
+	low := atLevel(scheme, ctQ, 8)
+	if _, err := attentionCiphertexts(scheme, low, ctK, ctV, d, scale, softmax, 0); err == nil {
+		t.Error("computed attention without the levels it takes")
+	}
+}
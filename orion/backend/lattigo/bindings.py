@@ -1,6 +1,9 @@
 import os 
+import json
 import ctypes
 import platform
+import threading
+from contextlib import contextmanager
 
 import torch
 import numpy as np
@@ -12,8 +15,18 @@ class LattigoFunction:
         self.func = func
         self.func.argtypes = argtypes 
         self.func.restype = restype
+        self.library = None
 
     def __call__(self, *args):
+        # Several schemes can live in the same process, so make sure the
+        # scheme that owns this binding is the active one in Go for as long
+        # as the call runs.
+        if self.library is None:
+            return self.call(*args)
+        with self.library.activate():
+            return self.call(*args)
+
+    def call(self, *args):
         c_args = []
         for arg in args:
             curr_argtype = self.func.argtypes[len(c_args)]
@@ -33,6 +46,9 @@ class LattigoFunction:
         if isinstance(py_result, list):
             LattigoFunction.FreeCArray(
                 ctypes.cast(c_result.Data, ctypes.c_void_p))
+        elif isinstance(c_result, ArrayResultComplex):
+            for ptr in (c_result.Real, c_result.Imag):
+                LattigoFunction.FreeCArray(ctypes.cast(ptr, ctypes.c_void_p))
 
         return py_result
 
@@ -42,6 +58,8 @@ class LattigoFunction:
             return ctypes.c_int(arg)
         elif isinstance(arg, int) and typ == ctypes.c_ulong:
             return ctypes.c_ulong(arg)
+        elif isinstance(arg, float) and typ == ctypes.c_double:
+            return ctypes.c_double(arg)
         elif isinstance(arg, float):
             return ctypes.c_float(arg)
         elif isinstance(arg, str):
@@ -56,6 +74,8 @@ class LattigoFunction:
                 return ((ctypes.c_int * len(arg))(*arg), len(arg))
             elif typ == ctypes.POINTER(ctypes.c_float):
                 return ((ctypes.c_float * len(arg))(*arg), len(arg))
+            elif typ == ctypes.POINTER(ctypes.c_double):
+                return ((ctypes.c_double * len(arg))(*arg), len(arg))
             elif typ == ctypes.POINTER(ctypes.c_ulong):
                 return ((ctypes.c_ulong * len(arg))(*arg), len(arg))
             elif typ == ctypes.POINTER(ctypes.c_ubyte):
@@ -76,6 +96,10 @@ class LattigoFunction:
             return [int(res.Data[i]) for i in range(res.Length)]
         elif type(res) == ArrayResultDouble:
             return [float(res.Data[i]) for i in range(res.Length)]
+        elif type(res) == ArrayResultComplex:
+            real = [float(res.Real[i]) for i in range(res.Length)]
+            imag = [float(res.Imag[i]) for i in range(res.Length)]
+            return real, imag
         elif type(res) == ArrayResultByte:
             # Create numpy array directly from the C buffer
             buffer = ctypes.cast(
@@ -90,8 +114,28 @@ class LattigoFunction:
 
 class LattigoLibrary:
     """A class to manage loading and interfacing with Lattigo."""
+    # Go acts on one active scheme at a time, shared by every library in
+    # the process. Calls for the active scheme may run concurrently (e.g.
+    # key prefetching alongside an evaluation), but switching to another
+    # scheme waits until none of them is in flight.
+    scheme_cond = threading.Condition()
+    active_scheme_id = None
+    calls_in_flight = 0
+
+    # Bindings that never touch the active scheme, and so run without
+    # activating one. FreeCArray is shared by all libraries, and tensors
+    # must still be released after the scheme that made them is deleted.
+    SCHEME_FREE_BINDINGS = (
+        "FreeCArray",
+        "GetLastError",
+        "DeletePlaintext",
+        "DeleteCiphertext",
+        "DeleteCiphertexts",
+    )
+
     def __init__(self):
         self.lib = self._load_library()
+        self.scheme_id = None
 
     def _load_library(self):
         try:
@@ -137,6 +181,64 @@ class LattigoLibrary:
         self.setup_poly_evaluator()
         self.setup_lt_evaluator()
         self.setup_bootstrapper()
+        self.setup_integer_scheme()
+        self.setup_multiparty()
+
+        for name, attr in vars(self).items():
+            if (isinstance(attr, LattigoFunction) and
+                    name not in self.SCHEME_FREE_BINDINGS):
+                attr.library = self
+
+    def get_last_error(self):
+        """Returns (and clears) the last error recorded by the backend."""
+        ptr = self.GetLastError()
+        if not ptr:
+            return "unknown Lattigo backend error"
+        try:
+            return ctypes.string_at(ptr).decode("utf-8")
+        finally:
+            self.FreeCArray(ptr)
+
+    def get_profiling_report(self):
+        """Returns the backend's linear transform profile as a dict."""
+        ptr = self.GetProfilingReport()
+        try:
+            return json.loads(ctypes.string_at(ptr).decode("utf-8"))
+        finally:
+            self.FreeCArray(ptr)
+
+    @contextmanager
+    def activate(self):
+        """Makes this library's scheme the active one in Go while the body
+        runs, waiting for calls on another scheme to finish first."""
+        if self.scheme_id is None:
+            raise RuntimeError("The Lattigo scheme has been deleted.")
+
+        cond = LattigoLibrary.scheme_cond
+        with cond:
+            while (LattigoLibrary.active_scheme_id != self.scheme_id and
+                    LattigoLibrary.calls_in_flight > 0):
+                cond.wait()
+            if LattigoLibrary.active_scheme_id != self.scheme_id:
+                # UseScheme is a binding itself, so going through it would
+                # activate again.
+                if self.lib.UseScheme(self.scheme_id) < 0:
+                    raise RuntimeError(self.get_last_error())
+                LattigoLibrary.active_scheme_id = self.scheme_id
+            LattigoLibrary.calls_in_flight += 1
+        try:
+            yield
+        finally:
+            with cond:
+                LattigoLibrary.calls_in_flight -= 1
+                cond.notify_all()
+
+    def delete_scheme(self):
+        """Deletes this library's scheme. Its bindings refuse to run after."""
+        self.DeleteScheme()
+        with LattigoLibrary.scheme_cond:
+            LattigoLibrary.active_scheme_id = None
+            self.scheme_id = None
 
     def setup_scheme(self, orion_params):
         self.NewScheme = LattigoFunction(
@@ -151,7 +253,131 @@ class LattigoLibrary:
                 ctypes.c_char_p,
                 ctypes.c_char_p,
             ],
-            restype=None
+            restype=ctypes.c_int
+        )
+
+        self.NewSchemeWithSeed = LattigoFunction(
+            self.lib.NewSchemeWithSeed,
+            argtypes=[
+                ctypes.c_int, 
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int,
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int,
+                ctypes.c_int,
+                ctypes.c_int,
+                ctypes.c_char_p,
+                ctypes.c_char_p,
+                ctypes.c_char_p,
+                ctypes.POINTER(ctypes.c_ubyte), ctypes.c_int, # seed
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.NewSchemeFromJSON = LattigoFunction(
+            self.lib.NewSchemeFromJSON,
+            argtypes=[ctypes.c_char_p],
+            restype=ctypes.c_int
+        )
+
+        self.NewSchemeFromPreset = LattigoFunction(
+            self.lib.NewSchemeFromPreset,
+            argtypes=[ctypes.c_char_p],
+            restype=ctypes.c_int
+        )
+
+        self.SaveScheme = LattigoFunction(
+            self.lib.SaveScheme,
+            argtypes=[ctypes.c_char_p],
+            restype=ctypes.c_int
+        )
+
+        self.SaveEvaluationKeyBundle = LattigoFunction(
+            self.lib.SaveEvaluationKeyBundle,
+            argtypes=[ctypes.c_char_p],
+            restype=ctypes.c_int
+        )
+
+        self.LoadScheme = LattigoFunction(
+            self.lib.LoadScheme,
+            argtypes=[ctypes.c_char_p],
+            restype=ctypes.c_int
+        )
+
+        self.SerializeScheme = LattigoFunction(
+            self.lib.SerializeScheme,
+            argtypes=[],
+            restype=ArrayResultByte
+        )
+
+        self.NewSchemeEvaluatorOnly = LattigoFunction(
+            self.lib.NewSchemeEvaluatorOnly,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong],
+            restype=ctypes.c_int
+        )
+
+        self.UseScheme = LattigoFunction(
+            self.lib.UseScheme,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.GetMaxSlots = LattigoFunction(
+            self.lib.GetMaxSlots,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
+        self.GetLogN = LattigoFunction(
+            self.lib.GetLogN,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
+        self.GetRingDegree = LattigoFunction(
+            self.lib.GetRingDegree,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
+        self.GetLogQP = LattigoFunction(
+            self.lib.GetLogQP,
+            argtypes=[],
+            restype=ctypes.c_double
+        )
+
+        self.GetDefaultScale = LattigoFunction(
+            self.lib.GetDefaultScale,
+            argtypes=[],
+            restype=ctypes.c_double
+        )
+
+        self.GetParametersFingerprint = LattigoFunction(
+            self.lib.GetParametersFingerprint,
+            argtypes=[],
+            restype=ArrayResultByte
+        )
+
+        self.GetMaxLevelQ = LattigoFunction(
+            self.lib.GetMaxLevelQ,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
+        self.GetMaxLevelP = LattigoFunction(
+            self.lib.GetMaxLevelP,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
+        self.GetLogScale = LattigoFunction(
+            self.lib.GetLogScale,
+            argtypes=[],
+            restype=ctypes.c_double
+        )
+
+        self.EstimateSecurityBits = LattigoFunction(
+            self.lib.EstimateSecurityBits,
+            argtypes=[],
+            restype=ctypes.c_double
         )
 
         self.DeleteScheme = LattigoFunction(
@@ -167,6 +393,39 @@ class LattigoLibrary:
         )
         LattigoFunction.FreeCArray = self.FreeCArray
 
+        self.GetLastError = LattigoFunction(
+            self.lib.GetLastError,
+            argtypes=[],
+            restype=ctypes.c_void_p
+        )
+
+        self.SetLogLevel = LattigoFunction(
+            self.lib.SetLogLevel,
+            argtypes=[ctypes.c_int],
+            restype=None
+        )
+
+        self.SetStorage = LattigoFunction(
+            self.lib.SetStorage,
+            argtypes=[
+                ctypes.c_char_p, # storage ("hdf5" or "file")
+                ctypes.c_char_p, # root directory of the "file" storage
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.SetProfilingEnabled = LattigoFunction(
+            self.lib.SetProfilingEnabled,
+            argtypes=[ctypes.c_int],
+            restype=None
+        )
+
+        self.GetProfilingReport = LattigoFunction(
+            self.lib.GetProfilingReport,
+            argtypes=[],
+            restype=ctypes.c_void_p
+        )
+
         logn = orion_params.get_logn()
         logq = orion_params.get_logq()
         logp = orion_params.get_logp()
@@ -176,7 +435,51 @@ class LattigoLibrary:
         keys_path = orion_params.get_keys_path()
         io_mode = orion_params.get_io_mode()
 
-        self.NewScheme(logn, logq, logp, logscale, h, ringtype, keys_path, io_mode)
+        seed = orion_params.get_seed()
+
+        # A new scheme becomes the active one, so as with activate() we
+        # wait until no call on another scheme is in flight. A seed makes
+        # keys and encryptions reproducible (for tests only).
+        with LattigoLibrary.scheme_cond:
+            while LattigoLibrary.calls_in_flight > 0:
+                LattigoLibrary.scheme_cond.wait()
+            if seed:
+                self.scheme_id = self.NewSchemeWithSeed(
+                    logn, logq, logp, logscale, h, ringtype, keys_path,
+                    io_mode, np.frombuffer(seed.encode("utf-8"), dtype=np.uint8))
+            else:
+                self.scheme_id = self.NewScheme(
+                    logn, logq, logp, logscale, h, ringtype, keys_path, io_mode)
+            LattigoLibrary.active_scheme_id = self.scheme_id
+
+            # Refuse insecure parameters before any keys are generated. The
+            # bindings are not tied to this library yet, so we call into Go
+            # directly on the scheme NewScheme just made active.
+            min_bits = orion_params.get_min_security_bits()
+            security_bits = self.lib.EstimateSecurityBits()
+            if min_bits and security_bits < min_bits:
+                self.lib.DeleteScheme()
+                LattigoLibrary.active_scheme_id = None
+                self.scheme_id = None
+                if security_bits < 0:
+                    raise ValueError(
+                        f"Cannot estimate the security of LogN = "
+                        f"{orion_params.get_logn()}.")
+                raise ValueError(
+                    f"The CKKS parameters give an estimated {security_bits:.1f} "
+                    f"bits of security, below the required {min_bits}. Lower "
+                    f"LogQ/LogP or raise LogN."
+                )
+
+        log_levels = {"silent": 0, "info": 1, "debug": 2}
+        self.SetLogLevel(log_levels[orion_params.get_log_level()])
+
+        # With the "file" storage, the backend reads and writes diagonals
+        # and rotation keys itself, rather than us through HDF5.
+        if self.SetStorage(
+            orion_params.get_storage(), orion_params.get_store_path()
+        ) < 0:
+            raise ValueError(self.get_last_error())
 
     def setup_tensor_binds(self):
         self.DeletePlaintext = LattigoFunction(
@@ -191,6 +494,12 @@ class LattigoLibrary:
             restype=None
         )
 
+        self.DeleteCiphertexts = LattigoFunction(
+            self.lib.DeleteCiphertexts,
+            argtypes=[ctypes.POINTER(ctypes.c_int), ctypes.c_int],
+            restype=None
+        )
+
         self.GetPlaintextScale = LattigoFunction(
             self.lib.GetPlaintextScale,
             argtypes=[ctypes.c_int],
@@ -203,6 +512,12 @@ class LattigoLibrary:
             restype=ctypes.c_ulong
         )
 
+        self.GetCiphertextLogScale = LattigoFunction(
+            self.lib.GetCiphertextLogScale,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_double
+        )
+
         self.SetPlaintextScale = LattigoFunction(
             self.lib.SetPlaintextScale,
             argtypes=[
@@ -269,6 +584,12 @@ class LattigoLibrary:
             restype=ArrayResultInt
         )
 
+        self.GetHeapStats = LattigoFunction(
+            self.lib.GetHeapStats,
+            argtypes=[ctypes.c_int],
+            restype=ArrayResultUInt64
+        )
+
     def setup_key_generator(self):
         self.NewKeyGenerator = LattigoFunction(
             self.lib.NewKeyGenerator,
@@ -279,7 +600,7 @@ class LattigoLibrary:
         self.GenerateSecretKey = LattigoFunction(
             self.lib.GenerateSecretKey,
             argtypes=[], 
-            restype=None
+            restype=ctypes.c_int
         )
 
         self.GeneratePublicKey = LattigoFunction(
@@ -309,6 +630,81 @@ class LattigoLibrary:
         self.LoadSecretKey = LattigoFunction(
             self.lib.LoadSecretKey,
             argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong],
+            restype=ctypes.c_int
+        )
+
+        self.SerializeSecretKeySealed = LattigoFunction(
+            self.lib.SerializeSecretKeySealed,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_int],
+            restype=ArrayResultByte
+        )
+
+        self.LoadSecretKeySealed = LattigoFunction(
+            self.lib.LoadSecretKeySealed,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong,
+                ctypes.POINTER(ctypes.c_ubyte), ctypes.c_int,
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.LoadSecretKeyFromBytes = LattigoFunction(
+            self.lib.LoadSecretKeyFromBytes,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.GenKeySwitchingKey = LattigoFunction(
+            self.lib.GenKeySwitchingKey,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.KeySwitchCiphertext = LattigoFunction(
+            self.lib.KeySwitchCiphertext,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.DeleteSwitchingKey = LattigoFunction(
+            self.lib.DeleteSwitchingKey,
+            argtypes=[ctypes.c_int],
+            restype=None
+        )
+
+        self.RefreshSecretKey = LattigoFunction(
+            self.lib.RefreshSecretKey,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
+        self.ZeroizeSecretKey = LattigoFunction(
+            self.lib.ZeroizeSecretKey,
+            argtypes=[],
+            restype=None
+        )
+
+        self.SerializePublicKey = LattigoFunction(
+            self.lib.SerializePublicKey,
+            argtypes=[],
+            restype=ArrayResultByte
+        )
+
+        self.LoadPublicKey = LattigoFunction(
+            self.lib.LoadPublicKey,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong],
+            restype=None
+        )
+
+        self.SerializeRelinearizationKey = LattigoFunction(
+            self.lib.SerializeRelinearizationKey,
+            argtypes=[],
+            restype=ArrayResultByte
+        )
+
+        self.LoadRelinearizationKey = LattigoFunction(
+            self.lib.LoadRelinearizationKey,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong],
             restype=None
         )
 
@@ -352,12 +748,56 @@ class LattigoLibrary:
             argtypes=[ctypes.c_int],
             restype=ctypes.c_int
         )
+        self.EncryptWithScale = LattigoFunction(
+            self.lib.EncryptWithScale,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_float), ctypes.c_int, # values
+                ctypes.c_double, # log_scale
+            ],
+            restype=ctypes.c_int
+        )
         self.Decrypt = LattigoFunction(
             self.lib.Decrypt,
             argtypes=[ctypes.c_int],
             restype=ctypes.c_int
         )
 
+        self.EncryptBatch = LattigoFunction(
+            self.lib.EncryptBatch,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_float), ctypes.c_int, # flat data
+                ctypes.c_int, # batch size
+            ],
+            restype=ArrayResultInt
+        )
+
+        self.DecryptComplex = LattigoFunction(
+            self.lib.DecryptComplex,
+            argtypes=[ctypes.c_int],
+            restype=ArrayResultComplex
+        )
+
+        self.DecryptPrecisionStats = LattigoFunction(
+            self.lib.DecryptPrecisionStats,
+            argtypes=[
+                ctypes.c_int,
+                ctypes.POINTER(ctypes.c_float), ctypes.c_int,
+            ],
+            restype=ArrayResultDouble
+        )
+
+        self.SetHealthCheckBound = LattigoFunction(
+            self.lib.SetHealthCheckBound,
+            argtypes=[ctypes.c_double],
+            restype=None
+        )
+
+        self.DecryptHealthCheck = LattigoFunction(
+            self.lib.DecryptHealthCheck,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
     def setup_evaluator(self):
         self.NewEvaluator = LattigoFunction(
             self.lib.NewEvaluator,
@@ -395,6 +835,12 @@ class LattigoLibrary:
             restype=ctypes.c_int
         )       
 
+        self.RotateCiphertext = LattigoFunction(
+            self.lib.RotateCiphertext,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
         self.Rescale = LattigoFunction(
             self.lib.Rescale,
             argtypes=[ctypes.c_int],
@@ -407,6 +853,18 @@ class LattigoLibrary:
             restype=ctypes.c_int
         )
 
+        self.DropLevel = LattigoFunction(
+            self.lib.DropLevel,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.RescaleToLevel = LattigoFunction(
+            self.lib.RescaleToLevel,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
         self.AddScalar = LattigoFunction(
             self.lib.AddScalar,
             argtypes=[
@@ -587,93 +1045,632 @@ class LattigoLibrary:
             restype=ctypes.c_int
         )
 
-    def setup_poly_evaluator(self):
-        self.NewPolynomialEvaluator = LattigoFunction(
-            self.lib.NewPolynomialEvaluator,
-            argtypes=[],
-            restype=None
+        self.AddConstant = LattigoFunction(
+            self.lib.AddConstant,
+            argtypes=[ctypes.c_int, ctypes.c_double, ctypes.c_double],
+            restype=ctypes.c_int
         )
 
-        self.GenerateMonomial = LattigoFunction(
-            self.lib.GenerateMonomial,
-            argtypes=[ctypes.POINTER(ctypes.c_float), ctypes.c_int],
+        self.MultConstant = LattigoFunction(
+            self.lib.MultConstant,
+            argtypes=[ctypes.c_int, ctypes.c_double, ctypes.c_double],
             restype=ctypes.c_int
         )
 
-        self.GenerateChebyshev = LattigoFunction(
-            self.lib.GenerateChebyshev,
-            argtypes=[ctypes.POINTER(ctypes.c_float), ctypes.c_int],
+        self.MulCiphertexts = LattigoFunction(
+            self.lib.MulCiphertexts,
+            argtypes=[ctypes.c_int, ctypes.c_int],
             restype=ctypes.c_int
         )
 
-        self.EvaluatePolynomial = LattigoFunction(
-            self.lib.EvaluatePolynomial,
+        self.MulPlaintextData = LattigoFunction(
+            self.lib.MulPlaintextData,
             argtypes=[
                 ctypes.c_int,
-                ctypes.c_int,
-                ctypes.c_ulong,
+                ctypes.POINTER(ctypes.c_float),
+                ctypes.c_int
             ],
             restype=ctypes.c_int
         )
 
-        self.GenerateMinimaxSignCoeffs = LattigoFunction(
-            self.lib.GenerateMinimaxSignCoeffs,
+        self.PoolCiphertext = LattigoFunction(
+            self.lib.PoolCiphertext,
             argtypes=[
-                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # degrees
-                ctypes.c_int, # prec 
-                ctypes.c_int, # logalpha
-                ctypes.c_int, # logerr
-                ctypes.c_int, # debug
+                ctypes.c_int,
+                ctypes.c_int, ctypes.c_int, # gap, row length
+                ctypes.c_int, ctypes.c_int, # kernel height, width
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # mask
             ],
-            restype=ArrayResultDouble
+            restype=ctypes.c_int
         )
 
-    def setup_lt_evaluator(self):
-        self.NewLinearTransformEvaluator = LattigoFunction(
-            self.lib.NewLinearTransformEvaluator,
-            argtypes=[],
-            restype=None
+        self.InnerSum = LattigoFunction(
+            self.lib.InnerSum,
+            argtypes=[ctypes.c_int, ctypes.c_int, ctypes.c_int], # stride, n
+            restype=ctypes.c_int
         )
 
-        self.GenerateLinearTransform = LattigoFunction(
-            self.lib.GenerateLinearTransform,
+        self.Replicate = LattigoFunction(
+            self.lib.Replicate,
+            argtypes=[ctypes.c_int, ctypes.c_int, ctypes.c_int], # block, mask
+            restype=ctypes.c_int
+        )
+
+        self.MaskCiphertext = LattigoFunction(
+            self.lib.MaskCiphertext,
             argtypes=[
-                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_idxs
-                ctypes.POINTER(ctypes.c_float), ctypes.c_int, # diags_data
-                ctypes.c_int, # level
-                ctypes.c_float, # bsgs_ratio
-                ctypes.c_char_p, # io_mode
+                ctypes.c_int,
+                ctypes.c_int, ctypes.c_int, ctypes.c_int, # start, end, stride
             ],
             restype=ctypes.c_int
         )
 
-        self.EvaluateLinearTransform = LattigoFunction(
-            self.lib.EvaluateLinearTransform,
+        self.SelectCiphertexts = LattigoFunction(
+            self.lib.SelectCiphertexts,
             argtypes=[
-                ctypes.c_int, # transform ID
-                ctypes.c_int, # ctxt ID
+                ctypes.c_int, ctypes.c_int,
+                ctypes.c_int, ctypes.c_int, ctypes.c_int, # start, end, stride
             ],
             restype=ctypes.c_int
         )
 
-        self.DeleteLinearTransform = LattigoFunction(
-            self.lib.DeleteLinearTransform,
-            argtypes=[ctypes.c_int],
-            restype=None
+        self.MatMulRotationSteps = LattigoFunction(
+            self.lib.MatMulRotationSteps,
+            argtypes=[ctypes.c_int, ctypes.c_int], # dim, transpose B
+            restype=ArrayResultInt
         )
 
-        self.GetLinearTransformRotationKeys = LattigoFunction(
-            self.lib.GetLinearTransformRotationKeys,
-            argtypes=[ctypes.c_int],
-            restype=ArrayResultInt
+        self.MatMulCiphertexts = LattigoFunction(
+            self.lib.MatMulCiphertexts,
+            argtypes=[
+                ctypes.c_int, ctypes.c_int,
+                ctypes.c_int, ctypes.c_int, # dim, transpose B
+            ],
+            restype=ctypes.c_int
         )
 
-        self.GenerateLinearTransformRotationKey = LattigoFunction(
-            self.lib.GenerateLinearTransformRotationKey,
+        self.GenerateAffine = LattigoFunction(
+            self.lib.GenerateAffine,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # scale
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # bias
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluateAffine = LattigoFunction(
+            self.lib.EvaluateAffine,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.DeleteAffine = LattigoFunction(
+            self.lib.DeleteAffine,
+            argtypes=[ctypes.c_int],
+            restype=None
+        )
+
+        self.AttentionCiphertexts = LattigoFunction(
+            self.lib.AttentionCiphertexts,
+            argtypes=[
+                ctypes.c_int, ctypes.c_int, ctypes.c_int, # Q, K, V
+                ctypes.c_int, # dim
+                ctypes.c_double, # score scale
+                ctypes.c_int, # exp polynomial
+                ctypes.c_double, ctypes.c_double, # row sum range
+                ctypes.c_int, # inverse iterations
+                ctypes.c_int, # bootstrap slots
+            ],
+            restype=ctypes.c_int
+        )
+
+    def setup_poly_evaluator(self):
+        self.NewPolynomialEvaluator = LattigoFunction(
+            self.lib.NewPolynomialEvaluator,
+            argtypes=[],
+            restype=None
+        )
+
+        self.GenerateMonomial = LattigoFunction(
+            self.lib.GenerateMonomial,
+            argtypes=[ctypes.POINTER(ctypes.c_float), ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateChebyshev = LattigoFunction(
+            self.lib.GenerateChebyshev,
+            argtypes=[ctypes.POINTER(ctypes.c_float), ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateChebyshevInterval = LattigoFunction(
+            self.lib.GenerateChebyshevInterval,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int,
+                ctypes.c_double, ctypes.c_double, # interval
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GetPolyDepth = LattigoFunction(
+            self.lib.GetPolyDepth,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluatePolynomial = LattigoFunction(
+            self.lib.EvaluatePolynomial,
+            argtypes=[
+                ctypes.c_int,
+                ctypes.c_int,
+                ctypes.c_ulong,
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluatePiecewise = LattigoFunction(
+            self.lib.EvaluatePiecewise,
+            argtypes=[
+                ctypes.c_int,
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # sign polys
+                ctypes.c_int, ctypes.c_int, # negative, positive pieces
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.RegisterSignComposition = LattigoFunction(
+            self.lib.RegisterSignComposition,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # degrees
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # coeffs
+                ctypes.c_int, ctypes.c_int, ctypes.c_int, # prec, logalpha, logerr
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.DeleteSignComposition = LattigoFunction(
+            self.lib.DeleteSignComposition,
+            argtypes=[ctypes.c_int],
+            restype=None
+        )
+
+        self.GetSignCompositionDepth = LattigoFunction(
+            self.lib.GetSignCompositionDepth,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluateSign = LattigoFunction(
+            self.lib.EvaluateSign,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluatePiecewiseSign = LattigoFunction(
+            self.lib.EvaluatePiecewiseSign,
+            argtypes=[
+                ctypes.c_int, ctypes.c_int, # ciphertext, sign composition
+                ctypes.c_int, ctypes.c_int, # negative, positive pieces
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GetReLUDepth = LattigoFunction(
+            self.lib.GetReLUDepth,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluateReLU = LattigoFunction(
+            self.lib.EvaluateReLU,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.GetActivationDepth = LattigoFunction(
+            self.lib.GetActivationDepth,
+            argtypes=[ctypes.c_double, ctypes.c_double, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluateGELU = LattigoFunction(
+            self.lib.EvaluateGELU,
+            argtypes=[
+                ctypes.c_int, # ciphertext
+                ctypes.c_double, ctypes.c_double, # interval
+                ctypes.c_int, # degree
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluateSiLU = LattigoFunction(
+            self.lib.EvaluateSiLU,
+            argtypes=[
+                ctypes.c_int, # ciphertext
+                ctypes.c_double, ctypes.c_double, # interval
+                ctypes.c_int, # degree
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluateSoftplus = LattigoFunction(
+            self.lib.EvaluateSoftplus,
+            argtypes=[
+                ctypes.c_int, # ciphertext
+                ctypes.c_double, ctypes.c_double, # interval
+                ctypes.c_int, # degree
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateMinimaxSignCoeffs = LattigoFunction(
+            self.lib.GenerateMinimaxSignCoeffs,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # degrees
+                ctypes.c_int, # prec 
+                ctypes.c_int, # logalpha
+                ctypes.c_int, # logerr
+                ctypes.c_int, # debug
+            ],
+            restype=ArrayResultDouble
+        )
+
+    def setup_lt_evaluator(self):
+        self.NewLinearTransformEvaluator = LattigoFunction(
+            self.lib.NewLinearTransformEvaluator,
+            argtypes=[],
+            restype=None
+        )
+
+        self.GenerateLinearTransform = LattigoFunction(
+            self.lib.GenerateLinearTransform,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_idxs
+                ctypes.POINTER(ctypes.c_float), ctypes.c_int, # diags_data
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_float, # prune_threshold
+                ctypes.c_char_p, # io_mode
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateLinearTransformF64 = LattigoFunction(
+            self.lib.GenerateLinearTransformF64,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_idxs
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # diags_data
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_float, # prune_threshold
+                ctypes.c_char_p, # io_mode
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateLinearTransformComplex = LattigoFunction(
+            self.lib.GenerateLinearTransformComplex,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_idxs
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # real parts
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # imag parts
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_float, # prune_threshold
+                ctypes.c_char_p, # io_mode
+            ],
+            restype=ctypes.c_int
+        )
+
+        # Callbacks passed to GenerateLinearTransformStreamed, which fill
+        # their buffer with one diagonal and return 0 on success.
+        self.DiagonalSource = ctypes.CFUNCTYPE(
+            ctypes.c_int, # status
+            ctypes.c_int, # diagonal index
+            ctypes.POINTER(ctypes.c_double), # out
+            ctypes.c_int, # slots
+        )
+
+        self.GenerateLinearTransformStreamed = LattigoFunction(
+            self.lib.GenerateLinearTransformStreamed,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_idxs
+                self.DiagonalSource, # source
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_char_p, # io_mode
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateLinearTransformSparse = LattigoFunction(
+            self.lib.GenerateLinearTransformSparse,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_idxs
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # entries per diag
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # slot indices
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # values
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_float, # prune_threshold
+                ctypes.c_char_p, # io_mode
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateLinearTransformRows = LattigoFunction(
+            self.lib.GenerateLinearTransformRows,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_idxs
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # diags_data
+                ctypes.c_int, # log_rows
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_float, # prune_threshold
+                ctypes.c_char_p, # io_mode
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.ConvDiagonalIndices = LattigoFunction(
+            self.lib.ConvDiagonalIndices,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # weights
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # geometry
+                ctypes.c_int, # hybrid
+            ],
+            restype=ArrayResultInt
+        )
+
+        self.ConvDiagonals = LattigoFunction(
+            self.lib.ConvDiagonals,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # weights
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # geometry
+                ctypes.c_int, # hybrid
+            ],
+            restype=ArrayResultDouble
+        )
+
+        self.GenerateConvTransforms = LattigoFunction(
+            self.lib.GenerateConvTransforms,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_double), ctypes.c_int, # weights
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # geometry
+                ctypes.c_int, # hybrid
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_float, # prune_threshold
+            ],
+            restype=ArrayResultInt
+        )
+
+        self.EvaluateLinearTransform = LattigoFunction(
+            self.lib.EvaluateLinearTransform,
+            argtypes=[
+                ctypes.c_int, # transform ID
+                ctypes.c_int, # ctxt ID
+            ],
+            restype=ctypes.c_int
+        )
+
+        # Callbacks passed to EvaluateLinearTransformStreamed, which point
+        # data at one serialized diagonal, kept valid until the next call,
+        # and return 0 on success.
+        self.PlaintextSource = ctypes.CFUNCTYPE(
+            ctypes.c_int, # status
+            ctypes.c_int, # diagonal index
+            ctypes.POINTER(ctypes.POINTER(ctypes.c_ubyte)), # data
+            ctypes.POINTER(ctypes.c_ulong), # length
+        )
+
+        self.EvaluateLinearTransformStreamed = LattigoFunction(
+            self.lib.EvaluateLinearTransformStreamed,
+            argtypes=[
+                ctypes.c_int, # transform ID
+                ctypes.c_int, # ctxt ID
+                self.PlaintextSource, # source
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.EvaluateLinearTransforms = LattigoFunction(
+            self.lib.EvaluateLinearTransforms,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # transform IDs
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # ctxt IDs
+                ctypes.c_int, # max workers
+                ctypes.c_int, # rescale
+            ],
+            restype=ArrayResultInt
+        )
+
+        self.EvaluateLinearTransformsBatch = LattigoFunction(
+            self.lib.EvaluateLinearTransformsBatch,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # transform IDs
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # ctxt IDs
+                ctypes.c_int, # batch size
+                ctypes.c_int, # max workers
+            ],
+            restype=ArrayResultInt
+        )
+
+        self.EvaluateLinearTransformMany = LattigoFunction(
+            self.lib.EvaluateLinearTransformMany,
+            argtypes=[
+                ctypes.c_int, # transform ID
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # ctxt IDs
+                ctypes.c_int, # max workers
+            ],
+            restype=ArrayResultInt
+        )
+
+        self.EvaluateLinearTransformsInto = LattigoFunction(
+            self.lib.EvaluateLinearTransformsInto,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # output ctxt IDs
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # transform IDs
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # ctxt IDs
+                ctypes.c_int, # max workers
+            ],
+            restype=ArrayResultInt
+        )
+
+        self.DeleteLinearTransform = LattigoFunction(
+            self.lib.DeleteLinearTransform,
+            argtypes=[ctypes.c_int],
+            restype=None
+        )
+
+        self.DeleteLinearTransforms = LattigoFunction(
+            self.lib.DeleteLinearTransforms,
+            argtypes=[ctypes.POINTER(ctypes.c_int), ctypes.c_int],
+            restype=None
+        )
+
+        self.SuggestTransformLevel = LattigoFunction(
+            self.lib.SuggestTransformLevel,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.EstimateFinalLevel = LattigoFunction(
+            self.lib.EstimateFinalLevel,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.EstimateFinalLevelWithMuls = LattigoFunction(
+            self.lib.EstimateFinalLevelWithMuls,
+            argtypes=[ctypes.c_int, ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.FuseLinearTransforms = LattigoFunction(
+            self.lib.FuseLinearTransforms,
+            argtypes=[
+                ctypes.c_int, # first transform ID
+                ctypes.c_int, # second transform ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_float, # prune_threshold
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateGatherTransform = LattigoFunction(
+            self.lib.GenerateGatherTransform,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # source slots
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GenerateLayoutTransform = LattigoFunction(
+            self.lib.GenerateLayoutTransform,
+            argtypes=[
+                ctypes.c_char_p, # layout conversion
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # dimensions
+                ctypes.c_int, # level (-1 to infer it from ref_ctxt)
+                ctypes.c_int, # ref_ctxt ID
+                ctypes.c_float, # bsgs_ratio
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.TransposeLinearTransform = LattigoFunction(
+            self.lib.TransposeLinearTransform,
+            argtypes=[
+                ctypes.c_int, # transform ID
+                ctypes.c_float, # bsgs_ratio
+                ctypes.c_float, # prune_threshold
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GetLinearTransformDiagonals = LattigoFunction(
+            self.lib.GetLinearTransformDiagonals,
+            argtypes=[ctypes.c_int],
+            restype=ArrayResultInt
+        )
+
+        self.GetLinearTransformRotationKeys = LattigoFunction(
+            self.lib.GetLinearTransformRotationKeys,
+            argtypes=[ctypes.c_int],
+            restype=ArrayResultInt
+        )
+
+        self.PrecomputeGaloisElements = LattigoFunction(
+            self.lib.PrecomputeGaloisElements,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_idxs
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # diags_counts
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # levels
+                ctypes.POINTER(ctypes.c_float), ctypes.c_int, # bsgs_ratios
+            ],
+            restype=ArrayResultUInt64
+        )
+
+        self.GetGaloisElement = LattigoFunction(
+            self.lib.GetGaloisElement,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_ulong
+        )
+
+        self.HasRotationKey = LattigoFunction(
+            self.lib.HasRotationKey,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.EnsureRotationKey = LattigoFunction(
+            self.lib.EnsureRotationKey,
             argtypes=[ctypes.c_int],
             restype=None
         )
 
+        self.GenerateLinearTransformRotationKey = LattigoFunction(
+            self.lib.GenerateLinearTransformRotationKey,
+            argtypes=[ctypes.c_int],
+            restype=None
+        )
+
+        # Planning records the Galois elements of every transform generated
+        # in between, so that their keys are made in one pass at the end.
+        self.BeginKeyPlanning = LattigoFunction(
+            self.lib.BeginKeyPlanning,
+            argtypes=[],
+            restype=None
+        )
+
+        self.EndKeyPlanning = LattigoFunction(
+            self.lib.EndKeyPlanning,
+            argtypes=[],
+            restype=None
+        )
+
+        self.GetPlannedGaloisElements = LattigoFunction(
+            self.lib.GetPlannedGaloisElements,
+            argtypes=[],
+            restype=ArrayResultUInt64
+        )
+
+        self.GenerateAllRotationKeys = LattigoFunction(
+            self.lib.GenerateAllRotationKeys,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
         self.GenerateAndSerializeRotationKey = LattigoFunction(
             self.lib.GenerateAndSerializeRotationKey,
             argtypes=[ctypes.c_int],
@@ -686,9 +1683,105 @@ class LattigoLibrary:
                 ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong,
                 ctypes.c_ulong,
             ],
+            restype=ctypes.c_int
+        )
+
+        self.LoadCachedRotationKey = LattigoFunction(
+            self.lib.LoadCachedRotationKey,
+            argtypes=[ctypes.c_ulong],
+            restype=ctypes.c_int
+        )
+
+        self.HasCachedRotationKey = LattigoFunction(
+            self.lib.HasCachedRotationKey,
+            argtypes=[ctypes.c_ulong],
+            restype=ctypes.c_int
+        )
+
+        self.PrefetchRotationKey = LattigoFunction(
+            self.lib.PrefetchRotationKey,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong,
+                ctypes.c_ulong,
+            ],
+            restype=None
+        )
+
+        self.SetHoistedRotations = LattigoFunction(
+            self.lib.SetHoistedRotations,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=None
+        )
+
+        self.SetKeyPrefetchEnabled = LattigoFunction(
+            self.lib.SetKeyPrefetchEnabled,
+            argtypes=[ctypes.c_int],
+            restype=None
+        )
+
+        self.KeyPrefetchEnabled = LattigoFunction(
+            self.lib.KeyPrefetchEnabled,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
+        self.SetKeyCacheCapacity = LattigoFunction(
+            self.lib.SetKeyCacheCapacity,
+            argtypes=[ctypes.c_ulong],
             restype=None
         )
 
+        self.ClearKeyCache = LattigoFunction(
+            self.lib.ClearKeyCache,
+            argtypes=[],
+            restype=None
+        )
+
+        self.LoadCachedPlaintextDiagonals = LattigoFunction(
+            self.lib.LoadCachedPlaintextDiagonals,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.HasCachedPlaintextDiagonals = LattigoFunction(
+            self.lib.HasCachedPlaintextDiagonals,
+            argtypes=[ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.SetDiagonalCacheCapacity = LattigoFunction(
+            self.lib.SetDiagonalCacheCapacity,
+            argtypes=[ctypes.c_ulong],
+            restype=None
+        )
+
+        self.ClearDiagonalCache = LattigoFunction(
+            self.lib.ClearDiagonalCache,
+            argtypes=[],
+            restype=None
+        )
+
+        self.SetLTMemoryBudget = LattigoFunction(
+            self.lib.SetLTMemoryBudget,
+            argtypes=[ctypes.c_ulong],
+            restype=None
+        )
+
+        self.GetLTMemoryBudget = LattigoFunction(
+            self.lib.GetLTMemoryBudget,
+            argtypes=[],
+            restype=ctypes.c_ulong
+        )
+
+        self.PlanLinearTransformWindows = LattigoFunction(
+            self.lib.PlanLinearTransformWindows,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # transform ids
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # group sizes
+            ],
+            restype=ArrayResultInt
+        )
+
         self.SerializeDiagonal = LattigoFunction(
             self.lib.SerializeDiagonal,
             argtypes=[
@@ -705,7 +1798,7 @@ class LattigoLibrary:
                 ctypes.c_int,
                 ctypes.c_ulong,
             ],
-            restype=None
+            restype=ctypes.c_int
         )
 
         self.RemovePlaintextDiagonals = LattigoFunction(
@@ -720,6 +1813,50 @@ class LattigoLibrary:
             restype=None,
         )
 
+        self.RetainRotationKeys = LattigoFunction(
+            self.lib.RetainRotationKeys,
+            argtypes=[ctypes.POINTER(ctypes.c_ulong), ctypes.c_int],
+            restype=None
+        )
+
+        # Counterparts of the above for the "file" storage, where the
+        # backend reads and writes the store itself.
+        self.SaveDiagonals = LattigoFunction(
+            self.lib.SaveDiagonals,
+            argtypes=[
+                ctypes.c_int, # transform ID
+                ctypes.c_char_p, # prefix, e.g. "fc1/0_0"
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.LoadDiagonals = LattigoFunction(
+            self.lib.LoadDiagonals,
+            argtypes=[
+                ctypes.c_int, # transform ID
+                ctypes.c_char_p, # prefix
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.SaveRotationKeys = LattigoFunction(
+            self.lib.SaveRotationKeys,
+            argtypes=[ctypes.POINTER(ctypes.c_ulong), ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.LoadRotationKeys = LattigoFunction(
+            self.lib.LoadRotationKeys,
+            argtypes=[ctypes.POINTER(ctypes.c_ulong), ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.HasStoredRotationKey = LattigoFunction(
+            self.lib.HasStoredRotationKey,
+            argtypes=[ctypes.c_ulong],
+            restype=ctypes.c_int
+        )
+
     def setup_bootstrapper(self):
         self.NewBootstrapper = LattigoFunction(
             self.lib.NewBootstrapper,
@@ -727,7 +1864,16 @@ class LattigoLibrary:
                 ctypes.POINTER(ctypes.c_int), ctypes.c_int, # logPs
                 ctypes.c_int, # slots
             ], 
-            restype=None
+            restype=ctypes.c_int
+        )
+
+        self.InitBootstrapper = LattigoFunction(
+            self.lib.InitBootstrapper,
+            argtypes=[
+                ctypes.c_int, # log slots
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # logPs
+            ],
+            restype=ctypes.c_int
         )
 
         self.Bootstrap = LattigoFunction(
@@ -745,6 +1891,126 @@ class LattigoLibrary:
             restype=None
         )
 
+    def setup_integer_scheme(self):
+        self.NewIntegerScheme = LattigoFunction(
+            self.lib.NewIntegerScheme,
+            argtypes=[
+                ctypes.c_int, # logn
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # logq
+                ctypes.POINTER(ctypes.c_int), ctypes.c_int, # logp
+                ctypes.c_ulong, # plaintext modulus
+                ctypes.c_int, # hamming weight
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.GetIntegerSlots = LattigoFunction(
+            self.lib.GetIntegerSlots,
+            argtypes=[],
+            restype=ctypes.c_int
+        )
+
+        self.EncryptInts = LattigoFunction(
+            self.lib.EncryptInts,
+            argtypes=[ctypes.POINTER(ctypes.c_ulong), ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.DecryptInts = LattigoFunction(
+            self.lib.DecryptInts,
+            argtypes=[ctypes.c_int],
+            restype=ArrayResultUInt64
+        )
+
+        self.AddInts = LattigoFunction(
+            self.lib.AddInts,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.SubInts = LattigoFunction(
+            self.lib.SubInts,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.MulInts = LattigoFunction(
+            self.lib.MulInts,
+            argtypes=[ctypes.c_int, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+    def setup_multiparty(self):
+        # Shares are passed concatenated, along with how many there are.
+        self.MultipartySetup = LattigoFunction(
+            self.lib.MultipartySetup,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.MultipartyPublicKeyShare = LattigoFunction(
+            self.lib.MultipartyPublicKeyShare,
+            argtypes=[],
+            restype=ArrayResultByte
+        )
+
+        self.MultipartyCombinePublicKey = LattigoFunction(
+            self.lib.MultipartyCombinePublicKey,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.MultipartyRelinKeyShareRoundOne = LattigoFunction(
+            self.lib.MultipartyRelinKeyShareRoundOne,
+            argtypes=[],
+            restype=ArrayResultByte
+        )
+
+        self.MultipartyCombineRelinKeyRoundOne = LattigoFunction(
+            self.lib.MultipartyCombineRelinKeyRoundOne,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong, ctypes.c_int],
+            restype=ArrayResultByte
+        )
+
+        self.MultipartyRelinKeyShareRoundTwo = LattigoFunction(
+            self.lib.MultipartyRelinKeyShareRoundTwo,
+            argtypes=[ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong],
+            restype=ArrayResultByte
+        )
+
+        self.MultipartyCombineRelinKey = LattigoFunction(
+            self.lib.MultipartyCombineRelinKey,
+            argtypes=[
+                ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong, # aggregated round one
+                ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong, ctypes.c_int,
+            ],
+            restype=ctypes.c_int
+        )
+
+        self.MultipartyGaloisKeyShare = LattigoFunction(
+            self.lib.MultipartyGaloisKeyShare,
+            argtypes=[ctypes.c_ulong],
+            restype=ArrayResultByte
+        )
+
+        self.MultipartyCombineGaloisKey = LattigoFunction(
+            self.lib.MultipartyCombineGaloisKey,
+            argtypes=[ctypes.c_ulong, ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
+        self.MultipartyDecryptionShare = LattigoFunction(
+            self.lib.MultipartyDecryptionShare,
+            argtypes=[ctypes.c_int],
+            restype=ArrayResultByte
+        )
+
+        self.MultipartyCombineDecryptionShares = LattigoFunction(
+            self.lib.MultipartyCombineDecryptionShares,
+            argtypes=[ctypes.c_int, ctypes.POINTER(ctypes.c_ubyte), ctypes.c_ulong, ctypes.c_int],
+            restype=ctypes.c_int
+        )
+
 
 class ArrayResultInt(ctypes.Structure):
     _fields_ = [("Data", ctypes.POINTER(ctypes.c_int)), ("Length", ctypes.c_ulong)]
@@ -759,4 +2025,11 @@ class ArrayResultUInt64(ctypes.Structure):
     _fields_ = [("Data", ctypes.POINTER(ctypes.c_ulong)), ("Length", ctypes.c_ulong)]
 
 class ArrayResultByte(ctypes.Structure):
-    _fields_ = [("Data", ctypes.POINTER(ctypes.c_char)), ("Length", ctypes.c_ulong)]
\ No newline at end of file
+    _fields_ = [("Data", ctypes.POINTER(ctypes.c_char)), ("Length", ctypes.c_ulong)]
+
+class ArrayResultComplex(ctypes.Structure):
+    _fields_ = [
+        ("Real", ctypes.POINTER(ctypes.c_double)),
+        ("Imag", ctypes.POINTER(ctypes.c_double)),
+        ("Length", ctypes.c_ulong),
+    ]
@@ -8,30 +8,102 @@ import (
 	"math"
 
 	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/bootstrapping"
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/ring"
 	"github.com/baahl-nyu/lattigo/v6/utils"
 )
 
-// Map to store bootstrapping.Evaluators by their slot count
-// Initialize the map at package level
-var bootstrapperMap = make(map[int]*bootstrapping.Evaluator)
-
+// NewBootstrapper builds a bootstrapper for numSlots slots from the
+// active scheme's parameters, unless there already is one, and makes it
+// the most recent one. Returns 0, or -1 with the last error set.
+//
 //export NewBootstrapper
 func NewBootstrapper(
 	LogPs *C.int,
 	lenLogPs C.int,
 	numSlots C.int,
-) {
-	slots := int(numSlots)
+) C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil || scheme.SecretKey == nil {
+		SetLastError(fmt.Errorf(
+			"cannot create bootstrapper: scheme has no secret key"))
+		return -1
+	}
 
-	if _, exists := bootstrapperMap[slots]; exists {
-		return
+	slots := int(numSlots)
+	if _, exists := scheme.Bootstrappers[slots]; exists {
+		return 0
 	}
 
 	// If not initialized for this slot count, create a new one
 	logP := CArrayToSlice(LogPs, lenLogPs, convertCIntToInt)
+	btpEval, err := newBootstrapper(scheme, slots, logP)
+	if err != nil {
+		SetLastError(fmt.Errorf(
+			"cannot create bootstrapper for %d slots: %w", slots, err))
+		return -1
+	}
+
+	// Store the new evaluator by its slot count. The scheme also keeps a handle
+	// to the most recently created bootstrapper.
+	scheme.Bootstrappers[slots] = btpEval
+	scheme.Bootstrapper = btpEval
+	return 0
+}
+
+// InitBootstrapper builds a bootstrapper for 2^logSlots slots from the
+// active scheme's parameters, generating its evaluation keys, and makes it
+// the one Bootstrap uses when given no slot count. An empty logP falls
+// back to the scheme's default bootstrapping LogP. Returns 0, or -1 with
+// the last error set.
+//
+//export InitBootstrapper
+func InitBootstrapper(logSlots C.int, logPPtr *C.int, lenLogP C.int) C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil || scheme.SecretKey == nil {
+		SetLastError(fmt.Errorf(
+			"cannot create bootstrapper: scheme has no secret key"))
+		return -1
+	}
+	if logSlots < 0 || int(logSlots) > scheme.Params.LogMaxSlots() {
+		SetLastError(fmt.Errorf(
+			"cannot create bootstrapper for 2^%d slots: the scheme has 2^%d",
+			int(logSlots), scheme.Params.LogMaxSlots()))
+		return -1
+	}
+
+	slots := 1 << int(logSlots)
+	btpEval, exists := scheme.Bootstrappers[slots]
+	if !exists {
+		logP := CArrayToSlice(logPPtr, lenLogP, convertCIntToInt)
+		var err error
+		if btpEval, err = newBootstrapper(scheme, slots, logP); err != nil {
+			SetLastError(fmt.Errorf("cannot create bootstrapper: %w", err))
+			return -1
+		}
+		scheme.Bootstrappers[slots] = btpEval
+	}
+	scheme.Bootstrapper = btpEval
+	return 0
+}
+
+// newBootstrapper builds a bootstrapping evaluator and its keys for the
+// given slot count.
+func newBootstrapper(scheme *Scheme, slots int, logP []int) (*bootstrapping.Evaluator, error) {
+	if len(logP) == 0 {
+		logP = scheme.BootLogP
+	}
+
+	// A conjugate-invariant scheme is bootstrapped by switching to the
+	// standard ring of twice the degree, which carries the same number of
+	// (complex) slots as the residual ring has real ones.
+	logN := scheme.Params.LogN()
+	if scheme.Params.RingType() == ring.ConjugateInvariant {
+		logN++
+	}
 
 	btpParametersLit := bootstrapping.ParametersLiteral{
-		LogN:     utils.Pointy(scheme.Params.LogN()),
+		LogN:     utils.Pointy(logN),
 		LogP:     logP,
 		Xs:       scheme.Params.Xs(),
 		LogSlots: utils.Pointy(int(math.Log2(float64(slots)))),
@@ -40,54 +112,122 @@ func NewBootstrapper(
 	btpParams, err := bootstrapping.NewParametersFromLiteral(
 		*scheme.Params, btpParametersLit)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	btpKeys, _, err := btpParams.GenEvaluationKeys(scheme.SecretKey)
 	if err != nil {
-		panic(err)
-	}
-
-	var btpEval *bootstrapping.Evaluator
-	if btpEval, err = bootstrapping.NewEvaluator(btpParams, btpKeys); err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	// Store the new evaluator in the map
-	bootstrapperMap[slots] = btpEval
+	return bootstrapping.NewEvaluator(btpParams, btpKeys)
 }
 
+// Bootstrap refreshes a ciphertext with the bootstrapper for numSlots, or,
+// when numSlots is 0 or less, with the one set by InitBootstrapper.
+// Returns the ID of the result, or -1 with the last error set.
+//
 //export Bootstrap
 func Bootstrap(ciphertextID, numSlots C.int) C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		SetLastError(fmt.Errorf("cannot bootstrap ciphertext: no active scheme"))
+		return -1
+	}
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+
+	var bootstrapper *bootstrapping.Evaluator
+	if numSlots <= 0 {
+		if bootstrapper = scheme.Bootstrapper; bootstrapper == nil {
+			SetLastError(fmt.Errorf(
+				"no bootstrapper to use (call InitBootstrapper before Bootstrap)"))
+			return -1
+		}
+	} else {
+		var exists bool
+		if bootstrapper, exists = scheme.Bootstrappers[int(numSlots)]; !exists {
+			SetLastError(fmt.Errorf(
+				"no bootstrapper found for slot count: %d (call NewBootstrapper "+
+					"with this slot count before Bootstrap)", int(numSlots)))
+			return -1
+		}
+	}
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
-	bootstrapper := GetBootstrapper(int(numSlots))
+	ctOut, err := bootstrapCiphertext(scheme, ctIn, bootstrapper)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot bootstrap ciphertext: %w", err))
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
 
+// bootstrapCiphertext refreshes a copy of ctIn with a bootstrapper that
+// may work on fewer slots than the scheme, rescaling the result back to
+// the scheme's slots.
+func bootstrapCiphertext(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, bootstrapper *bootstrapping.Evaluator,
+) (*rlwe.Ciphertext, error) {
 	ctBtp := ctIn.CopyNew()
 	ctBtp.LogDimensions.Cols = bootstrapper.LogMaxSlots()
 
 	ctOut, err := bootstrapper.Bootstrap(ctBtp)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	postscale := int(1 << (scheme.Params.LogMaxSlots() - bootstrapper.LogMaxSlots()))
-	scheme.Evaluator.Mul(ctOut, postscale, ctOut)
+	if err := scheme.Evaluator.Mul(ctOut, postscale, ctOut); err != nil {
+		return nil, err
+	}
 
 	ctOut.LogDimensions.Cols = scheme.Params.LogMaxSlots()
-
-	idx := PushCiphertext(ctOut)
-	return C.int(idx)
+	return ctOut, nil
 }
 
-func GetBootstrapper(numSlots int) *bootstrapping.Evaluator {
-	bootstrapper, exists := bootstrapperMap[numSlots]
-	if !exists {
-		panic(fmt.Errorf("no bootstrapper found for slot count: %d", numSlots))
+// ensureLevel returns ctIn if it has at least level levels left, and
+// otherwise bootstraps it with the bootstrapper for numSlots. A numSlots of
+// 0 disables bootstrapping, so that a ciphertext too low is an error.
+func ensureLevel(
+	scheme *Scheme, ctIn *rlwe.Ciphertext, level, numSlots int,
+) (*rlwe.Ciphertext, error) {
+	if ctIn.Level() >= level {
+		return ctIn, nil
+	}
+	bootstrapper, exists := scheme.Bootstrappers[numSlots]
+	if numSlots <= 0 || !exists {
+		return nil, fmt.Errorf(
+			"ciphertext at level %d needs %d levels and no bootstrapper "+
+				"for %d slots is available", ctIn.Level(), level, numSlots)
+	}
+
+	ctOut, err := bootstrapCiphertext(scheme, ctIn, bootstrapper)
+	if err != nil {
+		return nil, err
 	}
-	return bootstrapper
+	if ctOut.Level() < level {
+		return nil, fmt.Errorf(
+			"bootstrapping only restores %d levels, but %d are needed",
+			ctOut.Level(), level)
+	}
+	return ctOut, nil
 }
 
 //export DeleteBootstrappers
 func DeleteBootstrappers() {
-	bootstrapperMap = make(map[int]*bootstrapping.Evaluator)
+	deleteBootstrappers(activeScheme.Load())
+}
+
+func deleteBootstrappers(scheme *Scheme) {
+	if scheme == nil {
+		return
+	}
+	scheme.Bootstrappers = make(map[int]*bootstrapping.Evaluator)
+	scheme.Bootstrapper = nil
 }
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+// Without an active scheme, bootstrapping exports fail with an error
+// rather than crash the process.
+func TestBootstrapWithoutScheme(t *testing.T) {
+	active := activeScheme.Swap(nil)
+	t.Cleanup(func() { activeScheme.Store(active) })
+
+	lastError = nil
+	if NewBootstrapper(nil, 0, 1024) != -1 || lastError == nil {
+		t.Error("created a bootstrapper without a scheme")
+	}
+	lastError = nil
+	if Bootstrap(0, 0) != -1 || lastError == nil {
+		t.Error("bootstrapped without a scheme")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	commonlintrans "github.com/baahl-nyu/lattigo/v6/circuits/common/lintrans"
+)
+
+// autoBSGSRatio is the bsgsRatio that asks for the baby-step giant-step
+// split of a transform to be chosen for it by bestLogBSGSRatio.
+const autoBSGSRatio = -1
+
+// bestLogBSGSRatio returns the LogBabyStepGiantStepRatio that minimizes
+// the estimated cost of evaluating a transform with the given diagonals at
+// levelQ, or -1 if evaluating it without baby-step giant-step is cheapest.
+//
+// Costs are counted in NTTs of a single RNS limb, with a pointwise product
+// of a limb weighing 1/LogN of one. Hoisted rotations share a single
+// decomposition of the input and only pay for their gadget products, while
+// each giant step is a full key switch at the cost of its own
+// decomposition and ModDown.
+func bestLogBSGSRatio(scheme *Scheme, diagIdxs []int, levelQ int) int {
+	levelP := scheme.Params.MaxLevelP()
+	q, qp := float64(levelQ+1), float64(levelQ+levelP+2)
+	dnum := float64(scheme.Params.BaseRNSDecompositionVectorSize(levelQ, levelP))
+	mul := 1 / float64(scheme.Params.LogN())
+
+	decompose := q + dnum*qp
+	hoisted := 2 * (dnum + 1) * qp * mul
+	modDown := 2 * qp
+	plaintextMul := 2 * qp * mul * float64(len(diagIdxs))
+
+	slots := scheme.Params.MaxSlots()
+	cost := func(babySteps, giantSteps int) float64 {
+		return decompose + modDown + plaintextMul +
+			float64(babySteps)*hoisted +
+			float64(giantSteps)*(decompose+hoisted+modDown)
+	}
+	nonZero := func(rots []int) (n int) {
+		for _, rot := range rots {
+			if rot&(slots-1) != 0 {
+				n++
+			}
+		}
+		return
+	}
+
+	best, bestCost := -1, cost(nonZero(diagIdxs), 0)
+	for logRatio := 0; logRatio <= scheme.Params.LogMaxSlots(); logRatio++ {
+		N1 := commonlintrans.FindBestBSGSRatio(diagIdxs, slots, logRatio)
+		_, rotN1, rotN2 := commonlintrans.BSGSIndex(diagIdxs, slots, N1)
+
+		if c := cost(nonZero(rotN2), nonZero(rotN1)); c < bestCost {
+			best, bestCost = logRatio, c
+		}
+	}
+	return best
+}
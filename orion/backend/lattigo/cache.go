@@ -0,0 +1,125 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUCache is a size-bounded least-recently-used cache. Each entry is
+// charged sizeOf(value) against the capacity, and the least recently used
+// entries are evicted once the total exceeds it. It is safe for
+// concurrent use.
+type LRUCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	order    *list.List // front is most recently used
+	items    map[K]*list.Element
+	sizeOf   func(V) int64
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64
+}
+
+// NewLRUCache returns an empty cache holding at most capacity units, as
+// measured by sizeOf.
+func NewLRUCache[K comparable, V any](capacity int64, sizeOf func(V) int64) *LRUCache[K, V] {
+	return &LRUCache[K, V]{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[K]*list.Element),
+		sizeOf:   sizeOf,
+	}
+}
+
+// Get returns the value stored under key and marks it as recently used.
+func (c *LRUCache[K, V]) Get(key K) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return value, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[K, V]).value, true
+}
+
+// Contains reports whether key is cached, without marking it as used.
+func (c *LRUCache[K, V]) Contains(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.items[key]
+	return ok
+}
+
+// Put stores value under key, evicting older entries as needed. Values
+// larger than the whole capacity are not cached.
+func (c *LRUCache[K, V]) Put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	size := c.sizeOf(value)
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	if size > c.capacity {
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key, value, size})
+	c.size += size
+	c.evict()
+}
+
+// Remove deletes the entry stored under key, if any.
+func (c *LRUCache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// SetCapacity changes the capacity, evicting entries if it shrank.
+func (c *LRUCache[K, V]) SetCapacity(capacity int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	c.evict()
+}
+
+// Clear removes every entry.
+func (c *LRUCache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = make(map[K]*list.Element)
+	c.size = 0
+}
+
+// Size returns the total size of the cached entries.
+func (c *LRUCache[K, V]) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *LRUCache[K, V]) evict() {
+	for c.size > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *LRUCache[K, V]) removeElement(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry[K, V])
+	delete(c.items, entry.key)
+	c.size -= entry.size
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func newTestCache(capacity int64) *LRUCache[string, []byte] {
+	return NewLRUCache[string](capacity, func(v []byte) int64 { return int64(len(v)) })
+}
+
+// cachedKeys returns which of keys are cached, without marking them used.
+func cachedKeys(c *LRUCache[string, []byte], keys ...string) []string {
+	cached := []string{}
+	for _, key := range keys {
+		if c.Contains(key) {
+			cached = append(cached, key)
+		}
+	}
+	return cached
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTestCache(10)
+	c.Put("a", make([]byte, 4))
+	c.Put("b", make([]byte, 4))
+
+	// Reading a makes b the least recently used entry, so b goes first.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a is not cached")
+	}
+	c.Put("c", make([]byte, 4))
+	if got := cachedKeys(c, "a", "b", "c"); !slices.Equal(got, []string{"a", "c"}) {
+		t.Errorf("cached %v, want [a c]", got)
+	}
+	if c.Size() != 8 {
+		t.Errorf("got size %d, want 8", c.Size())
+	}
+
+	// Contains does not refresh an entry, so a is still the oldest.
+	c.Contains("a")
+	c.Put("d", make([]byte, 4))
+	if got := cachedKeys(c, "a", "c", "d"); !slices.Equal(got, []string{"c", "d"}) {
+		t.Errorf("cached %v, want [c d]", got)
+	}
+}
+
+func TestLRUCachePut(t *testing.T) {
+	c := newTestCache(10)
+
+	// Storing under an existing key replaces the entry and its size.
+	c.Put("a", make([]byte, 6))
+	c.Put("a", []byte{1, 2})
+	if got, _ := c.Get("a"); !slices.Equal(got, []byte{1, 2}) {
+		t.Errorf("got %v, want [1 2]", got)
+	}
+	if c.Size() != 2 {
+		t.Errorf("got size %d, want 2", c.Size())
+	}
+
+	// A value larger than the whole capacity is dropped, rather than
+	// evicting everything else.
+	c.Put("big", make([]byte, 11))
+	if got := cachedKeys(c, "a", "big"); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("cached %v, want [a]", got)
+	}
+}
+
+func TestLRUCacheCapacity(t *testing.T) {
+	c := newTestCache(12)
+	for _, key := range []string{"a", "b", "c"} {
+		c.Put(key, make([]byte, 4))
+	}
+
+	c.SetCapacity(8)
+	if got := cachedKeys(c, "a", "b", "c"); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("cached %v after shrinking, want [b c]", got)
+	}
+
+	c.Remove("b")
+	if c.Contains("b") || c.Size() != 4 {
+		t.Errorf("b is still cached after removal, size %d", c.Size())
+	}
+	c.Remove("missing")
+
+	c.Clear()
+	if got := cachedKeys(c, "a", "b", "c"); len(got) != 0 || c.Size() != 0 {
+		t.Errorf("cached %v with size %d after clearing", got, c.Size())
+	}
+	c.Put("a", make([]byte, 8))
+	if !c.Contains("a") {
+		t.Error("cleared cache does not take new entries")
+	}
+}
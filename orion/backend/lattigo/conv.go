@@ -0,0 +1,320 @@
+package main
+
+import (
+	"C"
+	"fmt"
+	"math/bits"
+	"slices"
+
+	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
+)
+
+// Convolutions are matrix-vector products with a Toeplitz matrix, whose
+// blocked diagonals hold each weight once per output position they are
+// applied at. Rather than receiving these from Python, where they are
+// built at a cost of several times their size, the backend can build them
+// from the weights, the same way orion/core/packing.py does.
+
+// convGeometry describes a convolution over multiplexed inputs and
+// outputs. It is passed from Python as a list of ints in field order.
+type convGeometry struct {
+	OutChannels, InChannels int // weight shape, after resolving groups
+	KernelH, KernelW        int
+	Batch                   int
+	InC, InH, InW           int // multiplexed input shape
+	OutC, OutH, OutW        int // multiplexed output shape
+	Ho, Wo                  int // output shape, before multiplexing
+	Padding, Dilation       int
+	Stride, InputGap        int
+}
+
+const convGeometryLen = 17
+
+func newConvGeometry(values []int, numWeights int) (convGeometry, error) {
+	if len(values) != convGeometryLen {
+		return convGeometry{}, fmt.Errorf(
+			"expected %d convolution parameters, got %d",
+			convGeometryLen, len(values))
+	}
+	g := convGeometry{
+		values[0], values[1], values[2], values[3], values[4],
+		values[5], values[6], values[7], values[8], values[9], values[10],
+		values[11], values[12], values[13], values[14], values[15],
+		values[16],
+	}
+
+	for i, v := range values {
+		if v < 0 || (v == 0 && i != 13) { // only the padding may be zero
+			return convGeometry{}, fmt.Errorf(
+				"convolution parameter %d must be positive, got %d", i, v)
+		}
+	}
+	if numWeights != g.OutChannels*g.InChannels*g.KernelH*g.KernelW {
+		return convGeometry{}, fmt.Errorf(
+			"expected %d weights (%d x %d x %d x %d), got %d",
+			g.OutChannels*g.InChannels*g.KernelH*g.KernelW,
+			g.OutChannels, g.InChannels, g.KernelH, g.KernelW, numWeights)
+	}
+	outputGap := g.InputGap * g.Stride
+	if g.OutChannels > g.OutC*outputGap*outputGap ||
+		g.InChannels > g.InC*g.InputGap*g.InputGap {
+		return convGeometry{}, fmt.Errorf(
+			"%d x %d channels do not fit the multiplexed shapes",
+			g.OutChannels, g.InChannels)
+	}
+	return g, nil
+}
+
+// forEachEntry calls fn with the row, column and value of every non-zero
+// entry of the convolution's Toeplitz matrix, batched block-diagonally.
+func (g convGeometry) forEachEntry(weights []float64, fn func(row, col int, v float64)) {
+	iG, oG := g.InputGap, g.InputGap*g.Stride
+	P, D := g.Padding, g.Dilation
+
+	// Kernel positions are laid out over the padded input image, with the
+	// same (transposed) kernel order as packing.py.
+	padH, padW := g.InH+2*P*iG, g.InW+2*P*iG
+	kernelSize := g.KernelH * g.KernelW
+	offsets := make([]int, kernelSize)
+	for m := range offsets {
+		a, b := m/g.KernelH, m%g.KernelH
+		offsets[m] = a*D*iG*padW + b*D*iG
+	}
+
+	rowsPerBatch := g.OutC * g.OutH * g.OutW
+	colsPerBatch := g.InC * g.InH * g.InW
+
+	for y := range g.Ho {
+		for x := range g.Wo {
+			inCorner := y*oG*padW + x*oG
+			outCorner := y*oG*g.OutW + x*oG
+
+			for o := range g.OutChannels {
+				co, p, q := o/(oG*oG), (o%(oG*oG))/oG, o%oG
+				row := co*g.OutH*g.OutW + outCorner + p*g.OutW + q
+
+				for i := range g.InChannels {
+					c, r, s := i/(iG*iG), (i%(iG*iG))/iG, i%iG
+					anchor := c*padH*padW + r*padW + s + inCorner
+
+					kernel := weights[(o*g.InChannels+i)*kernelSize:][:kernelSize]
+					for m, v := range kernel {
+						if v == 0 {
+							continue
+						}
+						// Drop the padding's columns.
+						pos := anchor + offsets[m]
+						pc, ph, pw := pos/(padH*padW), (pos/padW)%padH, pos%padW
+						h, w := ph-P*iG, pw-P*iG
+						if h < 0 || h >= g.InH || w < 0 || w >= g.InW {
+							continue
+						}
+						col := pc*g.InH*g.InW + h*g.InW + w
+
+						for n := range g.Batch {
+							fn(n*rowsPerBatch+row, n*colsPerBatch+col, v)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// blocks returns the grid of blocks the Toeplitz matrix is split into,
+// and the height of each. With the hybrid embedding, a matrix of a single
+// row of blocks is packed into blocks of its height rounded up to a power
+// of two, whose outputs are summed by log2(slots / height) rotations.
+func (g convGeometry) blocks(slots int, hybrid bool) (rows, cols, height, outputRotations int) {
+	numRows := g.Batch * g.OutC * g.OutH * g.OutW
+	numCols := g.Batch * g.InC * g.InH * g.InW
+	rows = (numRows + slots - 1) / slots
+	cols = (numCols + slots - 1) / slots
+
+	height = slots
+	if rows == 1 && hybrid {
+		height = 1 << bits.Len(uint(numRows-1))
+		outputRotations = bits.Len(uint(slots/height)) - 1
+	}
+	return rows, cols, height, outputRotations
+}
+
+// convBlockDiagonal returns the block of an entry of the Toeplitz matrix,
+// and its diagonal and slot within the block.
+func convBlockDiagonal(row, col, slots, height int) (blockRow, blockCol, diag, slot int) {
+	lr, lc := row%slots, col%slots
+	diag = ((lc-lr)%height + height) % height
+	slot = ((lc-diag)%slots + slots) % slots
+	return row / slots, col / slots, diag, slot
+}
+
+// blockDiagonals builds the non-zero diagonals of each block of the
+// Toeplitz matrix, in row-major block order, along with the number of
+// output rotations. Like packing.py, blocks without entries keep a zero
+// diagonal 0.
+func (g convGeometry) blockDiagonals(
+	weights []float64, slots int, hybrid bool,
+) (blocks []lintrans.Diagonals[float64], outputRotations int) {
+	rows, cols, height, outputRotations := g.blocks(slots, hybrid)
+
+	blocks = make([]lintrans.Diagonals[float64], rows*cols)
+	for b := range blocks {
+		blocks[b] = make(lintrans.Diagonals[float64])
+	}
+	g.forEachEntry(weights, func(row, col int, v float64) {
+		br, bc, diag, slot := convBlockDiagonal(row, col, slots, height)
+		block := blocks[br*cols+bc]
+		if block[diag] == nil {
+			block[diag] = make([]float64, slots)
+		}
+		block[diag][slot] = v
+	})
+
+	for _, diagonals := range blocks {
+		if len(diagonals) == 0 {
+			diagonals[0] = make([]float64, slots)
+		}
+	}
+	return blocks, outputRotations
+}
+
+// ConvDiagonalIndices returns the layout of a convolution's diagonals, for
+// planning levels and rotation keys before the transforms are generated.
+// The result holds the number of block rows and columns, the number of
+// output rotations, and then, for each block in row-major order, its
+// number of non-zero diagonals followed by their indices. Returns an empty
+// array with the last error set on failure.
+//
+//export ConvDiagonalIndices
+func ConvDiagonalIndices(
+	weightsC *C.double, lenWeights C.int,
+	geometryC *C.int, lenGeometry C.int,
+	hybrid C.int,
+) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	weights := CArrayToSlice(weightsC, lenWeights, convertCDoubleToFloat)
+	geometry := CArrayToSlice(geometryC, lenGeometry, convertCIntToInt)
+
+	g, err := newConvGeometry(geometry, len(weights))
+	if err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	slots := scheme.Params.MaxSlots()
+	rows, cols, height, outputRotations := g.blocks(slots, hybrid != 0)
+
+	idxs := make([]map[int]bool, rows*cols)
+	for b := range idxs {
+		idxs[b] = map[int]bool{}
+	}
+	g.forEachEntry(weights, func(row, col int, _ float64) {
+		br, bc, diag, _ := convBlockDiagonal(row, col, slots, height)
+		idxs[br*cols+bc][diag] = true
+	})
+
+	layout := []int{rows, cols, outputRotations}
+	for _, block := range idxs {
+		// Like packing.py, blocks without entries keep a zero diagonal 0.
+		if len(block) == 0 {
+			block[0] = true
+		}
+		layout = append(layout, len(block))
+		for diag := range block {
+			layout = append(layout, diag)
+		}
+	}
+
+	arrPtr, length := SliceToCArray(layout, convertIntToCInt)
+	return arrPtr, length
+}
+
+// ConvDiagonals returns the diagonals GenerateConvTransforms would encode,
+// for checking them against packing.py. The result is laid out as that of
+// ConvDiagonalIndices, with each diagonal index followed by the diagonal's
+// slots. Returns an empty array with the last error set on failure.
+//
+//export ConvDiagonals
+func ConvDiagonals(
+	weightsC *C.double, lenWeights C.int,
+	geometryC *C.int, lenGeometry C.int,
+	hybrid C.int,
+) (*C.double, C.ulong) {
+	scheme := activeScheme.Load()
+
+	weights := CArrayToSlice(weightsC, lenWeights, convertCDoubleToFloat)
+	geometry := CArrayToSlice(geometryC, lenGeometry, convertCIntToInt)
+
+	g, err := newConvGeometry(geometry, len(weights))
+	if err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	slots := scheme.Params.MaxSlots()
+	rows, cols, _, _ := g.blocks(slots, hybrid != 0)
+	blocks, outputRotations := g.blockDiagonals(weights, slots, hybrid != 0)
+
+	layout := []float64{float64(rows), float64(cols), float64(outputRotations)}
+	for _, diagonals := range blocks {
+		idxs := GetKeysFromMap(diagonals)
+		slices.Sort(idxs)
+
+		layout = append(layout, float64(len(idxs)))
+		for _, idx := range idxs {
+			layout = append(layout, float64(idx))
+			layout = append(layout, diagonals[idx]...)
+		}
+	}
+
+	arrPtr, length := SliceToCArray(layout, convertFloat64ToCDouble)
+	return arrPtr, length
+}
+
+// GenerateConvTransforms builds the blocked diagonals of a convolution
+// from its weights, and generates a transform for each block at level.
+// weights are the (out, in, kernel height, kernel width) weights with any
+// groups resolved, and geometry lists the fields of convGeometry. hybrid
+// selects the hybrid embedding's block height. Returns the transforms'
+// handles in row-major block order, or an empty array with the last error
+// set on failure.
+//
+//export GenerateConvTransforms
+func GenerateConvTransforms(
+	weightsC *C.double, lenWeights C.int,
+	geometryC *C.int, lenGeometry C.int,
+	hybrid C.int,
+	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio C.float,
+	pruneThreshold C.float,
+) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	weights := CArrayToSlice(weightsC, lenWeights, convertCDoubleToFloat)
+	geometry := CArrayToSlice(geometryC, lenGeometry, convertCIntToInt)
+
+	g, err := newConvGeometry(geometry, len(weights))
+	if err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+	level, err = resolveTransformLevel(scheme, level, refCiphertextID)
+	if err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	blocks, _ := g.blockDiagonals(weights, scheme.Params.MaxSlots(), hybrid != 0)
+	ids := make([]int, len(blocks))
+	for b, diagonals := range blocks {
+		ids[b] = int(newLinearTransform(
+			scheme, diagonals, level,
+			float64(bsgsRatio), float64(pruneThreshold), "none"))
+		blocks[b] = nil // encoded, so the diagonals can be freed
+	}
+
+	arrPtr, length := SliceToCArray(ids, convertIntToCInt)
+	return arrPtr, length
+}
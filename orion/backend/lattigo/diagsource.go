@@ -0,0 +1,60 @@
+package main
+
+/*
+typedef int (*diagonal_source)(int diag_idx, double *out, int slots);
+
+static int call_diagonal_source(
+	diagonal_source source, int diag_idx, double *out, int slots) {
+	return source(diag_idx, out, slots);
+}
+
+typedef int (*plaintext_source)(int diag_idx, char **data, unsigned long *len);
+
+static int call_plaintext_source(
+	plaintext_source source, int diag_idx, char **data, unsigned long *len) {
+	return source(diag_idx, data, len);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/baahl-nyu/lattigo/v6/ring/ringqp"
+)
+
+// pullDiagonal calls a diagonal source callback, as passed to
+// GenerateLinearTransformStreamed, to fill out with diagonal diagIdx.
+// The callback signals failure with a non-zero return value.
+func pullDiagonal(source unsafe.Pointer, diagIdx int, out []float64) error {
+	status := C.call_diagonal_source(
+		C.diagonal_source(source), C.int(diagIdx),
+		(*C.double)(unsafe.Pointer(&out[0])), C.int(len(out)))
+	if status != 0 {
+		return fmt.Errorf("diagonal source failed on diagonal %d", diagIdx)
+	}
+	return nil
+}
+
+// pullPlaintextDiagonal calls a plaintext source callback, as passed to
+// EvaluateLinearTransformStreamed, for serialized diagonal diagIdx, and
+// decodes it. The callback points data at the serialized diagonal, which
+// only has to stay valid until it is called again, and signals failure
+// with a non-zero return value.
+func pullPlaintextDiagonal(source unsafe.Pointer, diagIdx int) (ringqp.Poly, error) {
+	var data *C.char
+	var length C.ulong
+	status := C.call_plaintext_source(
+		C.plaintext_source(source), C.int(diagIdx), &data, &length)
+	if status != 0 {
+		return ringqp.Poly{}, fmt.Errorf("plaintext source failed on diagonal %d", diagIdx)
+	}
+
+	var diag ringqp.Poly
+	if err := diag.UnmarshalBinary(
+		CArrayToByteSlice(unsafe.Pointer(data), uint64(length))); err != nil {
+		return ringqp.Poly{}, fmt.Errorf("cannot load diagonal %d: %w", diagIdx, err)
+	}
+	return diag, nil
+}
@@ -9,6 +9,10 @@ import (
 
 //export NewEncoder
 func NewEncoder() {
+	newEncoder(activeScheme.Load())
+}
+
+func newEncoder(scheme *Scheme) {
 	scheme.Encoder = ckks.NewEncoder(*scheme.Params)
 }
 
@@ -19,6 +23,8 @@ func Encode(
 	level C.int,
 	scale C.ulong,
 ) C.int {
+	scheme := activeScheme.Load()
+
 	values := CArrayToSlice(valuesPtr, lenValues, convertCFloatToFloat)
 	plaintext := ckks.NewPlaintext(*scheme.Params, int(level))
 	plaintext.Scale = rlwe.NewScale(uint64(scale))
@@ -33,6 +39,8 @@ func Encode(
 func Decode(
 	plaintextID C.int,
 ) (*C.float, C.ulong) {
+	scheme := activeScheme.Load()
+
 	plaintext := RetrievePlaintext(int(plaintextID))
 	result := make([]float64, scheme.Params.MaxSlots())
 	scheme.Encoder.Decode(plaintext, result)
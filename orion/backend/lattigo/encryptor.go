@@ -2,22 +2,41 @@ package main
 
 import (
 	"C"
+	"fmt"
+	"math"
 
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/ring"
 	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
 )
 
 //export NewEncryptor
 func NewEncryptor() {
+	newEncryptor(activeScheme.Load())
+}
+
+func newEncryptor(scheme *Scheme) {
+	if scheme.Seed != nil {
+		scheme.Encryptor = rlwe.NewTestEncryptorWithPRNG(
+			*scheme.Params, scheme.PublicKey, seededPRNG(scheme, "encryptor"))
+		return
+	}
 	scheme.Encryptor = ckks.NewEncryptor(*scheme.Params, scheme.PublicKey)
 }
 
 //export NewDecryptor
 func NewDecryptor() {
+	newDecryptor(activeScheme.Load())
+}
+
+func newDecryptor(scheme *Scheme) {
 	scheme.Decryptor = ckks.NewDecryptor(*scheme.Params, scheme.SecretKey)
 }
 
 //export Encrypt
 func Encrypt(plaintextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	plaintext := RetrievePlaintext(int(plaintextID))
 	ciphertext := ckks.NewCiphertext(*scheme.Params, 1, plaintext.Level())
 	scheme.Encryptor.Encrypt(plaintext, ciphertext)
@@ -26,8 +45,97 @@ func Encrypt(plaintextID C.int) C.int {
 	return C.int(idx)
 }
 
+// EncryptBatch encrypts batchSize independent inputs in one call. The data
+// is laid out row-major, one row of MaxSlots values per input, so dataLen
+// must be batchSize * MaxSlots. Each row is encoded at the top level with
+// the default scale. Returns the ciphertext IDs in row order, or an empty
+// array with the last error set on invalid input.
+//
+//export EncryptBatch
+func EncryptBatch(dataC *C.float, dataLen C.int, batchSize C.int) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	slots := scheme.Params.MaxSlots()
+	if batchSize <= 0 || int(dataLen) != int(batchSize)*slots {
+		SetLastError(fmt.Errorf(
+			"cannot split %d values into a batch of %d rows of %d slots",
+			int(dataLen), int(batchSize), slots))
+		return nil, 0
+	}
+
+	data := CArrayToSlice(dataC, dataLen, convertCFloatToFloat)
+	level := scheme.Params.MaxLevel()
+
+	ids := make([]int, batchSize)
+	for i := range ids {
+		plaintext := ckks.NewPlaintext(*scheme.Params, level)
+		if err := scheme.Encoder.Encode(data[i*slots:(i+1)*slots], plaintext); err != nil {
+			SetLastError(err)
+			return nil, 0
+		}
+		ciphertext := ckks.NewCiphertext(*scheme.Params, 1, level)
+		if err := scheme.Encryptor.Encrypt(plaintext, ciphertext); err != nil {
+			SetLastError(err)
+			return nil, 0
+		}
+		ids[i] = PushCiphertext(ciphertext)
+	}
+
+	arrPtr, length := SliceToCArray(ids, convertIntToCInt)
+	return arrPtr, length
+}
+
+// EncryptWithScale encodes the values at the top level with a scale of
+// 2^logScale rather than the default one, then encrypts them. Decryption
+// needs nothing special, since the scale travels with the ciphertext.
+//
+// Linear transforms multiply by diagonals encoded at the scale of the
+// modulus at their level and rescale once after all blocks of a row are
+// summed, so an input at scale S comes out at S * q_l / q_l. Picking S
+// lets the caller land the output on an exact scale, e.g. to match the
+// other operand of a later addition. Returns -1 with the last error set
+// on invalid input.
+//
+//export EncryptWithScale
+func EncryptWithScale(valuesPtr *C.float, lenValues C.int, logScale C.double) C.int {
+	scheme := activeScheme.Load()
+
+	if int(lenValues) > scheme.Params.MaxSlots() {
+		SetLastError(fmt.Errorf(
+			"cannot encrypt %d values into %d slots",
+			int(lenValues), scheme.Params.MaxSlots()))
+		return -1
+	}
+	if logScale <= 0 || float64(logScale) >= scheme.Params.LogQ() {
+		SetLastError(fmt.Errorf(
+			"scale 2^%.2f is outside (1, 2^%.2f)",
+			float64(logScale), scheme.Params.LogQ()))
+		return -1
+	}
+
+	values := CArrayToSlice(valuesPtr, lenValues, convertCFloatToFloat)
+	plaintext := ckks.NewPlaintext(*scheme.Params, scheme.Params.MaxLevelQ())
+	plaintext.Scale = rlwe.NewScale(math.Exp2(float64(logScale)))
+
+	if err := scheme.Encoder.Encode(values, plaintext); err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	ciphertext := ckks.NewCiphertext(*scheme.Params, 1, plaintext.Level())
+	if err := scheme.Encryptor.Encrypt(plaintext, ciphertext); err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ciphertext)
+	return C.int(idx)
+}
+
 //export Decrypt
 func Decrypt(ciphertextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ciphertext := RetrieveCiphertext(int(ciphertextID))
 
 	plaintext := ckks.NewPlaintext(*scheme.Params, ciphertext.Level())
@@ -36,3 +144,149 @@ func Decrypt(ciphertextID C.int) C.int {
 	idx := PushPlaintext(plaintext)
 	return C.int(idx)
 }
+
+// DecryptComplex decrypts and decodes the ciphertext into complex values,
+// returned as separate arrays of real and imaginary parts, each with one
+// entry per slot. Only the standard ring has complex slots, so for other
+// ring types both arrays are empty and the last error is set.
+//
+//export DecryptComplex
+func DecryptComplex(ciphertextID C.int) (*C.double, *C.double, C.ulong) {
+	scheme := activeScheme.Load()
+
+	values, err := decryptComplex(scheme, RetrieveCiphertext(int(ciphertextID)))
+	if err != nil {
+		SetLastError(err)
+		return nil, nil, 0
+	}
+
+	realPtr, length := SliceToCArray(values, func(v complex128) C.double {
+		return C.double(real(v))
+	})
+	imagPtr, _ := SliceToCArray(values, func(v complex128) C.double {
+		return C.double(imag(v))
+	})
+	return realPtr, imagPtr, length
+}
+
+// decryptComplex decrypts and decodes a ciphertext into one complex value
+// per slot.
+func decryptComplex(scheme *Scheme, ciphertext *rlwe.Ciphertext) ([]complex128, error) {
+	if scheme.Params.RingType() != ring.Standard {
+		return nil, fmt.Errorf(
+			"cannot decrypt complex values: ring type %s has only real slots",
+			scheme.Params.RingType())
+	}
+
+	plaintext := ckks.NewPlaintext(*scheme.Params, ciphertext.Level())
+	scheme.Decryptor.Decrypt(ciphertext, plaintext)
+
+	values := make([]complex128, scheme.Params.MaxSlots())
+	if err := scheme.Encoder.Decode(plaintext, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+//export DecryptPrecisionStats
+func DecryptPrecisionStats(
+	ciphertextID C.int,
+	wantPtr *C.float,
+	lenWant C.int,
+) (*C.double, C.ulong) {
+	scheme := activeScheme.Load()
+
+	ciphertext := RetrieveCiphertext(int(ciphertextID))
+
+	// The expected values only need to cover the prefix of the slots
+	// that the caller cares about. The rest are compared against zero.
+	want := make([]float64, scheme.Params.MaxSlots())
+	copy(want, CArrayToSlice(wantPtr, lenWant, convertCFloatToFloat))
+
+	prec := ckks.GetPrecisionStats(
+		*scheme.Params, scheme.Encoder, scheme.Decryptor,
+		want, ciphertext, 0, false,
+	)
+
+	// Flattened as: [min, max, mean] log2 absolute error followed by
+	// the [min, mean] log2 precision of the real and imaginary parts.
+	stats := []float64{
+		prec.MINLog2Err.L2,
+		prec.MAXLog2Err.L2,
+		prec.AVGLog2Err.L2,
+		prec.MINLog2Prec.Real,
+		prec.AVGLog2Prec.Real,
+		prec.MINLog2Prec.Imag,
+		prec.AVGLog2Prec.Imag,
+	}
+
+	arrPtr, length := SliceToCArray(stats, convertFloat64ToCDouble)
+	return arrPtr, length
+}
+
+// Bits of the DecryptHealthCheck result.
+const (
+	healthNaN        = 1 << 0
+	healthInf        = 1 << 1
+	healthOutOfRange = 1 << 2
+)
+
+// healthCheckBound is the largest slot magnitude DecryptHealthCheck accepts
+// before flagging it as out of range.
+var healthCheckBound = 1e6
+
+//export SetHealthCheckBound
+func SetHealthCheckBound(bound C.double) {
+	healthCheckBound = float64(bound)
+}
+
+// DecryptHealthCheck decrypts a ciphertext and scans its slots, real and
+// imaginary parts alike, for NaN, Inf and magnitudes above the health
+// check bound. Returns a bitmask of what it found (0 if the slots are
+// clean), or -1 with the last error set if decoding failed.
+//
+//export DecryptHealthCheck
+func DecryptHealthCheck(ciphertextID C.int) C.int {
+	scheme := activeScheme.Load()
+
+	ciphertext := RetrieveCiphertext(int(ciphertextID))
+	plaintext := ckks.NewPlaintext(*scheme.Params, ciphertext.Level())
+	scheme.Decryptor.Decrypt(ciphertext, plaintext)
+
+	// The conjugate-invariant ring only has real slots to scan.
+	if scheme.Params.RingType() != ring.Standard {
+		values := make([]float64, scheme.Params.MaxSlots())
+		if err := scheme.Encoder.Decode(plaintext, values); err != nil {
+			SetLastError(err)
+			return -1
+		}
+		status := 0
+		for _, v := range values {
+			status |= checkSlotHealth(v)
+		}
+		return C.int(status)
+	}
+
+	values := make([]complex128, scheme.Params.MaxSlots())
+	if err := scheme.Encoder.Decode(plaintext, values); err != nil {
+		SetLastError(err)
+		return -1
+	}
+	status := 0
+	for _, v := range values {
+		status |= checkSlotHealth(real(v)) | checkSlotHealth(imag(v))
+	}
+	return C.int(status)
+}
+
+func checkSlotHealth(v float64) int {
+	switch {
+	case math.IsNaN(v):
+		return healthNaN
+	case math.IsInf(v, 0):
+		return healthInf
+	case math.Abs(v) > healthCheckBound:
+		return healthOutOfRange
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/ring"
+)
+
+// A known complex vector comes back from decryptComplex with both its
+// real and imaginary parts intact.
+func TestDecryptComplexRoundTrip(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(5, 6))
+	slots := scheme.Params.MaxSlots()
+
+	re, im := randomValues(rng, slots), randomValues(rng, slots)
+	values := make([]complex128, slots)
+	for i := range values {
+		values[i] = complex(re[i], im[i])
+	}
+
+	ctID := encryptValues(t, scheme, values, testMaxLevel)
+	got, err := decryptComplex(scheme, RetrieveCiphertext(ctID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != slots {
+		t.Fatalf("got %d values, want one per slot (%d)", len(got), slots)
+	}
+
+	gotRe, gotIm := make([]float64, slots), make([]float64, slots)
+	for i, v := range got {
+		gotRe[i], gotIm[i] = real(v), imag(v)
+	}
+	if err := maxError(re, gotRe); err > 1e-8 {
+		t.Errorf("real parts differ by up to %g", err)
+	}
+	if err := maxError(im, gotIm); err > 1e-8 {
+		t.Errorf("imaginary parts differ by up to %g", err)
+	}
+}
+
+// The conjugate-invariant ring has no imaginary part to decrypt.
+func TestDecryptComplexConjugateInvariant(t *testing.T) {
+	lit := testParams
+	lit.RingType = ring.ConjugateInvariant
+	scheme := newTestScheme(t, lit)
+
+	ctID := encryptValues(t, scheme, make([]float64, scheme.Params.MaxSlots()), testMaxLevel)
+	if _, err := decryptComplex(scheme, RetrieveCiphertext(ctID)); err == nil {
+		t.Error("decrypted complex values on the conjugate-invariant ring")
+	}
+}
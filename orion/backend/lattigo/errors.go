@@ -0,0 +1,34 @@
+package main
+
+import (
+	"C"
+	"sync"
+)
+
+// Exports that can fail on bad input from Python record the reason here
+// and return a negative status instead of panicking, which would take
+// down the whole interpreter. Python then fetches it with GetLastError.
+var (
+	lastErrorMu sync.Mutex
+	lastError   error
+)
+
+func SetLastError(err error) {
+	lastErrorMu.Lock()
+	defer lastErrorMu.Unlock()
+	lastError = err
+}
+
+//export GetLastError
+func GetLastError() *C.char {
+	lastErrorMu.Lock()
+	defer lastErrorMu.Unlock()
+	if lastError == nil {
+		return nil
+	}
+
+	// The caller is responsible for releasing this with FreeCArray.
+	msg := C.CString(lastError.Error())
+	lastError = nil
+	return msg
+}
@@ -2,16 +2,21 @@ package main
 
 import (
 	"C"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
 
+	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
 	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/ring"
 	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
 )
 
-var liveRotKeys = make(map[uint64]*rlwe.GaloisKey)
-var savedRotKeys = []uint64{}
-
 //export NewEvaluator
 func NewEvaluator() {
+	scheme := activeScheme.Load()
+
 	scheme.Evaluator = ckks.NewEvaluator(
 		*scheme.Params, rlwe.NewMemEvaluationKeySet(scheme.RelinKey))
 
@@ -19,48 +24,251 @@ func NewEvaluator() {
 	// store in memory all power of two rotation keys. This will ensure
 	// all keys needed for the rotations and summations in the hyrid
 	// method remain alive.
-	AddPo2RotationKeys()
+	AddPo2RotationKeys(scheme)
 }
 
-func AddPo2RotationKeys() {
+func AddPo2RotationKeys(scheme *Scheme) {
 	maxSlots := scheme.Params.MaxSlots()
 	// Generate all positive power-of-two rotation keys
+	galEls := []uint64{}
 	for i := 1; i < maxSlots; i *= 2 {
-		AddRotationKey(C.int(i))
+		galEls = append(galEls, scheme.Params.GaloisElement(i))
+	}
+	if err := addRotationKeys(scheme, galEls); err != nil {
+		panic(err)
 	}
 }
 
 //export AddRotationKey
 func AddRotationKey(rotation C.int) {
+	addRotationKey(activeScheme.Load(), rotation)
+}
+
+func addRotationKey(scheme *Scheme, rotation C.int) {
 	galEl := scheme.Params.GaloisElement(int(rotation))
+	if err := addRotationKeys(scheme, []uint64{galEl}); err != nil {
+		panic(err)
+	}
+}
 
-	// Generate the required rotation key if it doesn't exist
-	if _, exists := liveRotKeys[galEl]; !exists {
-		rotKey := scheme.KeyGen.GenGaloisKeyNew(galEl, scheme.SecretKey)
-		liveRotKeys[galEl] = rotKey
+//export GetGaloisElement
+func GetGaloisElement(step C.int) C.ulong {
+	scheme := activeScheme.Load()
+	return C.ulong(scheme.Params.GaloisElement(int(step)))
+}
 
-		allKeysList := GetValuesFromMap(liveRotKeys)
-		keys := rlwe.NewMemEvaluationKeySet(scheme.RelinKey, allKeysList...)
-		scheme.Evaluator = scheme.Evaluator.WithKey(keys)
+// HasRotationKey reports whether the key for a rotation step is held in
+// memory, either live in the evaluator or installed for linear transforms.
+// Keys that only exist in the keys file are checked from Python, since
+// the backend never reads it directly. Returns 1 if it is, and 0 if not.
+//
+//export HasRotationKey
+func HasRotationKey(step C.int) C.int {
+	scheme := activeScheme.Load()
+
+	galEl := scheme.Params.GaloisElement(int(step))
+	if _, exists := scheme.LiveRotKeys[galEl]; exists {
+		return 1
+	}
+	if _, exists := scheme.EvalKeys.GaloisKeys[galEl]; exists {
+		return 1
 	}
+	return 0
 }
 
+// EnsureRotationKey makes the key for a rotation step available to both the
+// evaluator and the linear transform evaluator. A key already loaded for
+// linear transforms is reused, otherwise it is generated.
+//
+//export EnsureRotationKey
+func EnsureRotationKey(step C.int) {
+	scheme := activeScheme.Load()
+
+	galEl := scheme.Params.GaloisElement(int(step))
+	_, live := scheme.LiveRotKeys[galEl]
+	if rotKey, exists := scheme.EvalKeys.GaloisKeys[galEl]; exists && !live {
+		scheme.LiveRotKeys[galEl] = rotKey
+		installLiveRotKeys(scheme)
+	} else if err := addRotationKeys(scheme, []uint64{galEl}); err != nil {
+		panic(err)
+	}
+
+	if _, exists := scheme.EvalKeys.GaloisKeys[galEl]; !exists {
+		scheme.EvalKeys.GaloisKeys[galEl] = scheme.LiveRotKeys[galEl]
+	}
+	scheme.LinEvaluator = lintrans.NewEvaluator(
+		scheme.Evaluator.WithKey(scheme.EvalKeys),
+	)
+}
+
+// addRotationKeys generates the rotation keys for the Galois elements that
+// aren't live yet and installs them into the evaluator. Keys are
+// independent, so several are generated concurrently, each worker using
+// its own key generator since they are not safe for concurrent use.
+// Generating keys needs the secret key, so on schemes without one this
+// returns an error if any key is missing.
+func addRotationKeys(scheme *Scheme, galEls []uint64) error {
+	missing := []uint64{}
+	for _, galEl := range galEls {
+		if _, exists := scheme.LiveRotKeys[galEl]; !exists && !slices.Contains(missing, galEl) {
+			missing = append(missing, galEl)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if scheme.SecretKey == nil {
+		return fmt.Errorf("cannot generate %d rotation keys: scheme has no "+
+			"secret key", len(missing))
+	}
+
+	rotKeys := make([]*rlwe.GaloisKey, len(missing))
+	if len(missing) == 1 {
+		rotKeys[0] = galoisKeyGenerator(scheme, missing[0], scheme.KeyGen).
+			GenGaloisKeyNew(missing[0], scheme.SecretKey)
+	} else {
+		numWorkers := min(runtime.GOMAXPROCS(0), len(missing))
+
+		var wg sync.WaitGroup
+		for w := range numWorkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				keyGen := rlwe.NewKeyGenerator(scheme.Params)
+				for i := w; i < len(missing); i += numWorkers {
+					rotKeys[i] = galoisKeyGenerator(scheme, missing[i], keyGen).
+						GenGaloisKeyNew(missing[i], scheme.SecretKey)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	for i, galEl := range missing {
+		scheme.LiveRotKeys[galEl] = rotKeys[i]
+	}
+	installLiveRotKeys(scheme)
+	return nil
+}
+
+// installLiveRotKeys rebuilds the evaluator's key set from the live
+// rotation keys.
+func installLiveRotKeys(scheme *Scheme) {
+	allKeysList := GetValuesFromMap(scheme.LiveRotKeys)
+	keys := rlwe.NewMemEvaluationKeySet(scheme.RelinKey, allKeysList...)
+	scheme.Evaluator = scheme.Evaluator.WithKey(keys)
+}
+
+// Negate negates a ciphertext by negating its polynomials, which involves
+// no multiplication at all.
+//
 //export Negate
 func Negate(ciphertextID C.int) C.int {
+	scheme := activeScheme.Load()
+
+	ctOut := RetrieveCiphertext(int(ciphertextID)).CopyNew()
+	ringQ := scheme.Params.RingQ().AtLevel(ctOut.Level())
+	for _, poly := range ctOut.Value {
+		ringQ.Neg(poly, poly)
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+// AddConstant adds the complex constant real + i*imag to every slot of a
+// ciphertext. Returns the ID of the sum, or -1 with the last error set.
+//
+//export AddConstant
+func AddConstant(ciphertextID C.int, real, imag C.double) C.int {
+	scheme := activeScheme.Load()
+
+	constant, err := newConstant(scheme, real, imag)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
-	ctOut, err := scheme.Evaluator.MulNew(ctIn, -1.0)
+	ctOut, err := scheme.Evaluator.AddNew(ctIn, constant)
 	if err != nil {
-		panic(err)
+		SetLastError(err)
+		return -1
 	}
 
 	idx := PushCiphertext(ctOut)
 	return C.int(idx)
 }
 
+// MultConstant multiplies every slot of a ciphertext by the complex
+// constant real + i*imag and rescales, so the product keeps the input's
+// scale one level lower. Its level can be read back with
+// GetCiphertextLevel. Returns the ID of the product, or -1 with the last
+// error set.
+//
+//export MultConstant
+func MultConstant(ciphertextID C.int, real, imag C.double) C.int {
+	scheme := activeScheme.Load()
+
+	constant, err := newConstant(scheme, real, imag)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	ctOut := RetrieveCiphertext(int(ciphertextID)).CopyNew()
+	if err := mulConstantAndRescale(scheme, ctOut, constant); err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+// mulConstantAndRescale multiplies ct in place by a constant and
+// rescales, keeping its scale one level lower.
+func mulConstantAndRescale[T float64 | complex128](
+	scheme *Scheme, ct *rlwe.Ciphertext, constant T,
+) error {
+	perRescale := scheme.Params.LevelsConsumedPerRescaling()
+	if ct.Level() < perRescale {
+		return fmt.Errorf(
+			"cannot multiply a ciphertext at level %d: "+
+				"no level left to rescale the product", ct.Level())
+	}
+	scale := ct.Scale
+	if err := scheme.Evaluator.Mul(ct, constant, ct); err != nil {
+		return err
+	}
+
+	// Lattigo multiplies by an integer constant as it is, without scaling
+	// it up, so there is nothing to rescale. The level is dropped all the
+	// same, so that every constant costs one.
+	if ct.Scale.Equal(scale) {
+		scheme.Evaluator.DropLevel(ct, perRescale)
+		return nil
+	}
+	return scheme.Evaluator.Rescale(ct, ct)
+}
+
+// newConstant builds a slot constant, rejecting imaginary parts that the
+// conjugate-invariant ring, whose slots are real, cannot hold.
+func newConstant(scheme *Scheme, real, imag C.double) (complex128, error) {
+	if imag != 0 && scheme.Params.RingType() != ring.Standard {
+		return 0, fmt.Errorf(
+			"cannot use imaginary part %g with ring type %s",
+			float64(imag), scheme.Params.RingType())
+	}
+	return complex(float64(real), float64(imag)), nil
+}
+
 //export Rotate
 func Rotate(ciphertextID, amount C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
-	AddRotationKey(amount)
+	addRotationKey(scheme, amount)
 	scheme.Evaluator.Rotate(ctIn, int(amount), ctIn)
 
 	return ciphertextID
@@ -68,8 +276,10 @@ func Rotate(ciphertextID, amount C.int) C.int {
 
 //export RotateNew
 func RotateNew(ciphertextID, amount C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
-	AddRotationKey(amount)
+	addRotationKey(scheme, amount)
 
 	ctOut, err := scheme.Evaluator.RotateNew(ctIn, int(amount))
 	if err != nil {
@@ -80,8 +290,59 @@ func RotateNew(ciphertextID, amount C.int) C.int {
 	return C.int(idx)
 }
 
+// RotateCiphertext rotates a ciphertext by any k, as a sequence of
+// rotations by the powers of two in the binary expansion of k modulo the
+// slot count, whose keys AddPo2RotationKeys keeps resident. This takes up
+// to log2(slots) key switches, but no key specific to k. Returns the ID of
+// the rotated ciphertext, or -1 with the last error set.
+//
+//export RotateCiphertext
+func RotateCiphertext(ciphertextID, k C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	ctOut, err := rotatePo2(scheme, ctIn, int(k))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+// rotatePo2 returns ctIn rotated by k using power-of-two rotations only.
+func rotatePo2(scheme *Scheme, ctIn *rlwe.Ciphertext, k int) (*rlwe.Ciphertext, error) {
+	slots := scheme.Params.MaxSlots()
+	k = (k%slots + slots) % slots
+
+	steps := []int{}
+	for step := 1; step < slots; step *= 2 {
+		if k&step != 0 {
+			steps = append(steps, step)
+		}
+	}
+	if err := addRotationKeys(scheme, rotationGaloisElements(scheme, steps)); err != nil {
+		return nil, err
+	}
+
+	ctOut := ctIn.CopyNew()
+	for _, step := range steps {
+		if err := scheme.Evaluator.Rotate(ctOut, step, ctOut); err != nil {
+			return nil, err
+		}
+	}
+	return ctOut, nil
+}
+
 //export Rescale
 func Rescale(ciphertextID C.int) C.int {
+	scheme := activeScheme.Load()
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	scheme.Evaluator.Rescale(ctIn, ctIn)
 
@@ -90,6 +351,8 @@ func Rescale(ciphertextID C.int) C.int {
 
 //export RescaleNew
 func RescaleNew(ciphertextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	scheme.Evaluator.Rescale(ctIn, ctIn)
 	ctOut := ctIn.CopyNew()
@@ -98,8 +361,54 @@ func RescaleNew(ciphertextID C.int) C.int {
 	return C.int(idx)
 }
 
+// DropLevel lowers the ciphertext by the given number of levels in place,
+// without dividing by the dropped moduli. Returns 0 on success and -1 with
+// the last error set otherwise.
+//
+//export DropLevel
+func DropLevel(ciphertextID C.int, levels C.int) C.int {
+	scheme := activeScheme.Load()
+
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+	if levels < 0 || int(levels) > ctIn.Level() {
+		SetLastError(fmt.Errorf(
+			"cannot drop %d levels from a ciphertext at level %d",
+			int(levels), ctIn.Level()))
+		return -1
+	}
+
+	scheme.Evaluator.DropLevel(ctIn, int(levels))
+	return 0
+}
+
+// RescaleToLevel rescales the ciphertext in place until it reaches
+// targetLevel. Returns 0 on success and -1 with the last error set
+// otherwise.
+//
+//export RescaleToLevel
+func RescaleToLevel(ciphertextID C.int, targetLevel C.int) C.int {
+	scheme := activeScheme.Load()
+
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+	if targetLevel < 0 || int(targetLevel) > ctIn.Level() {
+		SetLastError(fmt.Errorf(
+			"cannot rescale a ciphertext at level %d to level %d",
+			ctIn.Level(), int(targetLevel)))
+		return -1
+	}
+
+	for ctIn.Level() > int(targetLevel) {
+		if err := scheme.Evaluator.Rescale(ctIn, ctIn); err != nil {
+			SetLastError(err)
+			return -1
+		}
+	}
+	return 0
+}
+
 //export AddScalar
 func AddScalar(ciphertextID C.int, scalar C.float) C.int {
+	scheme := activeScheme.Load()
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	scheme.Evaluator.Add(ctIn, float64(scalar), ctIn)
 
@@ -108,6 +417,8 @@ func AddScalar(ciphertextID C.int, scalar C.float) C.int {
 
 //export AddScalarNew
 func AddScalarNew(ciphertextID C.int, scalar C.float) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ctOut, err := scheme.Evaluator.AddNew(ctIn, float64(scalar))
 	if err != nil {
@@ -120,6 +431,7 @@ func AddScalarNew(ciphertextID C.int, scalar C.float) C.int {
 
 //export SubScalar
 func SubScalar(ciphertextID C.int, scalar C.float) C.int {
+	scheme := activeScheme.Load()
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	scheme.Evaluator.Sub(ctIn, float64(scalar), ctIn)
 
@@ -128,6 +440,8 @@ func SubScalar(ciphertextID C.int, scalar C.float) C.int {
 
 //export SubScalarNew
 func SubScalarNew(ciphertextID C.int, scalar C.float) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ctOut, err := scheme.Evaluator.SubNew(ctIn, float64(scalar))
 	if err != nil {
@@ -140,6 +454,7 @@ func SubScalarNew(ciphertextID C.int, scalar C.float) C.int {
 
 //export MulScalarInt
 func MulScalarInt(ciphertextID C.int, scalar C.int) C.int {
+	scheme := activeScheme.Load()
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	scheme.Evaluator.Mul(ctIn, int(scalar), ctIn)
 
@@ -148,6 +463,8 @@ func MulScalarInt(ciphertextID C.int, scalar C.int) C.int {
 
 //export MulScalarIntNew
 func MulScalarIntNew(ciphertextID C.int, scalar C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ctOut, err := scheme.Evaluator.MulNew(ctIn, int(scalar))
 	if err != nil {
@@ -160,6 +477,7 @@ func MulScalarIntNew(ciphertextID C.int, scalar C.int) C.int {
 
 //export MulScalarFloat
 func MulScalarFloat(ciphertextID C.int, scalar C.float) C.int {
+	scheme := activeScheme.Load()
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	scheme.Evaluator.Mul(ctIn, float64(scalar), ctIn)
 
@@ -168,6 +486,8 @@ func MulScalarFloat(ciphertextID C.int, scalar C.float) C.int {
 
 //export MulScalarFloatNew
 func MulScalarFloatNew(ciphertextID C.int, scalar C.float) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ctOut, err := scheme.Evaluator.MulNew(ctIn, float64(scalar))
 	if err != nil {
@@ -180,6 +500,8 @@ func MulScalarFloatNew(ciphertextID C.int, scalar C.float) C.int {
 
 //export AddPlaintext
 func AddPlaintext(ciphertextID, plaintextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ptIn := RetrievePlaintext(int(plaintextID))
 	scheme.Evaluator.Add(ctIn, ptIn, ctIn)
@@ -189,6 +511,8 @@ func AddPlaintext(ciphertextID, plaintextID C.int) C.int {
 
 //export AddPlaintextNew
 func AddPlaintextNew(ciphertextID, plaintextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ptIn := RetrievePlaintext(int(plaintextID))
 
@@ -203,6 +527,8 @@ func AddPlaintextNew(ciphertextID, plaintextID C.int) C.int {
 
 //export SubPlaintext
 func SubPlaintext(ciphertextID, plaintextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ptIn := RetrievePlaintext(int(plaintextID))
 	scheme.Evaluator.Sub(ctIn, ptIn, ctIn)
@@ -212,6 +538,8 @@ func SubPlaintext(ciphertextID, plaintextID C.int) C.int {
 
 //export SubPlaintextNew
 func SubPlaintextNew(ciphertextID, plaintextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ptIn := RetrievePlaintext(int(plaintextID))
 
@@ -226,6 +554,8 @@ func SubPlaintextNew(ciphertextID, plaintextID C.int) C.int {
 
 //export MulPlaintext
 func MulPlaintext(ciphertextID, plaintextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ptIn := RetrievePlaintext(int(plaintextID))
 	scheme.Evaluator.Mul(ctIn, ptIn, ctIn)
@@ -235,6 +565,8 @@ func MulPlaintext(ciphertextID, plaintextID C.int) C.int {
 
 //export MulPlaintextNew
 func MulPlaintextNew(ciphertextID, plaintextID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn := RetrieveCiphertext(int(ciphertextID))
 	ptIn := RetrievePlaintext(int(plaintextID))
 
@@ -249,6 +581,8 @@ func MulPlaintextNew(ciphertextID, plaintextID C.int) C.int {
 
 //export AddCiphertext
 func AddCiphertext(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn0 := RetrieveCiphertext(int(ctID0))
 	ctIn1 := RetrieveCiphertext((int(ctID1)))
 	scheme.Evaluator.Add(ctIn0, ctIn1, ctIn0)
@@ -258,6 +592,8 @@ func AddCiphertext(ctID0, ctID1 C.int) C.int {
 
 //export AddCiphertextNew
 func AddCiphertextNew(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn0 := RetrieveCiphertext(int(ctID0))
 	ctIn1 := RetrieveCiphertext((int(ctID1)))
 
@@ -272,6 +608,8 @@ func AddCiphertextNew(ctID0, ctID1 C.int) C.int {
 
 //export SubCiphertext
 func SubCiphertext(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn0 := RetrieveCiphertext(int(ctID0))
 	ctIn1 := RetrieveCiphertext((int(ctID1)))
 	scheme.Evaluator.Sub(ctIn0, ctIn1, ctIn0)
@@ -281,6 +619,8 @@ func SubCiphertext(ctID0, ctID1 C.int) C.int {
 
 //export SubCiphertextNew
 func SubCiphertextNew(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn0 := RetrieveCiphertext(int(ctID0))
 	ctIn1 := RetrieveCiphertext((int(ctID1)))
 
@@ -295,6 +635,8 @@ func SubCiphertextNew(ctID0, ctID1 C.int) C.int {
 
 //export MulRelinCiphertext
 func MulRelinCiphertext(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn0 := RetrieveCiphertext(int(ctID0))
 	ctIn1 := RetrieveCiphertext((int(ctID1)))
 	scheme.Evaluator.MulRelin(ctIn0, ctIn1, ctIn0)
@@ -304,6 +646,8 @@ func MulRelinCiphertext(ctID0, ctID1 C.int) C.int {
 
 //export MulRelinCiphertextNew
 func MulRelinCiphertextNew(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+
 	ctIn0 := RetrieveCiphertext(int(ctID0))
 	ctIn1 := RetrieveCiphertext((int(ctID1)))
 
@@ -316,7 +660,90 @@ func MulRelinCiphertextNew(ctID0, ctID1 C.int) C.int {
 	return C.int(idx)
 }
 
-func DeleteRotationKeys() {
-	liveRotKeys = make(map[uint64]*rlwe.GaloisKey)
-	savedRotKeys = []uint64{}
+// MulCiphertexts multiplies two ciphertexts, relinearizes and rescales the
+// product. Inputs at different levels are multiplied at the lower one, so
+// the result ends up one rescale below min(level(a), level(b)). Returns
+// the ID of the product, or -1 with the last error set.
+//
+//export MulCiphertexts
+func MulCiphertexts(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+
+	ctIn0 := RetrieveCiphertext(int(ctID0))
+	ctIn1 := RetrieveCiphertext(int(ctID1))
+
+	level := min(ctIn0.Level(), ctIn1.Level())
+	if level < scheme.Params.LevelsConsumedPerRescaling() {
+		SetLastError(fmt.Errorf(
+			"cannot multiply ciphertexts at levels %d and %d: "+
+				"no level left to rescale the product",
+			ctIn0.Level(), ctIn1.Level()))
+		return -1
+	}
+
+	ctOut, err := scheme.Evaluator.MulRelinNew(ctIn0, ctIn1)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+// MulPlaintextData multiplies a ciphertext by the given values and
+// rescales. The values are encoded at the ciphertext's level with a scale
+// equal to the modulus dropped by the rescale, so the product keeps the
+// ciphertext's scale and lands exactly one level lower. Returns the ID of
+// the product, or -1 with the last error set.
+//
+//export MulPlaintextData
+func MulPlaintextData(ciphertextID C.int, valuesPtr *C.float, lenValues C.int) C.int {
+	scheme := activeScheme.Load()
+
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	level := ctIn.Level()
+	if level < scheme.Params.LevelsConsumedPerRescaling() {
+		SetLastError(fmt.Errorf(
+			"cannot multiply a ciphertext at level %d: "+
+				"no level left to rescale the product", level))
+		return -1
+	}
+	if int(lenValues) > scheme.Params.MaxSlots() {
+		SetLastError(fmt.Errorf(
+			"cannot encode %d values into %d slots",
+			int(lenValues), scheme.Params.MaxSlots()))
+		return -1
+	}
+
+	values := CArrayToSlice(valuesPtr, lenValues, convertCFloatToFloat)
+	plaintext := ckks.NewPlaintext(*scheme.Params, level)
+	plaintext.Scale = rlwe.NewScale(scheme.Params.Q()[level])
+	if err := scheme.Encoder.Encode(values, plaintext); err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	ctOut, err := scheme.Evaluator.MulNew(ctIn, plaintext)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func deleteRotationKeys(scheme *Scheme) {
+	scheme.LiveRotKeys = make(map[uint64]*rlwe.GaloisKey)
+	scheme.SavedRotKeys = []uint64{}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/cmplx"
+	"math/rand/v2"
+	"runtime"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+)
+
+// generatePo2RotationKeysSerially generates the keys AddPo2RotationKeys
+// does, one after the other with the scheme's key generator.
+func generatePo2RotationKeysSerially(scheme *Scheme) map[uint64]*rlwe.GaloisKey {
+	rotKeys := map[uint64]*rlwe.GaloisKey{}
+	for i := 1; i < scheme.Params.MaxSlots(); i *= 2 {
+		galEl := scheme.Params.GaloisElement(i)
+		rotKeys[galEl] = galoisKeyGenerator(scheme, galEl, scheme.KeyGen).
+			GenGaloisKeyNew(galEl, scheme.SecretKey)
+	}
+	return rotKeys
+}
+
+// Generating the power-of-two rotation keys concurrently yields the same
+// keys as generating them serially. Seeding makes the keys deterministic,
+// so that they can be compared bit for bit.
+func TestAddPo2RotationKeysMatchesSerial(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	scheme := newSeededTestScheme(t, testParams, []byte("po2 rotation keys"))
+
+	serial := generatePo2RotationKeysSerially(scheme)
+	if len(scheme.LiveRotKeys) != len(serial) {
+		t.Fatalf("got %d live rotation keys, want %d",
+			len(scheme.LiveRotKeys), len(serial))
+	}
+	for galEl, want := range serial {
+		got, ok := scheme.LiveRotKeys[galEl]
+		if !ok {
+			t.Fatalf("no live rotation key for Galois element %d", galEl)
+		}
+		gotData, err := got.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantData, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("rotation keys for Galois element %d differ", galEl)
+		}
+	}
+}
+
+// The power-of-two rotation keys are generated at startup, which for
+// large rings takes long enough to be worth spreading over every core.
+func BenchmarkAddPo2RotationKeys(b *testing.B) {
+	lit := testParams
+	lit.LogN = 15
+	scheme := newTestScheme(b, lit)
+
+	b.Run("serial", func(b *testing.B) {
+		for range b.N {
+			generatePo2RotationKeysSerially(scheme)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		for range b.N {
+			clear(scheme.LiveRotKeys)
+			AddPo2RotationKeys(scheme)
+		}
+	})
+}
+
+// Multiplying by a constant costs one level whether or not the constant
+// is a Gaussian integer, which Lattigo does not scale up.
+func TestMulConstantAndRescale(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(35, 36))
+	slots := scheme.Params.MaxSlots()
+	x := make([]complex128, slots)
+	for i, re := range randomValues(rng, slots) {
+		x[i] = complex(re, 2*rng.Float64()-1)
+	}
+
+	for _, constant := range []complex128{0.5, -0.125, 1, 2, -3, 2i, 1 - 1i, 0.25 + 0.5i} {
+		ctID := encryptValues(t, scheme, x, testMaxLevel)
+		ct := RetrieveCiphertext(ctID)
+		if err := mulConstantAndRescale(scheme, ct, constant); err != nil {
+			t.Fatal(err)
+		}
+		if ct.Level() != testMaxLevel-1 {
+			t.Errorf("x * %g is at level %d, want %d", constant, ct.Level(), testMaxLevel-1)
+		}
+
+		got := make([]complex128, slots)
+		if err := scheme.Encoder.Decode(scheme.Decryptor.DecryptNew(ct), got); err != nil {
+			t.Fatal(err)
+		}
+		maxErr := 0.0
+		for i := range got {
+			maxErr = math.Max(maxErr, cmplx.Abs(got[i]-constant*x[i]))
+		}
+		if maxErr > 1e-6 {
+			t.Errorf("x * %g differs from the expected one by up to %g", constant, maxErr)
+		}
+	}
+}
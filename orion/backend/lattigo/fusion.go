@@ -0,0 +1,185 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
+	"github.com/baahl-nyu/lattigo/v6/ring"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+	"github.com/baahl-nyu/lattigo/v6/utils"
+)
+
+// FuseLinearTransforms composes two transforms into a new one that applies
+// first and then second, so back-to-back linear layers cost one level and
+// one set of rotations rather than two. The matrices are multiplied in the
+// clear, from the diagonals recovered by decoding both transforms, which
+// must therefore be loaded. The result is generated at the level of first,
+// with the given BSGS ratio and pruning threshold; its rotation keys are
+// not generated. Returns the new transform's handle, or -1 with the last
+// error set.
+//
+//export FuseLinearTransforms
+func FuseLinearTransforms(
+	firstID, secondID C.int,
+	bsgsRatio C.float,
+	pruneThreshold C.float,
+) C.int {
+	scheme := activeScheme.Load()
+
+	first := RetrieveLinearTransform(int(firstID))
+	second := RetrieveLinearTransform(int(secondID))
+
+	var id C.int
+	var err error
+	if scheme.Params.RingType() == ring.Standard {
+		id, err = fuseLinearTransforms[complex128](
+			scheme, first, second, float64(bsgsRatio), float64(pruneThreshold))
+	} else {
+		id, err = fuseLinearTransforms[float64](
+			scheme, first, second, float64(bsgsRatio), float64(pruneThreshold))
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf(
+			"cannot fuse transforms %d and %d: %w", int(firstID), int(secondID), err))
+		return -1
+	}
+	return id
+}
+
+func fuseLinearTransforms[T float64 | complex128](
+	scheme *Scheme,
+	first, second lintrans.LinearTransformation,
+	bsgsRatio, pruneThreshold float64,
+) (C.int, error) {
+	if first.LogDimensions != second.LogDimensions {
+		return -1, fmt.Errorf("transforms act on different slot layouts")
+	}
+
+	inner, err := transformDiagonals[T](scheme, first)
+	if err != nil {
+		return -1, fmt.Errorf("first transform: %w", err)
+	}
+	outer, err := transformDiagonals[T](scheme, second)
+	if err != nil {
+		return -1, fmt.Errorf("second transform: %w", err)
+	}
+
+	fused := composeDiagonals(outer, inner, 1<<first.LogDimensions.Cols)
+	return newLinearTransform(
+		scheme, fused, C.int(first.LevelQ), bsgsRatio, pruneThreshold, "none"), nil
+}
+
+// TransposeLinearTransform returns a new transform computing the transpose
+// of an existing one, as needed to backpropagate through a linear layer.
+// Its diagonals are derived from those of the transform, which must be
+// loaded, and it is generated at the same level with the given BSGS ratio
+// and pruning threshold. Its rotations are the inverses of the transform's,
+// and their keys are not generated. Returns the new transform's handle, or
+// -1 with the last error set.
+//
+//export TransposeLinearTransform
+func TransposeLinearTransform(
+	transformID C.int,
+	bsgsRatio C.float,
+	pruneThreshold C.float,
+) C.int {
+	scheme := activeScheme.Load()
+
+	transform := RetrieveLinearTransform(int(transformID))
+
+	var id C.int
+	var err error
+	if scheme.Params.RingType() == ring.Standard {
+		id, err = transposeLinearTransform[complex128](
+			scheme, transform, float64(bsgsRatio), float64(pruneThreshold))
+	} else {
+		id, err = transposeLinearTransform[float64](
+			scheme, transform, float64(bsgsRatio), float64(pruneThreshold))
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot transpose transform %d: %w", int(transformID), err))
+		return -1
+	}
+	return id
+}
+
+// transposeLinearTransform generates the transpose of transform. Diagonal
+// k holds the entries M[i][i+k], which lie on diagonal -k of the
+// transpose at row i+k, so that diagonal is diagonal k rotated by -k.
+func transposeLinearTransform[T float64 | complex128](
+	scheme *Scheme,
+	transform lintrans.LinearTransformation,
+	bsgsRatio, pruneThreshold float64,
+) (C.int, error) {
+	diagonals, err := transformDiagonals[T](scheme, transform)
+	if err != nil {
+		return -1, err
+	}
+
+	slots := 1 << transform.LogDimensions.Cols
+	transposed := make(lintrans.Diagonals[T], len(diagonals))
+	for k, diag := range diagonals {
+		transposed[(slots-k)&(slots-1)] = utils.RotateSlice(diag, -k)
+	}
+	return newLinearTransform(
+		scheme, transposed, C.int(transform.LevelQ),
+		bsgsRatio, pruneThreshold, "none"), nil
+}
+
+// transformDiagonals recovers the diagonals a transform was encoded from,
+// undoing the baby-step rotations of BSGS. They come back with the small
+// error of decoding at the transform's scale.
+func transformDiagonals[T float64 | complex128](
+	scheme *Scheme,
+	transform lintrans.LinearTransformation,
+) (lintrans.Diagonals[T], error) {
+	slots := 1 << transform.LogDimensions.Cols
+	ringQ := scheme.Params.RingQ().AtLevel(transform.LevelQ)
+
+	rots := encodingRotations(transform)
+
+	diagonals := make(lintrans.Diagonals[T], len(transform.Vec))
+	for idx, poly := range transform.Vec {
+		if poly.Q.Coeffs == nil {
+			return nil, fmt.Errorf("diagonal %d is not loaded", idx)
+		}
+
+		pt := ckks.NewPlaintext(*scheme.Params, transform.LevelQ)
+		*pt.MetaData = *transform.MetaData
+		pt.Value.CopyLvl(transform.LevelQ, poly.Q)
+		if pt.IsMontgomery {
+			ringQ.IMForm(pt.Value, pt.Value)
+			pt.IsMontgomery = false
+		}
+
+		values := make([]T, slots)
+		if err := scheme.Encoder.Decode(pt, values); err != nil {
+			return nil, fmt.Errorf("diagonal %d: %w", idx, err)
+		}
+		diagonals[idx] = utils.RotateSlice(values, rots[idx])
+	}
+	return diagonals, nil
+}
+
+// composeDiagonals returns the diagonals of the matrix product outer *
+// inner. Since a transform computes the sum over k of d_k * rot(x, k),
+// diagonal a of outer and b of inner contribute d_a * rot(d_b, a) to
+// diagonal a + b of the product.
+func composeDiagonals[T float64 | complex128](
+	outer, inner lintrans.Diagonals[T], slots int,
+) lintrans.Diagonals[T] {
+	fused := make(lintrans.Diagonals[T])
+	for a, outerDiag := range outer {
+		for b, innerDiag := range inner {
+			k := (a + b) & (slots - 1)
+			if _, ok := fused[k]; !ok {
+				fused[k] = make([]T, slots)
+			}
+			for i := range slots {
+				fused[k][i] += outerDiag[i] * innerDiag[(i+a)&(slots-1)]
+			}
+		}
+	}
+	return fused
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// randomDiagonals returns random diagonals at the given indices.
+func randomDiagonals(rng *rand.Rand, idxs []int, slots int) map[int][]float64 {
+	diags := map[int][]float64{}
+	for _, k := range idxs {
+		diags[k] = randomValues(rng, slots)
+	}
+	return diags
+}
+
+// evaluateTransform applies a transform to a ciphertext and returns the
+// decrypted output.
+func evaluateTransform(tb testing.TB, scheme *Scheme, transformID, ctID int) []float64 {
+	tb.Helper()
+
+	outIDs, err := evaluateLinearTransforms(scheme, []int{transformID}, []int{ctID}, nil, 1, true)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return decryptValues(tb, scheme, outIDs[0])
+}
+
+// A fused transform computes in one level what its two transforms do one
+// after the other.
+func TestFuseLinearTransforms(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(37, 38))
+	slots := scheme.Params.MaxSlots()
+
+	firstDiags := randomDiagonals(rng, []int{0, 1, 5, slots - 2}, slots)
+	secondDiags := randomDiagonals(rng, []int{0, 3, 64}, slots)
+	first := newTestTransform(t, scheme, firstDiags, testMaxLevel)
+	second := newTestTransform(t, scheme, secondDiags, testMaxLevel-1)
+
+	fusedID, err := fuseLinearTransforms[complex128](
+		scheme, RetrieveLinearTransform(first), RetrieveLinearTransform(second), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fused := int(fusedID)
+	generateRotationKeys(scheme, fused)
+
+	x := randomValues(rng, slots)
+	ctID := encryptValues(t, scheme, x, testMaxLevel)
+	outIDs, err := evaluateLinearTransforms(scheme, []int{first}, []int{ctID}, nil, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	separate := evaluateTransform(t, scheme, second, outIDs[0])
+	together := evaluateTransform(t, scheme, fused, ctID)
+
+	want := applyDiagonals(secondDiags, applyDiagonals(firstDiags, x))
+	if err := maxError(separate, together); err > 1e-5 {
+		t.Errorf("fused output differs from the separate one by up to %g", err)
+	}
+	if err := maxError(want, together); err > 1e-5 {
+		t.Errorf("fused output differs from the expected one by up to %g", err)
+	}
+	if level := RetrieveLinearTransform(fused).LevelQ; level != testMaxLevel {
+		t.Errorf("fused transform is at level %d, want %d", level, testMaxLevel)
+	}
+}
+
+// The transpose of a transform computes M^T x for the matrix M the
+// transform applies, and transposing it back computes M x again.
+func TestTransposeLinearTransform(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(39, 40))
+	slots := scheme.Params.MaxSlots()
+
+	diags := randomDiagonals(rng, []int{0, 1, 7, 100, slots - 3}, slots)
+	transformID := newTestTransform(t, scheme, diags, testMaxLevel)
+
+	transpose := func(id int) int {
+		transposed, err := transposeLinearTransform[complex128](
+			scheme, RetrieveLinearTransform(id), 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		generateRotationKeys(scheme, int(transposed))
+		return int(transposed)
+	}
+	transposedID := transpose(transformID)
+	twiceID := transpose(transposedID)
+
+	// Diagonal k holds M[i][i+k], which multiplies x[i] into (M^T x)[i+k].
+	x := randomValues(rng, slots)
+	want := make([]float64, slots)
+	for k, diag := range diags {
+		for i := range slots {
+			want[(i+k)%slots] += diag[i] * x[i]
+		}
+	}
+
+	ctID := encryptValues(t, scheme, x, testMaxLevel)
+	if err := maxError(want, evaluateTransform(t, scheme, transposedID, ctID)); err > 1e-5 {
+		t.Errorf("transposed output differs from the expected one by up to %g", err)
+	}
+	original := evaluateTransform(t, scheme, transformID, ctID)
+	if err := maxError(original, evaluateTransform(t, scheme, twiceID, ctID)); err > 1e-5 {
+		t.Errorf("transposing twice changes the output by up to %g", err)
+	}
+}
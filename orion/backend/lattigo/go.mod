@@ -2,7 +2,10 @@ module github.com/baahl-nyu/orion
 
 go 1.23.0
 
-require github.com/baahl-nyu/lattigo/v6 v6.2.0
+require (
+	github.com/baahl-nyu/lattigo/v6 v6.2.0
+	golang.org/x/crypto v0.31.0
+)
 
 require (
 	github.com/ALTree/bigfloat v0.0.0-20220102081255-38c8b72a9924 // indirect
@@ -11,7 +14,6 @@ require (
 	github.com/kr/text v0.2.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.8.0 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"C"
+
+	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// heapStatsSampleSize is the number of objects per heap whose size is
+// measured when estimating memory. The total is extrapolated from them.
+const heapStatsSampleSize = 32
+
+// estimateHeapBytes extrapolates the memory held by a heap from the sizes
+// of (at most) heapStatsSampleSize of its objects.
+func estimateHeapBytes(ha *HeapAllocator, sizeOf func(interface{}) int) uint64 {
+	ids := ha.GetLiveKeys()
+	if len(ids) == 0 {
+		return 0
+	}
+
+	sample := ids[:min(len(ids), heapStatsSampleSize)]
+	total := 0
+	for _, id := range sample {
+		total += sizeOf(ha.Retrieve(id))
+	}
+
+	return uint64(total) * uint64(len(ids)) / uint64(len(sample))
+}
+
+func linearTransformSize(obj interface{}) (size int) {
+	for _, diag := range obj.(lintrans.LinearTransformation).Vec {
+		size += diag.BinarySize()
+	}
+	return
+}
+
+func ciphertextSize(obj interface{}) int {
+	return obj.(*rlwe.Ciphertext).BinarySize()
+}
+
+func plaintextSize(obj interface{}) int {
+	return obj.(*rlwe.Plaintext).BinarySize()
+}
+
+func polynomialSize(obj interface{}) (size int) {
+	for _, coeff := range obj.(bignum.Polynomial).Coeffs {
+		if coeff == nil {
+			continue
+		}
+		for _, part := range coeff {
+			size += int(part.Prec()+7) / 8
+		}
+	}
+	return
+}
+
+// GetHeapStats returns the number of live objects in the linear transform,
+// ciphertext, plaintext and polynomial heaps (in that order). When
+// estimateSizes is non-zero, the estimated bytes held by each heap follow
+// in the same order. Sizes are extrapolated from a sample of each heap.
+//
+//export GetHeapStats
+func GetHeapStats(estimateSizes C.int) (*C.ulong, C.ulong) {
+	heaps := []*HeapAllocator{ltHeap, ctHeap, ptHeap, polyHeap}
+	sizeFuncs := []func(interface{}) int{
+		linearTransformSize, ciphertextSize, plaintextSize, polynomialSize,
+	}
+
+	stats := make([]uint64, 0, 2*len(heaps))
+	for _, ha := range heaps {
+		stats = append(stats, uint64(ha.Len()))
+	}
+
+	if estimateSizes != 0 {
+		for i, ha := range heaps {
+			stats = append(stats, estimateHeapBytes(ha, sizeFuncs[i]))
+		}
+	}
+
+	arrPtr, length := SliceToCArray(stats, convertULongtoCULong)
+	return arrPtr, length
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/ring"
+	"github.com/baahl-nyu/lattigo/v6/schemes/bgv"
+)
+
+// IntScheme is an exact integer (BGV) context living alongside a scheme's
+// CKKS one, for workloads such as index selection or argmax
+// post-processing. It has parameters and keys of its own. Its ciphertexts
+// share the ciphertext heap, but must only be passed to the *Ints exports.
+type IntScheme struct {
+	Params    *bgv.Parameters
+	SecretKey *rlwe.SecretKey
+	Encoder   *bgv.Encoder
+	Encryptor *rlwe.Encryptor
+	Decryptor *rlwe.Decryptor
+	Evaluator *bgv.Evaluator
+}
+
+// NewIntegerScheme attaches a BGV context with plaintext modulus t to the
+// active scheme, replacing any earlier one. Returns 0, or -1 with the last
+// error set if the parameters are invalid.
+//
+//export NewIntegerScheme
+func NewIntegerScheme(
+	logN C.int,
+	logQPtr *C.int, lenQ C.int,
+	logPPtr *C.int, lenP C.int,
+	plaintextModulus C.ulong,
+	h C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             int(logN),
+		LogQ:             CArrayToSlice(logQPtr, lenQ, convertCIntToInt),
+		LogP:             CArrayToSlice(logPPtr, lenP, convertCIntToInt),
+		Xs:               ring.Ternary{H: int(h)},
+		PlaintextModulus: uint64(plaintextModulus),
+	})
+	if err != nil {
+		SetLastError(fmt.Errorf("invalid integer scheme parameters: %w", err))
+		return -1
+	}
+
+	deleteIntegerScheme(scheme)
+
+	keyGen := bgv.NewKeyGenerator(params)
+	sk, pk := keyGen.GenKeyPairNew()
+	rlk := keyGen.GenRelinearizationKeyNew(sk)
+
+	scheme.Int = &IntScheme{
+		Params:    &params,
+		SecretKey: sk,
+		Encoder:   bgv.NewEncoder(params),
+		Encryptor: bgv.NewEncryptor(params, pk),
+		Decryptor: bgv.NewDecryptor(params, sk),
+		Evaluator: bgv.NewEvaluator(params, rlwe.NewMemEvaluationKeySet(rlk)),
+	}
+	return 0
+}
+
+// deleteIntegerScheme zeroes the integer secret key and drops the context.
+func deleteIntegerScheme(scheme *Scheme) {
+	if scheme.Int == nil {
+		return
+	}
+	scheme.Int.SecretKey.Value.Q.Zero()
+	scheme.Int.SecretKey.Value.P.Zero()
+	scheme.Int = nil
+}
+
+//export GetIntegerSlots
+func GetIntegerSlots() C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil || scheme.Int == nil {
+		return -1
+	}
+	return C.int(scheme.Int.Params.MaxSlots())
+}
+
+// EncryptInts encodes the values (reduced mod t) at the top level and
+// encrypts them. Returns the ciphertext ID, or -1 with the last error set.
+//
+//export EncryptInts
+func EncryptInts(valuesPtr *C.ulong, lenValues C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if scheme.Int == nil {
+		SetLastError(fmt.Errorf("no integer scheme: call NewIntegerScheme first"))
+		return -1
+	}
+	ints := scheme.Int
+	if int(lenValues) > ints.Params.MaxSlots() {
+		SetLastError(fmt.Errorf(
+			"cannot encode %d values into %d slots",
+			int(lenValues), ints.Params.MaxSlots()))
+		return -1
+	}
+
+	values := CArrayToSlice(valuesPtr, lenValues, func(v C.ulong) uint64 {
+		return uint64(v)
+	})
+	plaintext := bgv.NewPlaintext(*ints.Params, ints.Params.MaxLevel())
+	if err := ints.Encoder.Encode(values, plaintext); err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	ciphertext := bgv.NewCiphertext(*ints.Params, 1, plaintext.Level())
+	if err := ints.Encryptor.Encrypt(plaintext, ciphertext); err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ciphertext)
+	return C.int(idx)
+}
+
+// DecryptInts decrypts an integer ciphertext into its slot values mod t.
+// Returns an empty array with the last error set on failure.
+//
+//export DecryptInts
+func DecryptInts(ciphertextID C.int) (*C.ulong, C.ulong) {
+	scheme := activeScheme.Load()
+
+	if scheme.Int == nil {
+		SetLastError(fmt.Errorf("no integer scheme: call NewIntegerScheme first"))
+		return nil, 0
+	}
+	ints := scheme.Int
+
+	ciphertext := RetrieveCiphertext(int(ciphertextID))
+	plaintext := bgv.NewPlaintext(*ints.Params, ciphertext.Level())
+	ints.Decryptor.Decrypt(ciphertext, plaintext)
+
+	values := make([]uint64, ints.Params.MaxSlots())
+	if err := ints.Encoder.Decode(plaintext, values); err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	arrPtr, length := SliceToCArray(values, convertULongtoCULong)
+	return arrPtr, length
+}
+
+//export AddInts
+func AddInts(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+	return evaluateInts(scheme, ctID0, ctID1, func(eval *bgv.Evaluator, ct0, ct1 *rlwe.Ciphertext) (*rlwe.Ciphertext, error) {
+		return eval.AddNew(ct0, ct1)
+	})
+}
+
+//export SubInts
+func SubInts(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+	return evaluateInts(scheme, ctID0, ctID1, func(eval *bgv.Evaluator, ct0, ct1 *rlwe.Ciphertext) (*rlwe.Ciphertext, error) {
+		return eval.SubNew(ct0, ct1)
+	})
+}
+
+// MulInts multiplies two integer ciphertexts, relinearizes and rescales
+// the product to keep the noise in check.
+//
+//export MulInts
+func MulInts(ctID0, ctID1 C.int) C.int {
+	scheme := activeScheme.Load()
+
+	return evaluateInts(scheme, ctID0, ctID1, func(eval *bgv.Evaluator, ct0, ct1 *rlwe.Ciphertext) (*rlwe.Ciphertext, error) {
+		ctOut, err := eval.MulRelinNew(ct0, ct1)
+		if err != nil {
+			return nil, err
+		}
+		if ctOut.Level() == 0 {
+			return ctOut, nil
+		}
+		return ctOut, eval.Rescale(ctOut, ctOut)
+	})
+}
+
+// evaluateInts applies a binary integer operation and pushes the result.
+// Returns its ID, or -1 with the last error set.
+func evaluateInts(
+	scheme *Scheme,
+	ctID0, ctID1 C.int,
+	op func(*bgv.Evaluator, *rlwe.Ciphertext, *rlwe.Ciphertext) (*rlwe.Ciphertext, error),
+) C.int {
+	if scheme.Int == nil {
+		SetLastError(fmt.Errorf("no integer scheme: call NewIntegerScheme first"))
+		return -1
+	}
+
+	ctOut, err := op(
+		scheme.Int.Evaluator,
+		RetrieveCiphertext(int(ctID0)),
+		RetrieveCiphertext(int(ctID1)))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
@@ -4,55 +4,372 @@ import (
 	"C"
 
 	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
 )
 import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
 	"unsafe"
+
+	"github.com/baahl-nyu/lattigo/v6/utils/sampling"
 )
 
 //export NewKeyGenerator
 func NewKeyGenerator() {
-	scheme.KeyGen = rlwe.NewKeyGenerator(scheme.Params)
+	scheme := activeScheme.Load()
+	scheme.KeyGen = newKeyGenerator(scheme, "keygen")
+}
+
+// seededPRNG returns a PRNG keyed by the scheme's seed and label, so that
+// every consumer of randomness on a seeded scheme gets its own stream.
+func seededPRNG(scheme *Scheme, label string) sampling.PRNG {
+	key := sha256.Sum256(append(slices.Clone(scheme.Seed), label...))
+	prng, err := sampling.NewKeyedPRNG(key[:])
+	if err != nil {
+		panic(err)
+	}
+	return prng
+}
+
+// newKeyGenerator returns a key generator, drawing its randomness from the
+// label's stream when the scheme is seeded.
+func newKeyGenerator(scheme *Scheme, label string) *rlwe.KeyGenerator {
+	keyGen := rlwe.NewKeyGenerator(scheme.Params)
+	if scheme.Seed != nil {
+		keyGen.Encryptor = rlwe.NewTestEncryptorWithPRNG(
+			scheme.Params, nil, seededPRNG(scheme, label))
+	}
+	return keyGen
 }
 
+// galoisKeyGenerator returns the key generator for the Galois key of
+// galEl. On a seeded scheme every key gets a generator of its own, so the
+// keys don't depend on the order (or worker) they were generated in.
+func galoisKeyGenerator(scheme *Scheme, galEl uint64, keyGen *rlwe.KeyGenerator) *rlwe.KeyGenerator {
+	if scheme.Seed == nil {
+		return keyGen
+	}
+	return newKeyGenerator(scheme, fmt.Sprintf("galois/%d", galEl))
+}
+
+// GenerateSecretKey returns 0, or -1 with the last error set if the scheme
+// is evaluator-only.
+//
 //export GenerateSecretKey
-func GenerateSecretKey() {
+func GenerateSecretKey() C.int {
+	scheme := activeScheme.Load()
+
+	if err := checkSecretKeyAllowed(scheme); err != nil {
+		SetLastError(fmt.Errorf("cannot generate secret key: %w", err))
+		return -1
+	}
 	scheme.SecretKey = scheme.KeyGen.GenSecretKeyNew()
+
+	// A fresh key may be about to overwrite a keys file whose rotation
+	// keys are still cached.
+	ClearKeyCache()
+	return 0
+}
+
+// checkSecretKeyParams checks that a secret key was made under the active
+// scheme's ring degree and modulus chain.
+func checkSecretKeyParams(scheme *Scheme, sk *rlwe.SecretKey) error {
+	if sk.Value.Q.N() != scheme.Params.N() ||
+		sk.Value.Q.Level() != scheme.Params.MaxLevelQ() {
+		return fmt.Errorf(
+			"key has ring degree %d and level %d, but the scheme expects "+
+				"%d and %d", sk.Value.Q.N(), sk.Value.Q.Level(),
+			scheme.Params.N(), scheme.Params.MaxLevelQ())
+	}
+	return nil
+}
+
+// checkSecretKeyAllowed refuses secret key material when there is no
+// active scheme, and on evaluator-only schemes.
+func checkSecretKeyAllowed(scheme *Scheme) error {
+	if scheme == nil {
+		return fmt.Errorf("no active scheme")
+	}
+	if scheme.EvaluatorOnly {
+		return fmt.Errorf("scheme %d is evaluator-only", scheme.ID)
+	}
+	return nil
 }
 
 //export GeneratePublicKey
 func GeneratePublicKey() {
+	generatePublicKey(activeScheme.Load())
+}
+
+func generatePublicKey(scheme *Scheme) {
 	scheme.PublicKey = scheme.KeyGen.GenPublicKeyNew(scheme.SecretKey)
 }
 
 //export GenerateRelinearizationKey
 func GenerateRelinearizationKey() {
+	generateRelinearizationKey(activeScheme.Load())
+}
+
+func generateRelinearizationKey(scheme *Scheme) {
 	scheme.RelinKey = scheme.KeyGen.GenRelinearizationKeyNew(scheme.SecretKey)
 }
 
 //export GenerateEvaluationKeys
 func GenerateEvaluationKeys() {
+	generateEvaluationKeys(activeScheme.Load())
+}
+
+func generateEvaluationKeys(scheme *Scheme) {
 	scheme.EvalKeys = rlwe.NewMemEvaluationKeySet(scheme.RelinKey)
 }
 
 //export SerializeSecretKey
 func SerializeSecretKey() (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
 	data, err := scheme.SecretKey.MarshalBinary()
 	if err != nil {
 		panic(err)
 	}
 
+	// The C array is a copy, so our Go-side serialization can be wiped.
 	arrPtr, length := SliceToCArray(data, convertByteToCChar)
+	clear(data)
 	return arrPtr, length
 }
 
+// LoadSecretKey installs a serialized secret key. Returns 0 on success and
+// -1 with the last error set if the data cannot be unmarshaled.
+//
 //export LoadSecretKey
-func LoadSecretKey(dataPtr *C.char, lenData C.ulong) {
+func LoadSecretKey(dataPtr *C.char, lenData C.ulong) C.int {
+	scheme := activeScheme.Load()
+
 	skSerial := CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData))
+	if err := checkSecretKeyAllowed(scheme); err != nil {
+		clear(skSerial)
+		SetLastError(fmt.Errorf("cannot load secret key: %w", err))
+		return -1
+	}
 
 	sk := &rlwe.SecretKey{}
-	if err := sk.UnmarshalBinary(skSerial); err != nil {
-		panic(err)
+	err := sk.UnmarshalBinary(skSerial)
+
+	// skSerial aliases the caller's buffer, which we no longer need.
+	clear(skSerial)
+
+	if err == nil {
+		err = checkSecretKeyParams(scheme, sk)
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot load secret key: %w", err))
+		return -1
 	}
 
 	scheme.SecretKey = sk
+	logInfo("loaded secret key (%d bytes)", int(lenData))
+	return 0
+}
+
+// LoadSecretKeyFromBytes installs a marshaled secret key into the active
+// scheme, e.g. one handed over by a secrets manager, and regenerates every
+// key derived from it: the public, relinearization and live rotation keys.
+// Bootstrappers built from the previous key are dropped. The input buffer
+// is zeroed once it has been read. Returns 0 on success and -1 with the
+// last error set otherwise.
+//
+//export LoadSecretKeyFromBytes
+func LoadSecretKeyFromBytes(dataPtr *C.char, lenData C.int) C.int {
+	scheme := activeScheme.Load()
+
+	skSerial := CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData))
+	if err := checkSecretKeyAllowed(scheme); err != nil {
+		clear(skSerial)
+		SetLastError(fmt.Errorf("cannot load secret key: %w", err))
+		return -1
+	}
+
+	sk := &rlwe.SecretKey{}
+	err := sk.UnmarshalBinary(skSerial)
+	clear(skSerial)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot load secret key: %w", err))
+		return -1
+	}
+
+	if err := checkSecretKeyParams(scheme, sk); err != nil {
+		SetLastError(fmt.Errorf("cannot load secret key: %w", err))
+		return -1
+	}
+
+	installSecretKey(scheme, sk)
+	return 0
+}
+
+// RefreshSecretKey replaces the secret key with a freshly generated one,
+// for periodic key rotation. Every live ciphertext is key-switched to the
+// new key, and the other keys are re-derived as in LoadSecretKeyFromBytes.
+// Rotation keys saved to disk are not, so they must be generated again.
+// This is refused while an integer scheme is attached, since its
+// ciphertexts share the heap but not the key. Returns 0, or -1 with the
+// last error set.
+//
+//export RefreshSecretKey
+func RefreshSecretKey() C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil || scheme.SecretKey == nil {
+		SetLastError(fmt.Errorf("cannot refresh secret key: no active secret key"))
+		return -1
+	}
+	if scheme.Int != nil {
+		SetLastError(fmt.Errorf(
+			"cannot refresh secret key while an integer scheme is attached"))
+		return -1
+	}
+
+	sk := scheme.KeyGen.GenSecretKeyNew()
+	evk := scheme.KeyGen.GenEvaluationKeyNew(scheme.SecretKey, sk)
+	eval := ckks.NewEvaluator(*scheme.Params, nil)
+
+	// Switch every ciphertext before touching any, so a failure leaves
+	// the heap as it was.
+	ids := ctHeap.GetLiveKeys()
+	switched := make([]*rlwe.Ciphertext, len(ids))
+	for i, id := range ids {
+		ct, err := eval.ApplyEvaluationKeyNew(RetrieveCiphertext(id), evk)
+		if err != nil {
+			SetLastError(fmt.Errorf(
+				"cannot refresh secret key: ciphertext %d: %w", id, err))
+			return -1
+		}
+		switched[i] = ct
+	}
+	for i, id := range ids {
+		RetrieveCiphertext(id).Copy(switched[i])
+	}
+
+	installSecretKey(scheme, sk)
+	return 0
+}
+
+// installSecretKey replaces the scheme's secret key and re-derives
+// its public, relinearization and live rotation keys, along with the
+// encryptor, decryptor and evaluators that depend on them. Bootstrappers
+// built from the previous key are dropped.
+func installSecretKey(scheme *Scheme, sk *rlwe.SecretKey) {
+	liveGalEls := GetKeysFromMap(scheme.LiveRotKeys)
+
+	zeroizeSecretKey(scheme)
+	scheme.SecretKey = sk
+	ClearKeyCache()
+
+	generatePublicKey(scheme)
+	generateRelinearizationKey(scheme)
+	generateEvaluationKeys(scheme)
+
+	if scheme.Encryptor != nil {
+		newEncryptor(scheme)
+	}
+	newDecryptor(scheme)
+
+	if scheme.Evaluator != nil {
+		scheme.LiveRotKeys = make(map[uint64]*rlwe.GaloisKey)
+		scheme.Evaluator = ckks.NewEvaluator(
+			*scheme.Params, rlwe.NewMemEvaluationKeySet(scheme.RelinKey))
+
+		for _, galEl := range liveGalEls {
+			scheme.LiveRotKeys[galEl] = galoisKeyGenerator(scheme, galEl, scheme.KeyGen).
+				GenGaloisKeyNew(galEl, scheme.SecretKey)
+		}
+		keys := rlwe.NewMemEvaluationKeySet(
+			scheme.RelinKey, GetValuesFromMap(scheme.LiveRotKeys)...)
+		scheme.Evaluator = scheme.Evaluator.WithKey(keys)
+
+		if scheme.PolyEvaluator != nil {
+			newPolynomialEvaluator(scheme)
+		}
+		if scheme.LinEvaluator != nil {
+			newLinearTransformEvaluator(scheme)
+		}
+	}
+
+	deleteBootstrappers(scheme)
+}
+
+// zeroizeSecretKey overwrites the coefficients of the scheme's secret
+// key and drops every reference to it, including the decryptor.
+// This is best effort: the Go runtime may already have copied the key
+// elsewhere (e.g. while growing a stack), but it keeps the key's main
+// buffers from lingering in freed memory until they are reused.
+func zeroizeSecretKey(scheme *Scheme) {
+	if scheme.SecretKey != nil {
+		scheme.SecretKey.Value.Q.Zero()
+		scheme.SecretKey.Value.P.Zero()
+	}
+	scheme.SecretKey = nil
+	scheme.Decryptor = nil
+}
+
+//export ZeroizeSecretKey
+func ZeroizeSecretKey() {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return
+	}
+	zeroizeSecretKey(scheme)
+}
+
+//export SerializePublicKey
+func SerializePublicKey() (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	data, err := scheme.PublicKey.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	arrPtr, length := SliceToCArray(data, convertByteToCChar)
+	return arrPtr, length
+}
+
+//export LoadPublicKey
+func LoadPublicKey(dataPtr *C.char, lenData C.ulong) {
+	scheme := activeScheme.Load()
+
+	pkSerial := CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData))
+
+	pk := &rlwe.PublicKey{}
+	if err := pk.UnmarshalBinary(pkSerial); err != nil {
+		panic(err)
+	}
+
+	scheme.PublicKey = pk
+}
+
+//export SerializeRelinearizationKey
+func SerializeRelinearizationKey() (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	data, err := scheme.RelinKey.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	arrPtr, length := SliceToCArray(data, convertByteToCChar)
+	return arrPtr, length
+}
+
+//export LoadRelinearizationKey
+func LoadRelinearizationKey(dataPtr *C.char, lenData C.ulong) {
+	scheme := activeScheme.Load()
+
+	rlkSerial := CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData))
+
+	rlk := &rlwe.RelinearizationKey{}
+	if err := rlk.UnmarshalBinary(rlkSerial); err != nil {
+		panic(err)
+	}
+
+	scheme.RelinKey = rlk
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"C"
+	"fmt"
+	"unsafe"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+)
+
+var switchKeyHeap = NewHeapAllocator()
+
+func PushSwitchingKey(evk *rlwe.EvaluationKey) int {
+	return switchKeyHeap.Add(evk)
+}
+
+func RetrieveSwitchingKey(id int) *rlwe.EvaluationKey {
+	return switchKeyHeap.Retrieve(id).(*rlwe.EvaluationKey)
+}
+
+// GenKeySwitchingKey generates a key that switches ciphertexts from the
+// active scheme's secret key to the serialized secret key given. The new
+// key's buffer is zeroed once read. Returns the ID of the switching key,
+// or -1 with the last error set.
+//
+//export GenKeySwitchingKey
+func GenKeySwitchingKey(newSkBytesC *C.char, lenData C.int) C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil || scheme.SecretKey == nil {
+		SetLastError(fmt.Errorf(
+			"cannot generate switching key: no active secret key"))
+		return -1
+	}
+
+	skSerial := CArrayToByteSlice(unsafe.Pointer(newSkBytesC), uint64(lenData))
+
+	skOut := &rlwe.SecretKey{}
+	err := skOut.UnmarshalBinary(skSerial)
+	clear(skSerial)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot generate switching key: %w", err))
+		return -1
+	}
+
+	idx, err := genKeySwitchingKey(scheme, skOut)
+
+	// The new secret key is only needed to generate the switching key.
+	skOut.Value.Q.Zero()
+	skOut.Value.P.Zero()
+
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot generate switching key: %w", err))
+		return -1
+	}
+	return C.int(idx)
+}
+
+// genKeySwitchingKey generates the key that switches ciphertexts from the
+// scheme's secret key to skOut, and returns its ID.
+func genKeySwitchingKey(scheme *Scheme, skOut *rlwe.SecretKey) (int, error) {
+	if skOut.Value.Q.N() != scheme.Params.N() ||
+		skOut.Value.Q.Level() != scheme.Params.MaxLevelQ() {
+		return -1, fmt.Errorf(
+			"key has ring degree %d and level %d, but the scheme expects %d and %d",
+			skOut.Value.Q.N(), skOut.Value.Q.Level(),
+			scheme.Params.N(), scheme.Params.MaxLevelQ())
+	}
+
+	evk := scheme.KeyGen.GenEvaluationKeyNew(scheme.SecretKey, skOut)
+	return PushSwitchingKey(evk), nil
+}
+
+// KeySwitchCiphertext re-keys a ciphertext with a switching key from
+// GenKeySwitchingKey. The result decrypts under the new secret key to
+// the same plaintext. Returns the ID of the re-keyed ciphertext, or -1
+// with the last error set.
+//
+//export KeySwitchCiphertext
+func KeySwitchCiphertext(ctID C.int, switchKeyID C.int) C.int {
+	idx, err := keySwitchCiphertext(
+		activeScheme.Load(), int(ctID), int(switchKeyID))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	return C.int(idx)
+}
+
+func keySwitchCiphertext(scheme *Scheme, ctID, switchKeyID int) (int, error) {
+	if !switchKeyHeap.Exists(switchKeyID) {
+		return -1, fmt.Errorf("switching key %d does not exist", switchKeyID)
+	}
+	ctIn := RetrieveCiphertext(ctID)
+	evk := RetrieveSwitchingKey(switchKeyID)
+
+	ctOut, err := scheme.Evaluator.ApplyEvaluationKeyNew(ctIn, evk)
+	if err != nil {
+		return -1, err
+	}
+	return PushCiphertext(ctOut), nil
+}
+
+//export DeleteSwitchingKey
+func DeleteSwitchingKey(switchKeyID C.int) {
+	switchKeyHeap.Delete(int(switchKeyID))
+}
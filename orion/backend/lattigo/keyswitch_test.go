@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+)
+
+// A ciphertext switched to a new secret key decrypts under that key to
+// what it did under the scheme's own.
+func TestKeySwitchCiphertext(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(23, 24))
+	x := randomValues(rng, scheme.Params.MaxSlots())
+
+	skOut := scheme.KeyGen.GenSecretKeyNew()
+	switchKeyID, err := genKeySwitchingKey(scheme, skOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { switchKeyHeap.Delete(switchKeyID) })
+
+	ctID := encryptValues(t, scheme, x, testMaxLevel)
+	switchedID, err := keySwitchCiphertext(scheme, ctID, switchKeyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decryptor := ckks.NewDecryptor(*scheme.Params, skOut)
+	got := make([]float64, scheme.Params.MaxSlots())
+	plaintext := decryptor.DecryptNew(RetrieveCiphertext(switchedID))
+	if err := scheme.Encoder.Decode(plaintext, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := maxError(x, got); err > 1e-6 {
+		t.Errorf("switched ciphertext decrypts with error %g", err)
+	}
+
+	// Under the old key it no longer decrypts to the input.
+	if err := maxError(x, decryptValues(t, scheme, switchedID)); err < 1 {
+		t.Errorf("switched ciphertext still decrypts under the old key (error %g)", err)
+	}
+
+	if _, err := keySwitchCiphertext(scheme, ctID, switchKeyID+100); err == nil {
+		t.Error("switched keys with a switching key that does not exist")
+	}
+}
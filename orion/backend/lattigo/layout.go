@@ -0,0 +1,175 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
+)
+
+// Layers do not all pack their tensors the same way: convolutions work on
+// multiplexed (gap-strided) channels, while others expect dense channel-
+// or row-major data. A conversion between two packings moves every slot
+// to a new position, which is a linear transform whose matrix has a
+// single 1 per row. Its diagonals are built here from where each output
+// slot reads its value, so that Python only sends the layout.
+
+// gatherDiagonals returns the diagonals of the transform whose output slot
+// i holds input slot src[i], or 0 when src[i] is negative. Slots past the
+// end of src are zero.
+func gatherDiagonals(scheme *Scheme, src []int) (lintrans.Diagonals[float64], error) {
+	slots := scheme.Params.MaxSlots()
+	if len(src) > slots {
+		return nil, fmt.Errorf(
+			"cannot gather %d slots from %d slots", len(src), slots)
+	}
+
+	diagonals := make(lintrans.Diagonals[float64])
+	for i, j := range src {
+		if j < 0 {
+			continue
+		}
+		if j >= slots {
+			return nil, fmt.Errorf(
+				"slot %d reads slot %d, outside the %d slots", i, j, slots)
+		}
+		diag := ((j-i)%slots + slots) % slots
+		if diagonals[diag] == nil {
+			diagonals[diag] = make([]float64, slots)
+		}
+		diagonals[diag][i] = 1
+	}
+	if len(diagonals) == 0 {
+		diagonals[0] = make([]float64, slots)
+	}
+	return diagonals, nil
+}
+
+// layoutSources returns, for a named conversion between packings, the
+// input slot every output slot reads. The dimensions are c, h and w for
+// "chw_to_hwc" and "hwc_to_chw", and c, h, w and the gap for
+// "gap_to_dense" and "dense_to_gap", where the gap-strided packing is the
+// multiplexed one convolutions use: every gap x gap block of pixels holds
+// that many consecutive channels.
+func layoutSources(scheme *Scheme, layout string, dims []int) ([]int, error) {
+	wantDims := map[string]int{
+		"chw_to_hwc": 3, "hwc_to_chw": 3, "gap_to_dense": 4, "dense_to_gap": 4,
+	}
+	n, known := wantDims[layout]
+	if !known {
+		return nil, fmt.Errorf("unknown layout conversion %q", layout)
+	}
+	if len(dims) != n {
+		return nil, fmt.Errorf(
+			"layout conversion %q takes %d dimensions, got %d", layout, n, len(dims))
+	}
+	for _, d := range dims {
+		if d <= 0 {
+			return nil, fmt.Errorf("dimensions %v must be positive", dims)
+		}
+	}
+
+	c, h, w := dims[0], dims[1], dims[2]
+	chw := func(ch, y, x int) int { return (ch*h+y)*w + x }
+	hwc := func(ch, y, x int) int { return (y*w+x)*c + ch }
+	size := c * h * w
+
+	gap := 1
+	if n == 4 {
+		gap = dims[3]
+	}
+	H, W := h*gap, w*gap
+	gapped := func(ch, y, x int) int {
+		block, r, s := ch/(gap*gap), (ch%(gap*gap))/gap, ch%gap
+		return (block*H+y*gap+r)*W + x*gap + s
+	}
+	if n == 4 {
+		size = max(size, ((c+gap*gap-1)/(gap*gap))*H*W)
+	}
+
+	from, to := chw, hwc
+	switch layout {
+	case "hwc_to_chw":
+		from, to = hwc, chw
+	case "gap_to_dense":
+		from, to = gapped, chw
+	case "dense_to_gap":
+		from, to = chw, gapped
+	}
+
+	if size > scheme.Params.MaxSlots() {
+		return nil, fmt.Errorf(
+			"layout of %d slots does not fit in %d slots",
+			size, scheme.Params.MaxSlots())
+	}
+	src := make([]int, size)
+	for i := range src {
+		src[i] = -1
+	}
+	for ch := range c {
+		for y := range h {
+			for x := range w {
+				src[to(ch, y, x)] = from(ch, y, x)
+			}
+		}
+	}
+	return src, nil
+}
+
+// GenerateGatherTransform generates a transform whose output slot i holds
+// input slot src[i], or 0 where src[i] is negative. Any packing
+// conversion, including ones that duplicate slots like im2col, can be
+// expressed this way. Returns the transform's handle, or -1 with the last
+// error set.
+//
+//export GenerateGatherTransform
+func GenerateGatherTransform(
+	srcPtr *C.int, lenSrc C.int,
+	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio C.float,
+) C.int {
+	scheme := activeScheme.Load()
+	src := CArrayToSlice(srcPtr, lenSrc, convertCIntToInt)
+	return generateGatherTransform(scheme, src, level, refCiphertextID, bsgsRatio)
+}
+
+// GenerateLayoutTransform generates the transform of a named conversion
+// between packings, as described by layoutSources. Returns the transform's
+// handle, or -1 with the last error set.
+//
+//export GenerateLayoutTransform
+func GenerateLayoutTransform(
+	layoutC *C.char,
+	dimsPtr *C.int, lenDims C.int,
+	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio C.float,
+) C.int {
+	scheme := activeScheme.Load()
+
+	dims := CArrayToSlice(dimsPtr, lenDims, convertCIntToInt)
+	src, err := layoutSources(scheme, C.GoString(layoutC), dims)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	return generateGatherTransform(scheme, src, level, refCiphertextID, bsgsRatio)
+}
+
+func generateGatherTransform(
+	scheme *Scheme,
+	src []int, level, refCiphertextID C.int, bsgsRatio C.float,
+) C.int {
+	level, err := resolveTransformLevel(scheme, level, refCiphertextID)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	diagonals, err := gatherDiagonals(scheme, src)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	return newLinearTransform(scheme, diagonals, level, float64(bsgsRatio), 0, "none")
+}
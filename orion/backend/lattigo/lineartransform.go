@@ -2,18 +2,31 @@ package main
 
 import (
 	"C"
+	"fmt"
+	"maps"
 	"math"
+	"math/cmplx"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
+	commonlintrans "github.com/baahl-nyu/lattigo/v6/circuits/common/lintrans"
 	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
 	"github.com/baahl-nyu/lattigo/v6/ring"
 	"github.com/baahl-nyu/lattigo/v6/ring/ringqp"
 	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+	"github.com/baahl-nyu/lattigo/v6/utils"
 )
 
 var ltHeap = NewHeapAllocator()
 
+// zeroDiagonalEpsilon is the magnitude below which a diagonal is always
+// treated as zero, even when no pruning threshold is requested.
+const zeroDiagonalEpsilon = 1e-12
+
 func AddLinearTransform(lt lintrans.LinearTransformation) int {
 	return ltHeap.Add(lt)
 }
@@ -24,11 +37,68 @@ func RetrieveLinearTransform(id int) lintrans.LinearTransformation {
 
 //export DeleteLinearTransform
 func DeleteLinearTransform(id C.int) {
+	removeCachedDiagonals(int(id))
+	removeReencodedTransforms(int(id))
 	ltHeap.Delete(int(id))
 }
 
+// Rotation keys loaded from disk are cached for the life of the process,
+// so that evaluating the same layer again (e.g. for the next input of a
+// batch) does not read its keys back from HDF5. Entries are keyed by the
+// keys file they came from and their Galois element.
+const defaultKeyCacheBytes = 1 << 30
+
+type rotKeyCacheKey struct {
+	KeysPath string
+	GalEl    uint64
+}
+
+var rotKeyCache = NewLRUCache[rotKeyCacheKey](
+	defaultKeyCacheBytes,
+	func(key *rlwe.GaloisKey) int64 { return int64(key.BinarySize()) },
+)
+
+// Likewise, plaintext diagonals loaded from disk are cached so that a
+// transform evaluated on every input of a batch reads them only once.
+// Transform IDs are reused once freed, so a transform's entries are
+// dropped when it is deleted.
+const defaultDiagCacheBytes = 1 << 30
+
+type diagCacheKey struct {
+	TransformID int
+	DiagIdx     int
+}
+
+var diagCache = NewLRUCache[diagCacheKey](
+	defaultDiagCacheBytes,
+	func(diag ringqp.Poly) int64 { return int64(diag.BinarySize()) },
+)
+
+func removeCachedDiagonals(transformID int) {
+	if !ltHeap.Exists(transformID) {
+		return
+	}
+	for diagIdx := range RetrieveLinearTransform(transformID).Vec {
+		diagCache.Remove(diagCacheKey{transformID, diagIdx})
+	}
+}
+
+//export DeleteLinearTransforms
+func DeleteLinearTransforms(idsC *C.int, lenIDs C.int) {
+	ids := CArrayToSlice(idsC, lenIDs, convertCIntToInt)
+	for _, id := range ids {
+		removeCachedDiagonals(id)
+		removeReencodedTransforms(id)
+	}
+	ltHeap.DeleteMany(ids)
+}
+
 //export NewLinearTransformEvaluator
 func NewLinearTransformEvaluator() {
+	newLinearTransformEvaluator(activeScheme.Load())
+}
+
+func newLinearTransformEvaluator(scheme *Scheme) {
 	scheme.LinEvaluator = lintrans.NewEvaluator(
 		ckks.NewEvaluator(*scheme.Params, scheme.EvalKeys))
 }
@@ -38,50 +108,390 @@ func GenerateLinearTransform(
 	diagIdxsC *C.int, diagIdxsLen C.int,
 	diagDataC *C.float, diagDataLen C.int,
 	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio C.float,
+	pruneThreshold C.float,
+	ioModeC *C.char,
+) C.int {
+	scheme := activeScheme.Load()
+
+	return generateLinearTransform(
+		scheme, CArrayToSlice(diagIdxsC, diagIdxsLen, convertCIntToInt),
+		CArrayToSlice(diagDataC, diagDataLen, convertCFloatToFloat),
+		level, refCiphertextID, float64(bsgsRatio), float64(pruneThreshold),
+		C.GoString(ioModeC),
+	)
+}
+
+// GenerateLinearTransformF64 is GenerateLinearTransform with the diagonal
+// data passed as doubles, so weights reach the encoder without first being
+// truncated to float32.
+//
+//export GenerateLinearTransformF64
+func GenerateLinearTransformF64(
+	diagIdxsC *C.int, diagIdxsLen C.int,
+	diagDataC *C.double, diagDataLen C.int,
+	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio C.float,
+	pruneThreshold C.float,
+	ioModeC *C.char,
+) C.int {
+	scheme := activeScheme.Load()
+
+	return generateLinearTransform(
+		scheme, CArrayToSlice(diagIdxsC, diagIdxsLen, convertCIntToInt),
+		CArrayToSlice(diagDataC, diagDataLen, convertCDoubleToFloat),
+		level, refCiphertextID, float64(bsgsRatio), float64(pruneThreshold),
+		C.GoString(ioModeC),
+	)
+}
+
+// GenerateLinearTransformComplex is GenerateLinearTransformF64 for complex
+// diagonals, whose real and imaginary parts are passed as two arrays of
+// equal length. This lets a transform use the imaginary part of the slots,
+// e.g. to pack two real channels into each one. It requires the standard
+// ring, since the conjugate-invariant one has no imaginary part.
+//
+//export GenerateLinearTransformComplex
+func GenerateLinearTransformComplex(
+	diagIdxsC *C.int, diagIdxsLen C.int,
+	diagRealC *C.double, diagRealLen C.int,
+	diagImagC *C.double, diagImagLen C.int,
+	level C.int,
+	refCiphertextID C.int,
 	bsgsRatio C.float,
+	pruneThreshold C.float,
 	ioModeC *C.char,
 ) C.int {
+	scheme := activeScheme.Load()
+
+	if scheme.Params.RingType() != ring.Standard {
+		SetLastError(fmt.Errorf(
+			"complex diagonals require the standard ring, not %s",
+			scheme.Params.RingType()))
+		return -1
+	}
+	if diagRealLen != diagImagLen {
+		SetLastError(fmt.Errorf(
+			"got %d real parts but %d imaginary parts of diagonals",
+			int(diagRealLen), int(diagImagLen)))
+		return -1
+	}
+
+	re := CArrayToSlice(diagRealC, diagRealLen, convertCDoubleToFloat)
+	im := CArrayToSlice(diagImagC, diagImagLen, convertCDoubleToFloat)
+	diagDataFlat := make([]complex128, len(re))
+	for i := range diagDataFlat {
+		diagDataFlat[i] = complex(re[i], im[i])
+	}
+
+	return generateLinearTransform(
+		scheme, CArrayToSlice(diagIdxsC, diagIdxsLen, convertCIntToInt),
+		diagDataFlat,
+		level, refCiphertextID, float64(bsgsRatio), float64(pruneThreshold),
+		C.GoString(ioModeC),
+	)
+}
+
+// GenerateLinearTransformStreamed is GenerateLinearTransformF64 for blocks
+// too large to pass as one array. Instead of the data, it takes a C
+// callback, int source(int diag_idx, double *out, int slots), and calls it
+// once for each diagonal in diagIdxsC to fill out with that diagonal. Each
+// diagonal is encoded before the next is requested, so only one is held
+// at a time. The callback returns 0, or anything else to abort. Since the
+// transform's layout is fixed before any diagonal is seen, zero diagonals
+// are not pruned, and should be left out by the caller. In IO modes load
+// and readonly, no diagonal is requested. Returns the new transform's
+// handle, or -1 with the last error set.
+//
+//export GenerateLinearTransformStreamed
+func GenerateLinearTransformStreamed(
+	diagIdxsC *C.int, diagIdxsLen C.int,
+	source unsafe.Pointer,
+	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio C.float,
+	ioModeC *C.char,
+) C.int {
+	scheme := activeScheme.Load()
+
+	diagIdxs := CArrayToSlice(diagIdxsC, diagIdxsLen, convertCIntToInt)
 	ioMode := C.GoString(ioModeC)
 
-	// Unload diags data
+	if len(diagIdxs) == 0 {
+		SetLastError(fmt.Errorf("a linear transform needs at least one diagonal"))
+		return -1
+	}
+	level, err := resolveTransformLevel(scheme, level, refCiphertextID)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	lt := allocateLinearTransform(scheme, diagIdxs, int(level), float64(bsgsRatio), ioMode)
+	if !loadsDiagonals(ioMode) {
+		if err := encodeStreamedDiagonals(scheme, lt, diagIdxs, source); err != nil {
+			SetLastError(fmt.Errorf("cannot generate linear transform: %w", err))
+			return -1
+		}
+	}
+	return C.int(ltHeap.Add(lt))
+}
+
+// encodeStreamedDiagonals pulls the diagonals of lt from source one at a
+// time and encodes each the way lintrans.Encode does.
+func encodeStreamedDiagonals(
+	scheme *Scheme,
+	lt lintrans.LinearTransformation, diagIdxs []int, source unsafe.Pointer,
+) error {
+	slots := 1 << lt.LogDimensions.Cols
+	rots := encodingRotations(lt)
+	diag := make([]float64, slots)
+	rotated := make([]float64, slots)
+
+	for _, idx := range diagIdxs {
+		if err := pullDiagonal(source, idx, diag); err != nil {
+			return err
+		}
+
+		key := idx & (slots - 1)
+		values := diag
+		if rot := rots[key]; rot != 0 {
+			utils.RotateSliceAllocFree(diag, -rot, rotated)
+			values = rotated
+		}
+		if err := scheme.Encoder.Embed(values, lt.MetaData, lt.Vec[key]); err != nil {
+			return fmt.Errorf("diagonal %d: %w", idx, err)
+		}
+	}
+	return nil
+}
+
+// GenerateLinearTransformSparse is GenerateLinearTransformF64 for diagonals
+// given by their non-zero entries only, which cuts the data passed for the
+// mostly-zero diagonals of convolutions. diagCountsC gives how many entries
+// each diagonal in diagIdxsC has, and the slot positions and values of all
+// entries are concatenated in slotIdxsC and valuesC. Diagonals without
+// entries are dropped, as zero ones are, before anything is encoded.
+//
+//export GenerateLinearTransformSparse
+func GenerateLinearTransformSparse(
+	diagIdxsC *C.int, diagIdxsLen C.int,
+	diagCountsC *C.int, diagCountsLen C.int,
+	slotIdxsC *C.int, slotIdxsLen C.int,
+	valuesC *C.double, valuesLen C.int,
+	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio C.float,
+	pruneThreshold C.float,
+	ioModeC *C.char,
+) C.int {
+	scheme := activeScheme.Load()
+
+	diagIdxs := CArrayToSlice(diagIdxsC, diagIdxsLen, convertCIntToInt)
+	diagCounts := CArrayToSlice(diagCountsC, diagCountsLen, convertCIntToInt)
+	slotIdxs := CArrayToSlice(slotIdxsC, slotIdxsLen, convertCIntToInt)
+	values := CArrayToSlice(valuesC, valuesLen, convertCDoubleToFloat)
+
+	if len(diagCounts) != len(diagIdxs) || len(slotIdxs) != len(values) {
+		SetLastError(fmt.Errorf(
+			"got %d diagonal counts for %d diagonals, and %d slot indices "+
+				"for %d values", len(diagCounts), len(diagIdxs),
+			len(slotIdxs), len(values)))
+		return -1
+	}
+
+	slots := scheme.Params.MaxSlots()
+	diagDataFlat := make([]float64, len(diagIdxs)*slots)
+	offset := 0
+	for i, count := range diagCounts {
+		if count < 0 || offset+count > len(values) {
+			SetLastError(fmt.Errorf(
+				"diagonal counts exceed the %d entries given", len(values)))
+			return -1
+		}
+		diag := diagDataFlat[i*slots : (i+1)*slots]
+		for k := offset; k < offset+count; k++ {
+			if slotIdxs[k] < 0 || slotIdxs[k] >= slots {
+				SetLastError(fmt.Errorf(
+					"diagonal %d: slot index %d is outside [0, %d)",
+					diagIdxs[i], slotIdxs[k], slots))
+				return -1
+			}
+			diag[slotIdxs[k]] = values[k]
+		}
+		offset += count
+	}
+	if offset != len(values) {
+		SetLastError(fmt.Errorf(
+			"diagonal counts add up to %d entries, but %d were given",
+			offset, len(values)))
+		return -1
+	}
+
+	return generateLinearTransform(
+		scheme, diagIdxs, diagDataFlat,
+		level, refCiphertextID, float64(bsgsRatio), float64(pruneThreshold),
+		C.GoString(ioModeC),
+	)
+}
+
+// GenerateLinearTransformRows is GenerateLinearTransformF64 for a
+// matrix-style packing, in which the slots hold 2^logRows rows of equal
+// length and the transform multiplies each row by a matrix of its own.
+// Diagonal k, for k in [0, cols), holds the k-th diagonal of each row's
+// matrix, one row after the other, and rotates within the row.
+//
+// Lattigo expresses this with LogDimensions.Rows, but CKKS rotations
+// always move every slot, so each row diagonal is encoded as the two
+// full-width diagonals k and k - cols instead: the first takes the entries
+// that stay within their row when rotated by k, and the second those that
+// wrap around to its start. Returns the transform's handle, or -1 with the
+// last error set.
+//
+//export GenerateLinearTransformRows
+func GenerateLinearTransformRows(
+	diagIdxsC *C.int, diagIdxsLen C.int,
+	diagDataC *C.double, diagDataLen C.int,
+	logRows C.int,
+	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio C.float,
+	pruneThreshold C.float,
+	ioModeC *C.char,
+) C.int {
+	scheme := activeScheme.Load()
+
 	diagIdxs := CArrayToSlice(diagIdxsC, diagIdxsLen, convertCIntToInt)
-	diagDataFlat := CArrayToSlice(diagDataC, diagDataLen, convertCFloatToFloat)
+	diagDataFlat := CArrayToSlice(diagDataC, diagDataLen, convertCDoubleToFloat)
+
+	slots := scheme.Params.MaxSlots()
+	if logRows < 0 || int(logRows) > scheme.Params.LogMaxSlots() {
+		SetLastError(fmt.Errorf(
+			"log rows %d is outside [0, %d]",
+			int(logRows), scheme.Params.LogMaxSlots()))
+		return -1
+	}
+	if len(diagDataFlat) != len(diagIdxs)*slots {
+		SetLastError(fmt.Errorf(
+			"diagonal data length mismatch: expected %d values "+
+				"(%d diagonals x %d slots), got %d",
+			len(diagIdxs)*slots, len(diagIdxs), slots, len(diagDataFlat)))
+		return -1
+	}
+	level, err := resolveTransformLevel(scheme, level, refCiphertextID)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	diagonals, err := rowDiagonals(slots, int(logRows), diagIdxs, diagDataFlat)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	return newLinearTransform(
+		scheme, diagonals, level, float64(bsgsRatio), float64(pruneThreshold),
+		C.GoString(ioModeC))
+}
+
+// rowDiagonals splits each row diagonal k into the full-width diagonals k
+// and k - cols, as described for GenerateLinearTransformRows.
+func rowDiagonals(
+	slots, logRows int, diagIdxs []int, diagDataFlat []float64,
+) (lintrans.Diagonals[float64], error) {
+	cols := slots >> logRows
+	diagonals := make(lintrans.Diagonals[float64])
+	diagonal := func(idx int) []float64 {
+		idx &= slots - 1
+		if diagonals[idx] == nil {
+			diagonals[idx] = make([]float64, slots)
+		}
+		return diagonals[idx]
+	}
 
+	for d, k := range diagIdxs {
+		if k < 0 || k >= cols {
+			return nil, fmt.Errorf("row diagonal %d is outside [0, %d)", k, cols)
+		}
+		rowDiag := diagDataFlat[d*slots : (d+1)*slots]
+		inRow, wrapped := diagonal(k), diagonal(k-cols)
+		for i, v := range rowDiag {
+			if i&(cols-1)+k < cols {
+				inRow[i] += v
+			} else {
+				wrapped[i] += v
+			}
+		}
+	}
+	return diagonals, nil
+}
+
+func generateLinearTransform[T float64 | complex128](
+	scheme *Scheme,
+	diagIdxs []int,
+	diagDataFlat []T,
+	level C.int,
+	refCiphertextID C.int,
+	bsgsRatio float64,
+	pruneThreshold float64,
+	ioMode string,
+) C.int {
 	// diagDataFlat is a flattened array of length len(diagIdxs) * slots.
+	// MaxSlots is N/2 for the standard ring and N for the conjugate-
+	// invariant one, matching the slot count the Python side packs for.
 	// The first element in diagIdxs corresponds to the first [0, slots]
 	// values in diagsDataFlat, and so on. We'll extract these into a
 	// dictionary that can be passed to Lattigo's LinearTransform evaluator.
 	slots := scheme.Params.MaxSlots()
-	diagonals := make(lintrans.Diagonals[float64])
+	if len(diagDataFlat) != len(diagIdxs)*slots {
+		SetLastError(fmt.Errorf(
+			"diagonal data length mismatch: expected %d values "+
+				"(%d diagonals x %d slots), got %d",
+			len(diagIdxs)*slots, len(diagIdxs), slots, len(diagDataFlat)))
+		return -1
+	}
+	level, err := resolveTransformLevel(scheme, level, refCiphertextID)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	diagonals := make(lintrans.Diagonals[T])
 
 	for i, key := range diagIdxs {
 		diagonals[key] = diagDataFlat[i*slots : (i+1)*slots]
 	}
 
-	ltparams := lintrans.Parameters{
-		DiagonalsIndexList:        diagonals.DiagonalsIndexList(),
-		LevelQ:                    int(level),
-		LevelP:                    scheme.Params.MaxLevelP(),
-		Scale:                     rlwe.NewScale(scheme.Params.Q()[int(level)]),
-		LogDimensions:             ring.Dimensions{Rows: 0, Cols: scheme.Params.LogMaxSlots()},
-		LogBabyStepGiantStepRatio: int(math.Log(float64(bsgsRatio))),
-	}
+	return newLinearTransform(scheme, diagonals, level, bsgsRatio, pruneThreshold, ioMode)
+}
 
-	lt := lintrans.NewTransformation(scheme.Params, ltparams)
+// newLinearTransform encodes the diagonals into a new transform at level,
+// and returns its handle.
+func newLinearTransform[T float64 | complex128](
+	scheme *Scheme,
+	diagonals lintrans.Diagonals[T],
+	level C.int,
+	bsgsRatio float64,
+	pruneThreshold float64,
+	ioMode string,
+) C.int {
+	// Diagonals that are (near) zero contribute nothing to the output, so
+	// we drop them before encoding. This also removes their Galois elements
+	// from the keys this transform requires.
+	pruneDiagonals(diagonals, max(pruneThreshold, zeroDiagonalEpsilon))
+	lt := allocateLinearTransform(
+		scheme, diagonals.DiagonalsIndexList(), int(level), bsgsRatio, ioMode)
 
 	// ---------------------------- //
 	//  Diagonal Generation/Saving  //
 	// ---------------------------- //
 
-	// If ioMode is "load", then we expect the diagonals to have already been
-	// generated and serialized, so there's no need to regenerate them here.
-	// We do, however, still need to instantiate empty plaintext diagonals.
-	if ioMode == "load" {
-		lt.Vec = make(map[int]ringqp.Poly)
-		for _, diag := range diagIdxs {
-			lt.Vec[diag] = ringqp.Poly{}
-		}
-	} else { // otherwise, generate diagonals here.
+	// If ioMode is "load" or "readonly", then we expect the diagonals to have
+	// already been generated and serialized, so there's no need to regenerate
+	// them here.
+	if !loadsDiagonals(ioMode) {
 		if err := lintrans.Encode(scheme.Encoder, diagonals, lt); err != nil {
 			panic(err)
 		}
@@ -92,28 +502,1049 @@ func GenerateLinearTransform(
 	return C.int(ltID)
 }
 
+// resolveTransformLevel checks the level a transform is requested at. A
+// level of -1 asks us to derive it from the ciphertext the transform will
+// be applied to.
+func resolveTransformLevel(scheme *Scheme, level, refCiphertextID C.int) (C.int, error) {
+	if level == -1 {
+		if level = suggestTransformLevel(scheme, refCiphertextID); level < 0 {
+			return -1, fmt.Errorf(
+				"cannot infer a linear transform level from ciphertext %d",
+				int(refCiphertextID))
+		}
+	}
+	if level < 0 || int(level) > scheme.Params.MaxLevelQ() {
+		return -1, fmt.Errorf(
+			"linear transform level %d is outside [0, %d]",
+			int(level), scheme.Params.MaxLevelQ())
+	}
+	return level, nil
+}
+
+// loadsDiagonals reports whether transforms generated in ioMode get their
+// diagonals from disk rather than encoding them.
+func loadsDiagonals(ioMode string) bool {
+	return ioMode == "load" || ioMode == "readonly"
+}
+
+// allocateLinearTransform returns a transform at level with the given
+// diagonals, ready to be encoded into. While planning, its Galois elements
+// are recorded. When its diagonals will be loaded from disk, they are left
+// as empty plaintexts.
+func allocateLinearTransform(
+	scheme *Scheme,
+	diagIdxs []int, level int, bsgsRatio float64, ioMode string,
+) lintrans.LinearTransformation {
+	ltparams := newLinearTransformParameters(scheme, diagIdxs, level, bsgsRatio)
+	lt := lintrans.NewTransformation(scheme.Params, ltparams)
+
+	// While planning, the transform's keys are generated later, together
+	// with those of every other transform.
+	if scheme.PlannedGalEls != nil {
+		for _, galEl := range lintrans.GaloisElements(scheme.Params, ltparams) {
+			scheme.PlannedGalEls[galEl] = true
+		}
+	}
+
+	if loadsDiagonals(ioMode) {
+		lt.Vec = make(map[int]ringqp.Poly)
+		for _, diag := range diagIdxs {
+			lt.Vec[diag] = ringqp.Poly{}
+		}
+	}
+	return lt
+}
+
+// encodingRotations returns the rotation each diagonal of a BSGS
+// transform is encoded with: lintrans.Encode stores diagonal i+j, for
+// giant step j, rotated by -j. Diagonals missing from the map are not
+// rotated.
+func encodingRotations(transform lintrans.LinearTransformation) map[int]int {
+	rots := map[int]int{}
+	if transform.N1 != 0 {
+		index, _, _ := commonlintrans.LinearTransformation(transform).BSGSIndex()
+		for j, diags := range index {
+			for _, i := range diags {
+				rots[i+j] = j
+			}
+		}
+	}
+	return rots
+}
+
+// newLinearTransformParameters returns the parameters of a transform over
+// all slots of the active scheme with the given diagonals. A bsgsRatio of
+// autoBSGSRatio picks the baby-step giant-step split for the transform.
+func newLinearTransformParameters(
+	scheme *Scheme,
+	diagIdxs []int, level int, bsgsRatio float64,
+) lintrans.Parameters {
+	logRatio := int(math.Log(bsgsRatio))
+	if bsgsRatio == autoBSGSRatio {
+		logRatio = bestLogBSGSRatio(scheme, diagIdxs, level)
+		logDebug("chose log BSGS ratio %d for %d diagonals at level %d",
+			logRatio, len(diagIdxs), level)
+	}
+
+	return lintrans.Parameters{
+		DiagonalsIndexList:        diagIdxs,
+		LevelQ:                    level,
+		LevelP:                    scheme.Params.MaxLevelP(),
+		Scale:                     rlwe.NewScale(scheme.Params.Q()[level]),
+		LogDimensions:             ring.Dimensions{Rows: 0, Cols: scheme.Params.LogMaxSlots()},
+		LogBabyStepGiantStepRatio: logRatio,
+	}
+}
+
+// pruneDiagonals removes every diagonal whose entries are all at most
+// threshold in magnitude. At least one diagonal is always kept so that the
+// transform still produces a ciphertext at the expected level and scale.
+func pruneDiagonals[T float64 | complex128](
+	diagonals lintrans.Diagonals[T], threshold float64,
+) {
+	idxs := diagonals.DiagonalsIndexList()
+	slices.Sort(idxs)
+
+	for _, idx := range idxs {
+		if len(diagonals) == 1 {
+			return
+		}
+
+		isZero := true
+		for _, v := range diagonals[idx] {
+			if magnitude(v) > threshold {
+				isZero = false
+				break
+			}
+		}
+		if isZero {
+			delete(diagonals, idx)
+		}
+	}
+}
+
+// magnitude returns the absolute value of a diagonal entry.
+func magnitude[T float64 | complex128](v T) float64 {
+	if v, ok := any(v).(float64); ok {
+		return math.Abs(v)
+	}
+	return cmplx.Abs(any(v).(complex128))
+}
+
+//export GetLinearTransformDiagonals
+func GetLinearTransformDiagonals(transformID C.int) (*C.int, C.ulong) {
+	transform := RetrieveLinearTransform(int(transformID))
+	diagIdxs := GetKeysFromMap(transform.Vec)
+	slices.Sort(diagIdxs)
+
+	arrPtr, length := SliceToCArray(diagIdxs, convertIntToCInt)
+	return arrPtr, length
+}
+
+// SuggestTransformLevel returns the level a linear transform should be
+// generated at so that applying it to the ciphertext consumes exactly one
+// level, i.e. the ciphertext's current level. Returns -1 if the ciphertext
+// does not exist or has no level left to consume.
+//
+//export SuggestTransformLevel
+func SuggestTransformLevel(ciphertextID C.int) C.int {
+	return suggestTransformLevel(activeScheme.Load(), ciphertextID)
+}
+
+func suggestTransformLevel(scheme *Scheme, ciphertextID C.int) C.int {
+	if !ctHeap.Exists(int(ciphertextID)) {
+		return -1
+	}
+
+	level := RetrieveCiphertext(int(ciphertextID)).Level()
+	if level < scheme.Params.LevelsConsumedPerRescaling() {
+		return -1
+	}
+	return C.int(level)
+}
+
+// EstimateFinalLevel returns the level left after applying numTransforms
+// linear transforms, each followed by one rescale, to a ciphertext at
+// startLevel. Returns -1 if the chain would run out of levels first, i.e.
+// a bootstrap is needed somewhere along it.
+//
+//export EstimateFinalLevel
+func EstimateFinalLevel(startLevel, numTransforms C.int) C.int {
+	scheme := activeScheme.Load()
+	return estimateFinalLevelWithMuls(scheme, startLevel, numTransforms, 0)
+}
+
+// EstimateFinalLevelWithMuls is EstimateFinalLevel for a chain that also
+// interleaves numMuls rescaled multiplications between the transforms.
+//
+//export EstimateFinalLevelWithMuls
+func EstimateFinalLevelWithMuls(startLevel, numTransforms, numMuls C.int) C.int {
+	return estimateFinalLevelWithMuls(activeScheme.Load(), startLevel, numTransforms, numMuls)
+}
+
+func estimateFinalLevelWithMuls(scheme *Scheme, startLevel, numTransforms, numMuls C.int) C.int {
+	if startLevel < 0 || int(startLevel) > scheme.Params.MaxLevelQ() ||
+		numTransforms < 0 || numMuls < 0 {
+		return -1
+	}
+
+	rescales := int(numTransforms) + int(numMuls)
+	level := int(startLevel) - rescales*scheme.Params.LevelsConsumedPerRescaling()
+	if level < 0 {
+		return -1
+	}
+	return C.int(level)
+}
+
 //export EvaluateLinearTransform
 func EvaluateLinearTransform(transformID, ctxtID C.int) C.int {
+	scheme := activeScheme.Load()
+
 	transform := RetrieveLinearTransform(int(transformID))
 	ctIn := RetrieveCiphertext(int(ctxtID))
 
+	transform, err := transformAtLevel(scheme, int(transformID), transform, ctIn.Level())
+	if err != nil {
+		panic(err)
+	}
+
 	// Update the linear transform evaluator to have the most
 	// recent set of rotation keys.
 	scheme.LinEvaluator = lintrans.NewEvaluator(
 		scheme.Evaluator.WithKey(scheme.EvalKeys),
 	)
 
+	profileCount(&profile.Calls, 1)
+	profileBlock(scheme, transform)
+	start := profileStart()
 	ctOut, err := scheme.LinEvaluator.EvaluateNew(ctIn, transform)
 	if err != nil {
 		panic(err)
 	}
+	profileStop(&profile.EvaluateNs, start)
+	profileStop(&profile.TotalNs, start)
 
 	idx := PushCiphertext(ctOut)
 	return C.int(idx)
 }
 
+// EvaluateLinearTransformStreamed is EvaluateLinearTransform for a
+// transform whose diagonals are on disk, in IO modes load and readonly.
+// Rather than having every diagonal loaded beforehand, it pulls them from
+// source in the order the baby-step giant-step decomposition consumes
+// them, one giant step at a time (or one diagonal at a time for a
+// transform without BSGS), and frees each group once it has been applied.
+// Only one group's plaintexts are held at once, for a mod-down and an
+// addition per group. The diagonal cache is bypassed, and the transform
+// cannot be re-encoded at a lower level, since that needs every diagonal.
+// Returns the output ciphertext's ID, or -1 with the last error set.
+//
+//export EvaluateLinearTransformStreamed
+func EvaluateLinearTransformStreamed(
+	transformID, ctxtID C.int, source unsafe.Pointer,
+) C.int {
+	scheme := activeScheme.Load()
+
+	ctOut, err := evaluateLinearTransformStreamed(
+		scheme, RetrieveLinearTransform(int(transformID)),
+		RetrieveCiphertext(int(ctxtID)),
+		func(diagIdx int) (ringqp.Poly, error) {
+			return pullPlaintextDiagonal(source, diagIdx)
+		},
+	)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot evaluate transform %d: %w", transformID, err))
+		return -1
+	}
+	return C.int(PushCiphertext(ctOut))
+}
+
+// evaluateLinearTransformStreamed backs EvaluateLinearTransformStreamed,
+// with load returning the plaintext of a diagonal.
+func evaluateLinearTransformStreamed(
+	scheme *Scheme,
+	transform lintrans.LinearTransformation,
+	ctIn *rlwe.Ciphertext,
+	load func(diagIdx int) (ringqp.Poly, error),
+) (*rlwe.Ciphertext, error) {
+	if ctIn.Level() < transform.LevelQ {
+		return nil, fmt.Errorf(
+			"input is at level %d, below the transform's level %d",
+			ctIn.Level(), transform.LevelQ)
+	}
+
+	// Each group is evaluated as a transform of its own. Their outputs add
+	// up to that of the whole transform, since each giant step's rotation
+	// only applies to its own diagonals.
+	groups := streamingGroups(transform)
+	parts := make([]lintrans.LinearTransformation, len(groups))
+	for g, diagIdxs := range groups {
+		parts[g] = transform
+		parts[g].Vec = make(map[int]ringqp.Poly, len(diagIdxs))
+		for _, diagIdx := range diagIdxs {
+			parts[g].Vec[diagIdx] = ringqp.Poly{}
+		}
+	}
+
+	profileCount(&profile.Calls, 1)
+	profileBlock(scheme, transform)
+	defer profileStop(&profile.TotalNs, profileStart())
+
+	eval := scheme.Evaluator.WithKey(scheme.EvalKeys)
+	linEval := lintrans.NewEvaluator(eval)
+
+	// The groups all rotate the same input, so its decomposition and
+	// baby-step rotations are computed once for all of them.
+	hoisted := newHoistedInput(ctIn, parts)
+
+	var ctOut, partial *rlwe.Ciphertext
+	for g, diagIdxs := range groups {
+		start := profileStart()
+		for _, diagIdx := range diagIdxs {
+			diag, err := load(diagIdx)
+			if err != nil {
+				return nil, err
+			}
+			parts[g].Vec[diagIdx] = diag
+		}
+		profileStop(&profile.DiskLoadNs, start)
+
+		start = profileStart()
+		out, err := hoisted.evaluate(eval, linEval, parts[g], partial)
+		if err != nil {
+			return nil, err
+		}
+		if ctOut == nil {
+			ctOut = out
+		} else if err := eval.Add(ctOut, out, ctOut); err != nil {
+			return nil, err
+		}
+		profileStop(&profile.EvaluateNs, start)
+
+		for _, diagIdx := range diagIdxs {
+			parts[g].Vec[diagIdx] = ringqp.Poly{}
+		}
+		if g == 0 && len(groups) > 1 {
+			partial = ckks.NewCiphertext(*scheme.Params, 1, ctOut.Level())
+		}
+	}
+	return ctOut, nil
+}
+
+// streamingGroups returns the diagonals of a transform in the order its
+// evaluation consumes them, grouped by giant step for a BSGS transform,
+// and one by one otherwise.
+func streamingGroups(transform lintrans.LinearTransformation) [][]int {
+	if transform.N1 == 0 {
+		// Without BSGS, Lattigo only clears its accumulator for a rotated
+		// diagonal, so diagonal 0 shares the group of the next one.
+		diagIdxs := slices.Sorted(maps.Keys(transform.Vec))
+		groups := [][]int{diagIdxs[:min(2, len(diagIdxs))]}
+		if diagIdxs[0] != 0 {
+			groups[0] = diagIdxs[:1]
+		}
+		for _, diagIdx := range diagIdxs[len(groups[0]):] {
+			groups = append(groups, []int{diagIdx})
+		}
+		return groups
+	}
+
+	index, _, _ := commonlintrans.LinearTransformation(transform).BSGSIndex()
+	var groups [][]int
+	for _, j := range slices.Sorted(maps.Keys(index)) {
+		group := make([]int, len(index[j]))
+		for k, i := range index[j] {
+			group[k] = j + i
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// EvaluateLinearTransforms performs a blocked linear transform. The
+// transforms are given in row-major order as a rows x cols grid, where
+// cols = len(ctIDs). Each output row is the rescaled sum of its blocks
+// applied to the matching input ciphertexts. When rescale is 0, the rows
+// are left unrescaled instead, so that the caller can fold a following
+// plaintext multiplication into the same rescale. Rows are independent, so
+// they are spread over a pool of at most maxWorkers goroutines (GOMAXPROCS
+// when maxWorkers <= 0), each with its own evaluator. All diagonals and
+// rotation keys must already be in memory. Returns the IDs of the output
+// ciphertexts, or an empty array with the last error set on failure.
+//
+//export EvaluateLinearTransforms
+func EvaluateLinearTransforms(
+	transformIDsC *C.int, lenTransformIDs C.int,
+	ctIDsC *C.int, lenCtIDs C.int,
+	maxWorkers C.int,
+	rescale C.int,
+) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	transformIDs := CArrayToSlice(transformIDsC, lenTransformIDs, convertCIntToInt)
+	ctIDs := CArrayToSlice(ctIDsC, lenCtIDs, convertCIntToInt)
+
+	outIDs, err := evaluateLinearTransforms(
+		scheme, transformIDs, ctIDs, nil, int(maxWorkers), rescale != 0)
+	if err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	arrPtr, length := SliceToCArray(outIDs, convertIntToCInt)
+	return arrPtr, length
+}
+
+// EvaluateLinearTransformsBatch is EvaluateLinearTransforms over a batch
+// of independent inputs, so that the whole batch flows through in one
+// call. ctIDs holds batchSize groups of input ciphertexts back to back,
+// one per input, and the output holds each input's rows in the same
+// order. Returns an empty array with the last error set on failure.
+//
+//export EvaluateLinearTransformsBatch
+func EvaluateLinearTransformsBatch(
+	transformIDsC *C.int, lenTransformIDs C.int,
+	ctIDsC *C.int, lenCtIDs C.int,
+	batchSize C.int,
+	maxWorkers C.int,
+) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	transformIDs := CArrayToSlice(transformIDsC, lenTransformIDs, convertCIntToInt)
+	ctIDs := CArrayToSlice(ctIDsC, lenCtIDs, convertCIntToInt)
+
+	if batchSize <= 0 || len(ctIDs)%int(batchSize) != 0 {
+		SetLastError(fmt.Errorf(
+			"cannot split %d input ciphertexts into a batch of %d",
+			len(ctIDs), int(batchSize)))
+		return nil, 0
+	}
+	cols := len(ctIDs) / int(batchSize)
+
+	outIDs := []int{}
+	for b := range int(batchSize) {
+		ids, err := evaluateLinearTransforms(
+			scheme, transformIDs, ctIDs[b*cols:(b+1)*cols], nil, int(maxWorkers), true)
+		if err != nil {
+			SetLastError(fmt.Errorf("batch input %d: %w", b, err))
+			return nil, 0
+		}
+		outIDs = append(outIDs, ids...)
+	}
+
+	arrPtr, length := SliceToCArray(outIDs, convertIntToCInt)
+	return arrPtr, length
+}
+
+// EvaluateLinearTransformMany applies one transform to each of the input
+// ciphertexts, such as the images of a batch, and rescales the results.
+// The inputs are spread over a pool of at most maxWorkers goroutines
+// (GOMAXPROCS when maxWorkers <= 0), which share the transform's diagonals
+// and rotation keys. Returns the IDs of the output ciphertexts in the
+// order of the inputs, or an empty array with the last error set.
+//
+//export EvaluateLinearTransformMany
+func EvaluateLinearTransformMany(
+	transformID C.int,
+	ctIDsC *C.int, lenCtIDs C.int,
+	maxWorkers C.int,
+) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	ctIDs := CArrayToSlice(ctIDsC, lenCtIDs, convertCIntToInt)
+
+	outIDs, err := evaluateLinearTransformMany(scheme, int(transformID), ctIDs, int(maxWorkers))
+	if err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	arrPtr, length := SliceToCArray(outIDs, convertIntToCInt)
+	return arrPtr, length
+}
+
+func evaluateLinearTransformMany(
+	scheme *Scheme, transformID int, ctIDs []int, maxWorkers int,
+) ([]int, error) {
+	profileCount(&profile.Calls, 1)
+	defer profileStop(&profile.TotalNs, profileStart())
+
+	if len(ctIDs) == 0 {
+		return nil, fmt.Errorf("no input ciphertexts to evaluate transform %d on", transformID)
+	}
+	if !ltHeap.Exists(transformID) {
+		return nil, fmt.Errorf("transform %d does not exist", transformID)
+	}
+	transform := RetrieveLinearTransform(transformID)
+	if err := checkRotationKeys(scheme, transformID, transform); err != nil {
+		return nil, err
+	}
+
+	ctsIn := make([]*rlwe.Ciphertext, len(ctIDs))
+	transforms := make([]lintrans.LinearTransformation, len(ctIDs))
+	for k, id := range ctIDs {
+		if !ctHeap.Exists(id) {
+			return nil, fmt.Errorf("input %d: ciphertext %d does not exist", k, id)
+		}
+		ctsIn[k] = RetrieveCiphertext(id)
+
+		var err error
+		transforms[k], err = transformAtLevel(scheme, transformID, transform, ctsIn[k].Level())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	numWorkers := maxWorkers
+	if numWorkers <= 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+	numWorkers = min(numWorkers, len(ctsIn))
+
+	tasks := make(chan int, len(ctsIn))
+	for k := range ctsIn {
+		tasks <- k
+	}
+	close(tasks)
+
+	ctsOut := make([]*rlwe.Ciphertext, len(ctsIn))
+	errs := make([]error, len(ctsIn))
+
+	var wg sync.WaitGroup
+	for range numWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			eval := scheme.Evaluator.ShallowCopy().WithKey(scheme.EvalKeys)
+			linEval := lintrans.NewEvaluator(eval)
+
+			for k := range tasks {
+				profileBlock(scheme, transforms[k])
+				start := profileStart()
+				ct, err := evaluateTransformInto(linEval, ctsIn[k], transforms[k], nil)
+				if err != nil {
+					errs[k] = fmt.Errorf("input %d: %w", k, err)
+					continue
+				}
+				profileStop(&profile.EvaluateNs, start)
+
+				start = profileStart()
+				if err := eval.Rescale(ct, ct); err != nil {
+					errs[k] = fmt.Errorf("input %d: %w", k, err)
+					continue
+				}
+				profileStop(&profile.RescaleNs, start)
+				ctsOut[k] = ct
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	outIDs := make([]int, len(ctsOut))
+	for k, ct := range ctsOut {
+		outIDs[k] = PushCiphertext(ct)
+	}
+	return outIDs, nil
+}
+
+// EvaluateLinearTransformsInto is EvaluateLinearTransforms, but writes
+// row i into the existing ciphertext outIDs[i] instead of allocating a new
+// one. Rows whose output ID is -1 are allocated as usual. Outputs may not
+// alias the inputs, since every row reads all of them. Returns the IDs of
+// the output ciphertexts, or an empty array with the last error set.
+//
+//export EvaluateLinearTransformsInto
+func EvaluateLinearTransformsInto(
+	outIDsC *C.int, lenOutIDs C.int,
+	transformIDsC *C.int, lenTransformIDs C.int,
+	ctIDsC *C.int, lenCtIDs C.int,
+	maxWorkers C.int,
+) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	outIDs := CArrayToSlice(outIDsC, lenOutIDs, convertCIntToInt)
+	transformIDs := CArrayToSlice(transformIDsC, lenTransformIDs, convertCIntToInt)
+	ctIDs := CArrayToSlice(ctIDsC, lenCtIDs, convertCIntToInt)
+
+	outIDs, err := evaluateLinearTransforms(
+		scheme, transformIDs, ctIDs, outIDs, int(maxWorkers), true)
+	if err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	arrPtr, length := SliceToCArray(outIDs, convertIntToCInt)
+	return arrPtr, length
+}
+
+// evaluateLinearTransforms backs both EvaluateLinearTransforms exports.
+// dstIDs is either nil or holds one (possibly -1) output ID per row.
+func evaluateLinearTransforms(
+	scheme *Scheme,
+	transformIDs, ctIDs, dstIDs []int, maxWorkers int, rescale bool,
+) ([]int, error) {
+	profileCount(&profile.Calls, 1)
+	defer profileStop(&profile.TotalNs, profileStart())
+
+	cols := len(ctIDs)
+	if cols == 0 || len(transformIDs)%cols != 0 {
+		return nil, fmt.Errorf(
+			"cannot arrange %d transforms into rows of %d input ciphertexts",
+			len(transformIDs), cols)
+	}
+	rows := len(transformIDs) / cols
+
+	if dstIDs == nil {
+		dstIDs = make([]int, rows)
+		for i := range dstIDs {
+			dstIDs[i] = -1
+		}
+	}
+	if len(dstIDs) != rows {
+		return nil, fmt.Errorf(
+			"got %d output ciphertexts for %d rows of blocks",
+			len(dstIDs), rows)
+	}
+
+	// Fetch everything from the heaps up front, since they are not safe
+	// for concurrent use.
+	transforms := make([]lintrans.LinearTransformation, len(transformIDs))
+	for i, id := range transformIDs {
+		transforms[i] = RetrieveLinearTransform(id)
+		if err := checkRotationKeys(scheme, id, transforms[i]); err != nil {
+			return nil, err
+		}
+	}
+	ctsIn := make([]*rlwe.Ciphertext, cols)
+	for j, id := range ctIDs {
+		ctsIn[j] = RetrieveCiphertext(id)
+	}
+
+	// The blocks of a row are added up before being rescaled together, so
+	// they must share a level and scale: every block is brought to the
+	// lowest level among them and their inputs.
+	for i := range rows {
+		level := math.MaxInt
+		for j := range cols {
+			level = min(level, ctsIn[j].Level(), transforms[i*cols+j].LevelQ)
+		}
+		for j := range cols {
+			k := i*cols + j
+			transform, err := transformAtLevel(scheme, transformIDs[k], transforms[k], level)
+			if err != nil {
+				return nil, err
+			}
+			transforms[k] = transform
+		}
+	}
+
+	// Every block of a column rotates the same input, so with more than
+	// one row, the work that depends only on the input is shared.
+	hoisted := make([]*hoistedInput, cols)
+	if rows > 1 && hoistingEnabled {
+		for j := range cols {
+			column := make([]lintrans.LinearTransformation, rows)
+			numDiags := 0
+			for i := range rows {
+				column[i] = transforms[i*cols+j]
+				numDiags += len(column[i].Vec)
+			}
+			if numDiags >= hoistingMinDiagonals {
+				hoisted[j] = newHoistedInput(ctsIn[j], column)
+			}
+		}
+	}
+
+	ctsOut := make([]*rlwe.Ciphertext, rows)
+	for i, id := range dstIDs {
+		if id < 0 {
+			continue
+		}
+		if !ctHeap.Exists(id) {
+			return nil, fmt.Errorf("row %d: output ciphertext %d does not exist", i, id)
+		}
+		if slices.Contains(ctIDs, id) || slices.Contains(dstIDs[:i], id) {
+			return nil, fmt.Errorf(
+				"row %d: output ciphertext %d is also an input or another "+
+					"row's output", i, id)
+		}
+		ctsOut[i] = RetrieveCiphertext(id)
+	}
+
+	numWorkers := maxWorkers
+	if numWorkers <= 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	// Rows are independent, so they are spread over the workers. With
+	// fewer rows than workers, each row is also split into chunks of
+	// blocks. The worker finishing a row's last chunk adds up the chunks'
+	// partial sums and rescales the row.
+	chunks := 1
+	if rows < numWorkers {
+		chunks = min(cols, (numWorkers+rows-1)/rows)
+	}
+	numWorkers = min(numWorkers, rows*chunks)
+
+	type rowChunk struct{ row, chunk int }
+	tasks := make(chan rowChunk, rows*chunks)
+	sums := make([][]*rlwe.Ciphertext, rows)
+	remaining := make([]atomic.Int32, rows)
+	for i := range rows {
+		sums[i] = make([]*rlwe.Ciphertext, chunks)
+		remaining[i].Store(int32(chunks))
+		for c := range chunks {
+			tasks <- rowChunk{i, c}
+		}
+	}
+	close(tasks)
+
+	errs := make([]error, rows*chunks)
+	rowErrs := make([]error, rows)
+
+	var wg sync.WaitGroup
+	for range numWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Evaluators hold scratch buffers, so every worker gets its own,
+			// along with one ciphertext for the partial results of a chunk,
+			// which chunks of a single block don't need.
+			eval := scheme.Evaluator.ShallowCopy().WithKey(scheme.EvalKeys)
+			linEval := lintrans.NewEvaluator(eval)
+			var partial *rlwe.Ciphertext
+
+			for task := range tasks {
+				i, c := task.row, task.chunk
+				lo, hi := c*cols/chunks, (c+1)*cols/chunks
+				if hi-lo > 1 && partial == nil {
+					partial = ckks.NewCiphertext(*scheme.Params, 1, scheme.Params.MaxLevelQ())
+				}
+
+				// Only the first chunk of a row writes into its output.
+				var dst *rlwe.Ciphertext
+				if c == 0 {
+					dst = ctsOut[i]
+				}
+				sums[i][c], errs[i*chunks+c] = accumulateBlocks(
+					scheme, eval, linEval, i, lo, transforms[i*cols+lo:i*cols+hi],
+					ctsIn[lo:hi], hoisted[lo:hi], dst, partial)
+
+				if remaining[i].Add(-1) == 0 {
+					ctsOut[i], rowErrs[i] = reduceTransformRow(
+						eval, i, sums[i], errs[i*chunks:(i+1)*chunks], rescale)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range rowErrs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	outIDs := make([]int, rows)
+	for i, ct := range ctsOut {
+		if dstIDs[i] >= 0 {
+			outIDs[i] = dstIDs[i]
+		} else {
+			outIDs[i] = PushCiphertext(ct)
+		}
+	}
+	return outIDs, nil
+}
+
+// checkRotationKeys returns an error listing the Galois elements the
+// transform needs that are missing from the evaluation key set, so that
+// they are reported before evaluation rather than deep inside Lattigo.
+func checkRotationKeys(
+	scheme *Scheme, transformID int, transform lintrans.LinearTransformation,
+) error {
+	missing := []uint64{}
+	for _, galEl := range transform.GaloisElements(scheme.Params) {
+		if _, exists := scheme.EvalKeys.GaloisKeys[galEl]; !exists {
+			missing = append(missing, galEl)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"transform %d: missing rotation keys for Galois elements %v",
+			transformID, missing)
+	}
+	return nil
+}
+
+// accumulateBlocks evaluates consecutive blocks of a row, the first of
+// which is in column col, and returns the sum of their outputs without
+// rescaling it. Blocks whose column has a hoisted input use it rather than
+// decomposing their input again. The sum is written into dst, or a new
+// ciphertext when dst is nil, and partial is reused as the scratch output
+// of every other block. Blocks generated at different levels are brought down to the
+// lowest one before being added, but their scales must then agree, since
+// matching those would cost a multiplication.
+func accumulateBlocks(
+	scheme *Scheme,
+	eval *ckks.Evaluator,
+	linEval *lintrans.Evaluator,
+	row, col int,
+	transforms []lintrans.LinearTransformation,
+	ctsIn []*rlwe.Ciphertext,
+	hoisted []*hoistedInput,
+	dst, partial *rlwe.Ciphertext,
+) (*rlwe.Ciphertext, error) {
+	var acc *rlwe.Ciphertext
+	for j, transform := range transforms {
+		out := partial
+		if acc == nil {
+			out = dst
+		}
+
+		profileBlock(scheme, transform)
+		start := profileStart()
+		var ct *rlwe.Ciphertext
+		var err error
+		if hoisted[j] != nil {
+			ct, err = hoisted[j].evaluate(eval, linEval, transform, out)
+		} else {
+			ct, err = evaluateTransformInto(linEval, ctsIn[j], transform, out)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("block (%d, %d): %w", row, col+j, err)
+		}
+		profileStop(&profile.EvaluateNs, start)
+
+		if acc == nil {
+			acc = ct
+			continue
+		}
+
+		start = profileStart()
+		if err := addToRow(eval, acc, ct); err != nil {
+			return nil, fmt.Errorf("block (%d, %d): %w", row, col+j, err)
+		}
+		profileStop(&profile.AccumulateNs, start)
+	}
+	return acc, nil
+}
+
+// reduceTransformRow adds up the partial sums of a row's chunks into the
+// first one, and rescales it if asked to. errs holds the error of each
+// chunk, if any.
+func reduceTransformRow(
+	eval *ckks.Evaluator,
+	row int,
+	sums []*rlwe.Ciphertext,
+	errs []error,
+	rescale bool,
+) (*rlwe.Ciphertext, error) {
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	acc := sums[0]
+	start := profileStart()
+	for _, ct := range sums[1:] {
+		if err := addToRow(eval, acc, ct); err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+	}
+	profileStop(&profile.AccumulateNs, start)
+
+	if !rescale {
+		return acc, nil
+	}
+	start = profileStart()
+	if err := eval.Rescale(acc, acc); err != nil {
+		return nil, fmt.Errorf("row %d: %w", row, err)
+	}
+	profileStop(&profile.RescaleNs, start)
+	return acc, nil
+}
+
+// addToRow adds ct into the row's running sum acc, first dropping
+// whichever of the two is at a higher level.
+func addToRow(eval *ckks.Evaluator, acc, ct *rlwe.Ciphertext) error {
+	if acc.Level() > ct.Level() {
+		eval.DropLevel(acc, acc.Level()-ct.Level())
+	} else if ct.Level() > acc.Level() {
+		eval.DropLevel(ct, ct.Level()-acc.Level())
+	}
+
+	if acc.Scale.Cmp(ct.Scale) != 0 {
+		return fmt.Errorf(
+			"scale 2^%.4f does not match the accumulated scale 2^%.4f "+
+				"of the row", ct.Scale.Log2(), acc.Scale.Log2())
+	}
+	return eval.Add(acc, ct, acc)
+}
+
+// evaluateTransformInto evaluates the transform into out, first growing
+// it to the level the result will have, or into a new ciphertext when out
+// is nil.
+func evaluateTransformInto(
+	linEval *lintrans.Evaluator,
+	ctIn *rlwe.Ciphertext,
+	transform lintrans.LinearTransformation,
+	out *rlwe.Ciphertext,
+) (*rlwe.Ciphertext, error) {
+	if out == nil {
+		return linEval.EvaluateNew(ctIn, transform)
+	}
+
+	out.Resize(1, min(ctIn.Level(), transform.LevelQ))
+	if err := linEval.Evaluate(ctIn, transform, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// hoistedInput is what the blocks of a column have in common: the
+// decomposition of their input's second component and, for BSGS
+// transforms, the input's baby-step rotations. Lattigo computes these on
+// every evaluation, which for a column shared by many rows means redoing
+// the most expensive part of each block. The first worker to need them
+// computes them with its own evaluator; they are read-only afterwards,
+// and dropped once every row has used them.
+type hoistedInput struct {
+	ctIn           *rlwe.Ciphertext
+	levelQ, levelP int
+	rots           []int
+
+	once   sync.Once
+	users  atomic.Int32
+	decomp []ringqp.Poly
+	preRot map[int]*rlwe.Element[ringqp.Poly]
+	err    error
+}
+
+// Columns share a hoisted input when hoisting is enabled and their blocks
+// have at least hoistingMinDiagonals diagonals between them.
+var (
+	hoistingEnabled      = true
+	hoistingMinDiagonals = 0
+)
+
+// SetHoistedRotations turns the sharing of a column's hoisted input on or
+// off, and sets the number of diagonals below which a column is evaluated
+// block by block instead, so that both paths can be measured against each
+// other. Lattigo still hoists the rotations within each block either way.
+// Hoisting is on for every column by default.
+//
+//export SetHoistedRotations
+func SetHoistedRotations(enabled, minDiagonals C.int) {
+	hoistingEnabled = enabled != 0
+	hoistingMinDiagonals = max(int(minDiagonals), 0)
+}
+
+// newHoistedInput prepares the hoisted input of a column, or returns nil
+// when its transforms cannot share one.
+func newHoistedInput(
+	ctIn *rlwe.Ciphertext, column []lintrans.LinearTransformation,
+) *hoistedInput {
+	h := &hoistedInput{ctIn: ctIn, levelP: column[0].LevelP}
+	rots := map[int]bool{}
+	for _, transform := range column {
+		if transform.LevelP != h.levelP {
+			return nil
+		}
+		h.levelQ = max(h.levelQ, transform.LevelQ)
+		if transform.N1 != 0 {
+			_, _, rotN2 := commonlintrans.LinearTransformation(transform).BSGSIndex()
+			for _, rot := range rotN2 {
+				rots[rot] = true
+			}
+		}
+	}
+	h.levelQ = min(h.levelQ, ctIn.Level())
+	h.rots = slices.Sorted(maps.Keys(rots))
+	h.users.Store(int32(len(column)))
+	return h
+}
+
+// compute decomposes the input and applies its baby-step rotations, the
+// same way Lattigo does when evaluating the transforms together.
+func (h *hoistedInput) compute(eval *ckks.Evaluator, linEval *lintrans.Evaluator) {
+	params := *eval.GetParameters()
+	ringQP := params.RingQP().AtLevel(h.levelQ, h.levelP)
+
+	h.decomp = make([]ringqp.Poly, params.BaseRNSDecompositionVectorSize(h.levelQ, h.levelP))
+	for i := range h.decomp {
+		h.decomp[i] = ringQP.NewPoly()
+	}
+	eval.DecomposeNTT(
+		h.levelQ, h.levelP, h.levelP+1, h.ctIn.Value[1], h.ctIn.IsNTT, h.decomp)
+
+	h.preRot = map[int]*rlwe.Element[ringqp.Poly]{}
+	h.err = linEval.PreRotatedCiphertextForDiagonalMatrixMultiplication(
+		h.levelQ, h.levelP, h.ctIn, h.decomp, h.rots, h.preRot)
+}
+
+// evaluate is evaluateTransformInto for a block of the column.
+func (h *hoistedInput) evaluate(
+	eval *ckks.Evaluator,
+	linEval *lintrans.Evaluator,
+	transform lintrans.LinearTransformation,
+	out *rlwe.Ciphertext,
+) (*rlwe.Ciphertext, error) {
+	// Every row releases its use, even when computing the input failed,
+	// so that the decomposition is dropped once all of them are done.
+	defer h.release()
+	h.once.Do(func() { h.compute(eval, linEval) })
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	if out == nil {
+		out = ckks.NewCiphertext(*eval.GetParameters(), 1, transform.LevelQ)
+	}
+	out.Resize(1, min(h.ctIn.Level(), transform.LevelQ))
+
+	lt := commonlintrans.LinearTransformation(transform)
+	var err error
+	if transform.N1 == 0 {
+		err = linEval.MultiplyByDiagMatrix(h.ctIn, lt, h.decomp, out)
+	} else {
+		err = linEval.MultiplyByDiagMatrixBSGS(h.ctIn, lt, h.preRot, out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// release drops the hoisted input once the last row has used it.
+func (h *hoistedInput) release() {
+	if h.users.Add(-1) == 0 {
+		h.decomp, h.preRot = nil, nil
+	}
+}
+
+// profileBlock records one evaluated block and the key switches (one per
+// Galois element) its rotations require.
+func profileBlock(scheme *Scheme, transform lintrans.LinearTransformation) {
+	if !profilingEnabled.Load() {
+		return
+	}
+	profile.Blocks.Add(1)
+	profile.Rotations.Add(int64(len(transform.GaloisElements(scheme.Params))))
+}
+
 //export GetLinearTransformRotationKeys
 func GetLinearTransformRotationKeys(transformID C.int) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
 	transform := RetrieveLinearTransform(int(transformID))
 	galEls := transform.GaloisElements(scheme.Params)
 
@@ -121,15 +1552,173 @@ func GetLinearTransformRotationKeys(transformID C.int) (*C.int, C.ulong) {
 	return arrPtr, length
 }
 
+// PrecomputeGaloisElements returns the sorted union of the Galois elements
+// needed by a set of transforms, without generating any transform or key.
+// The diagonal indices of all transforms are concatenated in diagIdxsC, and
+// diagCountsC gives how many belong to each transform. Levels and BSGS
+// ratios are given per transform. Since no diagonal data is passed, zero
+// diagonals are not pruned and the result may be a superset of the keys
+// GenerateLinearTransform would end up requiring. Returns an empty array
+// with the last error set on invalid input.
+//
+//export PrecomputeGaloisElements
+func PrecomputeGaloisElements(
+	diagIdxsC *C.int, lenDiagIdxs C.int,
+	diagCountsC *C.int, lenDiagCounts C.int,
+	levelsC *C.int, lenLevels C.int,
+	bsgsRatiosC *C.float, lenBsgsRatios C.int,
+) (*C.ulong, C.ulong) {
+	scheme := activeScheme.Load()
+
+	diagIdxs := CArrayToSlice(diagIdxsC, lenDiagIdxs, convertCIntToInt)
+	diagCounts := CArrayToSlice(diagCountsC, lenDiagCounts, convertCIntToInt)
+	levels := CArrayToSlice(levelsC, lenLevels, convertCIntToInt)
+	bsgsRatios := CArrayToSlice(bsgsRatiosC, lenBsgsRatios, convertCFloatToFloat)
+
+	numTransforms := len(diagCounts)
+	if len(levels) != numTransforms || len(bsgsRatios) != numTransforms {
+		SetLastError(fmt.Errorf(
+			"got %d diagonal counts, %d levels and %d BSGS ratios; "+
+				"expected one of each per transform",
+			numTransforms, len(levels), len(bsgsRatios)))
+		return nil, 0
+	}
+
+	galElsSet := make(map[uint64]bool)
+	offset := 0
+	for i, count := range diagCounts {
+		if count < 0 || offset+count > len(diagIdxs) {
+			SetLastError(fmt.Errorf(
+				"diagonal counts exceed the %d diagonal indices given",
+				len(diagIdxs)))
+			return nil, 0
+		}
+		if levels[i] < 0 || levels[i] > scheme.Params.MaxLevelQ() {
+			SetLastError(fmt.Errorf(
+				"transform %d: level %d is outside [0, %d]",
+				i, levels[i], scheme.Params.MaxLevelQ()))
+			return nil, 0
+		}
+
+		ltparams := newLinearTransformParameters(
+			scheme, diagIdxs[offset:offset+count], levels[i], bsgsRatios[i])
+		for _, galEl := range lintrans.GaloisElements(scheme.Params, ltparams) {
+			galElsSet[galEl] = true
+		}
+		offset += count
+	}
+
+	galEls := GetKeysFromMap(galElsSet)
+	slices.Sort(galEls)
+
+	arrPtr, length := SliceToCArray(galEls, convertULongtoCULong)
+	return arrPtr, length
+}
+
 //export GenerateLinearTransformRotationKey
 func GenerateLinearTransformRotationKey(galEl C.int) {
-	rotKey := scheme.KeyGen.GenGaloisKeyNew(uint64(galEl), scheme.SecretKey)
+	scheme := activeScheme.Load()
+	rotKey := galoisKeyGenerator(scheme, uint64(galEl), scheme.KeyGen).
+		GenGaloisKeyNew(uint64(galEl), scheme.SecretKey)
 	scheme.EvalKeys.GaloisKeys[uint64(galEl)] = rotKey
 }
 
+// BeginKeyPlanning starts recording the Galois elements of every linear
+// transform generated from now on, so that their rotation keys can be
+// generated at once by GenerateAllRotationKeys rather than transform by
+// transform.
+//
+//export BeginKeyPlanning
+func BeginKeyPlanning() {
+	scheme := activeScheme.Load()
+	scheme.PlannedGalEls = make(map[uint64]bool)
+}
+
+// EndKeyPlanning stops recording Galois elements and forgets those
+// recorded so far.
+//
+//export EndKeyPlanning
+func EndKeyPlanning() {
+	scheme := activeScheme.Load()
+	scheme.PlannedGalEls = nil
+}
+
+// GetPlannedGaloisElements returns the sorted Galois elements recorded
+// since BeginKeyPlanning, for callers that generate and save the keys
+// themselves.
+//
+//export GetPlannedGaloisElements
+func GetPlannedGaloisElements() (*C.ulong, C.ulong) {
+	scheme := activeScheme.Load()
+	galEls := GetKeysFromMap(scheme.PlannedGalEls)
+	slices.Sort(galEls)
+	return SliceToCArray(galEls, convertULongtoCULong)
+}
+
+// GenerateAllRotationKeys generates the rotation keys of every Galois
+// element recorded since BeginKeyPlanning, and installs them for linear
+// transforms. Keys are generated concurrently, and those already
+// installed are skipped. Planning ends afterwards. Returns the number of
+// keys generated, or -1 with the last error set if planning was not on.
+//
+//export GenerateAllRotationKeys
+func GenerateAllRotationKeys() C.int {
+	scheme := activeScheme.Load()
+
+	if scheme.PlannedGalEls == nil {
+		SetLastError(fmt.Errorf(
+			"cannot generate planned rotation keys: planning is not on"))
+		return -1
+	}
+	if scheme.SecretKey == nil {
+		SetLastError(fmt.Errorf(
+			"cannot generate planned rotation keys: no active secret key"))
+		return -1
+	}
+
+	missing := []uint64{}
+	for galEl := range scheme.PlannedGalEls {
+		if _, exists := scheme.EvalKeys.GaloisKeys[galEl]; !exists {
+			missing = append(missing, galEl)
+		}
+	}
+	scheme.PlannedGalEls = nil
+
+	rotKeys := make([]*rlwe.GaloisKey, len(missing))
+	numWorkers := min(runtime.GOMAXPROCS(0), len(missing))
+
+	var wg sync.WaitGroup
+	for w := range numWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keyGen := rlwe.NewKeyGenerator(scheme.Params)
+			for i := w; i < len(missing); i += numWorkers {
+				rotKeys[i] = galoisKeyGenerator(scheme, missing[i], keyGen).
+					GenGaloisKeyNew(missing[i], scheme.SecretKey)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, galEl := range missing {
+		scheme.EvalKeys.GaloisKeys[galEl] = rotKeys[i]
+	}
+	return C.int(len(missing))
+}
+
+// GenerateAndSerializeRotationKey generates the rotation key for galEl in
+// its compressed form, where the uniformly random half of the key is
+// replaced by the seed it was sampled from. This roughly halves the keys
+// file; LoadRotationKey expands the key again.
+//
 //export GenerateAndSerializeRotationKey
 func GenerateAndSerializeRotationKey(galEl C.int) (*C.char, C.ulong) {
-	rotKey := scheme.KeyGen.GenGaloisKeyNew(uint64(galEl), scheme.SecretKey)
+	scheme := activeScheme.Load()
+
+	rotKey := galoisKeyGenerator(scheme, uint64(galEl), scheme.KeyGen).
+		GenGaloisKeyNew(uint64(galEl), scheme.SecretKey,
+			rlwe.EvaluationKeyParameters{Compressed: true})
 	data, err := rotKey.MarshalBinary() // Marshal the key to binary
 	if err != nil {
 		panic(err)
@@ -139,23 +1728,81 @@ func GenerateAndSerializeRotationKey(galEl C.int) (*C.char, C.ulong) {
 	return arrPtr, length
 }
 
+// LoadRotationKey installs a serialized rotation key for galEl. Returns 0
+// on success, and -1 with the last error set if the data does not decode.
+//
 //export LoadRotationKey
 func LoadRotationKey(
 	dataPtr *C.char, lenData C.ulong,
 	galEl C.ulong,
-) {
+) C.int {
+	scheme := activeScheme.Load()
+
+	defer profileStop(&profile.DiskLoadNs, profileStart())
 	rotKeySerial := CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData))
 
-	// Unmarshal the binary data into a GaloisKey
-	var rotKey rlwe.GaloisKey
-	if err := rotKey.UnmarshalBinary(rotKeySerial); err != nil {
-		panic(err)
+	rotKey, err := unmarshalRotationKey(rotKeySerial, *scheme.Params)
+	if err != nil {
+		SetLastError(fmt.Errorf(
+			"cannot load rotation key for Galois element %d: %w", uint64(galEl), err))
+		return -1
 	}
 
 	// Update our global map of evaluation keys to include what
 	// we just loaded. This will eventually get used by the
 	// current linear transform and then deleted from RAM.
-	scheme.EvalKeys.GaloisKeys[uint64(galEl)] = &rotKey
+	scheme.EvalKeys.GaloisKeys[uint64(galEl)] = rotKey
+	rotKeyCache.Put(rotKeyCacheKey{scheme.KeysPath, uint64(galEl)}, rotKey)
+	return 0
+}
+
+// unmarshalRotationKey decodes a rotation key read from the keys file.
+// Keys files written before compression was introduced hold full keys,
+// which are used as they are.
+func unmarshalRotationKey(data []byte, params ckks.Parameters) (*rlwe.GaloisKey, error) {
+	rotKey := &rlwe.GaloisKey{}
+	if err := rotKey.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if rotKey.IsCompressed() {
+		if err := rotKey.Expand(params, nil); err != nil {
+			return nil, err
+		}
+	}
+	return rotKey, nil
+}
+
+// LoadCachedRotationKey installs the rotation key for galEl from the key
+// cache, if it is there. Returns 1 when it was, or when the key is already
+// installed, and 0 when the caller has to load it from disk instead.
+//
+//export LoadCachedRotationKey
+func LoadCachedRotationKey(galEl C.ulong) C.int {
+	scheme := activeScheme.Load()
+
+	if _, ok := scheme.EvalKeys.GaloisKeys[uint64(galEl)]; ok {
+		return 1
+	}
+
+	cacheKey := rotKeyCacheKey{scheme.KeysPath, uint64(galEl)}
+	waitForPrefetch(cacheKey)
+
+	rotKey, ok := rotKeyCache.Get(cacheKey)
+	if !ok {
+		return 0
+	}
+	scheme.EvalKeys.GaloisKeys[uint64(galEl)] = rotKey
+	return 1
+}
+
+//export SetKeyCacheCapacity
+func SetKeyCacheCapacity(capacityBytes C.ulong) {
+	rotKeyCache.SetCapacity(int64(capacityBytes))
+}
+
+//export ClearKeyCache
+func ClearKeyCache() {
+	rotKeyCache.Clear()
 }
 
 //export SerializeDiagonal
@@ -176,24 +1823,98 @@ func SerializeDiagonal(transformID, diagIdx C.int) (*C.char, C.ulong) {
 	return arrPtr, length
 }
 
+// LoadPlaintextDiagonal installs a serialized diagonal of a transform.
+// Returns 0 on success, and -1 with the last error set if the data does
+// not decode or the transform has no such diagonal.
+//
 //export LoadPlaintextDiagonal
 func LoadPlaintextDiagonal(
 	dataPtr *C.char, lenData C.ulong,
 	transformID C.int,
 	diagIdx C.ulong,
-) {
-	transform := RetrieveLinearTransform(int(transformID))
+) C.int {
+	defer profileStop(&profile.DiskLoadNs, profileStart())
 	diagSerial := CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData))
 
+	if err := loadPlaintextDiagonal(int(transformID), int(diagIdx), diagSerial); err != nil {
+		SetLastError(fmt.Errorf(
+			"cannot load diagonal %d of transform %d: %w",
+			int(diagIdx), int(transformID), err))
+		return -1
+	}
+	return 0
+}
+
+// loadPlaintextDiagonal decodes a diagonal into a transform. Only the
+// diagonals the transform was generated with can be loaded: a saved
+// diagonal that was pruned when generating it (e.g. with a higher prune
+// threshold than when saving) would otherwise be added to it silently.
+func loadPlaintextDiagonal(transformID, diagIdx int, data []byte) error {
+	transform := RetrieveLinearTransform(transformID)
+	if _, planned := transform.Vec[diagIdx]; !planned {
+		return fmt.Errorf("the transform was not generated with this diagonal")
+	}
+
 	var poly ringqp.Poly
-	if err := poly.UnmarshalBinary(diagSerial); err != nil {
-		panic(err)
+	if err := poly.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	transform.Vec[diagIdx] = poly
+	diagCache.Put(diagCacheKey{transformID, diagIdx}, poly)
+	return nil
+}
+
+// LoadCachedPlaintextDiagonals installs every diagonal of a transform from
+// the diagonal cache. Returns 1 when all of them were there, and 0 when
+// the caller has to load them from disk instead.
+//
+//export LoadCachedPlaintextDiagonals
+func LoadCachedPlaintextDiagonals(transformID C.int) C.int {
+	transform := RetrieveLinearTransform(int(transformID))
+
+	diags := make(map[int]ringqp.Poly, len(transform.Vec))
+	for diagIdx := range transform.Vec {
+		diag, ok := diagCache.Get(diagCacheKey{int(transformID), diagIdx})
+		if !ok {
+			return 0
+		}
+		diags[diagIdx] = diag
 	}
-	transform.Vec[int(diagIdx)] = poly
+	for diagIdx, diag := range diags {
+		transform.Vec[diagIdx] = diag
+	}
+	return 1
+}
+
+// HasCachedPlaintextDiagonals reports whether every diagonal of a
+// transform is in the diagonal cache, so the caller can skip reading them
+// from disk. Unlike LoadCachedPlaintextDiagonals, it does not install
+// them, and so is safe to call while another transform is being
+// evaluated. Returns 1 or 0.
+//
+//export HasCachedPlaintextDiagonals
+func HasCachedPlaintextDiagonals(transformID C.int) C.int {
+	for diagIdx := range RetrieveLinearTransform(int(transformID)).Vec {
+		if !diagCache.Contains(diagCacheKey{int(transformID), diagIdx}) {
+			return 0
+		}
+	}
+	return 1
+}
+
+//export SetDiagonalCacheCapacity
+func SetDiagonalCacheCapacity(capacityBytes C.ulong) {
+	diagCache.SetCapacity(int64(capacityBytes))
+}
+
+//export ClearDiagonalCache
+func ClearDiagonalCache() {
+	diagCache.Clear()
 }
 
 //export RemovePlaintextDiagonals
 func RemovePlaintextDiagonals(transformID C.int) {
+	removeReencodedTransforms(int(transformID))
 	linTransf := RetrieveLinearTransform(int(transformID))
 	for diag := range linTransf.Vec {
 		linTransf.Vec[diag] = ringqp.Poly{}
@@ -202,10 +1923,37 @@ func RemovePlaintextDiagonals(transformID C.int) {
 
 //export RemoveRotationKeys
 func RemoveRotationKeys() {
-	// We'll just update the linear transform evaluator to no longer have
-	// access to the Galois keys it had before. GC should do the rest.
-	scheme.EvalKeys = rlwe.NewMemEvaluationKeySet(scheme.RelinKey)
-	scheme.LinEvaluator = lintrans.NewEvaluator(scheme.Evaluator.WithKey(
-		scheme.EvalKeys,
-	))
+	scheme := activeScheme.Load()
+
+	// This runs after every block on the disk path, so we empty the key
+	// set in place rather than allocating a new one (and evaluator) each
+	// time. The linear transform evaluator shares this key set, so it
+	// loses access to the Galois keys as well, except for the live ones
+	// (see EnsureRotationKey), which are not on disk to be loaded again.
+	// GC should do the rest.
+	clear(scheme.EvalKeys.GaloisKeys)
+	maps.Copy(scheme.EvalKeys.GaloisKeys, scheme.LiveRotKeys)
+	scheme.EvalKeys.RelinearizationKey = scheme.RelinKey
+}
+
+// RetainRotationKeys is RemoveRotationKeys for the keys of the current
+// block only: the keys for galEls, which the next block needs as well,
+// stay loaded, so that they are not read back from disk.
+//
+//export RetainRotationKeys
+func RetainRotationKeys(galElsC *C.ulong, lenGalEls C.int) {
+	scheme := activeScheme.Load()
+
+	keep := make(map[uint64]bool, int(lenGalEls))
+	for _, galEl := range CArrayToSlice(galElsC, lenGalEls, func(v C.ulong) uint64 {
+		return uint64(v)
+	}) {
+		keep[galEl] = true
+	}
+
+	maps.DeleteFunc(scheme.EvalKeys.GaloisKeys, func(galEl uint64, _ *rlwe.GaloisKey) bool {
+		_, live := scheme.LiveRotKeys[galEl]
+		return !keep[galEl] && !live
+	})
+	scheme.EvalKeys.RelinearizationKey = scheme.RelinKey
 }
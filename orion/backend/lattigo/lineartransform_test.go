@@ -0,0 +1,548 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/ring"
+	"github.com/baahl-nyu/lattigo/v6/ring/ringqp"
+)
+
+// newTestTransform encodes a transform with the given diagonals at level
+// the way newLinearTransform does, installs its rotation keys and returns
+// its ID.
+func newTestTransform(tb testing.TB, scheme *Scheme, diags map[int][]float64, level int) int {
+	tb.Helper()
+
+	diagonals := lintrans.Diagonals[float64](diags)
+	lt := allocateLinearTransform(scheme, diagonals.DiagonalsIndexList(), level, 1, "none")
+	if err := lintrans.Encode(scheme.Encoder, diagonals, lt); err != nil {
+		tb.Fatal(err)
+	}
+
+	transformID := ltHeap.Add(lt)
+	generateRotationKeys(scheme, transformID)
+	return transformID
+}
+
+// Blocks of a row generated at different levels are brought to the lowest
+// one before being added up, rather than failing or adding garbage.
+func TestEvaluateLinearTransformsMixedLevels(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(1, 2))
+	slots := scheme.Params.MaxSlots()
+	maxLevel := scheme.Params.MaxLevel()
+
+	x0, x1 := randomValues(rng, slots), randomValues(rng, slots)
+	diags0 := map[int][]float64{0: randomValues(rng, slots), 1: randomValues(rng, slots)}
+	diags1 := map[int][]float64{0: randomValues(rng, slots), 3: randomValues(rng, slots)}
+
+	transformIDs := []int{
+		newTestTransform(t, scheme, diags0, maxLevel),
+		newTestTransform(t, scheme, diags1, maxLevel-1),
+	}
+	ctIDs := []int{
+		encryptValues(t, scheme, x0, maxLevel),
+		encryptValues(t, scheme, x1, maxLevel),
+	}
+
+	outIDs, err := evaluateLinearTransforms(scheme, transformIDs, ctIDs, nil, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outIDs) != 1 {
+		t.Fatalf("got %d output rows, want 1", len(outIDs))
+	}
+	if level := RetrieveCiphertext(outIDs[0]).Level(); level != maxLevel-2 {
+		t.Errorf("output is at level %d, want %d", level, maxLevel-2)
+	}
+
+	want := applyDiagonals(diags0, x0)
+	for i, v := range applyDiagonals(diags1, x1) {
+		want[i] += v
+	}
+	if err := maxError(want, decryptValues(t, scheme, outIDs[0])); err > 1e-6 {
+		t.Errorf("output differs from the expected one by up to %g", err)
+	}
+}
+
+// Pruning zero and near-zero diagonals leaves a transform's output as it
+// was without pruning, and a pruned diagonal cannot be loaded back in.
+func TestPrunedTransformOutput(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(21, 22))
+	slots := scheme.Params.MaxSlots()
+
+	tiny := randomValues(rng, slots)
+	for i := range tiny {
+		tiny[i] *= 1e-13
+	}
+	diags := map[int][]float64{
+		0:  randomValues(rng, slots),
+		3:  make([]float64, slots),
+		7:  randomValues(rng, slots),
+		12: tiny,
+		40: make([]float64, slots),
+	}
+	diagIdxs := slices.Sorted(maps.Keys(diags))
+	weights := []float64{}
+	for _, k := range diagIdxs {
+		weights = append(weights, diags[k]...)
+	}
+
+	unprunedID := newTestTransform(t, scheme, diags, testMaxLevel)
+	prunedID := int(generateLinearTransform(
+		scheme, diagIdxs, weights, testMaxLevel, -1, 1, 0, "none"))
+	if prunedID < 0 {
+		t.Fatal(lastError)
+	}
+	generateRotationKeys(scheme, prunedID)
+
+	pruned := RetrieveLinearTransform(prunedID)
+	if got := slices.Sorted(maps.Keys(pruned.Vec)); !slices.Equal(got, []int{0, 7}) {
+		t.Errorf("kept diagonals %v, want [0 7]", got)
+	}
+
+	x := randomValues(rng, slots)
+	evaluate := func(transformID int) []float64 {
+		ctID := encryptValues(t, scheme, x, testMaxLevel)
+		outIDs, err := evaluateLinearTransforms(
+			scheme, []int{transformID}, []int{ctID}, nil, 1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decryptValues(t, scheme, outIDs[0])
+	}
+	want, got := evaluate(unprunedID), evaluate(prunedID)
+	if err := maxError(want, got); err > 1e-6 {
+		t.Errorf("pruned output differs from the unpruned one by up to %g", err)
+	}
+	if err := maxError(applyDiagonals(diags, x), got); err > 1e-6 {
+		t.Errorf("pruned output differs from the expected one by up to %g", err)
+	}
+
+	data, err := RetrieveLinearTransform(unprunedID).Vec[3].MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadPlaintextDiagonal(prunedID, 3, data); err == nil {
+		t.Error("loaded a diagonal the transform was pruned of")
+	}
+	if _, ok := pruned.Vec[3]; ok {
+		t.Error("a rejected diagonal was added to the transform")
+	}
+}
+
+// On the conjugate-invariant ring, a transform acts on N real slots rather
+// than N/2, with wrapping diagonals, with and without BSGS.
+func TestGenerateLinearTransformConjugateInvariant(t *testing.T) {
+	lit := testParams
+	lit.RingType = ring.ConjugateInvariant
+	scheme := newTestScheme(t, lit)
+	rng := rand.New(rand.NewPCG(19, 20))
+	slots := scheme.Params.MaxSlots()
+	if slots != scheme.Params.N() {
+		t.Fatalf("got %d slots, want N = %d", slots, scheme.Params.N())
+	}
+
+	diagIdxs := []int{0, 1, 5, 64, slots - 3}
+	diags := map[int][]float64{}
+	weights := []float64{}
+	for _, k := range diagIdxs {
+		diags[k] = randomValues(rng, slots)
+		weights = append(weights, diags[k]...)
+	}
+	x := randomValues(rng, slots)
+	want := applyDiagonals(diags, x)
+
+	for name, bsgsRatio := range map[string]float64{"bsgs": 2, "no bsgs": 0.25} {
+		t.Run(name, func(t *testing.T) {
+			transformID := int(generateLinearTransform(
+				scheme, diagIdxs, weights, testMaxLevel, -1, bsgsRatio, 0, "none"))
+			if transformID < 0 {
+				t.Fatal(lastError)
+			}
+			generateRotationKeys(scheme, transformID)
+
+			ctID := encryptValues(t, scheme, x, testMaxLevel)
+			outIDs, err := evaluateLinearTransforms(
+				scheme, []int{transformID}, []int{ctID}, nil, 1, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := maxError(want, decryptValues(t, scheme, outIDs[0])); err > 1e-6 {
+				t.Errorf("output differs from the expected one by up to %g", err)
+			}
+		})
+	}
+}
+
+// Weights passed as doubles survive encoding at the precision CKKS
+// offers, while the float32 entry point rounds them first.
+func TestGenerateLinearTransformF64Precision(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(3, 4))
+	slots := scheme.Params.MaxSlots()
+
+	diagIdxs := []int{0, 1, 2}
+	diags := map[int][]float64{}
+	weights := []float64{}
+	for _, k := range diagIdxs {
+		diags[k] = randomValues(rng, slots)
+		weights = append(weights, diags[k]...)
+	}
+	x := randomValues(rng, slots)
+	want := applyDiagonals(diags, x)
+
+	// The diagonals reach generateLinearTransform as they would through
+	// each entry point's C array conversion.
+	entryPoints := map[string][]float64{
+		"GenerateLinearTransform": convertWeights(
+			weights, convertFloatToCFloat, convertCFloatToFloat),
+		"GenerateLinearTransformF64": convertWeights(
+			weights, convertFloat64ToCDouble, convertCDoubleToFloat),
+	}
+
+	errs := map[string]float64{}
+	for name, data := range entryPoints {
+		transformID := int(generateLinearTransform(
+			scheme, diagIdxs, data, testMaxLevel, -1, 1, 0, "none"))
+		if transformID < 0 {
+			t.Fatalf("%s: %v", name, lastError)
+		}
+		generateRotationKeys(scheme, transformID)
+
+		ctID := encryptValues(t, scheme, x, testMaxLevel)
+		outIDs, err := evaluateLinearTransforms(
+			scheme, []int{transformID}, []int{ctID}, nil, 0, true)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		errs[name] = maxError(want, decryptValues(t, scheme, outIDs[0]))
+		t.Logf("%s: max error %g", name, errs[name])
+	}
+
+	if errs["GenerateLinearTransformF64"] > errs["GenerateLinearTransform"]/10 {
+		t.Errorf("float64 diagonals are not more precise than float32 ones: "+
+			"max error %g against %g", errs["GenerateLinearTransformF64"],
+			errs["GenerateLinearTransform"])
+	}
+}
+
+// convertWeights passes weights through the conversions of a C array
+// of diagonal data and back.
+func convertWeights[U any](weights []float64, to func(float64) U, from func(U) float64) []float64 {
+	out := make([]float64, len(weights))
+	for i, w := range weights {
+		out[i] = from(to(w))
+	}
+	return out
+}
+
+// Streaming a transform's diagonals by giant step gives the output of
+// evaluating it with every diagonal loaded, with and without BSGS, and
+// reads each diagonal once.
+func TestEvaluateLinearTransformStreamed(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(13, 14))
+	slots := scheme.Params.MaxSlots()
+
+	diags := map[int][]float64{}
+	for _, k := range []int{0, 1, 2, 5, 9, 17, 33, 64, slots - 1} {
+		diags[k] = randomValues(rng, slots)
+	}
+	x := randomValues(rng, slots)
+	want := applyDiagonals(diags, x)
+
+	// A log ratio below zero turns BSGS off.
+	for name, bsgsRatio := range map[string]float64{"bsgs": 4, "no bsgs": 0.25} {
+		t.Run(name, func(t *testing.T) {
+			diagonals := lintrans.Diagonals[float64](diags)
+			lt := allocateLinearTransform(
+				scheme, diagonals.DiagonalsIndexList(), testMaxLevel, bsgsRatio, "none")
+			if err := lintrans.Encode(scheme.Encoder, diagonals, lt); err != nil {
+				t.Fatal(err)
+			}
+			if (lt.N1 != 0) != (name == "bsgs") {
+				t.Fatalf("transform has N1 = %d", lt.N1)
+			}
+			transformID := ltHeap.Add(lt)
+			generateRotationKeys(scheme, transformID)
+			ctID := encryptValues(t, scheme, x, testMaxLevel)
+
+			outIDs, err := evaluateLinearTransforms(
+				scheme, []int{transformID}, []int{ctID}, nil, 1, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded := decryptValues(t, scheme, outIDs[0])
+
+			// Diagonals come back from their serialized form, as from disk.
+			reads := map[int]int{}
+			ctOut, err := evaluateLinearTransformStreamed(scheme, lt, RetrieveCiphertext(ctID),
+				func(diagIdx int) (ringqp.Poly, error) {
+					reads[diagIdx]++
+					data, err := lt.Vec[diagIdx].MarshalBinary()
+					if err != nil {
+						return ringqp.Poly{}, err
+					}
+					var diag ringqp.Poly
+					return diag, diag.UnmarshalBinary(data)
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamed := decryptValues(t, scheme, PushCiphertext(ctOut))
+
+			for diagIdx := range lt.Vec {
+				if reads[diagIdx] != 1 {
+					t.Errorf("diagonal %d was read %d times", diagIdx, reads[diagIdx])
+				}
+			}
+			if err := maxError(loaded, streamed); err > 1e-9 {
+				t.Errorf("streamed output differs from the loaded one by up to %g", err)
+			}
+			if err := maxError(want, streamed); err > 1e-6 {
+				t.Errorf("streamed output differs from the expected one by up to %g", err)
+			}
+		})
+	}
+}
+
+// A transform given by row diagonals computes the same as the dense
+// transform of the block-diagonal matrix it stands for.
+func TestGenerateLinearTransformRows(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(27, 28))
+	slots := scheme.Params.MaxSlots()
+	const cols = 8
+	logRows := scheme.Params.LogMaxSlots() - 3
+
+	// Row r multiplies its slots by a matrix of its own, matrices[r],
+	// which is zero outside row diagonals diagIdxs.
+	diagIdxs := []int{0, 1, 3, 6, 7}
+	matrices := make([][][]float64, slots/cols)
+	for r := range matrices {
+		matrices[r] = make([][]float64, cols)
+		for j := range matrices[r] {
+			matrices[r][j] = make([]float64, cols)
+			for _, k := range diagIdxs {
+				matrices[r][j][(j+k)%cols] = 2*rng.Float64() - 1
+			}
+		}
+	}
+	entry := func(i, col int) float64 {
+		r, j := i/cols, i%cols
+		if col/cols != r {
+			return 0
+		}
+		return matrices[r][j][col%cols]
+	}
+
+	diagDataFlat := make([]float64, 0, len(diagIdxs)*slots)
+	for _, k := range diagIdxs {
+		for i := 0; i < slots; i++ {
+			r := i / cols
+			diagDataFlat = append(diagDataFlat, entry(i, r*cols+(i%cols+k)%cols))
+		}
+	}
+	rowDiags, err := rowDiagonals(slots, logRows, diagIdxs, diagDataFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The dense diagonals come from the matrix itself, for every offset a
+	// block-diagonal matrix can have entries at.
+	denseDiags := map[int][]float64{}
+	for d := -cols + 1; d < cols; d++ {
+		diag := make([]float64, slots)
+		for i := range diag {
+			if col := i + d; col >= 0 && col < slots {
+				diag[i] = entry(i, col)
+			}
+		}
+		denseDiags[(d+slots)%slots] = diag
+	}
+
+	x := randomValues(rng, slots)
+	want := make([]float64, slots)
+	for i := range want {
+		r := i / cols
+		for c := 0; c < cols; c++ {
+			want[i] += entry(i, r*cols+c) * x[r*cols+c]
+		}
+	}
+
+	outputs := map[string][]float64{}
+	for name, diags := range map[string]map[int][]float64{
+		"rows": rowDiags, "dense": denseDiags,
+	} {
+		transformID := newTestTransform(t, scheme, diags, testMaxLevel)
+		ctID := encryptValues(t, scheme, x, testMaxLevel)
+		outIDs, err := evaluateLinearTransforms(
+			scheme, []int{transformID}, []int{ctID}, nil, 1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs[name] = decryptValues(t, scheme, outIDs[0])
+	}
+
+	if err := maxError(outputs["dense"], outputs["rows"]); err > 1e-6 {
+		t.Errorf("rows output differs from the dense one by up to %g", err)
+	}
+	if err := maxError(want, outputs["rows"]); err > 1e-6 {
+		t.Errorf("rows output differs from the expected one by up to %g", err)
+	}
+
+	if _, err := rowDiagonals(slots, logRows, []int{cols}, make([]float64, slots)); err == nil {
+		t.Error("accepted a row diagonal outside the row")
+	}
+}
+
+// Rows of blocks are independent, so on a machine with 8 cores an 8-row
+// transform should run close to 8 times faster on 8 workers than on one.
+func BenchmarkEvaluateLinearTransformsRows(b *testing.B) {
+	scheme := newTestScheme(b, testParams)
+	rng := rand.New(rand.NewPCG(7, 8))
+	slots := scheme.Params.MaxSlots()
+
+	const rows = 8
+	transformIDs := make([]int, rows)
+	for i := range transformIDs {
+		diags := map[int][]float64{}
+		for k := range 16 {
+			diags[k] = randomValues(rng, slots)
+		}
+		transformIDs[i] = newTestTransform(b, scheme, diags, testMaxLevel)
+	}
+	ctIDs := []int{encryptValues(b, scheme, randomValues(rng, slots), testMaxLevel)}
+
+	for _, workers := range []int{1, 2, 4, rows} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				outIDs, err := evaluateLinearTransforms(
+					scheme, transformIDs, ctIDs, nil, workers, true)
+				if err != nil {
+					b.Fatal(err)
+				}
+				ctHeap.DeleteMany(outIDs)
+			}
+		})
+	}
+}
+
+// Evaluating a layer into an existing output ciphertext allocates less
+// than evaluating it into a new one, here over 10 layers of the same
+// transform.
+func BenchmarkEvaluateLinearTransformsInto(b *testing.B) {
+	scheme := newTestScheme(b, testParams)
+	rng := rand.New(rand.NewPCG(9, 10))
+	slots := scheme.Params.MaxSlots()
+
+	const layers = 10
+	diags := map[int][]float64{}
+	for k := range 8 {
+		diags[k] = randomValues(rng, slots)
+	}
+	transformIDs := []int{newTestTransform(b, scheme, diags, testMaxLevel)}
+	ctIDs := []int{encryptValues(b, scheme, randomValues(rng, slots), testMaxLevel)}
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			for range layers {
+				outIDs, err := evaluateLinearTransforms(scheme, transformIDs, ctIDs, nil, 1, true)
+				if err != nil {
+					b.Fatal(err)
+				}
+				ctHeap.DeleteMany(outIDs)
+			}
+		}
+	})
+
+	b.Run("into", func(b *testing.B) {
+		dstIDs := []int{encryptValues(b, scheme, make([]float64, slots), testMaxLevel)}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			for range layers {
+				if _, err := evaluateLinearTransforms(
+					scheme, transformIDs, ctIDs, dstIDs, 1, true); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// In "load" mode, the rotation keys of every block are cleared once it has
+// been evaluated. Doing so in place allocates less than rebuilding the key
+// set (with the live keys) and evaluator, as was done before. Keys and
+// diagonals are installed already decoded, as from the key and diagonal
+// caches.
+func BenchmarkRemoveRotationKeysLoadMode(b *testing.B) {
+	scheme := newTestScheme(b, testParams)
+	rng := rand.New(rand.NewPCG(11, 12))
+	slots := scheme.Params.MaxSlots()
+
+	const blocks = 16
+	transforms := make([]lintrans.LinearTransformation, blocks)
+	blockDiags := make([]map[int]ringqp.Poly, blocks)
+	blockKeys := make([]map[uint64]*rlwe.GaloisKey, blocks)
+	for j := range blocks {
+		diags := map[int][]float64{}
+		for k := range 4 {
+			diags[4*j+k] = randomValues(rng, slots)
+		}
+		encoded := RetrieveLinearTransform(newTestTransform(b, scheme, diags, testMaxLevel))
+
+		blockDiags[j] = encoded.Vec
+		blockKeys[j] = map[uint64]*rlwe.GaloisKey{}
+		for _, galEl := range encoded.GaloisElements(scheme.Params) {
+			blockKeys[j][galEl] = scheme.EvalKeys.GaloisKeys[galEl]
+		}
+		transforms[j] = allocateLinearTransform(
+			scheme, slices.Collect(maps.Keys(encoded.Vec)), testMaxLevel, 1, "load")
+	}
+	RemoveRotationKeys()
+	ctIn := RetrieveCiphertext(encryptValues(b, scheme, randomValues(rng, slots), testMaxLevel))
+
+	removeRotationKeys := map[string]func(){
+		"rebuild": func() {
+			scheme.EvalKeys = rlwe.NewMemEvaluationKeySet(
+				scheme.RelinKey, slices.Collect(maps.Values(scheme.LiveRotKeys))...)
+			scheme.LinEvaluator = lintrans.NewEvaluator(
+				scheme.Evaluator.WithKey(scheme.EvalKeys))
+		},
+		"in-place": RemoveRotationKeys,
+	}
+
+	for _, name := range []string{"rebuild", "in-place"} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				for j, transform := range transforms {
+					maps.Copy(scheme.EvalKeys.GaloisKeys, blockKeys[j])
+					maps.Copy(transform.Vec, blockDiags[j])
+
+					// As in EvaluateLinearTransform.
+					scheme.LinEvaluator = lintrans.NewEvaluator(
+						scheme.Evaluator.WithKey(scheme.EvalKeys))
+					if _, err := scheme.LinEvaluator.EvaluateNew(ctIn, transform); err != nil {
+						b.Fatal(err)
+					}
+
+					for diag := range transform.Vec {
+						transform.Vec[diag] = ringqp.Poly{}
+					}
+					removeRotationKeys[name]()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "C"
+import (
+	"log"
+	"os"
+)
+
+// Log levels accepted by SetLogLevel.
+const (
+	LogSilent = iota
+	LogInfo
+	LogDebug
+)
+
+// Diagnostics go to stderr so they never mix with output that Python may
+// be parsing, and nothing is logged unless SetLogLevel asks for it.
+var (
+	logLevel = LogSilent
+	logger   = log.New(os.Stderr, "[orion] ", log.LstdFlags)
+)
+
+//export SetLogLevel
+func SetLogLevel(level C.int) {
+	logLevel = min(max(int(level), LogSilent), LogDebug)
+}
+
+func logInfo(format string, args ...interface{}) {
+	if logLevel >= LogInfo {
+		logger.Printf(format, args...)
+	}
+}
+
+func logDebug(format string, args ...interface{}) {
+	if logLevel >= LogDebug {
+		logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"C"
+	"fmt"
+	"sync"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+)
+
+// slotMask selects the slots start, start + stride, ... below end. Its
+// encodings, and those of its complement, are cached per scheme and level,
+// since the same masks tend to be applied on every inference.
+type slotMask struct {
+	start, end, stride int
+}
+
+type slotMaskKey struct {
+	mask       slotMask
+	complement bool
+	schemeID   int
+	level      int
+}
+
+var (
+	slotMaskCacheMu sync.Mutex
+	slotMaskCache   = map[slotMaskKey]*rlwe.Plaintext{}
+)
+
+func newSlotMask(scheme *Scheme, start, end, stride int) (slotMask, error) {
+	slots := scheme.Params.MaxSlots()
+	if start < 0 || end > slots || start >= end || stride <= 0 {
+		return slotMask{}, fmt.Errorf(
+			"invalid mask: slots [%d, %d) with stride %d in %d slots",
+			start, end, stride, slots)
+	}
+	return slotMask{start, end, stride}, nil
+}
+
+// plaintext returns the mask, or its complement, encoded at level.
+func (m slotMask) plaintext(scheme *Scheme, level int, complement bool) (*rlwe.Plaintext, error) {
+	key := slotMaskKey{m, complement, scheme.ID, level}
+	slotMaskCacheMu.Lock()
+	plaintext, exists := slotMaskCache[key]
+	slotMaskCacheMu.Unlock()
+	if exists {
+		return plaintext, nil
+	}
+
+	values := make([]float64, scheme.Params.MaxSlots())
+	for i := m.start; i < m.end; i += m.stride {
+		values[i] = 1
+	}
+	if complement {
+		for i := range values {
+			values[i] = 1 - values[i]
+		}
+	}
+
+	plaintext, err := newMaskPlaintext(scheme, values, level)
+	if err != nil {
+		return nil, err
+	}
+	slotMaskCacheMu.Lock()
+	slotMaskCache[key] = plaintext
+	slotMaskCacheMu.Unlock()
+	return plaintext, nil
+}
+
+func clearSlotMaskCache() {
+	slotMaskCacheMu.Lock()
+	defer slotMaskCacheMu.Unlock()
+	slotMaskCache = map[slotMaskKey]*rlwe.Plaintext{}
+}
+
+// MaskCiphertext zeroes every slot of a ciphertext outside the mask given
+// by start, end and stride, consuming one level. Returns the ID of the
+// result, or -1 with the last error set.
+//
+//export MaskCiphertext
+func MaskCiphertext(ciphertextID, start, end, stride C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	mask, err := newSlotMask(scheme, int(start), int(end), int(stride))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	ctOut, err := selectSlots(scheme, ctIn, nil, mask)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+// SelectCiphertexts takes the slots inside the mask given by start, end
+// and stride from the first ciphertext and the others from the second,
+// i.e. ct0 * mask + ct1 * (1 - mask). Both products are rescaled together,
+// so this consumes a single level below the lower input. Returns the ID
+// of the result, or -1 with the last error set.
+//
+//export SelectCiphertexts
+func SelectCiphertexts(ctID0, ctID1, start, end, stride C.int) C.int {
+	scheme := activeScheme.Load()
+
+	for _, id := range []C.int{ctID0, ctID1} {
+		if !ctHeap.Exists(int(id)) {
+			SetLastError(fmt.Errorf("ciphertext %d does not exist", int(id)))
+			return -1
+		}
+	}
+	mask, err := newSlotMask(scheme, int(start), int(end), int(stride))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	ct0 := RetrieveCiphertext(int(ctID0))
+	ct1 := RetrieveCiphertext(int(ctID1))
+
+	ctOut, err := selectSlots(scheme, ct0, ct1, mask)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+// selectSlots returns ct0 * mask + ct1 * (1 - mask), or ct0 * mask when
+// ct1 is nil.
+func selectSlots(
+	scheme *Scheme, ct0, ct1 *rlwe.Ciphertext, mask slotMask,
+) (*rlwe.Ciphertext, error) {
+	level := ct0.Level()
+	if ct1 != nil {
+		level = min(level, ct1.Level())
+		ct0, ct1 = atLevel(scheme, ct0, level), atLevel(scheme, ct1, level)
+	}
+	if level < scheme.Params.LevelsConsumedPerRescaling() {
+		return nil, fmt.Errorf(
+			"cannot mask a ciphertext at level %d: "+
+				"no level left to rescale the product", level)
+	}
+
+	plaintext, err := mask.plaintext(scheme, level, false)
+	if err != nil {
+		return nil, err
+	}
+	ctOut, err := scheme.Evaluator.MulNew(ct0, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	if ct1 != nil {
+		complement, err := mask.plaintext(scheme, level, true)
+		if err != nil {
+			return nil, err
+		}
+		if err := scheme.Evaluator.MulThenAdd(ct1, complement, ctOut); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		return nil, err
+	}
+	return ctOut, nil
+}
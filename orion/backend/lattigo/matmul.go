@@ -0,0 +1,282 @@
+package main
+
+import (
+	"C"
+	"fmt"
+	"slices"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+)
+
+// Encrypted matrix products follow Jiang, Kim, Lauter and Song (JKLS,
+// CCS '18). A d x d matrix is packed row-major into d*d slots, and
+// replicated across the slot vector so that rotating all slots also rotates
+// every copy. The product of A and B is then
+//
+//	sum_k phi^k(sigma(A)) * psi^k(tau(B))
+//
+// where sigma shifts row i of A left by i, tau shifts column j of B up by
+// j, phi^k shifts every row left by k and psi^k every column up by k. Each
+// permutation is a sum of masked rotations. psi^k is a single rotation, so
+// the product takes three levels: one for sigma and tau, one for phi^k and
+// one for the multiplication itself.
+
+// matPermutation maps the (row, col) entry of a permuted d x d matrix to
+// the entry of the input it is taken from.
+type matPermutation func(row, col int) (srcRow, srcCol int)
+
+// matMulPermutations returns sigma, tau (applied to B^T when transposeB is
+// set, which costs nothing more), phi^k and psi^k for d x d matrices.
+func matMulPermutations(d int, transposeB bool) (
+	sigma, tau matPermutation, phi, psi func(k int) matPermutation,
+) {
+	sigma = func(i, j int) (int, int) { return i, (i + j) % d }
+	tau = func(i, j int) (int, int) { return (i + j) % d, j }
+	if transposeB {
+		tau = func(i, j int) (int, int) { return j, (i + j) % d }
+	}
+	phi = func(k int) matPermutation {
+		return func(i, j int) (int, int) { return i, (j + k) % d }
+	}
+	psi = func(k int) matPermutation {
+		return func(i, j int) (int, int) { return (i + k) % d, j }
+	}
+	return sigma, tau, phi, psi
+}
+
+// permutationMasks groups the entries of a d x d permutation by the
+// rotation that brings them in place, returning the slots of the matrix
+// each rotation is kept at. Rotations are taken modulo d*d.
+func permutationMasks(d int, perm matPermutation) map[int][]int {
+	n := d * d
+	masks := map[int][]int{}
+	for i := range d {
+		for j := range d {
+			si, sj := perm(i, j)
+			rot := ((si*d+sj-(i*d+j))%n + n) % n
+			masks[rot] = append(masks[rot], i*d+j)
+		}
+	}
+	return masks
+}
+
+// MatMulRotationSteps returns the rotation steps MatMulCiphertexts needs
+// for d x d matrices, so their keys can be planned or generated ahead of
+// time. Returns an empty array with the last error set on failure.
+//
+//export MatMulRotationSteps
+func MatMulRotationSteps(dim C.int, transposeB C.int) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	d := int(dim)
+	if err := checkMatMulDim(scheme, d); err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	arrPtr, length := SliceToCArray(
+		matMulRotationSteps(d, transposeB != 0), convertIntToCInt)
+	return arrPtr, length
+}
+
+func matMulRotationSteps(d int, transposeB bool) []int {
+	sigma, tau, phi, psi := matMulPermutations(d, transposeB)
+	perms := []matPermutation{sigma, tau}
+	for k := 1; k < d; k++ {
+		perms = append(perms, phi(k), psi(k))
+	}
+
+	steps := []int{}
+	for _, perm := range perms {
+		for rot := range permutationMasks(d, perm) {
+			if rot != 0 && !slices.Contains(steps, rot) {
+				steps = append(steps, rot)
+			}
+		}
+	}
+	slices.Sort(steps)
+	return steps
+}
+
+// MatMulCiphertexts multiplies the d x d matrices packed row-major in two
+// ciphertexts, each replicated across all slots, and returns their product
+// packed the same way. When transposeB is set, the second matrix is
+// transposed first, e.g. to compute the attention scores Q K^T. Missing
+// rotation keys are generated, and the d products are relinearized and
+// rescaled once, after they are summed. The result is three rescales below
+// the lower input. Returns the ID of the product, or -1 with the last
+// error set.
+//
+//export MatMulCiphertexts
+func MatMulCiphertexts(ctID0, ctID1 C.int, dim C.int, transposeB C.int) C.int {
+	scheme := activeScheme.Load()
+
+	for _, id := range []C.int{ctID0, ctID1} {
+		if !ctHeap.Exists(int(id)) {
+			SetLastError(fmt.Errorf("ciphertext %d does not exist", int(id)))
+			return -1
+		}
+	}
+	ctA := RetrieveCiphertext(int(ctID0))
+	ctB := RetrieveCiphertext(int(ctID1))
+
+	ctOut, err := matMulCiphertexts(scheme, ctA, ctB, int(dim), transposeB != 0)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func checkMatMulDim(scheme *Scheme, d int) error {
+	slots := scheme.Params.MaxSlots()
+	if d <= 0 || d*d > slots || slots%(d*d) != 0 {
+		return fmt.Errorf(
+			"cannot pack %d x %d matrices into %d slots: "+
+				"d*d must divide the slot count", d, d, slots)
+	}
+	return nil
+}
+
+func matMulCiphertexts(
+	scheme *Scheme,
+	ctA, ctB *rlwe.Ciphertext, d int, transposeB bool,
+) (*rlwe.Ciphertext, error) {
+	if err := checkMatMulDim(scheme, d); err != nil {
+		return nil, err
+	}
+	perRescale := scheme.Params.LevelsConsumedPerRescaling()
+	if level := min(ctA.Level(), ctB.Level()); level < 3*perRescale {
+		return nil, fmt.Errorf(
+			"cannot multiply matrices at levels %d and %d: "+
+				"%d levels are needed", ctA.Level(), ctB.Level(), 3*perRescale)
+	}
+	steps := matMulRotationSteps(d, transposeB)
+	if err := addRotationKeys(scheme, rotationGaloisElements(scheme, steps)); err != nil {
+		return nil, err
+	}
+
+	// Both operands are brought to the same level first, so that every
+	// phi^k(A) and psi^k(B) below lines up without further drops.
+	level := min(ctA.Level(), ctB.Level())
+	ctA, ctB = atLevel(scheme, ctA, level), atLevel(scheme, ctB, level)
+
+	sigma, tau, phi, psi := matMulPermutations(d, transposeB)
+	ctA0, err := permuteMatrix(scheme, ctA, d, sigma)
+	if err != nil {
+		return nil, err
+	}
+	ctB0, err := permuteMatrix(scheme, ctB, d, tau)
+	if err != nil {
+		return nil, err
+	}
+
+	var ctOut *rlwe.Ciphertext
+	for k := range d {
+		ctAk, ctBk := ctA0, ctB0
+		if k > 0 {
+			if ctAk, err = permuteMatrix(scheme, ctA0, d, phi(k)); err != nil {
+				return nil, err
+			}
+			if ctBk, err = permuteMatrix(scheme, ctB0, d, psi(k)); err != nil {
+				return nil, err
+			}
+		}
+		// phi^k takes a level for k > 0, which phi^0 and psi^k don't.
+		ctAk = atLevel(scheme, ctAk, ctA0.Level()-perRescale)
+		ctBk = atLevel(scheme, ctBk, ctAk.Level())
+
+		product, err := scheme.Evaluator.MulRelinNew(ctAk, ctBk)
+		if err != nil {
+			return nil, err
+		}
+		if ctOut == nil {
+			ctOut = product
+		} else if err := scheme.Evaluator.Add(ctOut, product, ctOut); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		return nil, err
+	}
+	return ctOut, nil
+}
+
+// permuteMatrix applies a permutation to the d x d matrices replicated in
+// a ciphertext. A permutation that is a single rotation costs no level;
+// otherwise each rotation is multiplied by its 0/1 mask and the sum is
+// rescaled once.
+func permuteMatrix(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, d int, perm matPermutation,
+) (*rlwe.Ciphertext, error) {
+	masks := permutationMasks(d, perm)
+	if len(masks) == 1 {
+		for rot := range masks {
+			if rot == 0 {
+				return ctIn.CopyNew(), nil
+			}
+			return scheme.Evaluator.RotateNew(ctIn, rot)
+		}
+	}
+
+	slots, n := scheme.Params.MaxSlots(), d*d
+	level := ctIn.Level()
+	var ctOut *rlwe.Ciphertext
+	for rot, positions := range masks {
+		rotated := ctIn
+		if rot != 0 {
+			var err error
+			if rotated, err = scheme.Evaluator.RotateNew(ctIn, rot); err != nil {
+				return nil, err
+			}
+		}
+
+		mask := make([]float64, slots)
+		for _, pos := range positions {
+			for c := pos; c < slots; c += n {
+				mask[c] = 1
+			}
+		}
+		plaintext, err := newMaskPlaintext(scheme, mask, level)
+		if err != nil {
+			return nil, err
+		}
+
+		if ctOut == nil {
+			ctOut, err = scheme.Evaluator.MulNew(rotated, plaintext)
+		} else {
+			err = scheme.Evaluator.MulThenAdd(rotated, plaintext, ctOut)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		return nil, err
+	}
+	return ctOut, nil
+}
+
+// atLevel returns ctIn, or a copy of it dropped to level if it is above.
+func atLevel(scheme *Scheme, ctIn *rlwe.Ciphertext, level int) *rlwe.Ciphertext {
+	if ctIn.Level() <= level {
+		return ctIn
+	}
+	ctOut := ctIn.CopyNew()
+	scheme.Evaluator.DropLevel(ctOut, ctIn.Level()-level)
+	return ctOut
+}
+
+// rotationGaloisElements returns the Galois elements of rotation steps.
+func rotationGaloisElements(scheme *Scheme, steps []int) []uint64 {
+	galEls := make([]uint64, len(steps))
+	for i, k := range steps {
+		galEls[i] = scheme.Params.GaloisElement(k)
+	}
+	return galEls
+}
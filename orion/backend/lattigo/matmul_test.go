@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// replicateMatrix packs a d x d matrix row-major and repeats it across
+// every slot, as MatMulCiphertexts expects.
+func replicateMatrix(m [][]float64, slots int) []float64 {
+	d := len(m)
+	values := make([]float64, slots)
+	for i := range values {
+		values[i] = m[(i%(d*d))/d][i%d]
+	}
+	return values
+}
+
+func randomMatrix(rng *rand.Rand, d int) [][]float64 {
+	m := make([][]float64, d)
+	for i := range m {
+		m[i] = randomValues(rng, d)
+	}
+	return m
+}
+
+// matMul multiplies a and b, or a and b^T when transposeB is set.
+func matMul(a, b [][]float64, transposeB bool) [][]float64 {
+	d := len(a)
+	out := make([][]float64, d)
+	for i := range out {
+		out[i] = make([]float64, d)
+		for j := range out[i] {
+			for k := range d {
+				if transposeB {
+					out[i][j] += a[i][k] * b[j][k]
+				} else {
+					out[i][j] += a[i][k] * b[k][j]
+				}
+			}
+		}
+	}
+	return out
+}
+
+// The product of two encrypted matrices decrypts to their product in the
+// clear, in every copy across the slots.
+func TestMatMulCiphertexts(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(29, 30))
+	slots := scheme.Params.MaxSlots()
+	const d = 4
+
+	a, b := randomMatrix(rng, d), randomMatrix(rng, d)
+	ctA := RetrieveCiphertext(encryptValues(t, scheme, replicateMatrix(a, slots), testMaxLevel))
+	ctB := RetrieveCiphertext(encryptValues(t, scheme, replicateMatrix(b, slots), testMaxLevel))
+
+	for name, transposeB := range map[string]bool{"AB": false, "ABt": true} {
+		t.Run(name, func(t *testing.T) {
+			ctOut, err := matMulCiphertexts(scheme, ctA, ctB, d, transposeB)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ctOut.Level() != testMaxLevel-3 {
+				t.Errorf("product is at level %d, want %d", ctOut.Level(), testMaxLevel-3)
+			}
+
+			want := replicateMatrix(matMul(a, b, transposeB), slots)
+			got := decryptValues(t, scheme, PushCiphertext(ctOut))
+			if err := maxError(want, got); err > 1e-6 {
+				t.Errorf("product differs from the expected one by up to %g", err)
+			}
+		})
+	}
+
+	if _, err := matMulCiphertexts(scheme, ctA, ctB, 3, false); err == nil {
+		t.Error("multiplied matrices that do not tile the slots")
+	}
+	low := atLevel(scheme, ctA, testMaxLevel-1)
+	if _, err := matMulCiphertexts(scheme, low, ctB, d, false); err == nil {
+		t.Error("multiplied matrices without the levels it takes")
+	}
+}
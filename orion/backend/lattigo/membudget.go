@@ -0,0 +1,126 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
+)
+
+// When diagonals and rotation keys are streamed from disk, the blocks of a
+// layer are evaluated in groups that share one load of rotation keys, and
+// the keys are dropped before the next group. With a memory budget,
+// consecutive groups are instead merged into windows whose rotation keys
+// fit in it, along with the diagonals of the largest of the groups, so a
+// key needed by several of them is loaded once per window. Diagonals are
+// still dropped after each block, since no other block uses them. A budget
+// of 0, the default, keeps one group per window.
+var ltMemoryBudget int64
+
+// SetLTMemoryBudget sets the number of bytes of plaintext diagonals and
+// rotation keys that may be resident at once while evaluating a linear
+// transform from disk.
+//
+//export SetLTMemoryBudget
+func SetLTMemoryBudget(budgetBytes C.ulong) {
+	ltMemoryBudget = int64(budgetBytes)
+}
+
+//export GetLTMemoryBudget
+func GetLTMemoryBudget() C.ulong {
+	return C.ulong(ltMemoryBudget)
+}
+
+// PlanLinearTransformWindows splits the groups of blocks of a layer into
+// windows that fit the memory budget. transformIDs lists the blocks in the
+// order they are evaluated, and groupSizes how many of them each group
+// holds. A group that does not fit the budget on its own gets a window of
+// its own. Returns the number of groups in each window, or an empty array
+// with the last error set.
+//
+//export PlanLinearTransformWindows
+func PlanLinearTransformWindows(
+	transformIDsC *C.int, lenTransformIDs C.int,
+	groupSizesC *C.int, lenGroupSizes C.int,
+) (*C.int, C.ulong) {
+	scheme := activeScheme.Load()
+
+	transformIDs := CArrayToSlice(transformIDsC, lenTransformIDs, convertCIntToInt)
+	groupSizes := CArrayToSlice(groupSizesC, lenGroupSizes, convertCIntToInt)
+
+	windows, err := planLinearTransformWindows(scheme, transformIDs, groupSizes)
+	if err != nil {
+		SetLastError(err)
+		return nil, 0
+	}
+
+	arrPtr, length := SliceToCArray(windows, convertIntToCInt)
+	return arrPtr, length
+}
+
+func planLinearTransformWindows(scheme *Scheme, transformIDs, groupSizes []int) ([]int, error) {
+	keyBytes := rotationKeyBytes(scheme)
+
+	windows := []int{}
+	var windowDiagBytes int64
+	windowKeys := map[uint64]bool{}
+
+	offset := 0
+	for g, size := range groupSizes {
+		if size < 0 || offset+size > len(transformIDs) {
+			return nil, fmt.Errorf(
+				"group sizes exceed the %d transforms given", len(transformIDs))
+		}
+
+		var diagBytes int64
+		groupKeys := map[uint64]bool{}
+		for _, id := range transformIDs[offset : offset+size] {
+			if !ltHeap.Exists(id) {
+				return nil, fmt.Errorf("group %d: transform %d does not exist", g, id)
+			}
+			transform := RetrieveLinearTransform(id)
+			diagBytes += transformDiagonalBytes(scheme, transform)
+			for _, galEl := range transform.GaloisElements(scheme.Params) {
+				groupKeys[galEl] = true
+			}
+		}
+		offset += size
+
+		numKeys := len(windowKeys)
+		for galEl := range groupKeys {
+			if !windowKeys[galEl] {
+				numKeys++
+			}
+		}
+
+		grown := max(windowDiagBytes, diagBytes) + int64(numKeys)*keyBytes
+		if len(windows) > 0 && grown <= ltMemoryBudget {
+			windows[len(windows)-1]++
+			windowDiagBytes = max(windowDiagBytes, diagBytes)
+		} else {
+			windows = append(windows, 1)
+			windowDiagBytes = diagBytes
+			clear(windowKeys)
+		}
+		for galEl := range groupKeys {
+			windowKeys[galEl] = true
+		}
+	}
+	return windows, nil
+}
+
+// transformDiagonalBytes returns the size of a transform's plaintext
+// diagonals once loaded, whether or not they currently are.
+func transformDiagonalBytes(scheme *Scheme, transform lintrans.LinearTransformation) int64 {
+	limbs := transform.LevelQ + transform.LevelP + 2
+	return int64(len(transform.Vec)) * int64(limbs*scheme.Params.N()*8)
+}
+
+// rotationKeyBytes returns the size of an expanded rotation key: two
+// polynomials over QP for each digit of its gadget decomposition.
+func rotationKeyBytes(scheme *Scheme) int64 {
+	levelQ, levelP := scheme.Params.MaxLevelQ(), scheme.Params.MaxLevelP()
+	digits := scheme.Params.BaseRNSDecompositionVectorSize(levelQ, levelP)
+	limbs := levelQ + levelP + 2
+	return int64(2 * digits * limbs * scheme.Params.N() * 8)
+}
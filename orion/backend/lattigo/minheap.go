@@ -3,6 +3,7 @@ package main
 import (
 	"container/heap"
 	"fmt"
+	"sync"
 )
 
 type MinHeap []int
@@ -23,8 +24,10 @@ func (h *MinHeap) Pop() interface{} {
 	return x
 }
 
-// HeapAllocator updated to store pointers
+// HeapAllocator updated to store pointers. It is shared by every scheme,
+// so calls on different schemes may use it concurrently.
 type HeapAllocator struct {
+	mu            sync.Mutex
 	nextInt       int                  // The next integer to allocate
 	freedIntegers MinHeap              // Min-heap to store freed integers
 	InterfaceMap  map[int]*interface{} // Map to store/retrieve pointers to structs
@@ -44,6 +47,9 @@ func NewHeapAllocator() *HeapAllocator {
 // Add assigns the lowest available integer to the provided object and
 // returns the integer. Now ensures we're storing a pointer.
 func (ha *HeapAllocator) Add(obj interface{}) int {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
 	var allocated int
 	if len(ha.freedIntegers) > 0 {
 		// Reuse the smallest available integer from the heap
@@ -65,6 +71,9 @@ func (ha *HeapAllocator) Add(obj interface{}) int {
 
 // Retrieve returns the associated object with integer.
 func (ha *HeapAllocator) Retrieve(integer int) interface{} {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
 	if objPtr, exists := ha.InterfaceMap[integer]; exists {
 		// Dereference the pointer to get the original interface value
 		return *objPtr
@@ -72,24 +81,58 @@ func (ha *HeapAllocator) Retrieve(integer int) interface{} {
 	panic(fmt.Sprintf("Heap object not found for integer: %d", integer))
 }
 
+// Exists reports whether an object is currently stored under integer.
+func (ha *HeapAllocator) Exists(integer int) bool {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
+	_, exists := ha.InterfaceMap[integer]
+	return exists
+}
+
 // Delete removes the integer and its associated object from the allocator
 // and adds the integer back to the pool of available integers.
 func (ha *HeapAllocator) Delete(integer int) {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
 	if _, exists := ha.InterfaceMap[integer]; exists {
 		heap.Push(&ha.freedIntegers, integer)
 		delete(ha.InterfaceMap, integer)
 	}
 }
 
+// DeleteMany removes every integer in integers. Integers that are not
+// currently allocated are skipped, so freeing the same ID twice is harmless.
+func (ha *HeapAllocator) DeleteMany(integers []int) {
+	for _, integer := range integers {
+		ha.Delete(integer)
+	}
+}
+
 // Reset clears the allocator's state, reinitializing its fields.
 func (ha *HeapAllocator) Reset() {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
 	ha.nextInt = 0
 	ha.freedIntegers = MinHeap{} // Reinitialize the slice
 	heap.Init(&ha.freedIntegers) // Reinitialize the heap properties
 	ha.InterfaceMap = make(map[int]*interface{})
 }
 
+// Len returns the number of objects currently stored.
+func (ha *HeapAllocator) Len() int {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
+	return len(ha.InterfaceMap)
+}
+
 func (ha *HeapAllocator) GetLiveKeys() []int {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
 	keys := make([]int, 0, len(ha.InterfaceMap))
 	for k := range ha.InterfaceMap {
 		keys = append(keys, k)
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"C"
+	"crypto/sha256"
+	"encoding"
+	"fmt"
+	"slices"
+	"unsafe"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/multiparty"
+	"github.com/baahl-nyu/lattigo/v6/ring"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+	"github.com/baahl-nyu/lattigo/v6/utils/sampling"
+)
+
+// Multiparty is a party's state in the threshold (N-out-of-N) protocols
+// set up by MultipartySetup. Each party holds an additive share of the
+// collective secret key as its scheme's secret key, and all parties derive
+// the protocols' common random polynomials from the same CRS seed. Shares
+// are exchanged as bytes; whoever aggregates them calls the Combine
+// exports, which install the collective keys into the active scheme.
+type Multiparty struct {
+	CRSSeed []byte
+
+	// RelinEphSk is this party's ephemeral key between the two rounds of
+	// relinearization key generation.
+	RelinEphSk *rlwe.SecretKey
+}
+
+// decryptionNoise is the standard deviation of the noise each party adds
+// to its decryption share so that it does not leak its secret key share,
+// following Lattigo's multiparty examples.
+const decryptionNoise = 8 * rlwe.DefaultNoise
+
+// MultipartySetup starts this party's participation in the multiparty
+// protocols. The CRS seed must be the same for every party. Returns 0, or
+// -1 with the last error set.
+//
+//export MultipartySetup
+func MultipartySetup(seedPtr *C.char, lenSeed C.int) C.int {
+	scheme := activeScheme.Load()
+	var seed []byte
+	if lenSeed > 0 {
+		seed = CArrayToByteSlice(unsafe.Pointer(seedPtr), uint64(lenSeed))
+	}
+	if err := multipartySetup(scheme, seed); err != nil {
+		SetLastError(fmt.Errorf("cannot set up multiparty: %w", err))
+		return -1
+	}
+	return 0
+}
+
+func multipartySetup(scheme *Scheme, seed []byte) error {
+	if scheme == nil || scheme.SecretKey == nil {
+		return fmt.Errorf("no active secret key share")
+	}
+	if len(seed) == 0 {
+		return fmt.Errorf("empty CRS seed")
+	}
+	scheme.Multiparty = &Multiparty{CRSSeed: slices.Clone(seed)}
+	return nil
+}
+
+// deleteMultiparty zeroes any ephemeral key left from an unfinished
+// relinearization round and drops the multiparty state.
+func deleteMultiparty(scheme *Scheme) {
+	if scheme.Multiparty == nil {
+		return
+	}
+	if ephSk := scheme.Multiparty.RelinEphSk; ephSk != nil {
+		ephSk.Value.Q.Zero()
+		ephSk.Value.P.Zero()
+	}
+	scheme.Multiparty = nil
+}
+
+// crs returns the common reference string for one protocol run. Each run
+// gets a stream of its own, so parties may run them in any order.
+func (mp *Multiparty) crs(label string) multiparty.CRS {
+	key := sha256.Sum256(append(slices.Clone(mp.CRSSeed), label...))
+	prng, err := sampling.NewKeyedPRNG(key[:])
+	if err != nil {
+		panic(err)
+	}
+	return prng
+}
+
+// schemeMultiparty returns the scheme's multiparty state, or an
+// error if MultipartySetup has not been called.
+func schemeMultiparty(scheme *Scheme) (*Multiparty, error) {
+	if scheme == nil || scheme.Multiparty == nil {
+		return nil, fmt.Errorf("multiparty is not set up")
+	}
+	return scheme.Multiparty, nil
+}
+
+// unmarshalShares splits data into numShares shares of equal size and
+// decodes each of them.
+func unmarshalShares[T any, PT interface {
+	*T
+	encoding.BinaryUnmarshaler
+}](data []byte, numShares int) ([]T, error) {
+	if numShares <= 0 || len(data)%numShares != 0 {
+		return nil, fmt.Errorf(
+			"cannot split %d bytes into %d shares", len(data), numShares)
+	}
+
+	size := len(data) / numShares
+	shares := make([]T, numShares)
+	for i := range shares {
+		if err := PT(&shares[i]).UnmarshalBinary(data[i*size : (i+1)*size]); err != nil {
+			return nil, fmt.Errorf("share %d: %w", i, err)
+		}
+	}
+	return shares, nil
+}
+
+// marshalShare returns a share as a C array, or nil with the last error set.
+func marshalShare(share encoding.BinaryMarshaler, what string) (*C.char, C.ulong) {
+	data, err := share.MarshalBinary()
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot serialize %s share: %w", what, err))
+		return nil, 0
+	}
+	return SliceToCArray(data, convertByteToCChar)
+}
+
+// MultipartyPublicKeyShare returns this party's share of the collective
+// public key.
+//
+//export MultipartyPublicKeyShare
+func MultipartyPublicKeyShare() (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	mp, err := schemeMultiparty(scheme)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot generate public key share: %w", err))
+		return nil, 0
+	}
+
+	ckg := multiparty.NewPublicKeyGenProtocol(*scheme.Params)
+	crp := ckg.SampleCRP(mp.crs("public"))
+	share := ckg.AllocateShare()
+	ckg.GenShare(scheme.SecretKey, crp, &share)
+	return marshalShare(share, "public key")
+}
+
+// MultipartyCombinePublicKey aggregates the public key shares of every
+// party, concatenated in sharesPtr, and installs the collective public
+// key. Returns 0, or -1 with the last error set.
+//
+//export MultipartyCombinePublicKey
+func MultipartyCombinePublicKey(
+	sharesPtr *C.char, lenShares C.ulong, numShares C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	mp, err := schemeMultiparty(scheme)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot combine public key: %w", err))
+		return -1
+	}
+	data := CArrayToByteSlice(unsafe.Pointer(sharesPtr), uint64(lenShares))
+	shares, err := unmarshalShares[multiparty.PublicKeyGenShare](data, int(numShares))
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot combine public key: %w", err))
+		return -1
+	}
+
+	ckg := multiparty.NewPublicKeyGenProtocol(*scheme.Params)
+	crp := ckg.SampleCRP(mp.crs("public"))
+	for _, share := range shares[1:] {
+		ckg.AggregateShares(shares[0], share, &shares[0])
+	}
+
+	pk := rlwe.NewPublicKey(*scheme.Params)
+	ckg.GenPublicKey(shares[0], crp, pk)
+	scheme.PublicKey = pk
+	if scheme.Encryptor != nil {
+		newEncryptor(scheme)
+	}
+	return 0
+}
+
+// MultipartyRelinKeyShareRoundOne returns this party's first-round share
+// of the collective relinearization key, and keeps the ephemeral key the
+// second round needs.
+//
+//export MultipartyRelinKeyShareRoundOne
+func MultipartyRelinKeyShareRoundOne() (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	mp, err := schemeMultiparty(scheme)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot generate relinearization key share: %w", err))
+		return nil, 0
+	}
+
+	rkg := multiparty.NewRelinearizationKeyGenProtocol(*scheme.Params)
+	crp := rkg.SampleCRP(mp.crs("relinearization"))
+	ephSk, share, _ := rkg.AllocateShare()
+	rkg.GenShareRoundOne(scheme.SecretKey, crp, ephSk, &share)
+
+	mp.RelinEphSk = ephSk
+	return marshalShare(share, "relinearization key")
+}
+
+// MultipartyCombineRelinKeyRoundOne aggregates the first-round shares of
+// every party. The result is handed back to each party for the second
+// round, and to MultipartyCombineRelinKey.
+//
+//export MultipartyCombineRelinKeyRoundOne
+func MultipartyCombineRelinKeyRoundOne(
+	sharesPtr *C.char, lenShares C.ulong, numShares C.int,
+) (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	if _, err := schemeMultiparty(scheme); err != nil {
+		SetLastError(fmt.Errorf("cannot combine relinearization key shares: %w", err))
+		return nil, 0
+	}
+	data := CArrayToByteSlice(unsafe.Pointer(sharesPtr), uint64(lenShares))
+	shares, err := unmarshalShares[multiparty.RelinearizationKeyGenShare](
+		data, int(numShares))
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot combine relinearization key shares: %w", err))
+		return nil, 0
+	}
+
+	rkg := multiparty.NewRelinearizationKeyGenProtocol(*scheme.Params)
+	for _, share := range shares[1:] {
+		rkg.AggregateShares(shares[0], share, &shares[0])
+	}
+	return marshalShare(shares[0], "relinearization key")
+}
+
+// MultipartyRelinKeyShareRoundTwo returns this party's second-round share
+// of the collective relinearization key, given the aggregated first round.
+// The ephemeral key kept from the first round is zeroed afterwards.
+//
+//export MultipartyRelinKeyShareRoundTwo
+func MultipartyRelinKeyShareRoundTwo(
+	roundOnePtr *C.char, lenRoundOne C.ulong,
+) (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	mp, err := schemeMultiparty(scheme)
+	if err == nil && mp.RelinEphSk == nil {
+		err = fmt.Errorf("the first round has not been run")
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot generate relinearization key share: %w", err))
+		return nil, 0
+	}
+	data := CArrayToByteSlice(unsafe.Pointer(roundOnePtr), uint64(lenRoundOne))
+	roundOne, err := unmarshalShares[multiparty.RelinearizationKeyGenShare](data, 1)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot generate relinearization key share: %w", err))
+		return nil, 0
+	}
+
+	rkg := multiparty.NewRelinearizationKeyGenProtocol(*scheme.Params)
+	_, _, share := rkg.AllocateShare()
+	rkg.GenShareRoundTwo(mp.RelinEphSk, scheme.SecretKey, roundOne[0], &share)
+
+	mp.RelinEphSk.Value.Q.Zero()
+	mp.RelinEphSk.Value.P.Zero()
+	mp.RelinEphSk = nil
+	return marshalShare(share, "relinearization key")
+}
+
+// MultipartyCombineRelinKey aggregates the second-round shares of every
+// party and installs the collective relinearization key. Returns 0, or -1
+// with the last error set.
+//
+//export MultipartyCombineRelinKey
+func MultipartyCombineRelinKey(
+	roundOnePtr *C.char, lenRoundOne C.ulong,
+	sharesPtr *C.char, lenShares C.ulong, numShares C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	if _, err := schemeMultiparty(scheme); err != nil {
+		SetLastError(fmt.Errorf("cannot combine relinearization key: %w", err))
+		return -1
+	}
+	data := CArrayToByteSlice(unsafe.Pointer(roundOnePtr), uint64(lenRoundOne))
+	roundOne, err := unmarshalShares[multiparty.RelinearizationKeyGenShare](data, 1)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot combine relinearization key: %w", err))
+		return -1
+	}
+	data = CArrayToByteSlice(unsafe.Pointer(sharesPtr), uint64(lenShares))
+	shares, err := unmarshalShares[multiparty.RelinearizationKeyGenShare](
+		data, int(numShares))
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot combine relinearization key: %w", err))
+		return -1
+	}
+
+	rkg := multiparty.NewRelinearizationKeyGenProtocol(*scheme.Params)
+	for _, share := range shares[1:] {
+		rkg.AggregateShares(shares[0], share, &shares[0])
+	}
+
+	rlk := rlwe.NewRelinearizationKey(*scheme.Params)
+	rkg.GenRelinearizationKey(roundOne[0], shares[0], rlk)
+	scheme.RelinKey = rlk
+	generateEvaluationKeys(scheme)
+	if scheme.Evaluator != nil {
+		installLiveRotKeys(scheme)
+	}
+	return 0
+}
+
+// MultipartyGaloisKeyShare returns this party's share of the collective
+// rotation key for galEl.
+//
+//export MultipartyGaloisKeyShare
+func MultipartyGaloisKeyShare(galEl C.ulong) (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	mp, err := schemeMultiparty(scheme)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot generate rotation key share: %w", err))
+		return nil, 0
+	}
+
+	gkg := multiparty.NewGaloisKeyGenProtocol(*scheme.Params)
+	crp := gkg.SampleCRP(mp.crs(fmt.Sprintf("galois/%d", galEl)))
+	share := gkg.AllocateShare()
+	if err := gkg.GenShare(scheme.SecretKey, uint64(galEl), crp, &share); err != nil {
+		SetLastError(fmt.Errorf("cannot generate rotation key share: %w", err))
+		return nil, 0
+	}
+	return marshalShare(share, "rotation key")
+}
+
+// MultipartyCombineGaloisKey aggregates every party's share of the
+// rotation key for galEl and installs it as a live rotation key. Returns
+// 0, or -1 with the last error set.
+//
+//export MultipartyCombineGaloisKey
+func MultipartyCombineGaloisKey(
+	galEl C.ulong,
+	sharesPtr *C.char, lenShares C.ulong, numShares C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	mp, err := schemeMultiparty(scheme)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot combine rotation key: %w", err))
+		return -1
+	}
+	data := CArrayToByteSlice(unsafe.Pointer(sharesPtr), uint64(lenShares))
+	shares, err := unmarshalShares[multiparty.GaloisKeyGenShare](data, int(numShares))
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot combine rotation key: %w", err))
+		return -1
+	}
+
+	gkg := multiparty.NewGaloisKeyGenProtocol(*scheme.Params)
+	crp := gkg.SampleCRP(mp.crs(fmt.Sprintf("galois/%d", galEl)))
+	for _, share := range shares[1:] {
+		if err := gkg.AggregateShares(shares[0], share, &shares[0]); err != nil {
+			SetLastError(fmt.Errorf("cannot combine rotation key: %w", err))
+			return -1
+		}
+	}
+
+	rotKey := rlwe.NewGaloisKey(*scheme.Params)
+	if err := gkg.GenGaloisKey(shares[0], crp, rotKey); err != nil {
+		SetLastError(fmt.Errorf("cannot combine rotation key: %w", err))
+		return -1
+	}
+	scheme.LiveRotKeys[uint64(galEl)] = rotKey
+	if scheme.Evaluator != nil {
+		installLiveRotKeys(scheme)
+	}
+	return 0
+}
+
+// MultipartyDecryptionShare returns this party's partial decryption of a
+// ciphertext encrypted under the collective key. The share is smudged
+// with noise, so on its own it reveals neither the message nor the
+// party's secret key share.
+//
+//export MultipartyDecryptionShare
+func MultipartyDecryptionShare(ciphertextID C.int) (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+	share, err := decryptionShare(scheme, RetrieveCiphertext(int(ciphertextID)))
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot generate decryption share: %w", err))
+		return nil, 0
+	}
+	return marshalShare(share, "decryption")
+}
+
+func decryptionShare(
+	scheme *Scheme, ct *rlwe.Ciphertext,
+) (*multiparty.KeySwitchShare, error) {
+	if _, err := schemeMultiparty(scheme); err != nil {
+		return nil, err
+	}
+	cks, err := newDecryptionProtocol(scheme)
+	if err != nil {
+		return nil, err
+	}
+	share := cks.AllocateShare(ct.Level())
+	cks.GenShare(scheme.SecretKey, rlwe.NewSecretKey(*scheme.Params), ct, &share)
+	return &share, nil
+}
+
+// MultipartyCombineDecryptionShares aggregates every party's decryption
+// share of a ciphertext and returns the handle of the decrypted
+// plaintext, which can be decoded as usual. Returns -1 with the last
+// error set on failure.
+//
+//export MultipartyCombineDecryptionShares
+func MultipartyCombineDecryptionShares(
+	ciphertextID C.int,
+	sharesPtr *C.char, lenShares C.ulong, numShares C.int,
+) C.int {
+	scheme := activeScheme.Load()
+	ct := RetrieveCiphertext(int(ciphertextID))
+	data := CArrayToByteSlice(unsafe.Pointer(sharesPtr), uint64(lenShares))
+
+	pt, err := combineDecryptionShares(scheme, ct, data, int(numShares))
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot combine decryption shares: %w", err))
+		return -1
+	}
+	return C.int(PushPlaintext(pt))
+}
+
+func combineDecryptionShares(
+	scheme *Scheme, ct *rlwe.Ciphertext, data []byte, numShares int,
+) (*rlwe.Plaintext, error) {
+	if _, err := schemeMultiparty(scheme); err != nil {
+		return nil, err
+	}
+	shares, err := unmarshalShares[multiparty.KeySwitchShare](data, numShares)
+	if err != nil {
+		return nil, err
+	}
+
+	cks, err := newDecryptionProtocol(scheme)
+	if err != nil {
+		return nil, err
+	}
+	for _, share := range shares[1:] {
+		if err := cks.AggregateShares(shares[0], share, &shares[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Switching to the zero key leaves the message in the first component.
+	out := ckks.NewCiphertext(*scheme.Params, 1, ct.Level())
+	cks.KeySwitch(ct, shares[0], out)
+
+	pt := ckks.NewPlaintext(*scheme.Params, ct.Level())
+	pt.Value.Copy(out.Value[0])
+	*pt.MetaData = *out.MetaData
+	return pt, nil
+}
+
+// newDecryptionProtocol returns the key-switching protocol used for
+// collective decryption, i.e. switching to the zero key.
+func newDecryptionProtocol(scheme *Scheme) (multiparty.KeySwitchProtocol, error) {
+	return multiparty.NewKeySwitchProtocol(*scheme.Params, ring.DiscreteGaussian{
+		Sigma: decryptionNoise,
+		Bound: 6 * decryptionNoise,
+	})
+}
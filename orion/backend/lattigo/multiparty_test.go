@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+)
+
+// A ciphertext under the sum of the parties' key shares decrypts to its
+// message once every party's decryption share is combined, and not with
+// any of them missing.
+func TestThresholdDecryption(t *testing.T) {
+	parties := []*Scheme{newTestScheme(t, testParams), newTestScheme(t, testParams)}
+	params := *parties[0].Params
+
+	collectiveSk := rlwe.NewSecretKey(params)
+	for _, party := range parties {
+		if err := multipartySetup(party, []byte("crs")); err != nil {
+			t.Fatal(err)
+		}
+		params.RingQP().Add(collectiveSk.Value, party.SecretKey.Value, collectiveSk.Value)
+	}
+
+	rng := rand.New(rand.NewPCG(25, 26))
+	x := randomValues(rng, params.MaxSlots())
+	pt := ckks.NewPlaintext(params, testMaxLevel)
+	if err := parties[0].Encoder.Encode(x, pt); err != nil {
+		t.Fatal(err)
+	}
+	ct, err := ckks.NewEncryptor(params, collectiveSk).EncryptNew(pt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Shares travel as bytes, concatenated in party order.
+	var data []byte
+	for _, party := range parties {
+		share, err := decryptionShare(party, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shareData, err := share.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, shareData...)
+	}
+
+	decode := func(data []byte, numShares int) []float64 {
+		t.Helper()
+		pt, err := combineDecryptionShares(parties[0], ct, data, numShares)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]float64, params.MaxSlots())
+		if err := parties[0].Encoder.Decode(pt, got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if err := maxError(x, decode(data, len(parties))); err > 1e-6 {
+		t.Errorf("threshold decryption has error %g", err)
+	}
+	if err := maxError(x, decode(data[:len(data)/2], 1)); err < 1 {
+		t.Errorf("one party's share alone decrypts (error %g)", err)
+	}
+
+	if _, err := combineDecryptionShares(parties[0], ct, data[1:], 2); err == nil {
+		t.Error("combined shares of uneven size")
+	}
+	if _, err := decryptionShare(newTestScheme(t, testParams), ct); err == nil {
+		t.Error("made a decryption share without multiparty set up")
+	}
+	if err := multipartySetup(parties[0], nil); err == nil {
+		t.Error("set up multiparty with an empty CRS seed")
+	}
+	if !slices.Equal(parties[0].Multiparty.CRSSeed, []byte("crs")) {
+		t.Error("a failed setup replaced the multiparty state")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// A piecewise polynomial is neg(x) for x < 0 and pos(x) for x > 0. It is
+// evaluated as neg(x) + step(x) * (pos(x) - neg(x)), where step is a
+// composite minimax sign approximation whose last polynomial maps onto
+// [0, 1], like those of GenerateMinimaxSignCoeffs. ReLU-like functions
+// split this way need a low degree on each side rather than a single
+// high-degree polynomial for the kink.
+
+// EvaluatePiecewise evaluates the piecewise polynomial given by the
+// composition of signPolys and the polynomials negPolyID and posPolyID on
+// a ciphertext. The pieces are evaluated alongside the step, so this
+// consumes one level more than the deeper of the two. Returns the ID of
+// the result, or -1 with the last error set.
+//
+//export EvaluatePiecewise
+func EvaluatePiecewise(
+	ciphertextID C.int,
+	signPolysPtr *C.int, lenSignPolys C.int,
+	negPolyID, posPolyID C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	signIDs := CArrayToSlice(signPolysPtr, lenSignPolys, convertCIntToInt)
+	if len(signIDs) == 0 {
+		SetLastError(fmt.Errorf("a piecewise polynomial needs a sign approximation"))
+		return -1
+	}
+	signPolys := make([]bignum.Polynomial, len(signIDs))
+	for i, id := range append(signIDs, int(negPolyID), int(posPolyID)) {
+		if !polyHeap.Exists(id) {
+			SetLastError(fmt.Errorf("polynomial %d does not exist", id))
+			return -1
+		}
+		if i < len(signPolys) {
+			signPolys[i] = RetrievePoly(id)
+		}
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	ctOut, err := evaluatePiecewise(
+		scheme, ctIn, signPolys,
+		RetrievePoly(int(negPolyID)), RetrievePoly(int(posPolyID)))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func evaluatePiecewise(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, signPolys []bignum.Polynomial, neg, pos bignum.Polynomial,
+) (*rlwe.Ciphertext, error) {
+	signLevels := signCompositionLevels(scheme, signPolys)
+	pieceLevels := max(polynomialLevels(scheme, neg), polynomialLevels(scheme, pos))
+	need := max(signLevels, pieceLevels) + scheme.Params.LevelsConsumedPerRescaling()
+	if ctIn.Level() < need {
+		return nil, fmt.Errorf(
+			"cannot evaluate a piecewise polynomial on a ciphertext at "+
+				"level %d: %d levels are needed", ctIn.Level(), need)
+	}
+
+	defaultScale := scheme.Params.DefaultScale()
+	ctNeg, err := evaluatePolynomial(scheme, ctIn, neg, defaultScale)
+	if err != nil {
+		return nil, err
+	}
+	ctPos, err := evaluatePolynomial(scheme, ctIn, pos, defaultScale)
+	if err != nil {
+		return nil, err
+	}
+	level := min(ctNeg.Level(), ctPos.Level())
+	ctNeg, ctPos = atLevel(scheme, ctNeg, level), atLevel(scheme, ctPos, level)
+	ctDiff, err := scheme.Evaluator.SubNew(ctPos, ctNeg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The step is brought to the scale of the prime its product with the
+	// difference is rescaled by, so that the rescale is exact.
+	level = min(level, ctIn.Level()-signLevels)
+	ctStep, err := evaluateSign(scheme, ctIn, signPolys, rlwe.NewScale(scheme.Params.Q()[level]))
+	if err != nil {
+		return nil, err
+	}
+
+	ctOut, err := scheme.Evaluator.MulRelinNew(
+		atLevel(scheme, ctStep, level), atLevel(scheme, ctDiff, level))
+	if err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		return nil, err
+	}
+	ctNeg = atLevel(scheme, ctNeg, ctOut.Level())
+	if err := scheme.Evaluator.Add(ctOut, ctNeg, ctOut); err != nil {
+		return nil, err
+	}
+	return ctOut, nil
+}
+
+// evaluateSign evaluates a composite sign approximation, producing the last
+// polynomial's output at outScale.
+func evaluateSign(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, signPolys []bignum.Polynomial, outScale rlwe.Scale,
+) (*rlwe.Ciphertext, error) {
+	ctOut := ctIn
+	for i, poly := range signPolys {
+		scale := scheme.Params.DefaultScale()
+		if i == len(signPolys)-1 {
+			scale = outScale
+		}
+		var err error
+		if ctOut, err = evaluatePolynomial(scheme, ctOut, poly, scale); err != nil {
+			return nil, err
+		}
+	}
+	return ctOut, nil
+}
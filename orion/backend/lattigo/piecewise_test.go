@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// A piecewise polynomial with a jump at 0 decrypts to neg(x) below 0 and
+// pos(x) above, up to the sign approximation's error, and to a blend of
+// the two within 2^-alpha of the jump.
+func TestEvaluatePiecewise(t *testing.T) {
+	scheme := newTestScheme(t, deepTestParams)
+	slots := scheme.Params.MaxSlots()
+	maxLevel := scheme.Params.MaxLevel()
+	const alpha = 4
+
+	// neg(x) = 0.1x + 0.05 and pos(x) = x^2, in the Chebyshev basis.
+	negCoeffs, posCoeffs := []float64{0.05, 0.1}, []float64{0.5, 0, 0.5}
+	neg := bignum.NewPolynomial(bignum.Chebyshev, negCoeffs, [2]float64{-1, 1})
+	pos := bignum.NewPolynomial(bignum.Chebyshev, posCoeffs, [2]float64{-1, 1})
+	signCoeffs := minimaxSignCoeffs([]int{7, 15}, 128, alpha, 12, false)
+
+	x := stepTestValues(slots, alpha)
+	ctID := encryptValues(t, scheme, x, maxLevel)
+	ctOut, err := evaluatePiecewise(
+		scheme, RetrieveCiphertext(ctID), newSignComposition(signCoeffs), neg, pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := decryptValues(t, scheme, PushCiphertext(ctOut))
+
+	// The circuit computes neg + step * (pos - neg) exactly as it does in
+	// the clear, and that is within the step's error of the pieces.
+	circuit := make([]float64, slots)
+	for i, xi := range x {
+		n, p := chebyshevAt(negCoeffs, -1, 1, xi), chebyshevAt(posCoeffs, -1, 1, xi)
+		circuit[i] = n + composeChebyshev(signCoeffs, xi)*(p-n)
+
+		switch {
+		case math.Abs(xi) >= math.Pow(2, -alpha):
+			want := n
+			if xi > 0 {
+				want = p
+			}
+			if math.Abs(got[i]-want) > 2e-3 {
+				t.Errorf("at %g, got %g, want %g", xi, got[i], want)
+			}
+		case got[i] < min(n, p)-2e-3 || got[i] > max(n, p)+2e-3:
+			t.Errorf("at %g, got %g outside [%g, %g]", xi, got[i], min(n, p), max(n, p))
+		}
+	}
+	if err := maxError(circuit, got); err > 1e-6 {
+		t.Errorf("piecewise polynomial differs from the circuit in the clear by up to %g", err)
+	}
+
+	low := atLevel(scheme, RetrieveCiphertext(ctID), 7)
+	if _, err := evaluatePiecewise(scheme, low, newSignComposition(signCoeffs), neg, pos); err == nil {
+		t.Error("evaluated a piecewise polynomial without the levels it takes")
+	}
+}
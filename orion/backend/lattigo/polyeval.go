@@ -5,7 +5,9 @@ import (
 
 	"fmt"
 	"math/big"
+	"math/bits"
 	"strings"
+	"sync"
 
 	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/minimax"
 	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/polynomial"
@@ -15,7 +17,10 @@ import (
 )
 
 var polyHeap = NewHeapAllocator()
-var minimaxSignMap = make(map[string][][]float64)
+var (
+	minimaxSignMapMu sync.Mutex
+	minimaxSignMap   = make(map[string][][]float64)
+)
 
 func AddPoly(poly bignum.Polynomial) int {
 	return polyHeap.Add(poly)
@@ -31,6 +36,10 @@ func DeletePoly(polyID int) {
 
 //export NewPolynomialEvaluator
 func NewPolynomialEvaluator() {
+	newPolynomialEvaluator(activeScheme.Load())
+}
+
+func newPolynomialEvaluator(scheme *Scheme) {
 	scheme.PolyEvaluator = polynomial.NewEvaluator(*scheme.Params, scheme.Evaluator)
 }
 
@@ -59,22 +68,53 @@ func GenerateChebyshev(
 	return C.int(idx)
 }
 
+// GenerateChebyshevInterval registers the polynomial sum_i coeffs[i] T_i(t)
+// in the Chebyshev basis over [a, b], where t = (2x - a - b) / (b - a)
+// maps the interval onto [-1, 1]. EvaluatePolynomial applies this change
+// of variable itself, which costs one more level than a polynomial over
+// [-1, 1]; GetPolyDepth accounts for it. Returns the polynomial's handle,
+// or -1 with the last error set.
+//
+//export GenerateChebyshevInterval
+func GenerateChebyshevInterval(
+	coeffsPtr *C.double,
+	lenCoeffs C.int,
+	a, b C.double,
+) C.int {
+	if lenCoeffs <= 0 || !(a < b) {
+		SetLastError(fmt.Errorf(
+			"invalid Chebyshev polynomial: %d coefficients over [%g, %g]",
+			int(lenCoeffs), float64(a), float64(b)))
+		return -1
+	}
+	coeffs := CArrayToSlice(coeffsPtr, lenCoeffs, convertCDoubleToFloat)
+	poly := bignum.NewPolynomial(
+		bignum.Chebyshev, coeffs, [2]float64{float64(a), float64(b)})
+
+	idx := AddPoly(poly)
+	return C.int(idx)
+}
+
+// GetPolyDepth returns the levels evaluating a polynomial consumes.
+//
+//export GetPolyDepth
+func GetPolyDepth(polyID C.int) C.int {
+	scheme := activeScheme.Load()
+	return C.int(polynomialLevels(scheme, RetrievePoly(int(polyID))))
+}
+
 //export EvaluatePolynomial
 func EvaluatePolynomial(
 	ctInID C.int,
 	polyID C.int,
 	outScale C.ulong,
 ) C.int {
+	scheme := activeScheme.Load()
+
 	poly := RetrievePoly(int(polyID))
 	ctIn := RetrieveCiphertext(int(ctInID))
 
-	// Often times we'll want to keep the original input ciphertext unchanged.
-	ctTmp := ckks.NewCiphertext(*scheme.Params, 1, ctIn.Level())
-	ctTmp.Copy(ctIn)
-
-	res, err := scheme.PolyEvaluator.Evaluate(
-		ctTmp, poly, rlwe.NewScale(uint64(outScale)),
-	)
+	res, err := evaluatePolynomial(scheme, ctIn, poly, rlwe.NewScale(uint64(outScale)))
 	if err != nil {
 		panic(err)
 	}
@@ -83,6 +123,62 @@ func EvaluatePolynomial(
 	return C.int(ctOutID)
 }
 
+// evaluatePolynomial evaluates poly on a copy of ctIn. Lattigo expects
+// the input of a Chebyshev polynomial to already be mapped from its
+// interval onto [-1, 1], so that change of variable is applied first when
+// the interval is another one.
+func evaluatePolynomial(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, poly bignum.Polynomial, outScale rlwe.Scale,
+) (*rlwe.Ciphertext, error) {
+	// Often times we'll want to keep the original input ciphertext unchanged.
+	ctTmp := ckks.NewCiphertext(*scheme.Params, 1, ctIn.Level())
+	ctTmp.Copy(ctIn)
+
+	// The evaluator cannot split a constant, which is also the simplest
+	// case: zero the ciphertext and add the constant at the output scale.
+	if poly.Degree() == 0 {
+		for _, p := range ctTmp.Value {
+			p.Zero()
+		}
+		ctTmp.Scale = outScale
+		if err := scheme.Evaluator.Add(ctTmp, poly.Coeffs[0], ctTmp); err != nil {
+			return nil, err
+		}
+		return ctTmp, nil
+	}
+
+	if poly.Basis == bignum.Chebyshev {
+		scalar, constant := poly.ChangeOfBasis()
+		if scalar.Cmp(big.NewFloat(1)) != 0 || constant.Sign() != 0 {
+			scalar, _ := scalar.Float64()
+			if err := mulConstantAndRescale(scheme, ctTmp, scalar); err != nil {
+				return nil, fmt.Errorf("cannot map a ciphertext onto [-1, 1]: %w", err)
+			}
+			if err := scheme.Evaluator.Add(ctTmp, constant, ctTmp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return scheme.PolyEvaluator.Evaluate(ctTmp, poly, outScale)
+}
+
+// polynomialLevels returns the levels evaluating poly consumes, counting
+// the change of variable a Chebyshev polynomial on an interval other than
+// [-1, 1] needs. Unlike poly.Depth, this accounts for the extra level the
+// evaluator takes for degrees that are powers of two.
+func polynomialLevels(scheme *Scheme, poly bignum.Polynomial) int {
+	levels := bits.Len(uint(poly.Degree()))
+	if poly.Basis == bignum.Chebyshev {
+		scalar, constant := poly.ChangeOfBasis()
+		if scalar.Cmp(big.NewFloat(1)) != 0 || constant.Sign() != 0 {
+			levels++
+		}
+	}
+	return levels * scheme.Params.LevelsConsumedPerRescaling()
+}
+
 // ------------------------------ //
 //  Minimax Sign Helper Functions //
 // ------------------------------ //
@@ -96,74 +192,64 @@ func GenerateMinimaxSignCoeffs(
 	debug C.int,
 ) (*C.double, C.ulong) {
 	degrees := CArrayToSlice(degreesPtr, lenDegrees, convertCIntToInt)
+	coeffs := minimaxSignCoeffs(
+		degrees, uint(prec), int(logalpha), int(logerr), int(debug) != 0)
 
-	// We'll eventually return this flattened list of coefficients
-	sumDegrees := 0
-	for _, d := range degrees {
-		sumDegrees += d + 1
+	// Return the coefficients flattened, one polynomial after the other.
+	flatCoeffs := []float64{}
+	for _, poly := range coeffs {
+		flatCoeffs = append(flatCoeffs, poly...)
 	}
-	flatCoeffs := make([]float64, sumDegrees)
 
+	arrPtr, arrLen := SliceToCArray(flatCoeffs, convertFloat64ToCDouble)
+	return arrPtr, arrLen
+}
+
+// minimaxSignCoeffs returns the Chebyshev coefficients over [-1, 1] of a
+// composite minimax approximation of sign with the given degrees, the last
+// polynomial mapping onto [0, 1] rather than [-1, 1]. Coefficients are
+// kept in minimaxSignMap, since generating them is slow.
+func minimaxSignCoeffs(
+	degrees []int, prec uint, logalpha, logerr int, debug bool,
+) [][]float64 {
 	// Generate key for given minimax sign parameters
-	key := GenerateUniqueKey(
-		degrees,
-		uint(prec),
-		int(logalpha),
-		int(logerr),
-	)
+	key := GenerateUniqueKey(degrees, prec, logalpha, logerr)
 
 	// Check if coefficients already exist in the map
-	if existingCoeffs, exists := minimaxSignMap[key]; exists {
-		// If so, avoid generating them and instead return these
-		idx := 0
-		for _, poly := range existingCoeffs {
-			for _, coeff := range poly {
-				flatCoeffs[idx] = coeff
-				idx++
-			}
-		}
-	} else {
-		// Otherwise, generate new coefficients
-		coeffs := minimax.GenMinimaxCompositePolynomial(
-			uint(prec),
-			int(logalpha),
-			int(logerr),
-			degrees,
-			bignum.Sign,
-			int(debug) != 0,
-		)
-
-		// Divide last poly by 2 to scale from [-1,1] -> [-0.5, 0.5]
-		for i := range coeffs[len(degrees)-1] {
-			coeffs[len(degrees)-1][i].Quo(coeffs[len(degrees)-1][i], big.NewFloat(2))
-		}
+	minimaxSignMapMu.Lock()
+	existingCoeffs, exists := minimaxSignMap[key]
+	minimaxSignMapMu.Unlock()
+	if exists {
+		return existingCoeffs
+	}
 
-		// Add 0.5 to last polynomial so sign outputs in range [0, 1]
-		coeffs[len(degrees)-1][0] = coeffs[len(degrees)-1][0].Add(
-			coeffs[len(degrees)-1][0], big.NewFloat(0.5))
+	// Otherwise, generate new coefficients
+	coeffs := minimax.GenMinimaxCompositePolynomial(
+		prec, logalpha, logerr, degrees, bignum.Sign, debug)
 
-		// Create 2D array of float64 to store in map
-		float64Coeffs := make([][]float64, len(coeffs))
-		for i := range coeffs {
-			float64Coeffs[i] = make([]float64, len(coeffs[i]))
-		}
+	// Divide last poly by 2 to scale from [-1,1] -> [-0.5, 0.5]
+	for i := range coeffs[len(degrees)-1] {
+		coeffs[len(degrees)-1][i].Quo(coeffs[len(degrees)-1][i], big.NewFloat(2))
+	}
 
-		idx := 0
-		for i, poly := range coeffs {
-			for j, coeff := range poly {
-				f64, _ := coeff.Float64()
-				flatCoeffs[idx] = f64
-				float64Coeffs[i][j] = f64
-				idx++
-			}
-		}
+	// Add 0.5 to last polynomial so sign outputs in range [0, 1]
+	coeffs[len(degrees)-1][0] = coeffs[len(degrees)-1][0].Add(
+		coeffs[len(degrees)-1][0], big.NewFloat(0.5))
 
-		// Store coefficients in the map for future use
-		minimaxSignMap[key] = float64Coeffs
+	// Create 2D array of float64 to store in map
+	float64Coeffs := make([][]float64, len(coeffs))
+	for i, poly := range coeffs {
+		float64Coeffs[i] = make([]float64, len(poly))
+		for j, coeff := range poly {
+			float64Coeffs[i][j], _ = coeff.Float64()
+		}
 	}
 
-	arrPtr, arrLen := SliceToCArray(flatCoeffs, convertFloat64ToCDouble)
-	return arrPtr, arrLen
+	// Store coefficients in the map for future use
+	minimaxSignMapMu.Lock()
+	minimaxSignMap[key] = float64Coeffs
+	minimaxSignMapMu.Unlock()
+	return float64Coeffs
 }
 
 // Create a unique string from the minimax parameters to use as an
@@ -188,5 +274,7 @@ func GenerateUniqueKey(
 }
 
 func DeleteMinimaxSignMap() {
+	minimaxSignMapMu.Lock()
+	defer minimaxSignMapMu.Unlock()
 	minimaxSignMap = make(map[string][][]float64)
 }
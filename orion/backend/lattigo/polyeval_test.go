@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// intervalValues spreads one value per slot evenly over [a, b], both ends
+// included.
+func intervalValues(slots int, a, b float64) []float64 {
+	values := make([]float64, slots)
+	for i := range values {
+		values[i] = a + (b-a)*float64(i)/float64(slots-1)
+	}
+	return values
+}
+
+// stepTestValues is intervalValues over [-1, 1], with the first slots
+// replaced by points on either side of 0 up to 2^-alpha away, where sign
+// approximations only hold to within 2^-alpha of the step.
+func stepTestValues(slots, alpha int) []float64 {
+	values := intervalValues(slots, -1, 1)
+	edge := math.Pow(2, -float64(alpha))
+	near := []float64{0, 1e-6, 1e-3, edge / 4, edge / 2, edge, 1.5 * edge, 2 * edge}
+	for i, x := range near {
+		values[2*i], values[2*i+1] = x, -x
+	}
+	return values
+}
+
+// composeChebyshev evaluates the composition of Chebyshev polynomials over
+// [-1, 1], as evaluateSign does, in the clear.
+func composeChebyshev(coeffs [][]float64, x float64) float64 {
+	for _, c := range coeffs {
+		x = chebyshevAt(c, -1, 1, x)
+	}
+	return x
+}
+
+// chebyshevAt evaluates sum_i coeffs[i] T_i(t) at t = (2x - a - b) / (b - a).
+func chebyshevAt(coeffs []float64, a, b, x float64) float64 {
+	t := (2*x - a - b) / (b - a)
+	sum, prev, cur := 0.0, 1.0, t
+	for i, c := range coeffs {
+		switch i {
+		case 0:
+			sum += c * prev
+		case 1:
+			sum += c * cur
+		default:
+			prev, cur = cur, 2*t*cur-prev
+			sum += c * cur
+		}
+	}
+	return sum
+}
+
+// Chebyshev polynomials decrypt to their value in the clear over the
+// whole of their interval, endpoints included, and consume the levels
+// polynomialLevels reports, one more when the interval is not [-1, 1].
+// The change of variable onto [-1, 1] is by an integer factor for the
+// narrow and offset intervals, which Lattigo multiplies in unscaled.
+func TestEvaluateChebyshevInterval(t *testing.T) {
+	scheme := newTestScheme(t, deepTestParams)
+	rng := rand.New(rand.NewPCG(33, 34))
+	slots := scheme.Params.MaxSlots()
+	maxLevel := scheme.Params.MaxLevel()
+
+	coeffs := randomValues(rng, 16)
+	for i := range coeffs {
+		coeffs[i] /= float64(i + 1)
+	}
+
+	for name, interval := range map[string][2]float64{
+		"unit":    {-1, 1},
+		"shifted": {-4, 6},
+		"narrow":  {0.25, 0.5},
+		"offset":  {0, 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a, b := interval[0], interval[1]
+			poly := bignum.NewPolynomial(bignum.Chebyshev, coeffs, interval)
+			x := intervalValues(slots, a, b)
+			ctID := encryptValues(t, scheme, x, maxLevel)
+
+			ctOut, err := evaluatePolynomial(
+				scheme, RetrieveCiphertext(ctID), poly, scheme.Params.DefaultScale())
+			if err != nil {
+				t.Fatal(err)
+			}
+			levels := polynomialLevels(scheme, poly)
+			if (levels == 4) != (name == "unit") {
+				t.Errorf("polynomial takes %d levels", levels)
+			}
+			if got := maxLevel - ctOut.Level(); got != levels {
+				t.Errorf("polynomial consumed %d levels, want %d", got, levels)
+			}
+
+			want := make([]float64, slots)
+			for i := range want {
+				want[i] = chebyshevAt(coeffs, a, b, x[i])
+			}
+			if err := maxError(want, decryptValues(t, scheme, PushCiphertext(ctOut))); err > 1e-6 {
+				t.Errorf("polynomial differs from the expected one by up to %g", err)
+			}
+		})
+	}
+
+	// Constants take no level and need no change of variable.
+	constant := bignum.NewPolynomial(bignum.Chebyshev, []float64{0.75}, [2]float64{-4, 6})
+	ctID := encryptValues(t, scheme, intervalValues(slots, -4, 6), maxLevel)
+	ctOut, err := evaluatePolynomial(
+		scheme, RetrieveCiphertext(ctID), constant, scheme.Params.DefaultScale())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]float64, slots)
+	for i := range want {
+		want[i] = 0.75
+	}
+	if err := maxError(want, decryptValues(t, scheme, PushCiphertext(ctOut))); err > 1e-6 {
+		t.Errorf("constant differs from the expected one by up to %g", err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+)
+
+// PoolCiphertext sums every kernelH x kernelW window of the feature maps
+// packed in a ciphertext, whose pixels are gap slots apart within a row and
+// gap * rowLen slots apart across rows. Each window's sum lands on its
+// top-left pixel, and takes log2 rotations per dimension rather than one
+// per kernel entry. The other pixels are left holding partial sums, so
+// maskPtr may give values to multiply the result by, e.g. 1/(kernelH *
+// kernelW) at the pixels a strided average pooling keeps and 0 elsewhere.
+// Masking consumes a level, and is skipped when lenMask is 0. Returns the
+// ID of the result, or -1 with the last error set.
+//
+//export PoolCiphertext
+func PoolCiphertext(
+	ciphertextID C.int,
+	gap, rowLen C.int,
+	kernelH, kernelW C.int,
+	maskPtr *C.double, lenMask C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	if gap <= 0 || rowLen <= 0 || kernelH <= 0 || kernelW <= 0 {
+		SetLastError(fmt.Errorf(
+			"gap %d, row length %d and kernel %d x %d must be positive",
+			int(gap), int(rowLen), int(kernelH), int(kernelW)))
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+	mask := CArrayToSlice(maskPtr, lenMask, convertCDoubleToFloat)
+
+	ctOut, err := poolCiphertext(
+		scheme, ctIn, int(gap), int(rowLen), int(kernelH), int(kernelW), mask)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func poolCiphertext(
+	scheme *Scheme,
+	ctIn *rlwe.Ciphertext, gap, rowLen, kernelH, kernelW int, mask []float64,
+) (*rlwe.Ciphertext, error) {
+	if len(mask) > scheme.Params.MaxSlots() {
+		return nil, fmt.Errorf(
+			"cannot encode a mask of %d values into %d slots",
+			len(mask), scheme.Params.MaxSlots())
+	}
+	if len(mask) > 0 && ctIn.Level() < scheme.Params.LevelsConsumedPerRescaling() {
+		return nil, fmt.Errorf(
+			"cannot mask a ciphertext at level %d: "+
+				"no level left to rescale the product", ctIn.Level())
+	}
+
+	// Summing along rows first, then across them, covers the window.
+	ctOut, err := rotateAndSum(scheme, ctIn, gap, kernelW)
+	if err != nil {
+		return nil, err
+	}
+	if ctOut, err = rotateAndSum(scheme, ctOut, gap*rowLen, kernelH); err != nil {
+		return nil, err
+	}
+	if len(mask) == 0 {
+		return ctOut, nil
+	}
+
+	// The mask is encoded at the scale of the prime the product is
+	// rescaled by, so the result keeps the input's scale.
+	plaintext, err := newMaskPlaintext(scheme, mask, ctOut.Level())
+	if err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Mul(ctOut, plaintext, ctOut); err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		return nil, err
+	}
+	return ctOut, nil
+}
+
+// newMaskPlaintext encodes values to multiply a ciphertext at level by. They
+// are encoded at the scale of the prime the product is rescaled by, so
+// that the product keeps the ciphertext's scale.
+func newMaskPlaintext(scheme *Scheme, values []float64, level int) (*rlwe.Plaintext, error) {
+	plaintext := ckks.NewPlaintext(*scheme.Params, level)
+	plaintext.Scale = rlwe.NewScale(scheme.Params.Q()[level])
+	if err := scheme.Encoder.Encode(values, plaintext); err != nil {
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// rotateAndSum returns the sum of ctIn rotated by 0, step, ..., (n-1) *
+// step. Unlike the evaluator's InnerSum, n need not divide the slots: the
+// sum is built from the binary digits of n, with partial sums of 2^i
+// rotations doubled at each step, so it takes at most 2 log2(n) rotations.
+func rotateAndSum(scheme *Scheme, ctIn *rlwe.Ciphertext, step, n int) (*rlwe.Ciphertext, error) {
+	if n == 1 {
+		return ctIn.CopyNew(), nil
+	}
+
+	rotations := []int{}
+	for i, offset := 0, 0; 1<<i <= n; i++ {
+		if n&(1<<i) != 0 {
+			if offset != 0 {
+				rotations = append(rotations, offset*step)
+			}
+			offset += 1 << i
+		}
+		if 1<<(i+1) <= n {
+			rotations = append(rotations, (1<<i)*step)
+		}
+	}
+	if err := addRotationKeys(scheme, rotationGaloisElements(scheme, rotations)); err != nil {
+		return nil, err
+	}
+
+	// power holds the sum of the first 2^i rotations, and ctOut that of
+	// the first offset ones.
+	var ctOut *rlwe.Ciphertext
+	power := ctIn.CopyNew()
+	for i, offset := 0, 0; 1<<i <= n; i++ {
+		if n&(1<<i) != 0 {
+			if ctOut == nil {
+				ctOut = power.CopyNew()
+			} else {
+				rotated, err := scheme.Evaluator.RotateNew(power, offset*step)
+				if err != nil {
+					return nil, err
+				}
+				if err := scheme.Evaluator.Add(ctOut, rotated, ctOut); err != nil {
+					return nil, err
+				}
+			}
+			offset += 1 << i
+		}
+		if 1<<(i+1) <= n {
+			rotated, err := scheme.Evaluator.RotateNew(power, (1<<i)*step)
+			if err != nil {
+				return nil, err
+			}
+			if err := scheme.Evaluator.Add(power, rotated, power); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ctOut, nil
+}
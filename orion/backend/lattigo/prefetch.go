@@ -0,0 +1,125 @@
+package main
+
+import (
+	"C"
+	"slices"
+	"sync"
+	"unsafe"
+)
+
+// While one block of a linear transform is evaluated, Python reads the
+// rotation keys of the next block from disk and hands them to
+// PrefetchRotationKey. Decoding and expanding a key is about as costly as
+// reading it, so each one is done in a goroutine of its own and lands in
+// the key cache, where LoadCachedRotationKey picks it up. Keys still in
+// flight are tracked so that a lookup waits for them rather than missing.
+var (
+	keyPrefetchEnabled = true
+
+	pendingKeysMu sync.Mutex
+	pendingKeys   = make(map[rotKeyCacheKey]chan struct{})
+)
+
+// SetKeyPrefetchEnabled turns rotation key prefetching on or off. It is on
+// by default.
+//
+//export SetKeyPrefetchEnabled
+func SetKeyPrefetchEnabled(enabled C.int) {
+	keyPrefetchEnabled = enabled != 0
+}
+
+//export KeyPrefetchEnabled
+func KeyPrefetchEnabled() C.int {
+	if keyPrefetchEnabled {
+		return 1
+	}
+	return 0
+}
+
+// HasCachedRotationKey reports whether the key for galEl is in the key
+// cache or on its way there, so the caller can skip reading it from disk.
+// Unlike LoadCachedRotationKey, it does not install the key, and so is
+// safe to call while a transform is being evaluated. Returns 1 or 0.
+//
+//export HasCachedRotationKey
+func HasCachedRotationKey(galEl C.ulong) C.int {
+	scheme := activeScheme.Load()
+
+	cacheKey := rotKeyCacheKey{scheme.KeysPath, uint64(galEl)}
+
+	pendingKeysMu.Lock()
+	_, pending := pendingKeys[cacheKey]
+	pendingKeysMu.Unlock()
+	if pending {
+		return 1
+	}
+	if _, ok := rotKeyCache.Get(cacheKey); ok {
+		return 1
+	}
+	return 0
+}
+
+// PrefetchRotationKey starts decoding a serialized rotation key into the
+// key cache in the background, and returns immediately. The data is
+// copied, so the caller may free it. Keys that fail to decode are
+// dropped, and the error surfaces when LoadRotationKey reads them again.
+// Does nothing when prefetching is disabled or the key is already cached
+// or pending.
+//
+//export PrefetchRotationKey
+func PrefetchRotationKey(dataPtr *C.char, lenData C.ulong, galEl C.ulong) {
+	if !keyPrefetchEnabled {
+		return
+	}
+	scheme := activeScheme.Load()
+	cacheKey := rotKeyCacheKey{scheme.KeysPath, uint64(galEl)}
+	done, ok := claimPrefetch(cacheKey)
+	if !ok {
+		return
+	}
+
+	data := slices.Clone(
+		CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData)))
+	params := *scheme.Params
+
+	go func() {
+		defer func() {
+			pendingKeysMu.Lock()
+			delete(pendingKeys, cacheKey)
+			pendingKeysMu.Unlock()
+			close(done)
+		}()
+
+		if rotKey, err := unmarshalRotationKey(data, params); err == nil {
+			rotKeyCache.Put(cacheKey, rotKey)
+		}
+	}()
+}
+
+// claimPrefetch marks cacheKey as pending and returns the channel to close
+// once it is cached, unless it is already cached or pending. Checking and
+// marking under one lock keeps two callers from both loading the key.
+func claimPrefetch(cacheKey rotKeyCacheKey) (done chan struct{}, ok bool) {
+	pendingKeysMu.Lock()
+	defer pendingKeysMu.Unlock()
+
+	if _, pending := pendingKeys[cacheKey]; pending {
+		return nil, false
+	}
+	if _, cached := rotKeyCache.Get(cacheKey); cached {
+		return nil, false
+	}
+	done = make(chan struct{})
+	pendingKeys[cacheKey] = done
+	return done, true
+}
+
+// waitForPrefetch blocks until a prefetch of cacheKey, if any, is done.
+func waitForPrefetch(cacheKey rotKeyCacheKey) {
+	pendingKeysMu.Lock()
+	done, pending := pendingKeys[cacheKey]
+	pendingKeysMu.Unlock()
+	if pending {
+		<-done
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Of many callers prefetching the same key at once, exactly one loads it.
+func TestClaimPrefetch(t *testing.T) {
+	cacheKey := rotKeyCacheKey{t.TempDir(), 5}
+
+	var claimed atomic.Int64
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := claimPrefetch(cacheKey); ok {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	pendingKeysMu.Lock()
+	done := pendingKeys[cacheKey]
+	delete(pendingKeys, cacheKey)
+	pendingKeysMu.Unlock()
+	close(done)
+
+	if got := claimed.Load(); got != 1 {
+		t.Errorf("%d callers claimed the key, want 1", got)
+	}
+	if _, ok := claimPrefetch(cacheKey); !ok {
+		t.Error("a key that is neither pending nor cached cannot be claimed")
+	}
+	pendingKeysMu.Lock()
+	delete(pendingKeys, cacheKey)
+	pendingKeysMu.Unlock()
+}
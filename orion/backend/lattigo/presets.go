@@ -0,0 +1,100 @@
+package main
+
+import (
+	"C"
+	"fmt"
+	"slices"
+
+	"github.com/baahl-nyu/lattigo/v6/ring"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+)
+
+// schemePreset is a vetted parameter set for NewSchemeFromPreset. All of
+// them use a uniform ternary secret and stay within the 128-bit classical
+// LogQP bound of the HE standard for their ring degree, including the
+// moduli that bootstrapping adds where BootLogP is set.
+type schemePreset struct {
+	LogN            int
+	LogQ            []int
+	LogP            []int
+	LogDefaultScale int
+	BootLogP        []int // nil if the preset is too small to bootstrap
+}
+
+func repeatInt(v, n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = v
+	}
+	return s
+}
+
+var schemePresets = map[string]schemePreset{
+	"logn13": {
+		LogN:            13,
+		LogQ:            append([]int{40}, repeatInt(30, 5)...),
+		LogP:            []int{28},
+		LogDefaultScale: 30,
+	},
+	"logn14": {
+		LogN:            14,
+		LogQ:            append([]int{50}, repeatInt(40, 8)...),
+		LogP:            []int{60},
+		LogDefaultScale: 40,
+	},
+	"logn15": {
+		LogN:            15,
+		LogQ:            append([]int{55}, repeatInt(45, 13)...),
+		LogP:            repeatInt(61, 3),
+		LogDefaultScale: 45,
+	},
+	"logn16": {
+		LogN:            16,
+		LogQ:            append([]int{55}, repeatInt(40, 10)...),
+		LogP:            repeatInt(61, 2),
+		LogDefaultScale: 40,
+		BootLogP:        repeatInt(61, 6),
+	},
+	"logn17": {
+		LogN:            17,
+		LogQ:            append([]int{55}, repeatInt(40, 20)...),
+		LogP:            repeatInt(61, 3),
+		LogDefaultScale: 40,
+		BootLogP:        repeatInt(61, 6),
+	},
+}
+
+// NewSchemeFromPreset creates a standard-ring scheme from one of the
+// built-in presets, "logn13" through "logn17". Presets from logn16 up
+// also set the bootstrapping LogP used when NewBootstrapper is given none.
+// Returns the scheme handle, or -1 with the last error set.
+//
+//export NewSchemeFromPreset
+func NewSchemeFromPreset(name *C.char) C.int {
+	preset, ok := schemePresets[C.GoString(name)]
+	if !ok {
+		names := GetKeysFromMap(schemePresets)
+		slices.Sort(names)
+		SetLastError(fmt.Errorf(
+			"unknown scheme preset %q, expected one of %v",
+			C.GoString(name), names))
+		return -1
+	}
+
+	params, err := ckks.NewParametersFromLiteral(ckks.ParametersLiteral{
+		LogN:            preset.LogN,
+		LogQ:            preset.LogQ,
+		LogP:            preset.LogP,
+		LogDefaultScale: preset.LogDefaultScale,
+		Xs:              ring.Ternary{P: 2.0 / 3.0},
+		RingType:        ring.Standard,
+	})
+	if err != nil {
+		SetLastError(fmt.Errorf("invalid scheme preset: %w", err))
+		return -1
+	}
+
+	scheme := addScheme(params, "")
+	scheme.BootLogP = preset.BootLogP
+	return C.int(scheme.ID)
+}
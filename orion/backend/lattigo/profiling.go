@@ -0,0 +1,104 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// Profiling is opt-in. When disabled, every probe below costs a single
+// boolean check. Row workers of EvaluateLinearTransforms run concurrently,
+// so their phase timings are summed across workers and can exceed the
+// wall-clock time of the call itself. Disk loading covers deserializing
+// the keys and diagonals handed over from Python, not the HDF5 reads.
+var profilingEnabled atomic.Bool
+
+type ltProfile struct {
+	Calls        atomic.Int64
+	Blocks       atomic.Int64
+	Rotations    atomic.Int64
+	DiskLoadNs   atomic.Int64
+	EvaluateNs   atomic.Int64
+	AccumulateNs atomic.Int64
+	RescaleNs    atomic.Int64
+	TotalNs      atomic.Int64
+}
+
+var profile ltProfile
+
+func (p *ltProfile) reset() {
+	for _, counter := range []*atomic.Int64{
+		&p.Calls, &p.Blocks, &p.Rotations, &p.DiskLoadNs,
+		&p.EvaluateNs, &p.AccumulateNs, &p.RescaleNs, &p.TotalNs,
+	} {
+		counter.Store(0)
+	}
+}
+
+// profileStart returns the start time of a profiled phase, or the zero
+// time when profiling is disabled.
+func profileStart() time.Time {
+	if !profilingEnabled.Load() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// profileStop adds the time elapsed since start to counter. Phases that
+// started before profiling was turned on have a zero start and are not
+// counted.
+func profileStop(counter *atomic.Int64, start time.Time) {
+	if !profilingEnabled.Load() || start.IsZero() {
+		return
+	}
+	counter.Add(int64(time.Since(start)))
+}
+
+// profileCount adds n to counter.
+func profileCount(counter *atomic.Int64, n int) {
+	if !profilingEnabled.Load() {
+		return
+	}
+	counter.Add(int64(n))
+}
+
+//export SetProfilingEnabled
+func SetProfilingEnabled(on C.int) {
+	// Turning profiling on starts a fresh report. Workers of a running
+	// evaluation may still be adding to it, so the counters are reset one
+	// by one rather than by overwriting the struct.
+	if on != 0 && !profilingEnabled.Load() {
+		profile.reset()
+	}
+	profilingEnabled.Store(on != 0)
+}
+
+// GetProfilingReport returns the accumulated linear transform profile as
+// a JSON string. The caller is responsible for releasing it with
+// FreeCArray.
+//
+//export GetProfilingReport
+func GetProfilingReport() *C.char {
+	ms := func(counter *atomic.Int64) float64 {
+		return float64(counter.Load()) / float64(time.Millisecond)
+	}
+
+	report := map[string]interface{}{
+		"enabled":       profilingEnabled.Load(),
+		"calls":         profile.Calls.Load(),
+		"blocks":        profile.Blocks.Load(),
+		"rotations":     profile.Rotations.Load(),
+		"disk_load_ms":  ms(&profile.DiskLoadNs),
+		"evaluate_ms":   ms(&profile.EvaluateNs),
+		"accumulate_ms": ms(&profile.AccumulateNs),
+		"rescale_ms":    ms(&profile.RescaleNs),
+		"total_ms":      ms(&profile.TotalNs),
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		panic(err)
+	}
+	return C.CString(string(data))
+}
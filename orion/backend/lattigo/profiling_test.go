@@ -0,0 +1,27 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// A phase that started while profiling was off is not counted once it is
+// turned on, rather than counting the time since the zero time.
+func TestProfileStopBeforeEnabled(t *testing.T) {
+	t.Cleanup(func() { SetProfilingEnabled(0) })
+	SetProfilingEnabled(0)
+
+	var counter atomic.Int64
+	start := profileStart()
+	SetProfilingEnabled(1)
+	profileStop(&counter, start)
+	if got := counter.Load(); got != 0 {
+		t.Errorf("counted %d ns for a phase started before profiling", got)
+	}
+
+	start = profileStart()
+	profileStop(&counter, start)
+	if got := counter.Load(); got < 0 || got > int64(1e9) {
+		t.Errorf("counted %d ns for an empty phase", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+)
+
+// InnerSum sums n slots that are stride apart, e.g. the entries of a dot
+// product or the pixels of a channel, using at most 2 log2(n) rotations
+// rather than n - 1. Slot i of the result holds the sum of slots i, i +
+// stride, ..., i + (n-1) * stride of the input, wrapping around the slot
+// vector. The keys of the rotations are generated as needed. Returns the
+// ID of the result, or -1 with the last error set.
+//
+//export InnerSum
+func InnerSum(ciphertextID, stride, n C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	if stride <= 0 || n <= 0 || int(n) > scheme.Params.MaxSlots() {
+		SetLastError(fmt.Errorf(
+			"cannot sum %d slots with stride %d in %d slots",
+			int(n), int(stride), scheme.Params.MaxSlots()))
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	ctOut, err := rotateAndSum(scheme, ctIn, int(stride), int(n))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+// Replicate copies the first blockSize slots of a ciphertext over the
+// whole slot vector, with log2(slots / blockSize) rotations. blockSize
+// must divide the slot count, and a blockSize of 1 broadcasts slot 0. The
+// other slots must be zero; when they are not, e.g. after an InnerSum,
+// setting mask first multiplies them by zero, which consumes a level.
+// Returns the ID of the result, or -1 with the last error set.
+//
+//export Replicate
+func Replicate(ciphertextID, blockSize, mask C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	ctOut, err := replicate(scheme, ctIn, int(blockSize), mask != 0)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func replicate(
+	scheme *Scheme, ctIn *rlwe.Ciphertext, blockSize int, mask bool,
+) (*rlwe.Ciphertext, error) {
+	slots := scheme.Params.MaxSlots()
+	if blockSize <= 0 || slots%blockSize != 0 {
+		return nil, fmt.Errorf(
+			"cannot replicate blocks of %d slots over %d slots", blockSize, slots)
+	}
+
+	if mask {
+		if ctIn.Level() < scheme.Params.LevelsConsumedPerRescaling() {
+			return nil, fmt.Errorf(
+				"cannot mask a ciphertext at level %d: "+
+					"no level left to rescale the product", ctIn.Level())
+		}
+		values := make([]float64, blockSize)
+		for i := range values {
+			values[i] = 1
+		}
+		plaintext, err := newMaskPlaintext(scheme, values, ctIn.Level())
+		if err != nil {
+			return nil, err
+		}
+		ctMasked, err := scheme.Evaluator.MulNew(ctIn, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		if err := scheme.Evaluator.Rescale(ctMasked, ctMasked); err != nil {
+			return nil, err
+		}
+		ctIn = ctMasked
+	}
+
+	// Rotating right by multiples of the block moves copies into place.
+	return rotateAndSum(scheme, ctIn, -blockSize, slots/blockSize)
+}
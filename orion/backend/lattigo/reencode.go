@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/lintrans"
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/ring"
+)
+
+// A transform is encoded at the scale of the prime its output is rescaled
+// by, so that the output keeps the scale of its input. Applied to a
+// ciphertext below its level, Lattigo only uses the transform's lower
+// primes, but the output is then rescaled by a different prime and comes
+// out at the wrong scale, which no longer matches other blocks of its row.
+// Such inputs instead get a copy of the transform re-encoded at their
+// level, kept until the transform's diagonals are removed or it is deleted.
+type reencodedKey struct {
+	TransformID int
+	Level       int
+}
+
+var (
+	reencodedTransformsMu sync.Mutex
+	reencodedTransforms   = map[reencodedKey]lintrans.LinearTransformation{}
+)
+
+// transformAtLevel returns the transform to evaluate at level: the
+// transform itself when level is at or above its own, and otherwise a copy
+// re-encoded at level from its diagonals, which must be loaded.
+func transformAtLevel(
+	scheme *Scheme,
+	transformID int, transform lintrans.LinearTransformation, level int,
+) (lintrans.LinearTransformation, error) {
+	if level >= transform.LevelQ {
+		return transform, nil
+	}
+
+	key := reencodedKey{transformID, level}
+	reencodedTransformsMu.Lock()
+	reencoded, ok := reencodedTransforms[key]
+	reencodedTransformsMu.Unlock()
+	if ok {
+		return reencoded, nil
+	}
+
+	reencoded, err := reencodeTransform(scheme, transform, level)
+	if err != nil {
+		return lintrans.LinearTransformation{}, fmt.Errorf(
+			"cannot re-encode transform %d at level %d: %w", transformID, level, err)
+	}
+	logDebug("re-encoded transform %d from level %d to %d",
+		transformID, transform.LevelQ, level)
+	reencodedTransformsMu.Lock()
+	reencodedTransforms[key] = reencoded
+	reencodedTransformsMu.Unlock()
+	return reencoded, nil
+}
+
+func reencodeTransform(
+	scheme *Scheme,
+	transform lintrans.LinearTransformation, level int,
+) (lintrans.LinearTransformation, error) {
+	if scheme.Params.RingType() == ring.Standard {
+		return reencodeDiagonals[complex128](scheme, transform, level)
+	}
+	return reencodeDiagonals[float64](scheme, transform, level)
+}
+
+// reencodeDiagonals encodes the diagonals of transform at level, with the
+// same baby-step giant-step split, so that it needs the same rotation
+// keys.
+func reencodeDiagonals[T float64 | complex128](
+	scheme *Scheme,
+	transform lintrans.LinearTransformation, level int,
+) (lintrans.LinearTransformation, error) {
+	diagonals, err := transformDiagonals[T](scheme, transform)
+	if err != nil {
+		return lintrans.LinearTransformation{}, err
+	}
+
+	reencoded := lintrans.NewTransformation(scheme.Params, lintrans.Parameters{
+		DiagonalsIndexList:        diagonals.DiagonalsIndexList(),
+		LevelQ:                    level,
+		LevelP:                    transform.LevelP,
+		Scale:                     rlwe.NewScale(scheme.Params.Q()[level]),
+		LogDimensions:             transform.LogDimensions,
+		LogBabyStepGiantStepRatio: transform.LogBabyStepGiantStepRatio,
+	})
+	if err := lintrans.Encode(scheme.Encoder, diagonals, reencoded); err != nil {
+		return lintrans.LinearTransformation{}, err
+	}
+	return reencoded, nil
+}
+
+// removeReencodedTransforms drops the re-encoded copies of a transform.
+func removeReencodedTransforms(transformID int) {
+	reencodedTransformsMu.Lock()
+	defer reencodedTransformsMu.Unlock()
+	for key := range reencodedTransforms {
+		if key.TransformID == transformID {
+			delete(reencodedTransforms, key)
+		}
+	}
+}
+
+// clearReencodedTransforms drops every re-encoded copy, for when the
+// transform heap is reset and its IDs are handed out again.
+func clearReencodedTransforms() {
+	reencodedTransformsMu.Lock()
+	defer reencodedTransformsMu.Unlock()
+	reencodedTransforms = map[reencodedKey]lintrans.LinearTransformation{}
+}
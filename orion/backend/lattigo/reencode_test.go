@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// A transform applied below its level is re-encoded there, and evaluates
+// as the original does at its own level, at the input's scale.
+func TestReencodedTransformOutput(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(41, 42))
+	slots := scheme.Params.MaxSlots()
+
+	diags := randomDiagonals(rng, []int{0, 2, 9, slots - 1}, slots)
+	transformID := newTestTransform(t, scheme, diags, testMaxLevel)
+	t.Cleanup(func() { removeReencodedTransforms(transformID) })
+
+	x := randomValues(rng, slots)
+	original := evaluateTransform(t, scheme, transformID, encryptValues(t, scheme, x, testMaxLevel))
+	if err := maxError(applyDiagonals(diags, x), original); err > 1e-6 {
+		t.Fatalf("original output differs from the expected one by up to %g", err)
+	}
+
+	for level := testMaxLevel - 1; level >= 1; level-- {
+		ctID := encryptValues(t, scheme, x, level)
+		outIDs, err := evaluateLinearTransforms(
+			scheme, []int{transformID}, []int{ctID}, nil, 1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctOut := RetrieveCiphertext(outIDs[0])
+		if ctOut.Level() != level-1 {
+			t.Errorf("output of an input at level %d is at level %d", level, ctOut.Level())
+		}
+		if !ctOut.Scale.Equal(scheme.Params.DefaultScale()) {
+			t.Errorf("output of an input at level %d has scale 2^%.2f, want 2^%.2f",
+				level, ctOut.Scale.Log2(), scheme.Params.DefaultScale().Log2())
+		}
+		if err := maxError(original, decryptValues(t, scheme, outIDs[0])); err > 1e-6 {
+			t.Errorf("re-encoded at level %d, output differs by up to %g", level, err)
+		}
+
+		reencodedTransformsMu.Lock()
+		_, cached := reencodedTransforms[reencodedKey{transformID, level}]
+		reencodedTransformsMu.Unlock()
+		if !cached {
+			t.Errorf("transform re-encoded at level %d was not kept", level)
+		}
+	}
+
+	removeReencodedTransforms(transformID)
+	reencodedTransformsMu.Lock()
+	defer reencodedTransformsMu.Unlock()
+	for key := range reencodedTransforms {
+		if key.TransformID == transformID {
+			t.Errorf("re-encoded copy at level %d was not removed", key.Level)
+		}
+	}
+}
+
+// Deleting the last scheme resets the transform heap, so re-encoded copies
+// go with it rather than being served for the next transform given the
+// same ID.
+func TestDeleteSchemeDropsReencodedTransforms(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(43, 44))
+	slots := scheme.Params.MaxSlots()
+
+	diags := randomDiagonals(rng, []int{0, 1}, slots)
+	transformID := newTestTransform(t, scheme, diags, testMaxLevel)
+	ctID := encryptValues(t, scheme, randomValues(rng, slots), testMaxLevel-1)
+	evaluateTransform(t, scheme, transformID, ctID)
+
+	DeleteScheme()
+	if len(schemeHeap.GetLiveKeys()) > 0 {
+		t.Skip("another scheme is still live")
+	}
+	reencodedTransformsMu.Lock()
+	defer reencodedTransformsMu.Unlock()
+	if len(reencodedTransforms) != 0 {
+		t.Errorf("%d re-encoded transforms outlived their scheme", len(reencodedTransforms))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// ReLU(x) = x * step(x), for x in [-1, 1]. If step is within 2^-alpha of
+// the step function for |x| >= 2^-alpha, ReLU is within 2^-alpha
+// everywhere, since below that the error is at most |x|. reluSignDegrees
+// lists, for increasing alpha, the cheapest composition whose minimax
+// approximation (with logalpha the listed alpha) meets this with a few
+// bits to spare.
+var reluSignDegrees = []struct {
+	alpha   int
+	degrees []int
+}{
+	{4, []int{7, 15}},
+	{6, []int{7, 7, 15}},
+	{8, []int{15, 15, 15}},
+	{10, []int{7, 7, 15, 15}},
+	{12, []int{7, 7, 15, 15, 15}},
+	{14, []int{15, 15, 15, 15, 15}},
+}
+
+// reluSignComposition returns the sign composition used for a ReLU within
+// 2^-alpha.
+func reluSignComposition(alpha int) ([]bignum.Polynomial, error) {
+	for _, entry := range reluSignDegrees {
+		if alpha <= entry.alpha {
+			coeffs := minimaxSignCoeffs(entry.degrees, 128, entry.alpha, 12, false)
+			return newSignComposition(coeffs), nil
+		}
+	}
+	return nil, fmt.Errorf(
+		"ReLU precision must be at most %d bits, got %d",
+		reluSignDegrees[len(reluSignDegrees)-1].alpha, alpha)
+}
+
+func reluLevels(scheme *Scheme, polys []bignum.Polynomial) int {
+	return signCompositionLevels(scheme, polys) + scheme.Params.LevelsConsumedPerRescaling()
+}
+
+// GetReLUDepth returns the levels EvaluateReLU consumes for a precision of
+// alpha bits, or -1 with the last error set.
+//
+//export GetReLUDepth
+func GetReLUDepth(alpha C.int) C.int {
+	scheme := activeScheme.Load()
+
+	polys, err := reluSignComposition(int(alpha))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	return C.int(reluLevels(scheme, polys))
+}
+
+// EvaluateReLU approximates ReLU within roughly 2^-alpha on a ciphertext
+// whose values lie in [-1, 1], as given by GetReLUDepth. Returns the ID of
+// the result, or -1 with the last error set.
+//
+//export EvaluateReLU
+func EvaluateReLU(ciphertextID, alpha C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	polys, err := reluSignComposition(int(alpha))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	ctOut, err := evaluateReLU(scheme, ctIn, polys)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+func evaluateReLU(
+	scheme *Scheme, ctIn *rlwe.Ciphertext, polys []bignum.Polynomial,
+) (*rlwe.Ciphertext, error) {
+	if need := reluLevels(scheme, polys); ctIn.Level() < need {
+		return nil, fmt.Errorf(
+			"cannot evaluate ReLU on a ciphertext at level %d: "+
+				"%d levels are needed", ctIn.Level(), need)
+	}
+
+	// As in evaluatePiecewise, the step's scale is the prime its product
+	// with x is rescaled by.
+	level := ctIn.Level() - signCompositionLevels(scheme, polys)
+	ctStep, err := evaluateSign(scheme, ctIn, polys, rlwe.NewScale(scheme.Params.Q()[level]))
+	if err != nil {
+		return nil, err
+	}
+
+	ctOut, err := scheme.Evaluator.MulRelinNew(
+		atLevel(scheme, ctStep, level), atLevel(scheme, ctIn, level))
+	if err != nil {
+		return nil, err
+	}
+	if err := scheme.Evaluator.Rescale(ctOut, ctOut); err != nil {
+		return nil, err
+	}
+	return ctOut, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// ReLU decrypts to within 2^-alpha of max(x, 0) over [-1, 1], including
+// right around 0, and consumes the levels GetReLUDepth reports.
+func TestEvaluateReLU(t *testing.T) {
+	scheme := newTestScheme(t, deepTestParams)
+	slots := scheme.Params.MaxSlots()
+	maxLevel := scheme.Params.MaxLevel()
+
+	for _, alpha := range []int{4, 8} {
+		t.Run(fmt.Sprintf("alpha %d", alpha), func(t *testing.T) {
+			polys, err := reluSignComposition(alpha)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x := stepTestValues(slots, alpha)
+			ctID := encryptValues(t, scheme, x, maxLevel)
+
+			ctOut, err := evaluateReLU(scheme, RetrieveCiphertext(ctID), polys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := maxLevel-ctOut.Level(), reluLevels(scheme, polys); got != want {
+				t.Errorf("ReLU consumed %d levels, want %d", got, want)
+			}
+
+			got := decryptValues(t, scheme, PushCiphertext(ctOut))
+			for i, xi := range x {
+				if err := math.Abs(got[i] - math.Max(xi, 0)); err > math.Pow(2, -float64(alpha)) {
+					t.Errorf("ReLU(%g) = %g, off by %g", xi, got[i], err)
+				}
+			}
+
+			low := atLevel(scheme, RetrieveCiphertext(ctID), reluLevels(scheme, polys)-1)
+			if _, err := evaluateReLU(scheme, low, polys); err == nil {
+				t.Error("evaluated ReLU without the levels it takes")
+			}
+		})
+	}
+
+	if _, err := reluSignComposition(20); err == nil {
+		t.Error("chose a sign composition for a precision none of them reach")
+	}
+}
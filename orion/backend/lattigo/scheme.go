@@ -2,6 +2,13 @@ package main
 
 import (
 	"C"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unsafe"
 
 	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/bootstrapping"
 	"github.com/baahl-nyu/lattigo/v6/circuits/ckks/polynomial"
@@ -27,9 +34,58 @@ type Scheme struct {
 	PolyEvaluator *polynomial.Evaluator
 	LinEvaluator  *lintrans.Evaluator
 	Bootstrapper  *bootstrapping.Evaluator
+
+	// Rotation keys and bootstrappers depend on the parameters, so they
+	// are kept per scheme rather than at package level.
+	ID            int
+	KeysPath      string
+	LiveRotKeys   map[uint64]*rlwe.GaloisKey
+	SavedRotKeys  []uint64
+	Bootstrappers map[int]*bootstrapping.Evaluator
+
+	// BootLogP is the default bootstrapping LogP from NewSchemeFromJSON,
+	// used when NewBootstrapper is not given one.
+	BootLogP []int
+
+	// Seed makes key generation and encryption deterministic when set by
+	// NewSchemeWithSeed. Nil schemes draw from the system's randomness.
+	Seed []byte
+
+	// EvaluatorOnly is set on schemes restored by LoadScheme or
+	// NewSchemeEvaluatorOnly. They never hold a secret key, so exports that
+	// would create or load one refuse.
+	EvaluatorOnly bool
+
+	// PlannedGalEls collects the Galois elements of the linear transforms
+	// generated between BeginKeyPlanning and GenerateAllRotationKeys. It
+	// is nil when no planning is under way.
+	PlannedGalEls map[uint64]bool
+
+	// Multiparty is this party's state in the threshold protocols, set up
+	// by MultipartySetup.
+	Multiparty *Multiparty
+
+	// Int is the optional integer (BGV) context set up by NewIntegerScheme.
+	Int *IntScheme
+
+	// Store holds diagonals and rotation keys with the "file" storage (see
+	// SetStorage). It is nil with the default HDF5 storage.
+	Store KVStore
 }
 
-var scheme Scheme
+// All schemes created by NewScheme are stored here and referenced from
+// Python by their handle. Every export operates on the active scheme,
+// which is the most recently created one unless UseScheme selects another.
+//
+// Exports load the active scheme once on entry and pass it down, so a
+// call (and any goroutine it starts) keeps working on one scheme even if
+// another thread switches schemes meanwhile.
+var schemeHeap = NewHeapAllocator()
+var activeScheme atomic.Pointer[Scheme]
+
+func RetrieveScheme(schemeID int) *Scheme {
+	return schemeHeap.Retrieve(schemeID).(*Scheme)
+}
 
 //export NewScheme
 func NewScheme(
@@ -41,7 +97,7 @@ func NewScheme(
 	ringType *C.char,
 	keysPath *C.char,
 	ioMode *C.char,
-) {
+) C.int {
 	// Convert LogQ and LogP to Go slices
 	logQ := CArrayToSlice(logQPtr, lenQ, convertCIntToInt)
 	logP := CArrayToSlice(logPPtr, lenP, convertCIntToInt)
@@ -66,9 +122,122 @@ func NewScheme(
 		panic(err)
 	}
 
+	return C.int(addScheme(params, C.GoString(keysPath)).ID)
+}
+
+// NewSchemeWithSeed is NewScheme, but derives the randomness of key
+// generation and encryption from seed, so that keys and ciphertexts are
+// reproducible bit for bit across runs and machines. This is meant for
+// test vectors and benchmarks only: anyone knowing the seed can recreate
+// the secret key. Bootstrapping keys are not covered by the seed.
+//
+//export NewSchemeWithSeed
+func NewSchemeWithSeed(
+	logN C.int,
+	logQPtr *C.int, lenQ C.int,
+	logPPtr *C.int, lenP C.int,
+	logScale C.int,
+	h C.int,
+	ringType *C.char,
+	keysPath *C.char,
+	ioMode *C.char,
+	seedPtr *C.char, lenSeed C.int,
+) C.int {
+	id := NewScheme(
+		logN, logQPtr, lenQ, logPPtr, lenP, logScale, h, ringType, keysPath, ioMode)
+
+	scheme := RetrieveScheme(int(id))
+	scheme.Seed = slices.Clone(
+		CArrayToByteSlice(unsafe.Pointer(seedPtr), uint64(lenSeed)))
+	scheme.KeyGen = newKeyGenerator(scheme, "keygen")
+	return id
+}
+
+// schemeLiteral is the JSON document accepted by NewSchemeFromJSON. Field
+// names match case-insensitively, and optional fields may be left out.
+type schemeLiteral struct {
+	LogN            int
+	LogQ            []int
+	LogP            []int
+	LogDefaultScale int
+	H               int     // Hamming weight of the ternary secret
+	Sigma           float64 // error standard deviation (default if 0)
+	Bound           float64 // error bound (6 * Sigma if 0)
+	RingType        string  // "standard" or "conjugate_invariant"
+	KeysPath        string
+	BootLogP        []int
+	Storage         string // "hdf5" (default) or "file", see SetStorage
+	StorePath       string // root directory of the "file" storage
+}
+
+// NewSchemeFromJSON is NewScheme with its parameters given as a single
+// JSON document (see schemeLiteral), so that new fields can be added
+// without changing the FFI signature. Unknown fields are rejected to
+// catch typos. Returns the scheme handle, or -1 with the last error set.
+//
+//export NewSchemeFromJSON
+func NewSchemeFromJSON(paramsJSON *C.char) C.int {
+	var lit schemeLiteral
+	dec := json.NewDecoder(strings.NewReader(C.GoString(paramsJSON)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&lit); err != nil {
+		SetLastError(fmt.Errorf("cannot parse scheme parameters: %w", err))
+		return -1
+	}
+
+	ckksLit := ckks.ParametersLiteral{
+		LogN:            lit.LogN,
+		LogQ:            lit.LogQ,
+		LogP:            lit.LogP,
+		LogDefaultScale: lit.LogDefaultScale,
+		Xs:              ring.Ternary{H: lit.H},
+	}
+
+	switch strings.ToLower(lit.RingType) {
+	case "", "standard":
+		ckksLit.RingType = ring.Standard
+	case "conjugate_invariant", "conjugateinvariant":
+		ckksLit.RingType = ring.ConjugateInvariant
+	default:
+		SetLastError(fmt.Errorf("unknown ring type %q", lit.RingType))
+		return -1
+	}
+
+	if lit.Sigma > 0 {
+		bound := lit.Bound
+		if bound == 0 {
+			bound = 6 * lit.Sigma
+		}
+		ckksLit.Xe = ring.DiscreteGaussian{Sigma: lit.Sigma, Bound: bound}
+	}
+
+	if lit.Storage == "" {
+		lit.Storage = storageHDF5
+	}
+	store, err := newStore(strings.ToLower(lit.Storage), lit.StorePath)
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	params, err := ckks.NewParametersFromLiteral(ckksLit)
+	if err != nil {
+		SetLastError(fmt.Errorf("invalid scheme parameters: %w", err))
+		return -1
+	}
+
+	scheme := addScheme(params, lit.KeysPath)
+	scheme.BootLogP = lit.BootLogP
+	scheme.Store = store
+	return C.int(scheme.ID)
+}
+
+// addScheme registers a new scheme with the given parameters and makes it
+// the active one.
+func addScheme(params ckks.Parameters, keysPath string) *Scheme {
 	keyGen := rlwe.NewKeyGenerator(params)
 
-	scheme = Scheme{
+	scheme := &Scheme{
 		Params:        &params,
 		KeyGen:        keyGen,
 		SecretKey:     nil,
@@ -82,19 +251,171 @@ func NewScheme(
 		PolyEvaluator: nil,
 		LinEvaluator:  nil,
 		Bootstrapper:  nil,
+		LiveRotKeys:   make(map[uint64]*rlwe.GaloisKey),
+		SavedRotKeys:  []uint64{},
+		Bootstrappers: make(map[int]*bootstrapping.Evaluator),
+	}
+	scheme.KeysPath = keysPath
+	scheme.ID = schemeHeap.Add(scheme)
+	activeScheme.Store(scheme)
+
+	return scheme
+}
+
+// UseScheme makes schemeID the scheme that the other exports act on.
+// Returns 0, or -1 with the last error set if there is no such scheme, in
+// which case the active scheme is left as it was.
+//
+//export UseScheme
+func UseScheme(schemeID C.int) C.int {
+	if err := useScheme(int(schemeID)); err != nil {
+		SetLastError(err)
+		return -1
+	}
+	return 0
+}
+
+func useScheme(schemeID int) error {
+	if !schemeHeap.Exists(schemeID) {
+		return fmt.Errorf("no scheme with handle %d", schemeID)
 	}
+	activeScheme.Store(RetrieveScheme(schemeID))
+	return nil
 }
 
 //export DeleteScheme
 func DeleteScheme() {
-	scheme = Scheme{}
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return
+	}
+
+	zeroizeSecretKey(scheme)
+	deleteIntegerScheme(scheme)
+	deleteMultiparty(scheme)
+	deleteRotationKeys(scheme)
+	deleteBootstrappers(scheme)
+
+	schemeHeap.Delete(scheme.ID)
+	// Another thread may have switched schemes meanwhile, in which case
+	// its scheme stays active.
+	activeScheme.CompareAndSwap(scheme, nil)
+
+	// Tensors, transforms and polynomials share one set of heaps across
+	// schemes, so we only clear them once the last scheme is gone.
+	if len(schemeHeap.GetLiveKeys()) > 0 {
+		return
+	}
 
-	DeleteRotationKeys()
-	DeleteBootstrappers()
 	DeleteMinimaxSignMap()
 
 	ltHeap.Reset()
+	clearReencodedTransforms()
+	ClearDiagonalCache()
 	polyHeap.Reset()
+	affineHeap.Reset()
+	clearSlotMaskCache()
+	signHeap.Reset()
 	ptHeap.Reset()
 	ctHeap.Reset()
+	switchKeyHeap.Reset()
+}
+
+// ---------------------------------------- //
+//            PARAMETER QUERIES             //
+// ---------------------------------------- //
+
+// The getters below return -1 when no scheme is active.
+
+//export GetMaxSlots
+func GetMaxSlots() C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	return C.int(scheme.Params.MaxSlots())
+}
+
+//export GetLogN
+func GetLogN() C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	return C.int(scheme.Params.LogN())
+}
+
+//export GetRingDegree
+func GetRingDegree() C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	return C.int(scheme.Params.N())
+}
+
+//export GetLogQP
+func GetLogQP() C.double {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	return C.double(scheme.Params.LogQP())
+}
+
+//export GetDefaultScale
+func GetDefaultScale() C.double {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	return C.double(scheme.Params.DefaultScale().Float64())
+}
+
+// GetParametersFingerprint returns a SHA-256 digest of the active scheme's
+// parameters. Keys are only valid under the parameters they were made
+// with, so the keys file records it to catch a mismatch on load. Returns
+// an empty array with the last error set on failure.
+//
+//export GetParametersFingerprint
+func GetParametersFingerprint() (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		SetLastError(fmt.Errorf("cannot fingerprint parameters: no active scheme"))
+		return nil, 0
+	}
+	data, err := scheme.Params.MarshalBinary()
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot fingerprint parameters: %w", err))
+		return nil, 0
+	}
+	digest := sha256.Sum256(data)
+	return SliceToCArray(digest[:], convertByteToCChar)
+}
+
+//export GetMaxLevelQ
+func GetMaxLevelQ() C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	return C.int(scheme.Params.MaxLevelQ())
+}
+
+//export GetMaxLevelP
+func GetMaxLevelP() C.int {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	return C.int(scheme.Params.MaxLevelP())
+}
+
+//export GetLogScale
+func GetLogScale() C.double {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	return C.double(scheme.Params.DefaultScale().Log2())
 }
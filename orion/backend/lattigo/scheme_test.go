@@ -0,0 +1,304 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/ring"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+)
+
+// testParams are small, insecure parameters that still leave enough
+// precision to tell float32 from float64 inputs apart.
+var testParams = ckks.ParametersLiteral{
+	LogN:            12,
+	LogQ:            []int{55, 45, 45, 45},
+	LogP:            []int{56},
+	LogDefaultScale: 45,
+	RingType:        ring.Standard,
+}
+
+// testMaxLevel is the top level of testParams.
+const testMaxLevel = 3
+
+// deepTestParams are small, insecure parameters with enough levels for
+// polynomial approximations and attention without bootstrapping.
+var deepTestParams = ckks.ParametersLiteral{
+	LogN:            12,
+	LogQ:            append([]int{55}, slices.Repeat([]int{40}, 24)...),
+	LogP:            []int{56, 56},
+	LogDefaultScale: 40,
+	RingType:        ring.Standard,
+}
+
+// newTestScheme makes a scheme with the given parameters and fresh keys
+// the active one, the way the Python side sets one up, and deletes it
+// when the test ends.
+func newTestScheme(tb testing.TB, lit ckks.ParametersLiteral) *Scheme {
+	tb.Helper()
+	return newSeededTestScheme(tb, lit, nil)
+}
+
+// newSeededTestScheme is newTestScheme with keys derived from seed, as
+// NewSchemeWithSeed does, unless seed is nil.
+func newSeededTestScheme(tb testing.TB, lit ckks.ParametersLiteral, seed []byte) *Scheme {
+	tb.Helper()
+
+	params, err := ckks.NewParametersFromLiteral(lit)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	scheme := addScheme(params, "")
+	tb.Cleanup(func() {
+		if useScheme(scheme.ID) == nil {
+			DeleteScheme()
+		}
+	})
+	scheme.Seed = seed
+
+	NewKeyGenerator()
+	GenerateSecretKey()
+	GeneratePublicKey()
+	GenerateRelinearizationKey()
+	GenerateEvaluationKeys()
+	NewEncoder()
+	NewEncryptor()
+	NewDecryptor()
+	NewEvaluator()
+	NewPolynomialEvaluator()
+	NewLinearTransformEvaluator()
+	return scheme
+}
+
+// Schemes with different parameters live side by side, each with its own
+// keys, and UseScheme switches between them.
+func TestUseScheme(t *testing.T) {
+	rng := rand.New(rand.NewPCG(17, 18))
+
+	first := newTestScheme(t, testParams)
+	x := randomValues(rng, first.Params.MaxSlots())
+	ctID := encryptValues(t, first, x, testMaxLevel)
+
+	second := newTestScheme(t, ckks.ParametersLiteral{
+		LogN:            11,
+		LogQ:            []int{50, 40},
+		LogP:            []int{51},
+		LogDefaultScale: 40,
+		RingType:        ring.Standard,
+	})
+	y := randomValues(rng, second.Params.MaxSlots())
+	otherCtID := encryptValues(t, second, y, second.Params.MaxLevel())
+
+	if err := useScheme(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if activeScheme.Load() != first {
+		t.Fatal("UseScheme did not make the first scheme active")
+	}
+	if err := maxError(x, decryptValues(t, first, ctID)); err > 1e-6 {
+		t.Errorf("first scheme decrypts its ciphertext with error %g", err)
+	}
+
+	if err := useScheme(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := maxError(y, decryptValues(t, second, otherCtID)); err > 1e-6 {
+		t.Errorf("second scheme decrypts its ciphertext with error %g", err)
+	}
+	if first.Params.MaxSlots() == second.Params.MaxSlots() {
+		t.Error("schemes share parameters")
+	}
+
+	if err := useScheme(second.ID + 100); err == nil {
+		t.Error("switched to a scheme that does not exist")
+	}
+	if activeScheme.Load() != second {
+		t.Error("a failed switch changed the active scheme")
+	}
+}
+
+// Schemes with different parameters can be used from separate goroutines
+// at once, while the active scheme keeps switching between them. Each
+// goroutine encrypts, applies a transform and decrypts on its own scheme.
+func TestConcurrentSchemes(t *testing.T) {
+	schemes := []*Scheme{
+		newTestScheme(t, testParams),
+		newTestScheme(t, ckks.ParametersLiteral{
+			LogN:            11,
+			LogQ:            []int{50, 40},
+			LogP:            []int{51},
+			LogDefaultScale: 40,
+			RingType:        ring.Standard,
+		}),
+	}
+
+	const rounds = 8
+	var wg sync.WaitGroup
+	for i, scheme := range schemes {
+		rng := rand.New(rand.NewPCG(uint64(i), 19))
+		slots := scheme.Params.MaxSlots()
+		level := scheme.Params.MaxLevel()
+		diags := map[int][]float64{0: randomValues(rng, slots), 1: randomValues(rng, slots)}
+		transformID := newTestTransform(t, scheme, diags, level)
+
+		inputs := make([][]float64, rounds)
+		for r := range inputs {
+			inputs[r] = randomValues(rng, slots)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, x := range inputs {
+				plaintext := ckks.NewPlaintext(*scheme.Params, level)
+				if err := scheme.Encoder.Encode(x, plaintext); err != nil {
+					t.Error(err)
+					return
+				}
+				ciphertext, err := scheme.Encryptor.EncryptNew(plaintext)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ctID := PushCiphertext(ciphertext)
+
+				outIDs, err := evaluateLinearTransforms(
+					scheme, []int{transformID}, []int{ctID}, nil, 1, true)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				got := make([]float64, slots)
+				plaintext = scheme.Decryptor.DecryptNew(RetrieveCiphertext(outIDs[0]))
+				if err := scheme.Encoder.Decode(plaintext, got); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := maxError(applyDiagonals(diags, x), got); err > 1e-4 {
+					t.Errorf("scheme %d: output differs from the expected one by up to %g",
+						scheme.ID, err)
+				}
+				ctHeap.DeleteMany(append(outIDs, ctID))
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for r := 0; ; r++ {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if err := useScheme(schemes[r%len(schemes)].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Deleting a scheme overwrites its secret key rather than just dropping
+// it, along with the decryptor that references it.
+func TestDeleteSchemeZeroizesSecretKey(t *testing.T) {
+	deleted := newTestScheme(t, testParams)
+	sk := deleted.SecretKey.Value
+
+	isZero := func() bool {
+		for _, coeffs := range slices.Concat(sk.Q.Coeffs, sk.P.Coeffs) {
+			for _, c := range coeffs {
+				if c != 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if isZero() {
+		t.Fatal("fresh secret key is already zero")
+	}
+
+	DeleteScheme()
+	if !isZero() {
+		t.Error("secret key buffers still hold key material")
+	}
+	if deleted.SecretKey != nil || deleted.Decryptor != nil {
+		t.Error("deleted scheme still references its secret key")
+	}
+}
+
+// randomValues returns n values drawn uniformly from [-1, 1).
+func randomValues(rng *rand.Rand, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = 2*rng.Float64() - 1
+	}
+	return values
+}
+
+// encryptValues encrypts values (of type []float64 or []complex128) at
+// level with the default scale, and returns the ciphertext's ID.
+func encryptValues(tb testing.TB, scheme *Scheme, values any, level int) int {
+	tb.Helper()
+
+	plaintext := ckks.NewPlaintext(*scheme.Params, level)
+	if err := scheme.Encoder.Encode(values, plaintext); err != nil {
+		tb.Fatal(err)
+	}
+	ciphertext, err := scheme.Encryptor.EncryptNew(plaintext)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return PushCiphertext(ciphertext)
+}
+
+// decryptValues decrypts and decodes a ciphertext into one real value per
+// slot.
+func decryptValues(tb testing.TB, scheme *Scheme, ciphertextID int) []float64 {
+	tb.Helper()
+
+	plaintext := scheme.Decryptor.DecryptNew(RetrieveCiphertext(ciphertextID))
+	values := make([]float64, scheme.Params.MaxSlots())
+	if err := scheme.Encoder.Decode(plaintext, values); err != nil {
+		tb.Fatal(err)
+	}
+	return values
+}
+
+// generateRotationKeys installs the rotation keys a transform needs for
+// linear transforms, as GenerateLinearTransformRotationKey does.
+func generateRotationKeys(scheme *Scheme, transformID int) {
+	transform := RetrieveLinearTransform(transformID)
+	for _, galEl := range transform.GaloisElements(scheme.Params) {
+		if _, exists := scheme.EvalKeys.GaloisKeys[galEl]; !exists {
+			scheme.EvalKeys.GaloisKeys[galEl] = scheme.KeyGen.GenGaloisKeyNew(
+				galEl, scheme.SecretKey)
+		}
+	}
+}
+
+// applyDiagonals computes in the clear what a transform with the given
+// diagonals does to x: output slot i sums diags[k][i] * x[i+k].
+func applyDiagonals(diags map[int][]float64, x []float64) []float64 {
+	out := make([]float64, len(x))
+	for k, diag := range diags {
+		for i := range out {
+			out[i] += diag[i] * x[((i+k)%len(x)+len(x))%len(x)]
+		}
+	}
+	return out
+}
+
+// maxError returns the largest absolute difference between want and got.
+func maxError(want, got []float64) (maxErr float64) {
+	for i := range want {
+		maxErr = math.Max(maxErr, math.Abs(got[i]-want[i]))
+	}
+	return
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"C"
+	"encoding/json"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/schemes/ckks"
+)
+
+// schemeFile is the artifact written by SaveScheme. It holds everything a
+// server needs to resume inference, but never the secret key: decryption
+// stays with whoever holds it. Keys are stored in their binary form.
+// GaloisKeys, the rotation keys of linear transforms, are only included
+// in evaluation-key bundles.
+type schemeFile struct {
+	Params       ckks.Parameters
+	KeysPath     string
+	BootLogP     []int
+	PublicKey    []byte
+	RelinKey     []byte
+	LiveRotKeys  [][]byte
+	SavedRotKeys []uint64
+	GaloisKeys   [][]byte `json:",omitempty"`
+}
+
+// SaveScheme writes the active scheme's parameters, public key,
+// relinearization key, live rotation keys and saved rotation key index
+// to path. Returns 0, or -1 with the last error set.
+//
+//export SaveScheme
+func SaveScheme(pathC *C.char) C.int {
+	scheme := activeScheme.Load()
+
+	if err := saveScheme(scheme, C.GoString(pathC)); err != nil {
+		SetLastError(fmt.Errorf("cannot save scheme: %w", err))
+		return -1
+	}
+	return 0
+}
+
+func saveScheme(scheme *Scheme, path string) error {
+	data, err := marshalScheme(scheme, false)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// SaveEvaluationKeyBundle writes what SaveScheme does, plus every rotation
+// key held for linear transforms, to a single file. This is all the public
+// material a remote evaluator needs, and it can be started from it with
+// LoadScheme or NewSchemeEvaluatorOnly. Keys that only exist in the keys
+// file must be loaded first. Returns 0, or -1 with the last error set.
+//
+//export SaveEvaluationKeyBundle
+func SaveEvaluationKeyBundle(pathC *C.char) C.int {
+	scheme := activeScheme.Load()
+
+	data, err := marshalScheme(scheme, true)
+	if err == nil {
+		err = os.WriteFile(C.GoString(pathC), data, 0o600)
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot save evaluation key bundle: %w", err))
+		return -1
+	}
+	return 0
+}
+
+// SerializeScheme returns the same artifact SaveScheme writes, for callers
+// that hand it to a server over the network rather than through a file.
+// Returns nil with the last error set on failure.
+//
+//export SerializeScheme
+func SerializeScheme() (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	data, err := marshalScheme(scheme, false)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot serialize scheme: %w", err))
+		return nil, 0
+	}
+	return SliceToCArray(data, convertByteToCChar)
+}
+
+// marshalScheme encodes the scheme as a schemeFile, with the
+// linear transform rotation keys if withGaloisKeys is set.
+func marshalScheme(scheme *Scheme, withGaloisKeys bool) ([]byte, error) {
+	if scheme == nil || scheme.PublicKey == nil || scheme.RelinKey == nil {
+		return nil, fmt.Errorf("no active scheme with generated keys")
+	}
+
+	file := schemeFile{
+		Params:       *scheme.Params,
+		KeysPath:     scheme.KeysPath,
+		BootLogP:     scheme.BootLogP,
+		SavedRotKeys: scheme.SavedRotKeys,
+	}
+
+	var err error
+	if file.PublicKey, err = scheme.PublicKey.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	if file.RelinKey, err = scheme.RelinKey.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	for _, rotKey := range scheme.LiveRotKeys {
+		data, err := rotKey.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		file.LiveRotKeys = append(file.LiveRotKeys, data)
+	}
+	if withGaloisKeys && scheme.EvalKeys != nil {
+		for galEl, rotKey := range scheme.EvalKeys.GaloisKeys {
+			if _, live := scheme.LiveRotKeys[galEl]; live {
+				continue
+			}
+			data, err := rotKey.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			file.GaloisKeys = append(file.GaloisKeys, data)
+		}
+	}
+
+	return json.Marshal(file)
+}
+
+// LoadScheme restores a scheme saved by SaveScheme and makes it the active
+// one, with its encoder, encryptor and evaluators ready for inference.
+// Since no secret key is saved, it has no decryptor and cannot generate
+// new keys. Returns the new scheme handle, or -1 with the last error set.
+//
+//export LoadScheme
+func LoadScheme(pathC *C.char) C.int {
+	id, err := loadScheme(C.GoString(pathC))
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot load scheme: %w", err))
+		return -1
+	}
+	return C.int(id)
+}
+
+func loadScheme(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1, err
+	}
+	return restoreScheme(data)
+}
+
+// NewSchemeEvaluatorOnly is LoadScheme for an artifact already in memory,
+// e.g. one produced by SerializeScheme on the client and received over the
+// network. It is meant for untrusted inference servers: the scheme never
+// holds a secret key, and exports that would generate or load one refuse.
+// Rotation keys must all come with the artifact or be loaded from the
+// keys file. Returns the new scheme handle, or -1 with the last error set.
+//
+//export NewSchemeEvaluatorOnly
+func NewSchemeEvaluatorOnly(dataPtr *C.char, lenData C.ulong) C.int {
+	data := CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData))
+	id, err := restoreScheme(data)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot create evaluator-only scheme: %w", err))
+		return -1
+	}
+	return C.int(id)
+}
+
+// restoreScheme makes a new active scheme from a marshaled schemeFile.
+func restoreScheme(data []byte) (int, error) {
+	var file schemeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return -1, err
+	}
+
+	pk := &rlwe.PublicKey{}
+	if err := pk.UnmarshalBinary(file.PublicKey); err != nil {
+		return -1, err
+	}
+	rlk := &rlwe.RelinearizationKey{}
+	if err := rlk.UnmarshalBinary(file.RelinKey); err != nil {
+		return -1, err
+	}
+	rotKeys := make([]*rlwe.GaloisKey, len(file.LiveRotKeys))
+	for i, data := range file.LiveRotKeys {
+		rotKeys[i] = &rlwe.GaloisKey{}
+		if err := rotKeys[i].UnmarshalBinary(data); err != nil {
+			return -1, err
+		}
+	}
+	galoisKeys := make([]*rlwe.GaloisKey, len(file.GaloisKeys))
+	for i, data := range file.GaloisKeys {
+		galoisKeys[i] = &rlwe.GaloisKey{}
+		if err := galoisKeys[i].UnmarshalBinary(data); err != nil {
+			return -1, err
+		}
+	}
+
+	scheme := addScheme(file.Params, file.KeysPath)
+	scheme.EvaluatorOnly = true
+	scheme.BootLogP = file.BootLogP
+	scheme.SavedRotKeys = file.SavedRotKeys
+	scheme.PublicKey = pk
+	scheme.RelinKey = rlk
+	for _, rotKey := range rotKeys {
+		scheme.LiveRotKeys[rotKey.GaloisElement] = rotKey
+	}
+
+	// Bundles leave out the transform keys that are also live, so those
+	// are made available to linear transforms too.
+	generateEvaluationKeys(scheme)
+	if file.GaloisKeys != nil {
+		for galEl, rotKey := range scheme.LiveRotKeys {
+			scheme.EvalKeys.GaloisKeys[galEl] = rotKey
+		}
+	}
+	for _, rotKey := range galoisKeys {
+		scheme.EvalKeys.GaloisKeys[rotKey.GaloisElement] = rotKey
+	}
+	newEncoder(scheme)
+	newEncryptor(scheme)
+	scheme.Evaluator = ckks.NewEvaluator(
+		*scheme.Params, rlwe.NewMemEvaluationKeySet(scheme.RelinKey))
+	installLiveRotKeys(scheme)
+	newPolynomialEvaluator(scheme)
+	newLinearTransformEvaluator(scheme)
+
+	return scheme.ID, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"C"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"golang.org/x/crypto/argon2"
+)
+
+// A sealed secret key is the marshaled key encrypted with AES-256-GCM,
+// under a key derived from a passphrase with Argon2id. It is laid out as
+//
+//	magic | time | memory | threads | salt | nonce | ciphertext
+//
+// The header up to the nonce is authenticated along with the key, so the
+// KDF cost can be raised later without breaking files sealed before.
+const (
+	sealedKeyMagic = "OSK1"
+	sealedSaltSize = 16
+
+	// Argon2id costs recommended by RFC 9106 for memory-constrained
+	// settings: 3 passes over 64 MiB with 4 lanes.
+	argonTime    uint32 = 3
+	argonMemory  uint32 = 64 * 1024
+	argonThreads uint8  = 4
+)
+
+// SerializeSecretKeySealed is SerializeSecretKey for keys stored at rest:
+// the key is encrypted under the passphrase, which is zeroed once read.
+// Returns an empty array with the last error set on failure.
+//
+//export SerializeSecretKeySealed
+func SerializeSecretKeySealed(passPtr *C.char, lenPass C.int) (*C.char, C.ulong) {
+	scheme := activeScheme.Load()
+
+	passphrase := CArrayToByteSlice(unsafe.Pointer(passPtr), uint64(lenPass))
+	defer clear(passphrase)
+
+	if scheme == nil || scheme.SecretKey == nil {
+		SetLastError(fmt.Errorf("cannot seal secret key: no active secret key"))
+		return nil, 0
+	}
+	if len(passphrase) == 0 {
+		SetLastError(fmt.Errorf("cannot seal secret key: empty passphrase"))
+		return nil, 0
+	}
+
+	sealed, err := sealSecretKey(scheme.SecretKey, passphrase)
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot seal secret key: %w", err))
+		return nil, 0
+	}
+	return SliceToCArray(sealed, convertByteToCChar)
+}
+
+// sealSecretKey encrypts a secret key under a passphrase in the sealed
+// key layout.
+func sealSecretKey(sk *rlwe.SecretKey, passphrase []byte) ([]byte, error) {
+	skSerial, err := sk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(skSerial)
+
+	header := make([]byte, 0, len(sealedKeyMagic)+9+sealedSaltSize)
+	header = append(header, sealedKeyMagic...)
+	header = binary.LittleEndian.AppendUint32(header, argonTime)
+	header = binary.LittleEndian.AppendUint32(header, argonMemory)
+	header = append(header, argonThreads)
+
+	salt := make([]byte, sealedSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	header = append(header, salt...)
+
+	gcm := newSealingCipher(passphrase, salt, argonTime, argonMemory, argonThreads)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return append(append(header, nonce...), gcm.Seal(nil, nonce, skSerial, header)...), nil
+}
+
+// LoadSecretKeySealed is LoadSecretKey for keys written by
+// SerializeSecretKeySealed. The passphrase is zeroed once read. Returns 0
+// on success and -1 with the last error set if the passphrase is wrong or
+// the data is corrupted.
+//
+//export LoadSecretKeySealed
+func LoadSecretKeySealed(
+	dataPtr *C.char, lenData C.ulong,
+	passPtr *C.char, lenPass C.int,
+) C.int {
+	scheme := activeScheme.Load()
+
+	data := CArrayToByteSlice(unsafe.Pointer(dataPtr), uint64(lenData))
+	passphrase := CArrayToByteSlice(unsafe.Pointer(passPtr), uint64(lenPass))
+	defer clear(passphrase)
+
+	if err := loadSecretKeySealed(scheme, data, passphrase); err != nil {
+		SetLastError(fmt.Errorf("cannot load secret key: %w", err))
+		return -1
+	}
+	logInfo("loaded sealed secret key (%d bytes)", int(lenData))
+	return 0
+}
+
+func loadSecretKeySealed(scheme *Scheme, data, passphrase []byte) error {
+	if err := checkSecretKeyAllowed(scheme); err != nil {
+		return err
+	}
+
+	skSerial, err := openSealedKey(data, passphrase)
+	if err != nil {
+		return err
+	}
+	defer clear(skSerial)
+
+	sk := &rlwe.SecretKey{}
+	if err := sk.UnmarshalBinary(skSerial); err != nil {
+		return err
+	}
+	if err := checkSecretKeyParams(scheme, sk); err != nil {
+		return err
+	}
+
+	scheme.SecretKey = sk
+	return nil
+}
+
+// openSealedKey decrypts a sealed secret key, returning its marshaled form.
+func openSealedKey(data, passphrase []byte) ([]byte, error) {
+	headerSize := len(sealedKeyMagic) + 9 + sealedSaltSize
+	if len(data) < headerSize || !bytes.HasPrefix(data, []byte(sealedKeyMagic)) {
+		return nil, fmt.Errorf("data is not a sealed secret key")
+	}
+
+	header := data[:headerSize]
+	params := header[len(sealedKeyMagic):]
+	time := binary.LittleEndian.Uint32(params[0:4])
+	memory := binary.LittleEndian.Uint32(params[4:8])
+	threads := params[8]
+	salt := params[9:]
+	if time == 0 || threads == 0 {
+		return nil, fmt.Errorf("sealed secret key has invalid KDF parameters")
+	}
+
+	gcm := newSealingCipher(passphrase, salt, time, memory, threads)
+	if len(data) < headerSize+gcm.NonceSize() {
+		return nil, fmt.Errorf("sealed secret key is truncated")
+	}
+	nonce := data[headerSize : headerSize+gcm.NonceSize()]
+
+	skSerial, err := gcm.Open(nil, nonce, data[headerSize+gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase, or the sealed key is corrupted")
+	}
+	return skSerial, nil
+}
+
+// newSealingCipher derives the AES-256-GCM cipher for a passphrase.
+func newSealingCipher(
+	passphrase, salt []byte, time, memory uint32, threads uint8,
+) cipher.AEAD {
+	key := argon2.IDKey(passphrase, salt, time, memory, threads, 32)
+	defer clear(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return gcm
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// A sealed secret key loads into another scheme under the passphrase it
+// was sealed with, and is rejected under any other or once tampered with.
+func TestSealedSecretKey(t *testing.T) {
+	owner := newTestScheme(t, testParams)
+	sealed, err := sealSecretKey(owner.SecretKey, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheme := newTestScheme(t, testParams)
+	ownKey := scheme.SecretKey
+
+	if err := loadSecretKeySealed(scheme, sealed, []byte("wrong horse")); err == nil {
+		t.Error("loaded a sealed key under the wrong passphrase")
+	}
+	tampered := slices.Clone(sealed)
+	tampered[len(sealedKeyMagic)] ^= 1
+	if err := loadSecretKeySealed(scheme, tampered, []byte("correct horse")); err == nil {
+		t.Error("loaded a sealed key with a tampered header")
+	}
+	if err := loadSecretKeySealed(scheme, sealed[1:], []byte("correct horse")); err == nil {
+		t.Error("loaded data that is not a sealed key")
+	}
+	if scheme.SecretKey != ownKey {
+		t.Fatal("a rejected sealed key replaced the scheme's own")
+	}
+
+	if err := loadSecretKeySealed(scheme, sealed, []byte("correct horse")); err != nil {
+		t.Fatal(err)
+	}
+	if !scheme.SecretKey.Equal(owner.SecretKey) {
+		t.Error("unsealed key differs from the one sealed")
+	}
+}
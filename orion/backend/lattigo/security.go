@@ -0,0 +1,60 @@
+package main
+
+import (
+	"C"
+)
+
+// securityBounds gives, per LogN, the largest LogQP that reaches 128, 192
+// and 256 bits of classical security with a uniform ternary secret. The
+// values up to LogN 15 are those of the HE standard; the larger ones
+// extend them linearly, as Lattigo does.
+var securityBounds = map[int][3]float64{
+	10: {27, 19, 14},
+	11: {54, 37, 29},
+	12: {109, 75, 58},
+	13: {218, 152, 118},
+	14: {438, 305, 237},
+	15: {881, 611, 476},
+	16: {1761, 1222, 952},
+	17: {3523, 2444, 1904},
+}
+
+var securityLevels = [3]float64{128, 192, 256}
+
+// EstimateSecurityBits returns the estimated classical security of the
+// active scheme in bits, from its LogN and LogQP. Security is taken as
+// linear in 1/LogQP between the tabulated points, and proportional to it
+// outside of them. Sparse secrets (a fixed Hamming weight) are somewhat
+// less secure than estimated here. Returns -1 if there is no scheme or its
+// LogN is outside the table.
+//
+//export EstimateSecurityBits
+func EstimateSecurityBits() C.double {
+	scheme := activeScheme.Load()
+	if scheme == nil {
+		return -1
+	}
+	bounds, ok := securityBounds[scheme.Params.LogN()]
+	if !ok {
+		return -1
+	}
+	return C.double(estimateSecurity(scheme.Params.LogQP(), bounds))
+}
+
+func estimateSecurity(logQP float64, bounds [3]float64) float64 {
+	// Beyond the table, security scales with 1/LogQP from its nearest end.
+	if logQP >= bounds[0] {
+		return securityLevels[0] * bounds[0] / logQP
+	}
+	if logQP <= bounds[2] {
+		return securityLevels[2] * bounds[2] / logQP
+	}
+
+	i := 0
+	if logQP < bounds[1] {
+		i = 1
+	}
+	x, x0, x1 := 1/logQP, 1/bounds[i], 1/bounds[i+1]
+	return securityLevels[i] +
+		(x-x0)/(x1-x0)*(securityLevels[i+1]-securityLevels[i])
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/baahl-nyu/lattigo/v6/utils/bignum"
+)
+
+// Sign compositions registered at runtime, each the list of polynomials
+// composed to approximate the step function, and referenced from Python by
+// their handle in sign and ReLU calls.
+var signHeap = NewHeapAllocator()
+
+func RetrieveSignComposition(signID int) []bignum.Polynomial {
+	return signHeap.Retrieve(signID).([]bignum.Polynomial)
+}
+
+// RegisterSignComposition registers a composite sign approximation with
+// the given degrees, e.g. {15, 15, 27}. coeffs holds the Chebyshev
+// coefficients over [-1, 1] of every polynomial in turn, the last one
+// mapping onto [0, 1] as with GenerateMinimaxSignCoeffs. When lenCoeffs is
+// 0, the minimax coefficients are generated from prec, logalpha and
+// logerr instead. Returns the composition's handle, or -1 with the last
+// error set.
+//
+//export RegisterSignComposition
+func RegisterSignComposition(
+	degreesPtr *C.int, lenDegrees C.int,
+	coeffsPtr *C.double, lenCoeffs C.int,
+	prec, logalpha, logerr C.int,
+) C.int {
+	degrees := CArrayToSlice(degreesPtr, lenDegrees, convertCIntToInt)
+	flatCoeffs := CArrayToSlice(coeffsPtr, lenCoeffs, convertCDoubleToFloat)
+
+	var coeffs [][]float64
+	if len(flatCoeffs) == 0 {
+		for _, d := range degrees {
+			if d <= 0 {
+				SetLastError(fmt.Errorf("sign degrees %v must be positive", degrees))
+				return -1
+			}
+		}
+		if len(degrees) == 0 {
+			SetLastError(fmt.Errorf("a sign composition needs at least one degree"))
+			return -1
+		}
+		coeffs = minimaxSignCoeffs(
+			degrees, uint(prec), int(logalpha), int(logerr), false)
+	} else {
+		var err error
+		if coeffs, err = splitSignCoeffs(degrees, flatCoeffs); err != nil {
+			SetLastError(err)
+			return -1
+		}
+	}
+
+	idx := signHeap.Add(newSignComposition(coeffs))
+	return C.int(idx)
+}
+
+// splitSignCoeffs splits the flattened coefficients of polynomials of the
+// given degrees.
+func splitSignCoeffs(degrees []int, flatCoeffs []float64) ([][]float64, error) {
+	total := 0
+	for _, d := range degrees {
+		if d < 0 {
+			return nil, fmt.Errorf("sign degrees %v must not be negative", degrees)
+		}
+		total += d + 1
+	}
+	if len(degrees) == 0 || total != len(flatCoeffs) {
+		return nil, fmt.Errorf(
+			"expected %d coefficients for degrees %v, got %d",
+			total, degrees, len(flatCoeffs))
+	}
+
+	coeffs := make([][]float64, len(degrees))
+	for i, d := range degrees {
+		coeffs[i], flatCoeffs = flatCoeffs[:d+1], flatCoeffs[d+1:]
+	}
+	return coeffs, nil
+}
+
+func newSignComposition(coeffs [][]float64) []bignum.Polynomial {
+	polys := make([]bignum.Polynomial, len(coeffs))
+	for i, c := range coeffs {
+		polys[i] = bignum.NewPolynomial(bignum.Chebyshev, c, [2]float64{-1.0, 1.0})
+	}
+	return polys
+}
+
+//export DeleteSignComposition
+func DeleteSignComposition(signID C.int) {
+	signHeap.Delete(int(signID))
+}
+
+// GetSignCompositionDepth returns the levels a sign composition consumes.
+//
+//export GetSignCompositionDepth
+func GetSignCompositionDepth(signID C.int) C.int {
+	scheme := activeScheme.Load()
+	return C.int(signCompositionLevels(scheme, RetrieveSignComposition(int(signID))))
+}
+
+func signCompositionLevels(scheme *Scheme, polys []bignum.Polynomial) int {
+	levels := 0
+	for _, poly := range polys {
+		levels += polynomialLevels(scheme, poly)
+	}
+	return levels
+}
+
+// EvaluateSign approximates the step function, 0 below 0 and 1 above, on
+// a ciphertext with a registered sign composition. Returns the ID of the
+// result, or -1 with the last error set.
+//
+//export EvaluateSign
+func EvaluateSign(ciphertextID, signID C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	if !signHeap.Exists(int(signID)) {
+		SetLastError(fmt.Errorf("sign composition %d does not exist", int(signID)))
+		return -1
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+	polys := RetrieveSignComposition(int(signID))
+
+	if levels := signCompositionLevels(scheme, polys); ctIn.Level() < levels {
+		SetLastError(fmt.Errorf(
+			"cannot evaluate sign on a ciphertext at level %d: "+
+				"%d levels are needed", ctIn.Level(), levels))
+		return -1
+	}
+
+	ctOut, err := evaluateSign(scheme, ctIn, polys, scheme.Params.DefaultScale())
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
+
+// EvaluatePiecewiseSign is EvaluatePiecewise with a registered sign
+// composition.
+//
+//export EvaluatePiecewiseSign
+func EvaluatePiecewiseSign(ciphertextID, signID, negPolyID, posPolyID C.int) C.int {
+	scheme := activeScheme.Load()
+
+	if !ctHeap.Exists(int(ciphertextID)) {
+		SetLastError(fmt.Errorf("ciphertext %d does not exist", int(ciphertextID)))
+		return -1
+	}
+	if !signHeap.Exists(int(signID)) {
+		SetLastError(fmt.Errorf("sign composition %d does not exist", int(signID)))
+		return -1
+	}
+	for _, id := range []C.int{negPolyID, posPolyID} {
+		if !polyHeap.Exists(int(id)) {
+			SetLastError(fmt.Errorf("polynomial %d does not exist", int(id)))
+			return -1
+		}
+	}
+	ctIn := RetrieveCiphertext(int(ciphertextID))
+
+	ctOut, err := evaluatePiecewise(
+		scheme, ctIn, RetrieveSignComposition(int(signID)),
+		RetrievePoly(int(negPolyID)), RetrievePoly(int(posPolyID)))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+
+	idx := PushCiphertext(ctOut)
+	return C.int(idx)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// A sign composition registered from its flattened coefficients decrypts
+// to the step function away from 0, and stays within [0, 1] close to it.
+func TestEvaluateSignComposition(t *testing.T) {
+	scheme := newTestScheme(t, deepTestParams)
+	slots := scheme.Params.MaxSlots()
+	maxLevel := scheme.Params.MaxLevel()
+	const alpha = 4
+	degrees := []int{7, 15}
+
+	var flatCoeffs []float64
+	for _, c := range minimaxSignCoeffs(degrees, 128, alpha, 12, false) {
+		flatCoeffs = append(flatCoeffs, c...)
+	}
+	coeffs, err := splitSignCoeffs(degrees, flatCoeffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	polys := newSignComposition(coeffs)
+
+	x := stepTestValues(slots, alpha)
+	ctID := encryptValues(t, scheme, x, maxLevel)
+	ctOut, err := evaluateSign(
+		scheme, RetrieveCiphertext(ctID), polys, scheme.Params.DefaultScale())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := maxLevel-ctOut.Level(), signCompositionLevels(scheme, polys); got != want {
+		t.Errorf("sign consumed %d levels, want %d", got, want)
+	}
+	got := decryptValues(t, scheme, PushCiphertext(ctOut))
+
+	// The minimax composition for alpha 4 is within 2^-8 of the step from
+	// 2^-4 on.
+	circuit := make([]float64, slots)
+	for i, xi := range x {
+		circuit[i] = composeChebyshev(coeffs, xi)
+
+		switch {
+		case math.Abs(xi) >= math.Pow(2, -alpha):
+			want := 0.0
+			if xi > 0 {
+				want = 1
+			}
+			if math.Abs(got[i]-want) > 1.0/256 {
+				t.Errorf("sign(%g) = %g, want %g", xi, got[i], want)
+			}
+		case got[i] < -1.0/256 || got[i] > 1+1.0/256:
+			t.Errorf("sign(%g) = %g is outside [0, 1]", xi, got[i])
+		}
+	}
+	if err := maxError(circuit, got); err > 1e-6 {
+		t.Errorf("sign differs from the composition in the clear by up to %g", err)
+	}
+
+	for _, bad := range [][]int{{7}, {7, 14}, {7, 15, 1}, {}} {
+		if _, err := splitSignCoeffs(bad, flatCoeffs); err == nil {
+			t.Errorf("split %d coefficients for degrees %v", len(flatCoeffs), bad)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
+	"github.com/baahl-nyu/lattigo/v6/ring/ringqp"
+)
+
+// KVStore holds serialized diagonals and rotation keys by key. Keys are
+// slash-separated paths, such as "diagonals/fc1/0_0/3".
+type KVStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Exists(key string) bool
+}
+
+// By default, diagonals and rotation keys are kept in HDF5 files, which
+// the Python side reads and writes. The "file" storage keeps them in a
+// directory tree instead, with one file of raw MarshalBinary output per
+// diagonal or key, rather than as many small HDF5 datasets.
+const (
+	storageHDF5 = "hdf5"
+	storageFile = "file"
+)
+
+// fileStore is the KVStore of the "file" storage, rooted at a directory.
+type fileStore struct {
+	root string
+}
+
+func (s fileStore) path(key string) (string, error) {
+	if path.Clean(key) != key || !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid store key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes data to a temporary file that then replaces the key's, so
+// that an interrupted write never leaves a truncated entry behind.
+func (s fileStore) Put(key string, data []byte) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s fileStore) Get(key string) ([]byte, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%q not found in %s", key, s.root)
+	}
+	return data, err
+}
+
+func (s fileStore) Exists(key string) bool {
+	name, err := s.path(key)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(name)
+	return err == nil
+}
+
+// newStore returns the KVStore of a storage kind rooted at root.
+func newStore(kind, root string) (KVStore, error) {
+	switch kind {
+	case storageHDF5:
+		return nil, nil
+	case storageFile:
+		if root == "" {
+			return nil, fmt.Errorf("the file storage needs a directory")
+		}
+		return fileStore{root}, nil
+	}
+	return nil, fmt.Errorf("unknown storage %q: expected %q or %q",
+		kind, storageHDF5, storageFile)
+}
+
+// SetStorage selects where the active scheme keeps diagonals and rotation
+// keys: "hdf5" (the default), or "file" for a directory tree rooted at
+// root. Returns 0, or -1 with the last error set.
+//
+//export SetStorage
+func SetStorage(kindC, rootC *C.char) C.int {
+	scheme := activeScheme.Load()
+
+	store, err := newStore(C.GoString(kindC), C.GoString(rootC))
+	if err != nil {
+		SetLastError(err)
+		return -1
+	}
+	scheme.Store = store
+	return 0
+}
+
+// schemeStore returns the scheme's store, which only the file storage
+// has.
+func schemeStore(scheme *Scheme) (KVStore, error) {
+	if scheme.Store == nil {
+		return nil, fmt.Errorf("the scheme stores its data in HDF5 files, " +
+			"which the Python side reads and writes")
+	}
+	return scheme.Store, nil
+}
+
+func diagonalKey(prefix string, diagIdx int) string {
+	return path.Join("diagonals", prefix, strconv.Itoa(diagIdx))
+}
+
+func rotationKeyKey(galEl uint64) string {
+	return path.Join("rotation_keys", strconv.FormatUint(galEl, 10))
+}
+
+// SaveDiagonals writes every diagonal of a transform to the active
+// scheme's store under prefix (e.g. "fc1/0_0"), and drops them from
+// memory, as SerializeDiagonal does. Returns 0, or -1 with the last error
+// set.
+//
+//export SaveDiagonals
+func SaveDiagonals(transformID C.int, prefixC *C.char) C.int {
+	scheme := activeScheme.Load()
+
+	store, err := schemeStore(scheme)
+	if err == nil {
+		err = saveDiagonals(store, int(transformID), C.GoString(prefixC))
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot save transform %d: %w", int(transformID), err))
+		return -1
+	}
+	return 0
+}
+
+func saveDiagonals(store KVStore, transformID int, prefix string) error {
+	transform := RetrieveLinearTransform(transformID)
+	for diagIdx, diag := range transform.Vec {
+		data, err := diag.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := store.Put(diagonalKey(prefix, diagIdx), data); err != nil {
+			return err
+		}
+		transform.Vec[diagIdx] = ringqp.Poly{}
+	}
+	return nil
+}
+
+// LoadDiagonals is LoadPlaintextDiagonal for every diagonal of a transform
+// saved by SaveDiagonals under prefix. Returns 0, or -1 with the last
+// error set.
+//
+//export LoadDiagonals
+func LoadDiagonals(transformID C.int, prefixC *C.char) C.int {
+	scheme := activeScheme.Load()
+
+	defer profileStop(&profile.DiskLoadNs, profileStart())
+	store, err := schemeStore(scheme)
+	if err == nil {
+		err = loadDiagonals(store, int(transformID), C.GoString(prefixC))
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot load transform %d: %w", int(transformID), err))
+		return -1
+	}
+	return 0
+}
+
+func loadDiagonals(store KVStore, transformID int, prefix string) error {
+	transform := RetrieveLinearTransform(transformID)
+	for diagIdx := range transform.Vec {
+		data, err := store.Get(diagonalKey(prefix, diagIdx))
+		if err != nil {
+			return err
+		}
+		var diag ringqp.Poly
+		if err := diag.UnmarshalBinary(data); err != nil {
+			return fmt.Errorf("diagonal %d: %w", diagIdx, err)
+		}
+		transform.Vec[diagIdx] = diag
+		diagCache.Put(diagCacheKey{transformID, diagIdx}, diag)
+	}
+	return nil
+}
+
+// SaveRotationKeys is GenerateAndSerializeRotationKey for every Galois
+// element in galElsC, writing the keys to the active scheme's store.
+// Keys already there are neither generated nor written again. Returns 0,
+// or -1 with the last error set.
+//
+//export SaveRotationKeys
+func SaveRotationKeys(galElsC *C.ulong, lenGalEls C.int) C.int {
+	scheme := activeScheme.Load()
+
+	store, err := schemeStore(scheme)
+	if err == nil {
+		galEls := CArrayToSlice(galElsC, lenGalEls, func(v C.ulong) uint64 {
+			return uint64(v)
+		})
+		err = saveRotationKeys(scheme, store, galEls)
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot save rotation keys: %w", err))
+		return -1
+	}
+	return 0
+}
+
+func saveRotationKeys(scheme *Scheme, store KVStore, galEls []uint64) error {
+	if scheme.SecretKey == nil {
+		return fmt.Errorf("the scheme has no secret key to generate them with")
+	}
+	for _, galEl := range galEls {
+		key := rotationKeyKey(galEl)
+		if store.Exists(key) {
+			continue
+		}
+		rotKey := galoisKeyGenerator(scheme, galEl, scheme.KeyGen).
+			GenGaloisKeyNew(galEl, scheme.SecretKey,
+				rlwe.EvaluationKeyParameters{Compressed: true})
+		data, err := rotKey.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := store.Put(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRotationKeys is LoadRotationKey for every Galois element in galElsC,
+// reading the keys from the active scheme's store. Returns 0, or -1 with
+// the last error set.
+//
+//export LoadRotationKeys
+func LoadRotationKeys(galElsC *C.ulong, lenGalEls C.int) C.int {
+	scheme := activeScheme.Load()
+
+	defer profileStop(&profile.DiskLoadNs, profileStart())
+	store, err := schemeStore(scheme)
+	if err == nil {
+		galEls := CArrayToSlice(galElsC, lenGalEls, func(v C.ulong) uint64 {
+			return uint64(v)
+		})
+		err = loadRotationKeys(scheme, store, galEls)
+	}
+	if err != nil {
+		SetLastError(fmt.Errorf("cannot load rotation keys: %w", err))
+		return -1
+	}
+	return 0
+}
+
+func loadRotationKeys(scheme *Scheme, store KVStore, galEls []uint64) error {
+	for _, galEl := range galEls {
+		data, err := store.Get(rotationKeyKey(galEl))
+		if err != nil {
+			return err
+		}
+		rotKey, err := unmarshalRotationKey(data, *scheme.Params)
+		if err != nil {
+			return fmt.Errorf("Galois element %d: %w", galEl, err)
+		}
+		scheme.EvalKeys.GaloisKeys[galEl] = rotKey
+		rotKeyCache.Put(rotKeyCacheKey{scheme.KeysPath, galEl}, rotKey)
+	}
+	return nil
+}
+
+// HasStoredRotationKey reports whether the active scheme's store holds the
+// rotation key for galEl. Returns 1 or 0, and 0 for the HDF5 storage.
+//
+//export HasStoredRotationKey
+func HasStoredRotationKey(galEl C.ulong) C.int {
+	scheme := activeScheme.Load()
+	if scheme.Store != nil && scheme.Store.Exists(rotationKeyKey(uint64(galEl))) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/baahl-nyu/lattigo/v6/ring/ringqp"
+)
+
+func TestFileStore(t *testing.T) {
+	store := fileStore{t.TempDir()}
+
+	if store.Exists("diagonals/fc1/0_0/3") {
+		t.Fatal("empty store has a key")
+	}
+	if _, err := store.Get("diagonals/fc1/0_0/3"); err == nil {
+		t.Fatal("got a missing key without an error")
+	}
+
+	for _, data := range [][]byte{{1, 2, 3}, {4, 5}} {
+		if err := store.Put("diagonals/fc1/0_0/3", data); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get("diagonals/fc1/0_0/3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("got %v, want %v", got, data)
+		}
+	}
+	if !store.Exists("diagonals/fc1/0_0/3") {
+		t.Error("stored key does not exist")
+	}
+
+	// Only the entry itself is left behind, without temporary files.
+	entries, err := os.ReadDir(filepath.Join(store.root, "diagonals", "fc1", "0_0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("block directory holds %d entries, want 1", len(entries))
+	}
+
+	for _, key := range []string{"", "/abs", "../escape", "a/../../b", "a//b"} {
+		if err := store.Put(key, nil); err == nil {
+			t.Errorf("stored invalid key %q", key)
+		}
+	}
+}
+
+// Diagonals written to the file storage evaluate to the same output once
+// loaded back.
+func TestSaveLoadDiagonals(t *testing.T) {
+	scheme := newTestScheme(t, testParams)
+	rng := rand.New(rand.NewPCG(15, 16))
+	slots := scheme.Params.MaxSlots()
+	store := fileStore{t.TempDir()}
+
+	diags := map[int][]float64{}
+	for _, k := range []int{0, 1, 7} {
+		diags[k] = randomValues(rng, slots)
+	}
+	transformID := newTestTransform(t, scheme, diags, testMaxLevel)
+	ctID := encryptValues(t, scheme, randomValues(rng, slots), testMaxLevel)
+
+	evaluate := func() []float64 {
+		outIDs, err := evaluateLinearTransforms(
+			scheme, []int{transformID}, []int{ctID}, nil, 1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decryptValues(t, scheme, outIDs[0])
+	}
+	want := evaluate()
+
+	if err := saveDiagonals(store, transformID, "fc1/0_0"); err != nil {
+		t.Fatal(err)
+	}
+	transform := RetrieveLinearTransform(transformID)
+	for diagIdx, diag := range transform.Vec {
+		if !diag.Equal(&ringqp.Poly{}) {
+			t.Errorf("diagonal %d is still in memory after saving", diagIdx)
+		}
+	}
+
+	ClearDiagonalCache()
+	if err := loadDiagonals(store, transformID, "fc1/0_0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := maxError(want, evaluate()); err > 1e-9 {
+		t.Errorf("output differs after a round trip by up to %g", err)
+	}
+
+	if err := loadDiagonals(store, transformID, "fc2/0_0"); err == nil {
+		t.Error("loaded diagonals that were never saved")
+	}
+}
+
+// Rotation keys written to the file storage are loaded back as they were
+// generated, and are not generated again once there.
+func TestSaveLoadRotationKeys(t *testing.T) {
+	scheme := newSeededTestScheme(t, testParams, []byte("rotation keys"))
+	store := fileStore{t.TempDir()}
+
+	galEls := []uint64{
+		scheme.Params.GaloisElement(1),
+		scheme.Params.GaloisElement(5),
+	}
+	if err := saveRotationKeys(scheme, store, galEls); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := map[uint64][]byte{}
+	for _, galEl := range galEls {
+		data, err := store.Get(rotationKeyKey(galEl))
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved[galEl] = data
+	}
+
+	// Saving again leaves the stored keys untouched.
+	if err := store.Put(rotationKeyKey(galEls[0]), []byte("placeholder")); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveRotationKeys(scheme, store, galEls); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := store.Get(rotationKeyKey(galEls[0])); string(data) != "placeholder" {
+		t.Error("an existing key was generated again")
+	}
+	if err := store.Put(rotationKeyKey(galEls[0]), saved[galEls[0]]); err != nil {
+		t.Fatal(err)
+	}
+
+	RemoveRotationKeys()
+	rotKeyCache.Clear()
+	if err := loadRotationKeys(scheme, store, galEls); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, galEl := range galEls {
+		rotKey, ok := scheme.EvalKeys.GaloisKeys[galEl]
+		if !ok {
+			t.Fatalf("key for Galois element %d was not installed", galEl)
+		}
+		want, err := unmarshalRotationKey(saved[galEl], *scheme.Params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rotKey.GadgetCiphertext.Equal(&want.GadgetCiphertext) {
+			t.Errorf("key for Galois element %d differs from the saved one", galEl)
+		}
+	}
+}
@@ -41,6 +41,11 @@ func DeleteCiphertext(ciphertextID C.int) {
 	ctHeap.Delete(int(ciphertextID))
 }
 
+//export DeleteCiphertexts
+func DeleteCiphertexts(idsC *C.int, lenIDs C.int) {
+	ctHeap.DeleteMany(CArrayToSlice(idsC, lenIDs, convertCIntToInt))
+}
+
 //export GetPlaintextScale
 func GetPlaintextScale(plaintextID C.int) C.ulong {
 	plaintext := RetrievePlaintext(int(plaintextID))
@@ -57,6 +62,15 @@ func GetCiphertextScale(ciphertextID C.int) C.ulong {
 	return C.ulong(scale)
 }
 
+//export GetCiphertextLogScale
+func GetCiphertextLogScale(ciphertextID C.int) C.double {
+	if !ctHeap.Exists(int(ciphertextID)) {
+		return -1
+	}
+	ciphertext := RetrieveCiphertext(int(ciphertextID))
+	return C.double(ciphertext.Scale.Log2())
+}
+
 //export SetPlaintextScale
 func SetPlaintextScale(plaintextID C.int, scale C.ulong) {
 	plaintext := RetrievePlaintext(int(plaintextID))
@@ -76,8 +90,11 @@ func GetPlaintextLevel(plaintextID C.int) C.int {
 }
 
 //export GetCiphertextLevel
-func GetCiphertextLevel(ciphertextID int) C.int {
-	ciphertext := RetrieveCiphertext(ciphertextID)
+func GetCiphertextLevel(ciphertextID C.int) C.int {
+	if !ctHeap.Exists(int(ciphertextID)) {
+		return -1
+	}
+	ciphertext := RetrieveCiphertext(int(ciphertextID))
 	return C.int(ciphertext.Level())
 }
 
@@ -103,6 +120,7 @@ func GetCiphertextDegree(ciphertextID int) C.int {
 
 //export GetModuliChain
 func GetModuliChain() (*C.ulong, C.ulong) {
+	scheme := activeScheme.Load()
 	moduli := scheme.Params.Q()
 	arrPtr, length := SliceToCArray(moduli, convertULongtoCULong)
 	return arrPtr, length
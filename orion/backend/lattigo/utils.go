@@ -4,7 +4,6 @@ package main
 import "C"
 
 import (
-	"fmt"
 	"unsafe"
 
 	"github.com/baahl-nyu/lattigo/v6/core/rlwe"
@@ -16,6 +15,9 @@ func convertCIntToInt(v C.int) int {
 func convertCFloatToFloat(v C.float) float64 {
 	return float64(v)
 }
+func convertCDoubleToFloat(v C.double) float64 {
+	return float64(v)
+}
 
 func CArrayToByteSlice(dataPtr unsafe.Pointer, length uint64) []byte {
 	return unsafe.Slice((*byte)(dataPtr), length)
@@ -94,7 +96,7 @@ func FreeCArray(ptr unsafe.Pointer) {
 	C.free(ptr)
 }
 
-func PrintCipher(scheme Scheme, ctxt *rlwe.Ciphertext) {
+func PrintCipher(scheme *Scheme, ctxt *rlwe.Ciphertext) {
 	msg := make([]float64, ctxt.Slots())
 
 	// Decode and check result
@@ -102,6 +104,6 @@ func PrintCipher(scheme Scheme, ctxt *rlwe.Ciphertext) {
 	_ = scheme.Encoder.Decode(ptxt, msg)
 
 	for i := 0; i < min(16, ctxt.Slots()); i++ {
-		fmt.Printf("msg[%d]: %.5f\n", i, msg[i])
+		logDebug("msg[%d]: %.5f", i, msg[i])
 	}
 }
@@ -10,7 +10,18 @@ class NewEvaluator:
         # We will wait to instantiate any bootstrapper until our bootstrap
         # placement algorithm determines they're necessary.
         logp = self.scheme.params.get_boot_logp()
-        return self.backend.NewBootstrapper(logp, slots)
+        if self.backend.NewBootstrapper(logp, slots) < 0:
+            raise ValueError(self.backend.get_last_error())
     
-    def bootstrap(self, ctxt, slots):
-        return self.backend.Bootstrap(ctxt, slots)
\ No newline at end of file
+    def init_bootstrapper(self, log_slots, logp=None):
+        # Sets up the bootstrapper that bootstrap() uses when not given a
+        # slot count. Without logp, the one from the parameters is used.
+        logp = self.scheme.params.get_boot_logp() if logp is None else logp
+        if self.backend.InitBootstrapper(log_slots, logp) < 0:
+            raise ValueError(self.backend.get_last_error())
+
+    def bootstrap(self, ctxt, slots=0):
+        btp_id = self.backend.Bootstrap(ctxt, slots)
+        if btp_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        return btp_id
\ No newline at end of file
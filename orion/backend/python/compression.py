@@ -0,0 +1,39 @@
+import numpy as np
+
+# Marshaled diagonals and rotation keys compress well, so they can be
+# written to disk as zstd frames. Frames are recognized by their magic
+# number on load, which no marshaled Lattigo object starts with, so files
+# may mix compressed and uncompressed datasets.
+ZSTD_MAGIC = b"\x28\xb5\x2f\xfd"
+ZSTD_LEVEL = 3
+
+
+def _zstd():
+    try:
+        import zstandard
+    except ImportError:
+        raise ImportError(
+            "zstd compression of saved diagonals and keys needs the "
+            "`zstandard` package. Install it with `pip install zstandard`."
+        ) from None
+    return zstandard
+
+
+def compress(data, method):
+    # Returns the serialized data to write to disk under the given
+    # compression method, "none" or "zstd".
+    if method == "none":
+        return data
+    frame = _zstd().ZstdCompressor(level=ZSTD_LEVEL).compress(
+        np.asarray(data, dtype=np.uint8).tobytes())
+    return np.frombuffer(frame, dtype=np.uint8)
+
+
+def decompress(data):
+    # Returns serialized data read from disk as the backend expects it,
+    # whether or not it was compressed.
+    data = np.asarray(data, dtype=np.uint8)
+    if data[:len(ZSTD_MAGIC)].tobytes() != ZSTD_MAGIC:
+        return data
+    raw = _zstd().ZstdDecompressor().decompress(data.tobytes())
+    return np.frombuffer(raw, dtype=np.uint8)
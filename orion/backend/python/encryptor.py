@@ -1,3 +1,4 @@
+import torch
 from .tensors import PlainTensor, CipherTensor
 
 class NewEncryptor:
@@ -22,6 +23,87 @@ class NewEncryptor:
         return CipherTensor(
             self.scheme, ciphertext_ids, plaintensor.shape, plaintensor.on_shape)
     
+    def encrypt_with_scale(self, values, log_scale):
+        # Encodes and encrypts in one step at a scale of 2^log_scale rather
+        # than the default one. Decrypting needs no special handling.
+        if isinstance(values, list):
+            values = torch.tensor(values)
+
+        num_slots = self.scheme.params.get_slots()
+        vector = values.cpu().flatten()
+
+        ciphertext_ids = []
+        for i in range(0, max(len(vector), 1), num_slots):
+            to_encrypt = vector[i:i+num_slots].tolist()
+            ciphertext_id = self.backend.EncryptWithScale(
+                to_encrypt, float(log_scale))
+            if ciphertext_id < 0:
+                raise ValueError(self.backend.get_last_error())
+            ciphertext_ids.append(ciphertext_id)
+
+        return CipherTensor(self.scheme, ciphertext_ids, values.shape)
+
+    def encrypt_batch(self, values):
+        # Encrypts each entry along the first dimension of values into its
+        # own ciphertext in a single backend call. Every entry has to fit
+        # in one ciphertext, and is zero-padded to the slot count.
+        if isinstance(values, list):
+            values = torch.tensor(values)
+
+        num_slots = self.scheme.params.get_slots()
+        batch = values.cpu().reshape(values.shape[0], -1)
+        if batch.shape[1] > num_slots:
+            raise ValueError(
+                f"Cannot encrypt entries of {batch.shape[1]} values into "
+                f"ciphertexts of {num_slots} slots.")
+
+        padded = torch.zeros(batch.shape[0], num_slots, dtype=batch.dtype)
+        padded[:, :batch.shape[1]] = batch
+        ciphertext_ids = self.backend.EncryptBatch(
+            padded.flatten().tolist(), batch.shape[0])
+        if not ciphertext_ids:
+            raise ValueError(self.backend.get_last_error())
+
+        shape = (1,) + tuple(values.shape[1:])
+        return [
+            CipherTensor(self.scheme, [ct_id], shape)
+            for ct_id in ciphertext_ids
+        ]
+    
+    def decrypt_complex(self, ciphertensor):
+        # Decrypts straight to complex values (standard ring only), since
+        # decode() keeps just the real part of every slot.
+        real, imag = [], []
+        for ctxt in ciphertensor.ids:
+            ct_real, ct_imag = self.backend.DecryptComplex(ctxt)
+            if not ct_real:
+                raise ValueError(self.backend.get_last_error())
+            real.extend(ct_real)
+            imag.extend(ct_imag)
+
+        num_elements = ciphertensor.on_shape.numel()
+        values = torch.complex(
+            torch.tensor(real[:num_elements], dtype=torch.float64),
+            torch.tensor(imag[:num_elements], dtype=torch.float64),
+        )
+        return values.reshape(ciphertensor.on_shape)
+
+    def set_health_check_bound(self, bound):
+        self.backend.SetHealthCheckBound(float(bound))
+
+    def check_health(self, ciphertensor):
+        # Raises if any ciphertext decrypts to NaN, Inf or values beyond
+        # the health check bound, e.g. after a scale mismatch.
+        problems = {1: "NaN", 2: "Inf", 4: "out-of-range"}
+        for ctxt in ciphertensor.ids:
+            status = self.backend.DecryptHealthCheck(ctxt)
+            if status < 0:
+                raise ValueError(self.backend.get_last_error())
+            if status:
+                found = [name for bit, name in problems.items() if status & bit]
+                raise ValueError(
+                    f"Ciphertext {ctxt} decrypts to {', '.join(found)} values.")
+
     def decrypt(self, ciphertensor):
         plaintext_ids = []
         for ctxt in ciphertensor.ids:
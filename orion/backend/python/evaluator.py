@@ -1,3 +1,5 @@
+import math
+
 class NewEvaluator:
     def __init__(self, scheme):
         self.backend = scheme.backend
@@ -17,6 +19,14 @@ class NewEvaluator:
             return self.backend.Rotate(ctxt, amount)
         return self.backend.RotateNew(ctxt, amount)
 
+    def rotate_po2(self, ctxt, amount):
+        # Rotates by any amount using only the resident power-of-two keys,
+        # so no key specific to amount is generated.
+        ct_out = self.backend.RotateCiphertext(ctxt, amount)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
     def add_scalar(self, ctxt, scalar, in_place):
         if in_place:
             return self.backend.AddScalar(ctxt, float(scalar))
@@ -77,14 +87,162 @@ class NewEvaluator:
         
         return self.backend.Rescale(ct_out)
     
+    def add_constant(self, ctxt, value):
+        value = complex(value)
+        ct_out = self.backend.AddConstant(ctxt, value.real, value.imag)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def mult_constant(self, ctxt, value):
+        # Returns the product along with its level, as the multiplication
+        # rescales and so consumes one.
+        value = complex(value)
+        ct_out = self.backend.MultConstant(ctxt, value.real, value.imag)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out, self.backend.GetCiphertextLevel(ct_out)
+
+    def mul_ciphertexts(self, ctxt0, ctxt1):
+        ct_out = self.backend.MulCiphertexts(ctxt0, ctxt1)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def mul_plaintext_data(self, ctxt, values):
+        ct_out = self.backend.MulPlaintextData(ctxt, list(values))
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def pool(self, ctxt, gap, row_len, kernel_size, mask=None):
+        # Sums every kernel window onto its top-left pixel, then multiplies
+        # by mask (e.g. 1/kernel area at the kept pixels, 0 elsewhere),
+        # which costs a level. Without a mask, no level is consumed.
+        kernel_h, kernel_w = kernel_size
+        mask = [] if mask is None else list(mask)
+        ct_out = self.backend.PoolCiphertext(
+            ctxt, gap, row_len, kernel_h, kernel_w, mask)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def inner_sum(self, ctxt, stride, n):
+        # Slot i of the result is the sum of the n slots stride apart
+        # starting at i, computed with log-depth rotations.
+        ct_out = self.backend.InnerSum(ctxt, stride, n)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def replicate(self, ctxt, block_size=1, mask=False):
+        # Tiles the first block_size slots over all slots. The rest must be
+        # zero, unless mask is set, which zeroes them at the cost of a level.
+        ct_out = self.backend.Replicate(ctxt, block_size, int(mask))
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def mask(self, ctxt, start, end, stride=1):
+        # Keeps the slots start, start + stride, ... below end and zeroes
+        # the rest, consuming a level.
+        ct_out = self.backend.MaskCiphertext(ctxt, start, end, stride)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def select(self, ctxt0, ctxt1, start, end, stride=1):
+        # Takes the masked slots from ctxt0 and the rest from ctxt1, in a
+        # single level.
+        ct_out = self.backend.SelectCiphertexts(
+            ctxt0, ctxt1, start, end, stride)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def generate_affine(self, scale, bias):
+        # Registers a per-slot x * scale + bias (e.g. a folded BatchNorm),
+        # whose encodings the backend caches per level.
+        affine_id = self.backend.GenerateAffine(list(scale), list(bias))
+        if affine_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        return affine_id
+
+    def affine(self, ctxt, affine_id):
+        # Applies a map from generate_affine, consuming one level.
+        ct_out = self.backend.EvaluateAffine(ctxt, affine_id)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def delete_affine(self, affine_id):
+        self.backend.DeleteAffine(affine_id)
+
+    def matmul(self, ctxt0, ctxt1, dim, transpose_b=False):
+        # Multiplies d x d matrices packed row-major and replicated across
+        # the slots, e.g. Q @ K.T with transpose_b. Costs three levels.
+        ct_out = self.backend.MatMulCiphertexts(
+            ctxt0, ctxt1, dim, int(transpose_b))
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def attention(self, q, k, v, dim, exp_poly, sum_range, inv_iters=3,
+                  scale=None, btp_slots=0):
+        # softmax(scale * Q @ K.T) @ V, with exp_poly approximating exp over
+        # the scaled scores and every row sum of the exponentials within
+        # sum_range. Bootstraps with the bootstrapper for btp_slots when a
+        # stage runs out of levels, or raises if btp_slots is 0.
+        if scale is None:
+            scale = 1 / math.sqrt(dim)
+        sum_min, sum_max = sum_range
+        ct_out = self.backend.AttentionCiphertexts(
+            q, k, v, dim, float(scale), exp_poly,
+            float(sum_min), float(sum_max), inv_iters, btp_slots)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
+    def matmul_rotation_steps(self, dim, transpose_b=False):
+        steps = self.backend.MatMulRotationSteps(dim, int(transpose_b))
+        if steps is None or (not steps and dim > 1):
+            raise ValueError(self.backend.get_last_error())
+        return list(steps)
+
+    def key_switch(self, ctxt, switch_key_id):
+        ct_out = self.backend.KeySwitchCiphertext(ctxt, switch_key_id)
+        if ct_out < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ct_out
+
     def rescale(self, ctxt, in_place):
         if in_place:
             return self.backend.Rescale(ctxt)
         return self.backend.RescaleNew(ctxt)
     
+    def drop_level(self, ctxt, levels):
+        if self.backend.DropLevel(ctxt, levels) < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ctxt
+
+    def rescale_to_level(self, ctxt, level):
+        if self.backend.RescaleToLevel(ctxt, level) < 0:
+            raise ValueError(self.backend.get_last_error())
+        return ctxt
+
     def get_live_plaintexts(self):
         return self.backend.GetLivePlaintexts() 
 
     def get_live_ciphertexts(self):
         return self.backend.GetLiveCiphertexts() 
 
+    def get_heap_stats(self, estimate_sizes=False):
+        stats = self.backend.GetHeapStats(int(estimate_sizes))
+        heaps = ["transforms", "ciphertexts", "plaintexts", "polynomials"]
+
+        result = {name: {"count": count} for name, count in zip(heaps, stats)}
+        if estimate_sizes:
+            for name, size in zip(heaps, stats[len(heaps):]):
+                result[name]["estimated_bytes"] = size
+        return result
+
@@ -0,0 +1,32 @@
+import zlib
+
+import numpy as np
+
+# Every saved diagonal and rotation key carries the CRC32 of its bytes as
+# written, so that a corrupted file is reported by name rather than failing
+# inside the backend's decoder. Datasets written before checksums were
+# introduced have none, and are read unchecked.
+CHECKSUM_ATTR = "crc32"
+
+
+def write_dataset(group, name, data, **kwargs):
+    # Creates a dataset holding serialized data, along with its checksum.
+    # Keyword arguments are passed on to create_dataset.
+    data = np.ascontiguousarray(data, dtype=np.uint8)
+    dataset = group.create_dataset(name, data=data, **kwargs)
+    dataset.attrs[CHECKSUM_ATTR] = zlib.crc32(data)
+    return dataset
+
+
+def read_dataset(dataset):
+    # Returns the serialized data of a dataset, after checking it against
+    # its checksum.
+    data = dataset[()]
+    expected = dataset.attrs.get(CHECKSUM_ATTR)
+    if expected is not None and zlib.crc32(np.ascontiguousarray(data)) != expected:
+        raise ValueError(
+            f"Dataset {dataset.name} in {dataset.file.filename} is corrupted: "
+            f"its contents do not match the checksum saved with them. "
+            f"Recompile the model with IO mode `save`."
+        )
+    return data
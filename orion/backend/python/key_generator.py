@@ -1,10 +1,29 @@
+import os
+import json
+import ctypes
+from datetime import datetime, timezone
+
 import h5py 
+import numpy as np
+
+# Version of the key formats in the keys file. Version 2 stores rotation
+# keys compressed; the backend still reads version 1 files.
+KEY_FORMAT_VERSION = 2
+
+# When this environment variable is set, the secret key is encrypted under
+# it before being written to the keys file, and decrypted with it on load.
+PASSPHRASE_ENV = "ORION_KEY_PASSPHRASE"
+SEALED_KEY_MAGIC = b"OSK1"
 
 class NewKeyGenerator:
     def __init__(self, scheme):
         self.backend = scheme.backend
         self.io_mode = scheme.params.get_io_mode()
+        self.readonly = scheme.params.is_readonly()
+        self.loads_from_disk = scheme.params.loads_from_disk()
         self.keys_path = scheme.params.get_keys_path()
+        self.loaded_sk = False
+        self.manifest_checked = False
         self.new_key_generator()
 
     def new_key_generator(self):
@@ -14,27 +33,194 @@ class NewKeyGenerator:
         self.generate_relinearization_key()
         self.generate_evaluation_keys()
 
+    def has_saved_key(self, name):
+        if not os.path.exists(self.keys_path):
+            return False
+        with h5py.File(self.keys_path, "r") as f:
+            return name in f
+
+    def has_saved_secret_key(self):
+        return self.has_saved_key("sk")
+
+    def get_parameters_fingerprint(self):
+        fingerprint, ptr = self.backend.GetParametersFingerprint()
+        if ptr is None:
+            raise ValueError(self.backend.get_last_error())
+        try:
+            return fingerprint.tobytes().hex()
+        finally:
+            self.backend.FreeCArray(ptr)
+
+    def write_manifest(self, f):
+        # Records what the keys in this file were made with, so a later run
+        # with different parameters fails cleanly rather than decrypting
+        # garbage. An existing manifest is kept along with its creation time.
+        if "manifest" in f:
+            return
+        manifest = {
+            "params_fingerprint": self.get_parameters_fingerprint(),
+            "created": datetime.now(timezone.utc).isoformat(),
+            "key_format_version": KEY_FORMAT_VERSION,
+        }
+        f.create_dataset("manifest", data=json.dumps(manifest))
+
+    def check_manifest(self):
+        # Files written before manifests were introduced are accepted as is.
+        if self.manifest_checked or not self.has_saved_key("manifest"):
+            return
+        with h5py.File(self.keys_path, "r") as f:
+            manifest = json.loads(f["manifest"][()])
+
+        if manifest["params_fingerprint"] != self.get_parameters_fingerprint():
+            raise ValueError(
+                f"The keys in {self.keys_path} were generated with different "
+                f"scheme parameters (created {manifest['created']}). Use the "
+                f"parameters they were made with, or recompile the model "
+                f"with IO mode `save`."
+            )
+        if manifest["key_format_version"] > KEY_FORMAT_VERSION:
+            raise ValueError(
+                f"The keys in {self.keys_path} use key format version "
+                f"{manifest['key_format_version']}, but this version of Orion "
+                f"only reads up to {KEY_FORMAT_VERSION}."
+            )
+        self.manifest_checked = True
+
     def generate_secret_key(self):
-        if self.io_mode != "load": # we'll need to generate a fresh sk
-            self.backend.GenerateSecretKey()
+        # In "append" mode we reuse the secret key of an earlier run so that
+        # its rotation keys remain valid.
+        load_sk = self.loads_from_disk or (
+            self.io_mode == "append" and self.has_saved_secret_key())
+
+        if not load_sk: # we'll need to generate a fresh sk
+            if self.backend.GenerateSecretKey() < 0:
+                raise ValueError(self.backend.get_last_error())
             
-            # Save key if in "save" mode
-            if self.io_mode == "save":
-                sk_serial, _ = self.backend.SerializeSecretKey()
-                with h5py.File(self.keys_path, "a") as f:
-                    f.create_dataset("sk", data=sk_serial)
+            # Save key if in "save" or "append" mode
+            if self.io_mode in ("save", "append"):
+                sk_serial, ptr = self.serialize_secret_key()
+                try:
+                    with h5py.File(self.keys_path, "a") as f:
+                        f.create_dataset("sk", data=sk_serial)
+                        self.write_manifest(f)
+                finally:
+                    # The buffer holds the marshaled key, so we wipe it
+                    # before handing it back to Go.
+                    ctypes.memset(ptr, 0, len(sk_serial))
+                    self.backend.FreeCArray(ptr)
         
-        # Load key if in "load" mode
-        elif self.io_mode == "load":
+        # Otherwise load the existing key
+        else:
+            if not self.has_saved_secret_key():
+                raise FileNotFoundError(
+                    f"No secret key found in {self.keys_path}. First set IO "
+                    f"mode in parameters YAML file to `save`."
+                )
+            self.check_manifest()
             with h5py.File(self.keys_path, "r") as f:
                 serial_sk = f["sk"][()]
-                self.backend.LoadSecretKey(serial_sk)
+            self.load_secret_key(serial_sk)
+            self.loaded_sk = True
+
+            # Files from before manifests gain one once we write to them.
+            if self.io_mode == "append":
+                with h5py.File(self.keys_path, "a") as f:
+                    self.write_manifest(f)
+
+    def get_passphrase(self):
+        passphrase = os.environ.get(PASSPHRASE_ENV, "")
+        return np.frombuffer(bytearray(passphrase.encode("utf-8")), dtype=np.uint8)
+
+    def serialize_secret_key(self):
+        passphrase = self.get_passphrase()
+        if not len(passphrase):
+            return self.backend.SerializeSecretKey()
+
+        sk_serial, ptr = self.backend.SerializeSecretKeySealed(passphrase)
+        if ptr is None:
+            raise ValueError(self.backend.get_last_error())
+        return sk_serial, ptr
+
+    def load_secret_key(self, serial_sk):
+        if serial_sk[:len(SEALED_KEY_MAGIC)].tobytes() != SEALED_KEY_MAGIC:
+            status = self.backend.LoadSecretKey(serial_sk)
+        else:
+            passphrase = self.get_passphrase()
+            if not len(passphrase):
+                raise ValueError(
+                    f"The secret key in {self.keys_path} is encrypted. Set "
+                    f"{PASSPHRASE_ENV} to the passphrase it was saved with."
+                )
+            status = self.backend.LoadSecretKeySealed(serial_sk, passphrase)
+        if status < 0:
+            raise ValueError(self.backend.get_last_error())
+
+    def load_secret_key_from_bytes(self, data):
+        # The backend zeroes the buffer it reads from, so we hand it a
+        # private copy rather than the caller's object.
+        serial_sk = np.frombuffer(bytearray(data), dtype=np.uint8)
+        if self.backend.LoadSecretKeyFromBytes(serial_sk) < 0:
+            raise ValueError(self.backend.get_last_error())
+
+    def refresh_secret_key(self):
+        # Rotates to a fresh secret key. Live ciphertexts are re-keyed in
+        # place, but rotation keys saved to disk become stale.
+        if self.backend.RefreshSecretKey() < 0:
+            raise ValueError(self.backend.get_last_error())
+
+    def gen_key_switching_key(self, new_sk_bytes):
+        # Returns the ID of a key that re-keys ciphertexts from the current
+        # secret key to new_sk_bytes. As above, the backend zeroes its copy.
+        serial_sk = np.frombuffer(bytearray(new_sk_bytes), dtype=np.uint8)
+        switch_key_id = self.backend.GenKeySwitchingKey(serial_sk)
+        if switch_key_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        return switch_key_id
+
+    def delete_switching_key(self, switch_key_id):
+        self.backend.DeleteSwitchingKey(switch_key_id)
 
     def generate_public_key(self):
-        self.backend.GeneratePublicKey()
+        self.load_or_generate_key(
+            "pk",
+            self.backend.GeneratePublicKey,
+            self.backend.SerializePublicKey,
+            self.backend.LoadPublicKey,
+        )
 
     def generate_relinearization_key(self):
-        self.backend.GenerateRelinearizationKey()
+        self.load_or_generate_key(
+            "rlk",
+            self.backend.GenerateRelinearizationKey,
+            self.backend.SerializeRelinearizationKey,
+            self.backend.LoadRelinearizationKey,
+        )
+
+    def load_or_generate_key(self, name, generate, serialize, load):
+        # Keys derived from a loaded secret key can be loaded as well, which
+        # saves regenerating them on every startup.
+        if self.loaded_sk and self.has_saved_key(name):
+            with h5py.File(self.keys_path, "r") as f:
+                load(f[name][()])
+            return
+
+        if self.readonly:
+            raise FileNotFoundError(
+                f"No {name} found in {self.keys_path}, and IO mode `readonly` "
+                f"does not generate missing keys."
+            )
+
+        generate()
+
+        # Save the key if we're writing keys to disk, or if a loaded key
+        # file was missing it, so that partially-populated files self-heal.
+        if self.io_mode in ("save", "append") or self.loaded_sk:
+            serial_key, ptr = serialize()
+            try:
+                with h5py.File(self.keys_path, "a") as f:
+                    f.create_dataset(name, data=serial_key)
+            finally:
+                self.backend.FreeCArray(ptr)
 
     def generate_evaluation_keys(self):
         self.backend.GenerateEvaluationKeys()
\ No newline at end of file
@@ -1,8 +1,21 @@
+import os
+import ctypes
+import hashlib
+import threading
+from collections import deque
+from concurrent.futures import ThreadPoolExecutor
+
 import h5py
 import torch
 import numpy as np
 
 from orion.backend.python.tensors import CipherTensor
+from orion.backend.python.compression import compress, decompress
+from orion.backend.python.integrity import read_dataset, write_dataset
+
+
+# Chunk size of the datasets of blocks saved in the packed layout.
+PACKED_CHUNK_BYTES = 1 << 20
 
 
 class NewEvaluator:
@@ -14,15 +27,51 @@ class NewEvaluator:
 
         self.embed_method = self.params.get_embedding_method()
         self.io_mode = self.params.get_io_mode()
+        self.readonly = self.params.is_readonly()
         self.diags_path = self.params.get_diags_path()
         self.keys_path = self.params.get_keys_path()
+        self.lt_workers = self.params.get_lt_workers()
+        self.prune_threshold = self.params.get_diag_prune_threshold()
+        self.dedup_diagonals = self.params.get_dedup_diagonals()
+        self.plan_rotation_keys = self.params.get_plan_rotation_keys()
+        self.diag_pipeline_depth = self.params.get_diag_pipeline_depth()
+        self.block_order = self.params.get_block_order()
+        self.compression = self.params.get_compression()
+        self.diag_layout = self.params.get_diag_layout()
+        self.stream_diagonals = self.params.get_stream_diagonals()
+        self.storage = self.params.get_storage()
+        self.store_path = self.params.get_store_path()
+        self.planning = False
 
         self.saved_rotation_keys = set()
+        self.rotation_key_reads = 0 # keys read from disk (not the cache)
+        self.diagonal_reads = 0 # blocks of diagonals read from disk
+        self.load_saved_rotation_keys()
         self.new_evaluator()
+        self.set_lt_memory_budget(self.params.get_lt_memory_budget())
 
     def new_evaluator(self):
         self.backend.NewLinearTransformEvaluator()
 
+    def set_profiling(self, enabled):
+        self.backend.SetProfilingEnabled(int(enabled))
+
+    def get_profiling_report(self):
+        return self.backend.get_profiling_report()
+
+    def load_saved_rotation_keys(self):
+        # In "append" mode the keys file may already hold rotation keys from
+        # an earlier run. Seeding our record from it means we only ever
+        # generate and write the keys that are genuinely missing. The
+        # backend skips the keys already in the "file" storage itself.
+        if (self.io_mode != "append" or self.storage == "file"
+                or not os.path.exists(self.keys_path)):
+            return
+
+        with h5py.File(self.keys_path, "r") as f:
+            self.saved_rotation_keys.update(
+                int(name) for name in f if name.isdigit())
+
     def generate_transforms(self, linear_layer):
         layer_name = linear_layer.name
         diagonals = linear_layer.diagonals 
@@ -37,38 +86,313 @@ class NewEvaluator:
                 diags_idxs.append(idx)
                 diags_data.extend(diag)
 
-            lintransf_id = self.backend.GenerateLinearTransform(
-                diags_idxs, diags_data, level, bsgs_ratio, self.io_mode
-            )
+            # Diagonals are passed as doubles so that small weights keep
+            # their full precision through encoding. Complex diagonals are
+            # passed as their real and imaginary parts, and mostly-zero
+            # ones as just their non-zero entries.
+            nonzeros = [
+                [k for k, v in enumerate(diag) if v] for diag in diags.values()
+            ]
+            if any(isinstance(v, complex) for v in diags_data):
+                lintransf_id = self.backend.GenerateLinearTransformComplex(
+                    diags_idxs,
+                    [complex(v).real for v in diags_data],
+                    [complex(v).imag for v in diags_data],
+                    level, -1, bsgs_ratio, self.prune_threshold, self.io_mode
+                )
+            elif 2 * sum(map(len, nonzeros)) <= len(diags_data):
+                lintransf_id = self.backend.GenerateLinearTransformSparse(
+                    diags_idxs,
+                    [len(slots) for slots in nonzeros],
+                    [k for slots in nonzeros for k in slots],
+                    [float(diag[k])
+                     for diag, slots in zip(diags.values(), nonzeros)
+                     for k in slots],
+                    level, -1, bsgs_ratio, self.prune_threshold, self.io_mode
+                )
+            else:
+                lintransf_id = self.backend.GenerateLinearTransformF64(
+                    diags_idxs, diags_data, level, -1, bsgs_ratio,
+                    self.prune_threshold, self.io_mode
+                )
+            if lintransf_id < 0:
+                raise ValueError(
+                    f"Failed to generate block ({row}, {col}) of layer "
+                    f"{layer_name}: {self.backend.get_last_error()}"
+                )
             lintransf_ids[(row, col)] = lintransf_id
 
-            # Now we can generate any new rotation keys needed for
-            # this linear transform.
-            self.generate_rotation_keys(lintransf_id)
-            if self.io_mode == "save":
+            # Now we can generate any new rotation keys needed for this
+            # linear transform, unless they are planned for later.
+            if not self.planning:
+                self.generate_rotation_keys(lintransf_id)
+            if self.io_mode in ("save", "append"):
+                # Zero diagonals were pruned in the backend, so only the
+                # ones it kept have plaintexts to save.
+                kept_idxs = self.backend.GetLinearTransformDiagonals(lintransf_id)
                 self.save_plaintext_diagonals(
-                    layer_name, lintransf_id, row, col, diags_idxs
+                    layer_name, lintransf_id, row, col, kept_idxs
                 )
 
         return lintransf_ids
     
+    def suggest_transform_level(self, ctxt):
+        # The level at which a transform applied to ctxt uses up exactly
+        # one of its levels.
+        level = self.backend.SuggestTransformLevel(ctxt)
+        if level < 0:
+            raise ValueError(
+                f"Ciphertext {ctxt} does not exist or has no level left.")
+        return level
+
+    def estimate_final_level(self, start_level, num_transforms, num_muls=0):
+        # The level left after the chain, or None when it needs a
+        # bootstrap somewhere along the way.
+        level = self.backend.EstimateFinalLevelWithMuls(
+            start_level, num_transforms, num_muls)
+        return level if level >= 0 else None
+
     def get_required_rotation_keys(self, transform_id):
         return self.backend.GetLinearTransformRotationKeys(transform_id)
 
+    def precompute_galois_elements(self, linear_layers):
+        # Plans the complete set of rotation keys needed by every block of
+        # the given layers, without generating any transforms or keys.
+        diags_idxs, diags_counts, levels, bsgs_ratios = [], [], [], []
+        for layer in linear_layers:
+            for diags in layer.diagonals.values():
+                diags_idxs.extend(diags.keys())
+                diags_counts.append(len(diags))
+                levels.append(layer.level)
+                bsgs_ratios.append(float(layer.bsgs_ratio))
+
+        if not diags_counts:
+            return []
+
+        return self.backend.PrecomputeGaloisElements(
+            diags_idxs, diags_counts, levels, bsgs_ratios
+        )
+
+    def begin_key_planning(self):
+        # Transforms generated from now on only record the keys they need,
+        # and generate_all_rotation_keys() makes them in one pass.
+        if not self.plan_rotation_keys:
+            return
+        self.backend.BeginKeyPlanning()
+        self.planning = True
+
+    def generate_all_rotation_keys(self):
+        if not self.planning:
+            return
+        self.planning = False
+
+        # With keys kept in memory, the backend generates them all at once
+        # and in parallel. Otherwise, they are written to disk in a single
+        # pass over the keys file.
+        if self.io_mode == "none":
+            keys = self.backend.GetPlannedGaloisElements()
+            if self.backend.GenerateAllRotationKeys() < 0:
+                raise ValueError(self.backend.get_last_error())
+            self.saved_rotation_keys.update(keys)
+        else:
+            keys = self.backend.GetPlannedGaloisElements()
+            self.backend.EndKeyPlanning()
+            self.generate_rotation_key_bundle(keys)
+
+    def generate_transform_streamed(self, diag_idxs, get_diagonal, level,
+                                    bsgs_ratio):
+        # Generates one block from diagonals that the backend requests one
+        # at a time through get_diagonal(idx), e.g. a read of one row of an
+        # HDF5 dataset, so that a very wide block never has to be held in
+        # memory whole. Zero diagonals should be left out of diag_idxs, as
+        # they are not pruned.
+        errors = []
+
+        def source(diag_idx, out, slots):
+            try:
+                diag = np.ascontiguousarray(get_diagonal(diag_idx), dtype=np.float64)
+                if diag.shape != (slots,):
+                    raise ValueError(
+                        f"Diagonal {diag_idx} has shape {diag.shape}, "
+                        f"expected ({slots},).")
+                ctypes.memmove(out, diag.ctypes.data, diag.nbytes)
+                return 0
+            except Exception as e:
+                errors.append(e)
+                return 1
+
+        transform_id = self.backend.GenerateLinearTransformStreamed(
+            [int(idx) for idx in diag_idxs], self.backend.DiagonalSource(source),
+            level, -1, bsgs_ratio, self.io_mode
+        )
+        if errors:
+            raise errors[0]
+        if transform_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        if not self.planning:
+            self.generate_rotation_keys(transform_id)
+        return transform_id
+
+    def generate_transform_rows(self, diags, log_rows, level, bsgs_ratio):
+        # Generates one block that multiplies each of the 2^log_rows rows
+        # the slots are split into by a matrix of its own, as used by
+        # matrix-style packings. diags maps each k in [0, cols) to the k-th
+        # diagonals of the rows' matrices, concatenated row after row.
+        diag_idxs = [int(idx) for idx in diags]
+        diag_data = [float(v) for idx in diag_idxs for v in diags[idx]]
+        transform_id = self.backend.GenerateLinearTransformRows(
+            diag_idxs, diag_data, log_rows, level, -1, bsgs_ratio,
+            self.prune_threshold, self.io_mode
+        )
+        if transform_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        if not self.planning:
+            self.generate_rotation_keys(transform_id)
+        return transform_id
+
+    def conv_diagonal_indices(self, conv_layer, last):
+        # Returns the blocks of a convolution with the indices of their
+        # non-zero diagonals (mapped to None), and its number of output
+        # rotations, without building the diagonals themselves.
+        weight, geometry = conv_layer.conv_geometry()
+        hybrid = self.embed_method == "hybrid" and not last
+        layout = self.backend.ConvDiagonalIndices(
+            weight.flatten().tolist(), geometry, int(hybrid)
+        )
+        if not layout:
+            raise ValueError(
+                f"Failed to lay out layer {conv_layer.name}: "
+                f"{self.backend.get_last_error()}"
+            )
+
+        rows, cols, output_rotations = layout[:3]
+        diagonals, pos = {}, 3
+        for row in range(rows):
+            for col in range(cols):
+                count = layout[pos]
+                diagonals[(row, col)] = dict.fromkeys(layout[pos+1:pos+1+count])
+                pos += 1 + count
+        return diagonals, output_rotations
+
+    def conv_diagonals(self, conv_layer, last):
+        # Returns the diagonals the backend builds for a convolution, in the
+        # form packing.pack_conv2d() returns them.
+        weight, geometry = conv_layer.conv_geometry()
+        hybrid = self.embed_method == "hybrid" and not last
+        layout = self.backend.ConvDiagonals(
+            weight.flatten().tolist(), geometry, int(hybrid)
+        )
+        if not layout:
+            raise ValueError(
+                f"Failed to lay out layer {conv_layer.name}: "
+                f"{self.backend.get_last_error()}"
+            )
+
+        slots = self.params.get_slots()
+        rows, cols, output_rotations = map(int, layout[:3])
+        diagonals, pos = {}, 3
+        for row in range(rows):
+            for col in range(cols):
+                count, pos = int(layout[pos]), pos + 1
+                diags = {}
+                for _ in range(count):
+                    diags[int(layout[pos])] = layout[pos+1:pos+1+slots]
+                    pos += 1 + slots
+                diagonals[(row, col)] = diags
+        return diagonals, output_rotations
+
+    def generate_conv_transforms(self, conv_layer):
+        # Generates the transforms of a convolution laid out by
+        # conv_diagonal_indices, with the backend building the diagonals
+        # from the weights.
+        weight, geometry = conv_layer.conv_geometry()
+
+        # Blocks are shorter than the slots, and their outputs rotated
+        # together, exactly when the hybrid embedding applies.
+        hybrid = conv_layer.output_rotations > 0
+        ids = self.backend.GenerateConvTransforms(
+            weight.flatten().tolist(), geometry, int(hybrid),
+            conv_layer.level, -1, conv_layer.bsgs_ratio, self.prune_threshold
+        )
+        if not ids:
+            raise ValueError(
+                f"Failed to generate layer {conv_layer.name}: "
+                f"{self.backend.get_last_error()}"
+            )
+
+        lintransf_ids = dict(zip(conv_layer.diagonals.keys(), ids))
+        if not self.planning:
+            for lintransf_id in ids:
+                self.generate_rotation_keys(lintransf_id)
+        return lintransf_ids
+
+    def fuse_transforms(self, first_id, second_id, bsgs_ratio):
+        # Returns a transform applying first_id and then second_id, which
+        # needs one level and one set of rotations instead of two. Both
+        # must have their diagonals loaded.
+        fused_id = self.backend.FuseLinearTransforms(
+            first_id, second_id, bsgs_ratio, self.prune_threshold)
+        if fused_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        if not self.planning:
+            self.generate_rotation_keys(fused_id)
+        return fused_id
+
+    def transpose_transform(self, transform_id, bsgs_ratio):
+        # Returns a transform computing the transpose of transform_id, e.g.
+        # for gradients, derived in the backend from its loaded diagonals.
+        transposed_id = self.backend.TransposeLinearTransform(
+            transform_id, bsgs_ratio, self.prune_threshold)
+        if transposed_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        if not self.planning:
+            self.generate_rotation_keys(transposed_id)
+        return transposed_id
+
+    def generate_gather_transform(self, src, level, bsgs_ratio):
+        # Returns a transform whose output slot i holds input slot src[i]
+        # (0 where src[i] is negative), for any conversion between packings.
+        transform_id = self.backend.GenerateGatherTransform(
+            [int(i) for i in src], level, -1, bsgs_ratio)
+        if transform_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        if not self.planning:
+            self.generate_rotation_keys(transform_id)
+        return transform_id
+
+    def generate_layout_transform(self, layout, dims, level, bsgs_ratio):
+        # Returns a transform converting between packings, e.g. layout
+        # "gap_to_dense" with dims (c, h, w, gap) to densify the multiplexed
+        # output of a convolution. See layout.go for the conversions.
+        transform_id = self.backend.GenerateLayoutTransform(
+            layout, [int(d) for d in dims], level, -1, bsgs_ratio)
+        if transform_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        if not self.planning:
+            self.generate_rotation_keys(transform_id)
+        return transform_id
+
     def generate_rotation_keys(self, transform_id):
         curr_keys = self.get_required_rotation_keys(transform_id)
+        self.generate_rotation_key_bundle(curr_keys)
 
+    def generate_rotation_key_bundle(self, keys):
         # Only generate keys that don't exist yet. Depending on the I/O
         # mode, we may also save these keys immediately rather than keep
         # them in RAM.
-        keys_to_gen = set(curr_keys).difference(self.saved_rotation_keys)
+        keys_to_gen = set(keys).difference(self.saved_rotation_keys)
         self.saved_rotation_keys.update(keys_to_gen)
 
         if self.io_mode == "none":
             for key in keys_to_gen:
                 self.backend.GenerateLinearTransformRotationKey(key)
 
-        elif self.io_mode == "save":
+        elif self.io_mode in ("save", "append") and self.storage == "file":
+            if self.backend.SaveRotationKeys(sorted(keys_to_gen)) < 0:
+                raise ValueError(
+                    f"{self.store_path}: {self.backend.get_last_error()}")
+
+        elif self.io_mode in ("save", "append"):
             with h5py.File(self.keys_path, "a") as f:
                 for key in keys_to_gen:
                     key_str = str(key)
@@ -78,10 +402,31 @@ class NewEvaluator:
                     # We'll generate, serialize, and then save the key
                     serial_key, ptr = self.backend.GenerateAndSerializeRotationKey(key)
                     try:
-                        f.create_dataset(key_str, data=serial_key)
+                        write_dataset(
+                            f, key_str, compress(serial_key, self.compression))
                     finally:
                         self.backend.FreeCArray(ptr)
 
+        # Nothing is generated in "readonly" mode, so check up front that
+        # the bundle has every key rather than failing mid-inference.
+        elif self.readonly and self.storage == "file":
+            missing = sorted(
+                k for k in keys_to_gen if not self.backend.HasStoredRotationKey(k))
+            if missing:
+                raise ValueError(
+                    f"Rotation keys for Galois elements {missing} not found in "
+                    f"{self.store_path}. Recompile the model with IO mode `save`."
+                )
+
+        elif self.readonly:
+            with h5py.File(self.keys_path, "r") as f:
+                missing = sorted(k for k in keys_to_gen if str(k) not in f)
+            if missing:
+                raise ValueError(
+                    f"Rotation keys for Galois elements {missing} not found in "
+                    f"{self.keys_path}. Recompile the model with IO mode `save`."
+                )
+
     def save_transforms(self, linear_layer):
         layer_name = linear_layer.name
         diagonals = linear_layer.diagonals 
@@ -94,8 +439,12 @@ class NewEvaluator:
         output_min = linear_layer.output_min 
         output_max = linear_layer.output_max
 
+        self._check_writable(self.diags_path)
         print("└── saving... ", end="", flush=True)
         with h5py.File(self.diags_path, "a") as f:
+            # When appending, a layer saved by an earlier run is replaced.
+            if self.io_mode == "append" and layer_name in f:
+                del f[layer_name]
             layer = f.require_group(layer_name)
 
             layer.create_dataset("embedding_method", data=self.embed_method)
@@ -127,7 +476,12 @@ class NewEvaluator:
         on_bias = linear_layer.on_bias
         output_rotations = linear_layer.output_rotations
 
-        with h5py.File(self.diags_path, "a") as f:
+        with h5py.File(self.diags_path, "r") as f:
+            if layer_name not in f:
+                raise ValueError(
+                    f"Module {layer_name!r} not found in {self.diags_path}. "
+                    f"Recompile the model with IO mode `save`."
+                )
             layer = f[layer_name]
 
             # Load the diagonals back into the correct struct
@@ -144,7 +498,10 @@ class NewEvaluator:
 
         return all_diagonals, on_bias, output_rotations
 
-    def evaluate_transforms(self, linear_layer, in_ctensor):
+    def evaluate_transforms(self, linear_layer, in_ctensor, rescale=True):
+        # With rescale=False, outputs are left at the scale of the
+        # transform times that of the input, so that a following plaintext
+        # multiplication (e.g. a BatchNorm scale) can share their rescale.
         layer_name = linear_layer.name
         out_shape = linear_layer.output_shape
         fhe_out_shape = linear_layer.fhe_output_shape 
@@ -155,37 +512,141 @@ class NewEvaluator:
         cols = len(in_ctensor)
         rows = len(transform_ids) // cols
 
-        # Now we can perform a blocked linear transform
+        # With everything already in memory, the backend can evaluate the
+        # (independent) rows of blocks in parallel.
+        if self.io_mode == "none":
+            cts_out = self.backend.EvaluateLinearTransforms(
+                transform_ids.tolist(), list(in_ctensor.ids), self.lt_workers,
+                int(rescale)
+            )
+            if not cts_out:
+                raise ValueError(
+                    f"Failed to evaluate layer {layer_name}: "
+                    f"{self.backend.get_last_error()}"
+                )
+            return CipherTensor(self.scheme, cts_out, out_shape, fhe_out_shape)
+
+        # Otherwise, keys and diagonals are streamed from disk one block at
+        # a time, so we evaluate the blocks sequentially, in groups that
+        # share one load of rotation keys. In row order each block is its
+        # own group; in column order a column is, since all of its blocks
+        # rotate the same input, and each row accumulates a partial sum.
+        # The backend merges consecutive groups into windows whose keys fit
+        # in the memory budget together, and keys stay loaded for a whole
+        # window. While a window is evaluated, the keys of the next one are
+        # prefetched, and the diagonals of the next few blocks are read
+        # ahead.
         transform_ids = transform_ids.reshape(rows, cols)
-        cts_out = []
-        for i in range(rows):
-            ct_out = None
-            for j in range(cols):
-                t_id = transform_ids[i][j]
+        if self.block_order == "column":
+            groups = [[(i, j) for i in range(rows)] for j in range(cols)]
+        else:
+            groups = [[(i, j)] for i in range(rows) for j in range(cols)]
+        windows = self._plan_windows(layer_name, transform_ids, groups)
+        window_keys = [
+            sorted(set().union(*(
+                self.get_required_rotation_keys(transform_ids[i][j])
+                for group in window for i, j in group
+            )))
+            for window in windows
+        ] + [[]]
 
-                if self.io_mode != "none":
-                    self.load_rotation_keys(t_id)
-                    self.load_plaintext_diagonals(layer_name, i, j, t_id)
+        blocks = [block for group in groups for block in group]
+        diagonals = self._diagonal_pipeline(layer_name, transform_ids, blocks)
+        cts_row = [None] * rows
+        prefetch = None
+        for w, window in enumerate(windows):
+            if prefetch is not None:
+                prefetch.join()
+            self.load_rotation_keys(window_keys[w])
+            retained = set(window_keys[w])
+            prefetch = self._start_key_prefetch(
+                [key for key in window_keys[w + 1] if key not in retained])
 
-                res = self.backend.EvaluateLinearTransform(t_id, in_ctensor.ids[j]) 
+            for i, j in (block for group in window for block in group):
+                t_id = transform_ids[i][j]
+                if self.stream_diagonals:
+                    res = self.evaluate_transform_streamed(
+                        layer_name, i, j, t_id, in_ctensor.ids[j])
+                else:
+                    self.load_plaintext_diagonals(
+                        layer_name, i, j, t_id, next(diagonals))
+                    res = self.backend.EvaluateLinearTransform(t_id, in_ctensor.ids[j])
+                    self.remove_plaintext_diagonals(t_id)
                 ct = CipherTensor(self.scheme, res, out_shape, fhe_out_shape)
 
                 # Accumulate results across a row of blocks
-                ct_out = ct if j == 0 else ct_out + ct
-                    
-                if self.io_mode != "none":
-                    self.remove_rotation_keys()
-                    self.remove_plaintext_diagonals(t_id)
-            
-            # We know the output of this accumulation will just be one ciphertext
-            ct_out_rescaled = self.evaluator.rescale(ct_out.ids[0], in_place=False)
-            cts_out.append(ct_out_rescaled)
+                cts_row[i] = ct if cts_row[i] is None else cts_row[i] + ct
+
+            # Keys the next window needs as well stay loaded, so that only
+            # the difference is read for it.
+            self.retain_rotation_keys(window_keys[w + 1])
 
+        # We know the output of each accumulation will just be one ciphertext
+        if rescale:
+            cts_out = [
+                self.evaluator.rescale(ct_out.ids[0], in_place=False)
+                for ct_out in cts_row
+            ]
+        else:
+            # The accumulated ciphertexts become the output, so their row
+            # tensors must not delete them when collected.
+            cts_out = [ct_out.ids[0] for ct_out in cts_row]
+            for ct_out in cts_row:
+                ct_out.ids = []
         return CipherTensor(self.scheme, cts_out, out_shape, fhe_out_shape)
             
+    def evaluate_transforms_batch(self, linear_layer, in_ctensors):
+        # Evaluates the layer on every CipherTensor of a batch in a single
+        # backend call. Like the parallel path, this needs io_mode "none".
+        out_shape = linear_layer.output_shape
+        fhe_out_shape = linear_layer.fhe_output_shape
+        transform_ids = list(linear_layer.transform_ids.values())
+
+        ct_ids = []
+        for in_ctensor in in_ctensors:
+            ct_ids.extend(in_ctensor.ids)
+
+        # A layer of a single block has nothing to parallelize within an
+        # input, so the inputs are evaluated in parallel instead.
+        if len(transform_ids) == 1:
+            cts_out = self.backend.EvaluateLinearTransformMany(
+                transform_ids[0], ct_ids, self.lt_workers
+            )
+        else:
+            cts_out = self.backend.EvaluateLinearTransformsBatch(
+                transform_ids, ct_ids, len(in_ctensors), self.lt_workers
+            )
+        if not cts_out:
+            raise ValueError(
+                f"Failed to evaluate layer {linear_layer.name}: "
+                f"{self.backend.get_last_error()}"
+            )
+
+        rows = len(cts_out) // len(in_ctensors)
+        return [
+            CipherTensor(
+                self.scheme, cts_out[i*rows:(i+1)*rows], out_shape, fhe_out_shape)
+            for i in range(len(in_ctensors))
+        ]
+
+    def evaluate_transforms_into(self, linear_layer, in_ctensor, out_ctensor):
+        # Same as evaluate_transforms with everything in memory, but the
+        # rows are written into the ciphertexts of out_ctensor rather than
+        # freshly allocated ones.
+        transform_ids = list(linear_layer.transform_ids.values())
+        ct_ids = self.backend.EvaluateLinearTransformsInto(
+            list(out_ctensor.ids), transform_ids, list(in_ctensor.ids),
+            self.lt_workers
+        )
+        if not ct_ids:
+            raise ValueError(
+                f"Failed to evaluate layer {linear_layer.name}: "
+                f"{self.backend.get_last_error()}"
+            )
+        return out_ctensor
+
     def delete_transforms(self, transform_ids: dict):
-        for tid in transform_ids.values():
-            self.backend.DeleteLinearTransform(tid)
+        self.backend.DeleteLinearTransforms(list(transform_ids.values()))
 
     def _verify_layer_compatibility(self, linear_layer):
         layer_name = linear_layer.name
@@ -267,42 +728,392 @@ class NewEvaluator:
                 
                 raise ValueError(error_msg)
             
+    def _check_writable(self, path):
+        if self.readonly:
+            raise PermissionError(
+                f"Cannot write to {path} in IO mode `readonly`.")
+
     def save_plaintext_diagonals(self, layer_name, lintransf_id, row, col, diag_idxs):
+        if self.storage == "file":
+            if self.backend.SaveDiagonals(lintransf_id, f"{layer_name}/{row}_{col}") < 0:
+                raise ValueError(
+                    f"Block {row}_{col} of module {layer_name!r} in "
+                    f"{self.store_path}: {self.backend.get_last_error()}"
+                )
+            return
+
+        self._check_writable(self.diags_path)
         with h5py.File(self.diags_path, "a") as f:
-            layer = f[layer_name]
+            # Create the hierarchy as needed, and reopen a block left behind
+            # by an earlier partial run rather than failing on it.
+            layer = f.require_group(layer_name)
             plaintext_group = layer.require_group("plaintexts")
             block_idx = f"{row}_{col}"
-            block_group = plaintext_group.create_group(block_idx)
+
+            # A block saved in the other layout is replaced.
+            if self.diag_layout == "packed":
+                if block_idx in plaintext_group:
+                    del plaintext_group[block_idx]
+                self._save_packed_block(
+                    plaintext_group, block_idx, lintransf_id, diag_idxs)
+                return
+            if isinstance(plaintext_group.get(block_idx), h5py.Dataset):
+                del plaintext_group[block_idx]
+            block_group = plaintext_group.require_group(block_idx)
+
+            # Structured transforms (e.g. block-Toeplitz convolutions) repeat
+            # the same diagonals across blocks. Each distinct plaintext is
+            # then stored once under its hash, and the blocks soft link to
+            # it. Soft links resolve transparently when loading.
+            if self.dedup_diagonals:
+                blob_group = layer.require_group("plaintext_blobs")
 
             for diag_idx in diag_idxs:
                 diag_serial, diag_ptr = self.backend.SerializeDiagonal(lintransf_id, diag_idx)
-                block_group.create_dataset(str(diag_idx), data=diag_serial)
+                try:
+                    # getlink also finds soft links whose target is gone.
+                    if block_group.get(str(diag_idx), getlink=True) is not None:
+                        del block_group[str(diag_idx)]
+
+                    data = compress(diag_serial, self.compression)
+                    if not self.dedup_diagonals:
+                        write_dataset(block_group, str(diag_idx), data)
+                        continue
 
-                # Now that it's saved, we'll free the memory
+                    # Blobs are named after the uncompressed diagonal, so
+                    # they dedup across runs with different compression.
+                    digest = hashlib.sha256(diag_serial).hexdigest()
+                    if digest not in blob_group:
+                        write_dataset(blob_group, digest, data)
+                    block_group[str(diag_idx)] = h5py.SoftLink(
+                        f"{blob_group.name}/{digest}")
+                finally:
+                    # Now that it's saved, we'll free the memory
+                    self.backend.FreeCArray(diag_ptr)
+
+    def _save_packed_block(self, plaintext_group, block_idx, lintransf_id,
+                           diag_idxs):
+        # Writes a block as one chunked dataset holding its diagonals back
+        # to back, with their indices and offsets as attributes, so that it
+        # is loaded with a single read. Diagonals are not deduplicated.
+        pieces = []
+        for diag_idx in diag_idxs:
+            diag_serial, diag_ptr = self.backend.SerializeDiagonal(lintransf_id, diag_idx)
+            try:
+                pieces.append(np.array(compress(diag_serial, self.compression)))
+            finally:
                 self.backend.FreeCArray(diag_ptr)
 
-    def load_plaintext_diagonals(self, layer_name, row, col, transform_id):
-        with h5py.File(self.diags_path, "r") as f:
-            layer = f[layer_name]
-            ptxt_group = layer["plaintexts"]
-            block = ptxt_group[f"{row}_{col}"]
+        data = np.concatenate(pieces)
+        block = write_dataset(
+            plaintext_group, block_idx, data,
+            chunks=(min(len(data), PACKED_CHUNK_BYTES),))
+        block.attrs["diag_idxs"] = np.asarray(diag_idxs, dtype=np.int64)
+        block.attrs["offsets"] = np.cumsum([0] + [len(p) for p in pieces])
+
+    def _plan_windows(self, layer_name, transform_ids, groups):
+        # Splits the groups of blocks into the windows the backend chose
+        # for the memory budget, in order.
+        window_sizes = self.backend.PlanLinearTransformWindows(
+            [int(transform_ids[i][j]) for group in groups for i, j in group],
+            [len(group) for group in groups],
+        )
+        if not window_sizes:
+            raise ValueError(
+                f"Failed to plan the evaluation of layer {layer_name}: "
+                f"{self.backend.get_last_error()}"
+            )
 
-            for diag_idx in block:
-                serial_diag = block[diag_idx][()]
-                self.backend.LoadPlaintextDiagonal(
-                    serial_diag, transform_id, int(diag_idx)
+        windows, start = [], 0
+        for size in window_sizes:
+            windows.append(groups[start:start + size])
+            start += size
+        return windows
+
+    def load_plaintext_diagonals(self, layer_name, row, col, transform_id,
+                                 block=None):
+        # As with rotation keys, blocks loaded by earlier evaluations are
+        # kept in the backend's diagonal cache. Otherwise the block is read
+        # from disk, unless the diagonal pipeline already read it.
+        if self.backend.LoadCachedPlaintextDiagonals(transform_id):
+            return
+
+        self.diagonal_reads += 1
+        if self.storage == "file":
+            if self.backend.LoadDiagonals(transform_id, f"{layer_name}/{row}_{col}") < 0:
+                raise ValueError(
+                    f"Block {row}_{col} of module {layer_name!r} in "
+                    f"{self.store_path}: {self.backend.get_last_error()}. "
+                    f"Recompile the model with IO mode `save`."
                 )
+            return
+
+        if block is None:
+            block = self._read_plaintext_diagonals(layer_name, row, col)
+        for diag_idx, serial_diag in block.items():
+            if self.backend.LoadPlaintextDiagonal(
+                serial_diag, transform_id, diag_idx
+            ) < 0:
+                raise ValueError(
+                    f"Block {row}_{col} of module {layer_name!r} in "
+                    f"{self.diags_path}: {self.backend.get_last_error()}"
+                )
+
+    def evaluate_transform_streamed(self, layer_name, row, col, transform_id,
+                                    ctxt_id):
+        # Evaluates a block whose diagonals the backend requests one at a
+        # time, in the order its baby-step giant-step evaluation uses them,
+        # so that only one giant step's plaintexts are held at once. They
+        # bypass the diagonal cache. In the packed layout, the serialized
+        # block is still read whole, since its checksum covers all of it.
+        errors = []
+        current = [None] # the diagonal the backend is decoding
+
+        with h5py.File(self.diags_path, "r") as f:
+            block = self._plaintext_block(f, layer_name, row, col)
+            if isinstance(block, h5py.Dataset):
+                read = self._read_packed_block(block).__getitem__
+            else:
+                read = lambda idx: decompress(read_dataset(block[str(idx)]))
+
+            def source(diag_idx, data, length):
+                try:
+                    current[0] = np.ascontiguousarray(read(diag_idx), dtype=np.uint8)
+                    data[0] = current[0].ctypes.data_as(
+                        ctypes.POINTER(ctypes.c_ubyte))
+                    length[0] = current[0].nbytes
+                    return 0
+                except Exception as e:
+                    errors.append(e)
+                    return 1
+
+            res = self.backend.EvaluateLinearTransformStreamed(
+                transform_id, ctxt_id, self.backend.PlaintextSource(source))
+
+        self.diagonal_reads += 1
+        if errors:
+            raise errors[0]
+        if res < 0:
+            raise ValueError(
+                f"Block {row}_{col} of module {layer_name!r} in "
+                f"{self.diags_path}: {self.backend.get_last_error()}"
+            )
+        return res
+
+    def _read_plaintext_diagonals(self, layer_name, row, col):
+        # Returns the serialized diagonals of a block by diagonal index.
+        with h5py.File(self.diags_path, "r") as f:
+            block = self._plaintext_block(f, layer_name, row, col)
+            if isinstance(block, h5py.Dataset):
+                return self._read_packed_block(block)
+            return {
+                int(diag_idx): decompress(read_dataset(block[diag_idx]))
+                for diag_idx in block
+            }
+
+    def _plaintext_block(self, f, layer_name, row, col):
+        # A partially compiled model may be missing any of these groups,
+        # so say exactly which part is absent.
+        block_path = f"{layer_name}/plaintexts/{row}_{col}"
+        if block_path not in f:
+            raise ValueError(
+                f"Diagonals for module {layer_name!r} block {row}_{col} "
+                f"not found in {self.diags_path}. Recompile the model "
+                f"with IO mode `save`."
+            )
+        return f[block_path]
+
+    def _read_packed_block(self, block):
+        data = read_dataset(block)
+        offsets = block.attrs["offsets"]
+        return {
+            int(diag_idx): decompress(data[offsets[k]:offsets[k + 1]])
+            for k, diag_idx in enumerate(block.attrs["diag_idxs"])
+        }
+
+    def _diagonal_pipeline(self, layer_name, transform_ids, blocks):
+        # Yields the serialized diagonals of each of the (row, col) blocks
+        # in turn, for load_plaintext_diagonals. A background thread reads
+        # up to diag_pipeline_depth blocks ahead of the one being evaluated,
+        # so that HDF5 reads overlap with evaluation, which releases the
+        # GIL. Blocks already in the diagonal cache are not read, and yield
+        # None, as does every block when the pipeline is disabled, when
+        # diagonals are streamed, or with the "file" storage.
+        def read(row, col):
+            if self.backend.HasCachedPlaintextDiagonals(transform_ids[row][col]):
+                return None
+            return self._read_plaintext_diagonals(layer_name, row, col)
+
+        depth = self.diag_pipeline_depth
+        if depth <= 0 or self.stream_diagonals or self.storage == "file":
+            for _ in blocks:
+                yield None
+            return
+
+        pending = deque()
+        with ThreadPoolExecutor(max_workers=1) as pool:
+            try:
+                for k in range(len(blocks)):
+                    while len(pending) <= depth and k + len(pending) < len(blocks):
+                        pending.append(pool.submit(read, *blocks[k + len(pending)]))
+                    yield pending.popleft().result()
+            finally:
+                # Reached when evaluation fails part way through.
+                for future in pending:
+                    future.cancel()
     
-    def load_rotation_keys(self, transform_id):
-        keys = self.get_required_rotation_keys(transform_id)
+    def has_rotation_key(self, step):
+        if self.backend.HasRotationKey(step):
+            return True
+        if self.io_mode == "none":
+            return False
+        return self._has_saved_rotation_key(self.backend.GetGaloisElement(step))
 
+    def _has_saved_rotation_key(self, gal_el):
+        if self.storage == "file":
+            return bool(self.backend.HasStoredRotationKey(gal_el))
+        if not os.path.exists(self.keys_path):
+            return False
         with h5py.File(self.keys_path, "r") as f:
-            for key in keys:
-                serial_key = f[str(key)][()]
-                self.backend.LoadRotationKey(serial_key, int(key))
+            return str(gal_el) in f
+
+    def ensure_rotation_key(self, step):
+        # Prefer a key that was already saved to disk over generating it
+        # again; the backend then reuses the loaded key.
+        if self.backend.HasRotationKey(step):
+            return
+        if self.has_rotation_key(step):
+            gal_el = self.backend.GetGaloisElement(step)
+            if self.storage == "file":
+                self._load_stored_rotation_keys([gal_el])
+            else:
+                with h5py.File(self.keys_path, "r") as f:
+                    self._load_rotation_key(f, gal_el)
+        elif self.readonly:
+            raise ValueError(
+                f"Rotation key for step {step} not found in {self.keys_path}, "
+                f"and IO mode `readonly` does not generate missing keys."
+            )
+        self.backend.EnsureRotationKey(step)
+
+    def load_rotation_keys(self, keys):
+        self.scheme.keygen.check_manifest()
+
+        # Keys loaded by earlier evaluations are kept in the backend's key
+        # cache, so we only go to disk for the ones that aren't there.
+        missing = [
+            key for key in keys if not self.backend.LoadCachedRotationKey(key)
+        ]
+        if not missing:
+            return
+        if self.storage == "file":
+            self._load_stored_rotation_keys(missing)
+            return
+
+        with h5py.File(self.keys_path, "r") as f:
+            for key in missing:
+                if str(key) not in f:
+                    raise ValueError(
+                        f"Rotation key for Galois element {key} not found in "
+                        f"{self.keys_path}. Recompile the model with IO mode "
+                        f"`save`."
+                    )
+                self._load_rotation_key(f, key)
+
+    def _load_rotation_key(self, f, key):
+        # Reads the key for Galois element key from the open keys file.
+        serial_key = decompress(read_dataset(f[str(key)]))
+        if self.backend.LoadRotationKey(serial_key, int(key)) < 0:
+            raise ValueError(
+                f"{self.keys_path}: {self.backend.get_last_error()}")
+        self.rotation_key_reads += 1
+
+    def _load_stored_rotation_keys(self, keys):
+        # Has the backend read the keys from the "file" storage.
+        if self.backend.LoadRotationKeys([int(key) for key in keys]) < 0:
+            raise ValueError(
+                f"{self.store_path}: {self.backend.get_last_error()}. "
+                f"Recompile the model with IO mode `save`."
+            )
+        self.rotation_key_reads += len(keys)
+
+    def _start_key_prefetch(self, keys):
+        # Reads the keys on a background thread and hands them to the
+        # backend, which decodes them into its key cache. The backend call
+        # we are overlapping with releases the GIL, so this runs alongside.
+        if (not keys or self.storage == "file"
+                or not self.backend.KeyPrefetchEnabled()):
+            return None
+
+        def prefetch():
+            missing = [
+                key for key in keys if not self.backend.HasCachedRotationKey(key)
+            ]
+            if not missing:
+                return
+            with h5py.File(self.keys_path, "r") as f:
+                for key in missing:
+                    # load_rotation_keys reports missing or corrupted keys.
+                    if str(key) not in f:
+                        continue
+                    try:
+                        serial_key = decompress(read_dataset(f[str(key)]))
+                    except ValueError:
+                        continue
+                    self.backend.PrefetchRotationKey(serial_key, int(key))
+                    self.rotation_key_reads += 1
+
+        thread = threading.Thread(target=prefetch, daemon=True)
+        thread.start()
+        return thread
+
+    def export_evaluation_keys(self, path):
+        # Writes the public key, relinearization key and every rotation key
+        # to one bundle for a remote evaluator. Keys saved to disk are
+        # loaded for the export and dropped again afterwards.
+        if self.io_mode != "none" and self.storage == "file":
+            self._load_stored_rotation_keys(sorted(self.saved_rotation_keys))
+        elif self.io_mode != "none" and os.path.exists(self.keys_path):
+            with h5py.File(self.keys_path, "r") as f:
+                for name in f:
+                    if name.isdigit():
+                        self._load_rotation_key(f, int(name))
+        try:
+            if self.backend.SaveEvaluationKeyBundle(path) < 0:
+                raise ValueError(self.backend.get_last_error())
+        finally:
+            if self.io_mode != "none":
+                self.remove_rotation_keys()
+
+    def set_diagonal_pipeline_depth(self, depth):
+        self.diag_pipeline_depth = int(depth)
+
+    def set_hoisted_rotations(self, enabled, min_diagonals=0):
+        self.backend.SetHoistedRotations(int(enabled), int(min_diagonals))
+
+    def set_key_prefetch(self, enabled):
+        self.backend.SetKeyPrefetchEnabled(int(enabled))
+
+    def set_key_cache_capacity(self, capacity_bytes):
+        self.backend.SetKeyCacheCapacity(int(capacity_bytes))
+
+    def set_lt_memory_budget(self, budget_bytes):
+        self.backend.SetLTMemoryBudget(int(budget_bytes))
+
+    def clear_key_cache(self):
+        self.backend.ClearKeyCache()
+
+    def set_diagonal_cache_capacity(self, capacity_bytes):
+        self.backend.SetDiagonalCacheCapacity(int(capacity_bytes))
+
+    def clear_diagonal_cache(self):
+        self.backend.ClearDiagonalCache()
 
     def remove_rotation_keys(self):
         self.backend.RemoveRotationKeys() 
 
+    def retain_rotation_keys(self, keys):
+        self.backend.RetainRotationKeys([int(key) for key in keys])
+
     def remove_plaintext_diagonals(self, transform_id):
         self.backend.RemovePlaintextDiagonals(transform_id)
\ No newline at end of file
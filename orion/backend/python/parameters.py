@@ -1,4 +1,5 @@
 import os
+import shutil
 from typing import Literal, List
 from dataclasses import dataclass, field
 
@@ -74,9 +75,25 @@ class OrionParameters:
     debug: bool = True
     embedding_method: Literal["hybrid", "square"] = "hybrid"
     backend: Literal["lattigo", "openfhe", "heaan"] = "lattigo"
-    io_mode: Literal["none", "save", "load"] = "none"
+    io_mode: Literal["none", "save", "load", "append", "readonly"] = "none"
     diags_path: str = ""
     keys_path: str = ""
+    lt_workers: int = 0 # 0 lets the backend use every available core
+    diag_prune_threshold: float = 0.0 # only all-zero diagonals by default
+    log_level: Literal["silent", "info", "debug"] = "silent"
+    min_security_bits: int = 0 # refuse weaker parameters (0 disables)
+    seed: str = "" # reproducible keys and encryptions, for testing only
+    dedup_diagonals: bool = True # store identical plaintext diagonals once
+    plan_rotation_keys: bool = True # generate all rotation keys after compiling
+    diag_pipeline_depth: int = 1 # blocks of diagonals read ahead in load mode
+    block_order: Literal["row", "column"] = "row" # of blocks in load mode
+    lt_memory_budget: int = 0 # bytes of rotation keys kept loaded at once
+    compression: Literal["none", "zstd"] = "none" # of saved diagonals and keys
+    diag_layout: Literal["datasets", "packed"] = "datasets" # one dataset per block when packed
+    stream_diagonals: bool = False # load each block's diagonals by giant step in load mode
+    storage: Literal["hdf5", "file"] = "hdf5" # of diagonals and rotation keys
+    store_path: str = "" # root directory of the "file" storage
+    backend_conv_packing: bool = False # build Conv2d diagonals in the backend in IO mode "none"
 
     def __str__(self) -> str:
         output = [
@@ -117,11 +134,20 @@ class NewParameters:
         )
         self.orion_params = OrionParameters(**orion_params)
 
+        if self.get_storage() == "file":
+            if not self.orion_params.store_path:
+                raise ValueError(
+                    "The `file` storage needs a store_path directory.")
+            if self.get_stream_diagonals():
+                raise ValueError(
+                    "Diagonals can only be streamed from the `hdf5` storage.")
+
         # Finally, we'll delete existing keys/diagonals if the user  
         # specifies to overwrite them.
         if self.get_io_mode() == "save" and self.io_paths_exist():
             self.reset_stored_keys()
             self.reset_stored_diags()
+            self.reset_store()
 
     def __str__(self) -> str:
         border = "=" * 50
@@ -183,6 +209,70 @@ class NewParameters:
     def get_io_mode(self):
         return self.orion_params.io_mode.lower()
 
+    def saves_to_disk(self):
+        # "append" behaves like "save" but keeps whatever keys and
+        # diagonals are already on disk from earlier runs.
+        return self.get_io_mode() in ("save", "append")
+
+    def loads_from_disk(self):
+        # "readonly" loads like "load", but never writes to or creates the
+        # key and diagonal files, and fails if anything it needs is missing.
+        return self.get_io_mode() in ("load", "readonly")
+
+    def is_readonly(self):
+        return self.get_io_mode() == "readonly"
+
+    def get_lt_workers(self):
+        return self.orion_params.lt_workers
+
+    def get_diag_prune_threshold(self):
+        return float(self.orion_params.diag_prune_threshold)
+
+    def get_dedup_diagonals(self):
+        return self.orion_params.dedup_diagonals
+
+    def get_plan_rotation_keys(self):
+        return self.orion_params.plan_rotation_keys
+
+    def get_diag_pipeline_depth(self):
+        return self.orion_params.diag_pipeline_depth
+
+    def get_block_order(self):
+        return self.orion_params.block_order
+
+    def get_lt_memory_budget(self):
+        return self.orion_params.lt_memory_budget
+
+    def get_compression(self):
+        return self.orion_params.compression.lower()
+
+    def get_diag_layout(self):
+        return self.orion_params.diag_layout.lower()
+
+    def get_stream_diagonals(self):
+        return self.orion_params.stream_diagonals
+
+    def get_storage(self):
+        return self.orion_params.storage.lower()
+
+    def get_store_path(self):
+        path = self.orion_params.store_path
+        if not path:
+            return ""
+        return os.path.abspath(os.path.join(os.getcwd(), path))
+
+    def get_backend_conv_packing(self):
+        return self.orion_params.backend_conv_packing
+
+    def get_min_security_bits(self):
+        return self.orion_params.min_security_bits
+
+    def get_seed(self):
+        return self.orion_params.seed
+
+    def get_log_level(self):
+        return self.orion_params.log_level.lower()
+
     def get_boot_logp(self):
         return self.ckks_params.boot_logp
 
@@ -200,4 +290,10 @@ class NewParameters:
         self.reset_stored_file(self.get_diags_path(), "diagonals")
 
     def reset_stored_keys(self):
-        self.reset_stored_file(self.get_keys_path(), "keys")
\ No newline at end of file
+        self.reset_stored_file(self.get_keys_path(), "keys")
+
+    def reset_store(self):
+        path = self.get_store_path()
+        if self.get_storage() == "file" and os.path.isdir(path):
+            print(f"Deleting existing diagonals and keys at {path}")
+            shutil.rmtree(path)
\ No newline at end of file
@@ -22,6 +22,20 @@ class NewEvaluator:
             coeffs = coeffs.tolist()
         return self.backend.GenerateChebyshev(coeffs)
 
+    def generate_chebyshev_interval(self, coeffs, interval):
+        # Chebyshev coefficients of an approximation over interval = (a, b),
+        # e.g. from numpy's Chebyshev.interpolate(f, deg, domain=[a, b]).
+        # The backend maps inputs from [a, b] onto [-1, 1] at the cost of
+        # one more level.
+        if isinstance(coeffs, (torch.Tensor, np.ndarray)):
+            coeffs = coeffs.tolist()
+        a, b = interval
+        poly = self.backend.GenerateChebyshevInterval(
+            [float(c) for c in coeffs], float(a), float(b))
+        if poly < 0:
+            raise ValueError(self.backend.get_last_error())
+        return poly
+
     def evaluate_polynomial(self, ciphertensor, poly, out_scale=None):
         out_scale = out_scale or self.scheme.params.get_default_scale()
 
@@ -33,6 +47,115 @@ class NewEvaluator:
         return CipherTensor(
             self.scheme, cts_out, ciphertensor.shape, ciphertensor.on_shape)
     
+    def evaluate_piecewise(self, ciphertensor, sign_polys, neg_poly, pos_poly):
+        # Evaluates neg_poly below 0 and pos_poly above, selected by the
+        # composite sign approximation sign_polys (whose last polynomial
+        # maps onto [0, 1]), e.g. ReLU with neg_poly = 0 and pos_poly = x.
+        cts_out = []
+        for ctxt in ciphertensor.ids:
+            ct_out = self.backend.EvaluatePiecewise(
+                ctxt, list(sign_polys), neg_poly, pos_poly)
+            if ct_out < 0:
+                raise ValueError(self.backend.get_last_error())
+            cts_out.append(ct_out)
+
+        return CipherTensor(
+            self.scheme, cts_out, ciphertensor.shape, ciphertensor.on_shape)
+
+    def register_sign_composition(self, degrees, coeffs=None, prec=128,
+                                  logalpha=12, logerr=12):
+        # Registers a composite sign approximation, e.g. degrees (15, 15, 27),
+        # from its Chebyshev coefficients (as split by
+        # generate_minimax_sign_coeffs) or, without them, from freshly
+        # generated minimax ones. Returns a handle for evaluate_sign.
+        flat = [] if coeffs is None else [float(c) for p in coeffs for c in p]
+        sign_id = self.backend.RegisterSignComposition(
+            list(degrees), flat, prec, logalpha, logerr)
+        if sign_id < 0:
+            raise ValueError(self.backend.get_last_error())
+        return sign_id
+
+    def delete_sign_composition(self, sign_id):
+        self.backend.DeleteSignComposition(sign_id)
+
+    def get_sign_depth(self, sign_id):
+        return self.backend.GetSignCompositionDepth(sign_id)
+
+    def evaluate_sign(self, ciphertensor, sign_id):
+        # Approximates the step function (0 below 0, 1 above).
+        cts_out = []
+        for ctxt in ciphertensor.ids:
+            ct_out = self.backend.EvaluateSign(ctxt, sign_id)
+            if ct_out < 0:
+                raise ValueError(self.backend.get_last_error())
+            cts_out.append(ct_out)
+
+        return CipherTensor(
+            self.scheme, cts_out, ciphertensor.shape, ciphertensor.on_shape)
+
+    def evaluate_piecewise_sign(self, ciphertensor, sign_id, neg_poly, pos_poly):
+        # Same as evaluate_piecewise, with a registered sign composition.
+        cts_out = []
+        for ctxt in ciphertensor.ids:
+            ct_out = self.backend.EvaluatePiecewiseSign(
+                ctxt, sign_id, neg_poly, pos_poly)
+            if ct_out < 0:
+                raise ValueError(self.backend.get_last_error())
+            cts_out.append(ct_out)
+
+        return CipherTensor(
+            self.scheme, cts_out, ciphertensor.shape, ciphertensor.on_shape)
+
+    def get_relu_depth(self, alpha):
+        depth = self.backend.GetReLUDepth(alpha)
+        if depth < 0:
+            raise ValueError(self.backend.get_last_error())
+        return depth
+
+    def evaluate_relu(self, ciphertensor, alpha=8):
+        # ReLU within roughly 2^-alpha, for values in [-1, 1].
+        cts_out = []
+        for ctxt in ciphertensor.ids:
+            ct_out = self.backend.EvaluateReLU(ctxt, alpha)
+            if ct_out < 0:
+                raise ValueError(self.backend.get_last_error())
+            cts_out.append(ct_out)
+
+        return CipherTensor(
+            self.scheme, cts_out, ciphertensor.shape, ciphertensor.on_shape)
+
+    def get_activation_depth(self, interval, degree):
+        depth = self.backend.GetActivationDepth(*interval, degree)
+        if depth < 0:
+            raise ValueError(self.backend.get_last_error())
+        return depth
+
+    def evaluate_gelu(self, ciphertensor, interval, degree=63):
+        return self._evaluate_activation(
+            self.backend.EvaluateGELU, ciphertensor, interval, degree)
+
+    def evaluate_silu(self, ciphertensor, interval, degree=63):
+        return self._evaluate_activation(
+            self.backend.EvaluateSiLU, ciphertensor, interval, degree)
+
+    def evaluate_softplus(self, ciphertensor, interval, degree=63):
+        return self._evaluate_activation(
+            self.backend.EvaluateSoftplus, ciphertensor, interval, degree)
+
+    def _evaluate_activation(self, fn, ciphertensor, interval, degree):
+        # Interpolates the activation over interval = (a, b), which must
+        # contain every input value.
+        a, b = interval
+        cts_out = []
+        for ctxt in ciphertensor.ids:
+            ct_out = fn(ctxt, a, b, degree)
+            if ct_out < 0:
+                raise ValueError(self.backend.get_last_error())
+            cts_out.append(ct_out)
+
+        return CipherTensor(
+            self.scheme, cts_out, ciphertensor.shape, ciphertensor.on_shape)
+
     def generate_minimax_sign_coeffs(self, degrees, prec=128, logalpha=12, 
                                      logerr=12, debug=False):
         if isinstance(degrees, int):
@@ -93,8 +93,7 @@ class CipherTensor:
     def __del__(self):
         if 'sys' in globals() and sys.modules and self.scheme:
             try:
-                for idx in self.ids:
-                    self.backend.DeleteCiphertext(idx)
+                self.backend.DeleteCiphertexts(list(self.ids))
             except Exception: 
                 pass # avoids errors for GC at program termination
 
@@ -224,6 +223,9 @@ class CipherTensor:
     
     def scale(self):
         return self.backend.GetCiphertextScale(self.ids[0])
+
+    def log_scale(self):
+        return self.backend.GetCiphertextLogScale(self.ids[0])
     
     def set_scale(self, scale):
         for ctxt in self.ids:
@@ -78,7 +78,8 @@ class Scheme:
     
     def delete_scheme(self):
         if self.backend:
-            self.backend.DeleteScheme()
+            self.backend.delete_scheme()
+            self.backend = None
     
     def __del__(self):
         self.delete_scheme()
@@ -301,12 +302,16 @@ class Scheme:
         #------------------------------------------#
 
         print("\n{5} Compiling network layers...", flush=True)
+        self.lt_evaluator.begin_key_planning()
         for node in topo_sort:
             node_attrs = network_dag.nodes[node]
             module = node_attrs["module"]
             if isinstance(module, Module):
                 print(f"├── {node} @ level={module.level}", flush=True)
                 module.compile()
+
+        # Rotation keys of every layer are generated together at the end.
+        self.lt_evaluator.generate_all_rotation_keys()
                 
         return input_level # level at which to encrypt the input.
 
@@ -26,6 +26,27 @@ def pack_conv2d(conv_layer: nn.Module, last: bool):
     
     return diagonals, output_rotations
 
+def conv2d_geometry(conv_layer):
+    # Returns the weights of a convolution, with any groups resolved, and
+    # the geometry the backend builds its diagonals from, in the order of
+    # convGeometry's fields (conv.go). The stride is taken from the gaps,
+    # as the Toeplitz matrix below does.
+    weight = conv_layer.on_weight
+    if conv_layer.groups > 1:
+        weight = resolve_grouped_conv(conv_layer)
+
+    N, on_Ci, on_Hi, on_Wi = conv_layer.fhe_input_shape
+    on_Co, on_Ho, on_Wo = conv_layer.fhe_output_shape[1:]
+    Ho, Wo = conv_layer.output_shape[2:]
+    stride = conv_layer.output_gap // conv_layer.input_gap
+
+    geometry = [
+        *weight.shape, N, on_Ci, on_Hi, on_Wi, on_Co, on_Ho, on_Wo, Ho, Wo,
+        conv_layer.padding[0], conv_layer.dilation[0], stride,
+        conv_layer.input_gap,
+    ]
+    return weight, [int(v) for v in geometry]
+
 def construct_conv2d_toeplitz(conv_layer, weight):
     N, on_Ci, on_Hi, on_Wi = conv_layer.fhe_input_shape
     on_Co, on_Ho, on_Wo = conv_layer.fhe_output_shape[1:]
@@ -58,17 +79,20 @@ def construct_conv2d_toeplitz(conv_layer, weight):
     Hi_pad = on_Hi + 2*P*iG 
     Wi_pad = on_Wi + 2*P*iG
 
-    # Initialize our sparse Toeplitz matrix
+    # Initialize our sparse Toeplitz matrix, in double precision if the
+    # weights are, so the backend encodes them without rounding.
     n_rows = on_Co * on_Ho * on_Wo
     n_cols = on_Ci * Hi_pad * Wi_pad
-    toeplitz = sp.lil_matrix((n_rows, n_cols), dtype="f")
+    dtype = "d" if weight.dtype == torch.float64 else "f"
+    toeplitz = sp.lil_matrix((n_rows, n_cols), dtype=dtype)
 
     # Create an index grid for the padded input image.
     valid_image_indices = torch.arange(n_cols).reshape(on_Ci, Hi_pad, Wi_pad)
 
     # Pad the kernel's input and output channels to the nearest multiple
     # of gap^2 to ensure that multiplexing works.
-    kernel = torch.zeros(on_Co * oG**2, on_Ci * iG**2, kW, kH) 
+    kernel = torch.zeros(
+        on_Co * oG**2, on_Ci * iG**2, kW, kH, dtype=weight.dtype)
     kernel[:weight.shape[0], :weight.shape[1], ...] = weight
 
     # All the indices the kernel initially touches
@@ -100,7 +124,7 @@ def construct_conv2d_toeplitz(conv_layer, weight):
     toeplitz = toeplitz.tocsc()[:, image_indices]
     
     # Support batching
-    toeplitz = sp.kron(sp.eye(N, dtype="f"), toeplitz, format="csr")
+    toeplitz = sp.kron(sp.eye(N, dtype=dtype), toeplitz, format="csr")
     return toeplitz
     
 def construct_conv2d_bias(conv_layer):
@@ -140,11 +164,12 @@ def construct_linear_matrix(linear_layer):
         reshaped = linear_layer.on_weight.reshape(out_features, Ci, Hi, Wi)
         reshaped = multiplex(reshaped, input_gap)
 
-        matrix = torch.zeros(out_features, on_Ci, on_Hi, on_Wi)
+        matrix = torch.zeros(
+            out_features, on_Ci, on_Hi, on_Wi, dtype=reshaped.dtype)
         matrix[..., :Hi*input_gap, :Wi*input_gap] = reshaped 
         matrix = matrix.reshape(out_features, -1)
    
-    matrix = torch.kron(torch.eye(N), matrix) 
+    matrix = torch.kron(torch.eye(N, dtype=matrix.dtype), matrix) 
     matrix_sparse = sp.csr_matrix(matrix.cpu().numpy())
     return matrix_sparse
 
@@ -161,7 +186,7 @@ def multiplex(matrix, gap):
     Co = math.ceil(Ci / (gap**2))
     
     # Pad the tensor to have channels divisible by gap^2
-    padded = torch.zeros(N, Co * gap**2, Hi, Wi)
+    padded = torch.zeros(N, Co * gap**2, Hi, Wi, dtype=matrix.dtype)
     padded[:, :Ci, ...] = matrix
     return F.pixel_shuffle(padded, gap) # multiplexed
 
@@ -272,7 +297,9 @@ def diagonalize(
                 row_start: row_start + block_height,
                 col_start: col_start + num_slots,
             ]
-            block_dense = torch.tensor(block_sparse.todense(), dtype=torch.float32)
+            # Blocks keep the matrix's precision: float64 weights reach
+            # the backend's double-precision entry point unrounded.
+            block_dense = torch.from_numpy(block_sparse.toarray())
             block_diagonals = block_dense[row_idx, col_idx]
 
             # Collect non-zero diagonals
@@ -1,6 +1,7 @@
 import sys
 import math
 from abc import abstractmethod
+from typing import Union
 
 import torch
 import torch.nn as nn
@@ -12,7 +13,9 @@ from ..core import packing
 class LinearTransform(Module):
     def __init__(self, bsgs_ratio, level) -> None:
         super().__init__()
-        self.bsgs_ratio = float(bsgs_ratio)
+        # "auto" lets the backend choose each transform's baby-step
+        # giant-step split from its diagonals and level.
+        self.bsgs_ratio = -1.0 if bsgs_ratio == "auto" else float(bsgs_ratio)
         self.set_depth(1)
         self.set_level(level)
 
@@ -28,7 +31,8 @@ class LinearTransform(Module):
                 pass # avoids errors for GC at program termination
 
     def extra_repr(self):
-        return super().extra_repr() + f", bsgs_ratio={self.bsgs_ratio}"
+        bsgs_ratio = "auto" if self.bsgs_ratio == -1 else self.bsgs_ratio
+        return super().extra_repr() + f", bsgs_ratio={bsgs_ratio}"
             
     def init_orion_params(self):
         # Initialize additional Orion-specific weights/biases.
@@ -81,7 +85,7 @@ class Linear(LinearTransform):
         in_features: int, 
         out_features: int, 
         bias: bool = True,
-        bsgs_ratio: int = 2,
+        bsgs_ratio: Union[int, str] = 2,
         level: int = None,
     ) -> None:
         super().__init__(bsgs_ratio, level)
@@ -118,7 +122,7 @@ class Linear(LinearTransform):
         # of our linear layer. When using the "hybrid" method of packing, this
         # may also require several output rotations and summations.
         self.diagonals, self.output_rotations = packing.pack_linear(self, last)
-        if self.get_io_mode() == "save":
+        if self.scheme.params.saves_to_disk():
             self.save_transforms()
 
     def compile(self):
@@ -163,7 +167,7 @@ class Conv2d(LinearTransform):
             dilation: int = 1,
             groups: int = 1,
             bias: bool = True,
-            bsgs_ratio: int = 2,
+            bsgs_ratio: Union[int, str] = 2,
             level: int = None,
     ) -> None:
         super().__init__(bsgs_ratio, level)
@@ -224,11 +228,27 @@ class Conv2d(LinearTransform):
 
         return torch.Size((N, on_Co, on_Ho, on_Wo))
     
+    def conv_geometry(self):
+        return packing.conv2d_geometry(self)
+
+    def packs_in_backend(self):
+        # Without diagonals on disk, the backend can build them from the
+        # weights when compiling, if asked to, rather than packing.py.
+        return (self.get_io_mode() == "none" and
+                self.scheme.params.get_backend_conv_packing())
+
     def generate_diagonals(self, last):
+        # When the backend builds the diagonals, only their indices are
+        # needed until compiling.
+        if self.packs_in_backend():
+            self.diagonals, self.output_rotations = (
+                self.scheme.lt_evaluator.conv_diagonal_indices(self, last))
+            return
+
         # Generate Toeplitz diagonals and determine the number of output
         # rotations if the `hybrid` packing method is used.
         self.diagonals, self.output_rotations = packing.pack_conv2d(self, last)
-        if self.get_io_mode() == "save":
+        if self.scheme.params.saves_to_disk():
             self.save_transforms()
 
     def compile(self):
@@ -242,7 +262,10 @@ class Conv2d(LinearTransform):
         # modify the bias variable beforehand.
         bias = packing.construct_conv2d_bias(self)
         self.on_bias_ptxt = self.scheme.encoder.encode(bias, self.level-self.depth)
-        self.transform_ids = self.scheme.lt_evaluator.generate_transforms(self)
+        if self.packs_in_backend():
+            self.transform_ids = self.scheme.lt_evaluator.generate_conv_transforms(self)
+        else:
+            self.transform_ids = self.scheme.lt_evaluator.generate_transforms(self)
 
     def forward(self, x):
         # Forward pass that handles both cleartext and FHE inference.
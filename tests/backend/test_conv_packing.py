@@ -0,0 +1,109 @@
+import pytest
+import torch
+import torch.nn as nn
+import orion
+import orion.nn as on
+from orion.core import packing
+from orion.core.orion import scheme
+
+
+class ConvNet(on.Module):
+    def __init__(self, in_channels, out_channels, kernel_size, stride,
+                 padding, dilation, groups, input_gap):
+        super().__init__()
+        # A strided 1x1 convolution first multiplexes the input of the one
+        # under test with a gap of input_gap.
+        layers = []
+        if input_gap > 1:
+            layers.append(on.Conv2d(in_channels, in_channels, 1, stride=input_gap))
+        self.conv = on.Conv2d(
+            in_channels, out_channels, kernel_size, stride=stride,
+            padding=padding, dilation=dilation, groups=groups)
+        self.layers = nn.Sequential(*layers, self.conv)
+
+    def forward(self, x):
+        return self.layers(x)
+
+
+def get_config(backend_conv_packing=False):
+    return {
+        "ckks_params": {
+            "LogN": 13,
+            "LogQ": [29, 26, 26, 26],
+            "LogP": [29, 29],
+            "LogScale": 26,
+            "H": 8192,
+            "RingType": "ConjugateInvariant",
+        },
+        "orion": {
+            "backend": "lattigo",
+            "debug": False,
+            "io_mode": "none",
+            "backend_conv_packing": backend_conv_packing,
+        },
+    }
+
+
+# in_channels, out_channels, kernel_size, stride, padding, dilation,
+# groups, input_gap, batch, size
+CASES = {
+    "basic": (4, 8, 3, 1, 1, 1, 1, 1, 1, 16),
+    "stride": (4, 8, 3, 2, 1, 1, 1, 1, 1, 16),
+    "no padding": (4, 8, 3, 1, 0, 1, 1, 1, 1, 16),
+    "dilation": (4, 8, 3, 1, 2, 2, 1, 1, 1, 16),
+    "even kernel": (4, 8, 2, 1, 0, 1, 1, 1, 1, 16),
+    "input gap": (4, 8, 3, 1, 1, 1, 1, 2, 1, 16),
+    "input gap and stride": (8, 16, 3, 2, 1, 1, 1, 2, 1, 16),
+    "groups": (4, 8, 3, 1, 1, 1, 2, 1, 1, 16),
+    "depthwise": (8, 8, 3, 1, 1, 1, 8, 1, 1, 16),
+    "batch": (4, 8, 3, 1, 1, 1, 1, 1, 2, 16),
+    "multi-block": (16, 16, 3, 1, 1, 1, 1, 1, 1, 32),
+    "multi-block batch": (8, 8, 3, 2, 1, 1, 1, 1, 2, 32),
+}
+
+
+@pytest.mark.parametrize("case", CASES.values(), ids=CASES.keys())
+def test_backend_diagonals_match_packing(case):
+    # The backend's Toeplitz diagonals are those of packing.pack_conv2d(),
+    # with the hybrid embedding's shorter blocks and output rotations
+    # (last=False) and with the square one's full blocks (last=True).
+    *layer, input_gap, batch, size = case
+    torch.manual_seed(42)
+    orion.init_scheme(get_config())
+    net = ConvNet(*layer, input_gap)
+    orion.fit(net, torch.randn(batch, layer[0], size, size))
+
+    conv = net.conv
+    conv.init_orion_params()
+    for last in (False, True):
+        want, want_rotations = packing.pack_conv2d(conv, last)
+        got, got_rotations = scheme.lt_evaluator.conv_diagonals(conv, last)
+
+        assert got_rotations == want_rotations
+        assert got.keys() == want.keys()
+        for block, diags in want.items():
+            assert got[block].keys() == diags.keys(), block
+            for idx, diag in diags.items():
+                assert got[block][idx] == diag, (block, idx)
+
+    orion.delete_scheme()
+
+
+@pytest.mark.parametrize("backend_conv_packing", [False, True])
+def test_conv_inference(backend_conv_packing):
+    # Either packer gives a network that matches its cleartext output.
+    torch.manual_seed(42)
+    orion.init_scheme(get_config(backend_conv_packing))
+    net = ConvNet(4, 8, 3, 2, 1, 1, 1, 2)
+    inp = torch.randn(1, 4, 16, 16)
+
+    net.eval()
+    out_clear = net(inp)
+
+    orion.fit(net, inp)
+    input_level = orion.compile(net)
+    net.he()
+    out_fhe = net(orion.encrypt(orion.encode(inp, input_level))).decrypt().decode()
+    orion.delete_scheme()
+
+    assert torch.allclose(out_clear, out_fhe, atol=1e-2)
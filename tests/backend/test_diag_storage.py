@@ -0,0 +1,167 @@
+import h5py
+import numpy as np
+import pytest
+import torch
+import orion
+import orion.nn as on
+from orion.core.orion import scheme
+from orion.backend.python.compression import ZSTD_MAGIC, compress, decompress
+from orion.backend.python.integrity import read_dataset, write_dataset
+
+
+class SingleLayer(on.Module):
+    def __init__(self):
+        super().__init__()
+        self.fc = on.Linear(64, 64)
+
+    def forward(self, x):
+        return self.fc(x)
+
+
+def get_config(tmp_path, io_mode, **storage):
+    # Keyword arguments set how diagonals are stored, e.g. compression.
+    config = {
+        "ckks_params": {
+            "LogN": 13,
+            "LogQ": [29, 26, 26, 26],
+            "LogP": [29, 29],
+            "LogScale": 26,
+            "H": 8192,
+            "RingType": "ConjugateInvariant",
+        },
+        "orion": {
+            "backend": "lattigo",
+            "debug": False,
+            "io_mode": io_mode,
+            "diags_path": str(tmp_path / "diagonals.h5"),
+            "keys_path": str(tmp_path / "keys.h5"),
+        },
+    }
+    config["orion"].update(storage)
+    return config
+
+
+def compile_layer(config):
+    torch.manual_seed(42)
+    orion.init_scheme(config)
+    net = SingleLayer()
+    inp = torch.randn(1, 64)
+
+    orion.fit(net, inp)
+    input_level = orion.compile(net)
+    return net, inp, input_level
+
+
+def run_layer(config):
+    net, inp, input_level = compile_layer(config)
+    net.he()
+
+    vec_ctxt = orion.encrypt(orion.encode(inp, input_level))
+    out = net(vec_ctxt).decrypt().decode()
+    orion.delete_scheme()
+    return out
+
+
+def block_paths(diags_path):
+    # Returns (layer_name, row, col) for every block saved in the file.
+    with h5py.File(diags_path, "r") as f:
+        return [
+            (layer_name, *map(int, block_idx.split("_")))
+            for layer_name, layer in f.items()
+            if isinstance(layer, h5py.Group) and "plaintexts" in layer
+            for block_idx in layer["plaintexts"]
+        ]
+
+
+def read_saved_diagonals(config):
+    # Saves the layer's diagonals under config and reads them back.
+    compile_layer(config)
+    lt_evaluator = scheme.lt_evaluator
+    diags = {
+        path: lt_evaluator._read_plaintext_diagonals(*path)
+        for path in block_paths(config["orion"]["diags_path"])
+    }
+    orion.delete_scheme()
+    return diags
+
+
+STORAGE = {
+    "zstd": {"compression": "zstd"},
+    "packed": {"diag_layout": "packed"},
+    "packed zstd": {"compression": "zstd", "diag_layout": "packed"},
+}
+
+
+@pytest.mark.parametrize("storage", STORAGE.values(), ids=STORAGE.keys())
+def test_diagonals_round_trip(tmp_path, storage):
+    # Compressed and packed files load the very diagonals that were saved
+    # uncompressed one per dataset, and evaluate to the same output.
+    if storage.get("compression") == "zstd":
+        pytest.importorskip("zstandard")
+
+    (tmp_path / "plain").mkdir()
+    (tmp_path / "stored").mkdir()
+    want = read_saved_diagonals(get_config(tmp_path / "plain", "save"))
+    got = read_saved_diagonals(get_config(tmp_path / "stored", "save", **storage))
+
+    assert want and got.keys() == want.keys()
+    for path, diags in want.items():
+        assert got[path].keys() == diags.keys(), path
+        for diag_idx, diag in diags.items():
+            assert np.array_equal(got[path][diag_idx], diag), (path, diag_idx)
+
+    out_plain = run_layer(get_config(tmp_path / "plain", "load"))
+    out_stored = run_layer(get_config(tmp_path / "stored", "load", **storage))
+    assert torch.allclose(out_plain, out_stored, atol=1e-2)
+
+
+def test_compress_round_trip():
+    pytest.importorskip("zstandard")
+    data = np.tile(np.arange(256, dtype=np.uint8), 64)
+
+    frame = compress(data, "zstd")
+    assert frame[:len(ZSTD_MAGIC)].tobytes() == ZSTD_MAGIC
+    assert len(frame) < len(data)
+    assert np.array_equal(decompress(frame), data)
+
+    # Uncompressed data passes through either way.
+    assert np.array_equal(decompress(compress(data, "none")), data)
+
+
+def test_checksum_mismatch_detected(tmp_path):
+    data = np.arange(64, dtype=np.uint8)
+    with h5py.File(tmp_path / "data.h5", "w") as f:
+        write_dataset(f, "intact", data)
+        write_dataset(f, "corrupted", data)
+        f["corrupted"][3] = data[3] ^ 1
+        f.create_dataset("unchecked", data=data)
+
+    with h5py.File(tmp_path / "data.h5", "r") as f:
+        assert np.array_equal(read_dataset(f["intact"]), data)
+        assert np.array_equal(read_dataset(f["unchecked"]), data)
+        with pytest.raises(ValueError, match="corrupted"):
+            read_dataset(f["corrupted"])
+
+
+@pytest.mark.parametrize("diag_layout", ["datasets", "packed"])
+def test_corrupted_diagonal_rejected(tmp_path, diag_layout):
+    # A diagonal flipped on disk after saving is reported by name when the
+    # block is read back, in either layout.
+    config = get_config(tmp_path, "save", diag_layout=diag_layout)
+    compile_layer(config)
+    lt_evaluator = scheme.lt_evaluator
+    path = block_paths(config["orion"]["diags_path"])[0]
+
+    layer_name, row, col = path
+    with h5py.File(tmp_path / "diagonals.h5", "a") as f:
+        block = f[f"{layer_name}/plaintexts/{row}_{col}"]
+        if isinstance(block, h5py.Group):
+            block = next(iter(block.values()))
+        last = block.shape[0] - 1
+        block[last] = block[last] ^ 1
+
+    try:
+        with pytest.raises(ValueError, match="corrupted"):
+            lt_evaluator._read_plaintext_diagonals(*path)
+    finally:
+        orion.delete_scheme()
@@ -0,0 +1,76 @@
+import h5py
+import torch
+import orion
+import orion.nn as on
+from orion.core.orion import scheme
+from orion.backend.python import lt_evaluator
+
+
+class SingleLayer(on.Module):
+    def __init__(self):
+        super().__init__()
+        self.fc = on.Linear(64, 64)
+
+    def forward(self, x):
+        return self.fc(x)
+
+
+def get_config(tmp_path, io_mode):
+    return {
+        "ckks_params": {
+            "LogN": 13,
+            "LogQ": [29, 26, 26, 26],
+            "LogP": [29, 29],
+            "LogScale": 26,
+            "H": 8192,
+            "RingType": "ConjugateInvariant",
+        },
+        "orion": {
+            "backend": "lattigo",
+            "debug": False,
+            "io_mode": io_mode,
+            "diags_path": str(tmp_path / "diagonals.h5"),
+            "keys_path": str(tmp_path / "keys.h5"),
+            "diag_pipeline_depth": 0,
+        },
+    }
+
+
+def compile_layer(config):
+    torch.manual_seed(42)
+    orion.init_scheme(config)
+    net = SingleLayer()
+    inp = torch.randn(1, 64)
+
+    orion.fit(net, inp)
+    input_level = orion.compile(net)
+    return net, inp, input_level
+
+
+def test_loaders_keep_one_dataset_open(tmp_path, monkeypatch):
+    # Every dataset the loaders read is closed before the next one is
+    # opened, rather than when the whole block or bundle is done, so that
+    # large transforms do not run into HDF5's handle limits.
+    compile_layer(get_config(tmp_path, "save"))
+    orion.delete_scheme()
+    net, inp, input_level = compile_layer(get_config(tmp_path, "load"))
+    net.he()
+
+    # Reads happen on the main thread, so that open handles are counted
+    # for one loader at a time.
+    scheme.lt_evaluator.set_key_prefetch(False)
+
+    open_datasets = []
+    read_dataset = lt_evaluator.read_dataset
+
+    def counting_read_dataset(dataset):
+        open_datasets.append(dataset.file.id.get_obj_count(h5py.h5f.OBJ_DATASET))
+        return read_dataset(dataset)
+
+    monkeypatch.setattr(lt_evaluator, "read_dataset", counting_read_dataset)
+    net(orion.encrypt(orion.encode(inp, input_level)))
+
+    assert len(open_datasets) > 1
+    assert max(open_datasets) == 1
+
+    orion.delete_scheme()
@@ -0,0 +1,67 @@
+import torch
+import orion
+import orion.nn as on
+from orion.core.orion import scheme
+
+
+class SingleLayer(on.Module):
+    def __init__(self):
+        super().__init__()
+        self.fc = on.Linear(64, 64)
+
+    def forward(self, x):
+        return self.fc(x)
+
+
+def get_config(tmp_path, io_mode):
+    return {
+        "ckks_params": {
+            "LogN": 13,
+            "LogQ": [29, 26, 26, 26],
+            "LogP": [29, 29],
+            "LogScale": 26,
+            "H": 8192,
+            "RingType": "ConjugateInvariant",
+        },
+        "orion": {
+            "backend": "lattigo",
+            "debug": False,
+            "io_mode": io_mode,
+            "diags_path": str(tmp_path / "diagonals.h5"),
+            "keys_path": str(tmp_path / "keys.h5"),
+        },
+    }
+
+
+def compile_layer(config):
+    torch.manual_seed(42)
+    orion.init_scheme(config)
+    net = SingleLayer()
+    inp = torch.randn(1, 64)
+
+    orion.fit(net, inp)
+    input_level = orion.compile(net)
+    return net, inp, input_level
+
+
+def test_second_evaluation_reads_nothing_from_disk(tmp_path):
+    # Save the layer's keys and diagonals, then run it from them twice.
+    compile_layer(get_config(tmp_path, "save"))
+    orion.delete_scheme()
+    net, inp, input_level = compile_layer(get_config(tmp_path, "load"))
+    net.he()
+
+    lt_evaluator = scheme.lt_evaluator
+    vec_ctxt = orion.encrypt(orion.encode(inp, input_level))
+
+    net(vec_ctxt)
+    key_reads = lt_evaluator.rotation_key_reads
+    diagonal_reads = lt_evaluator.diagonal_reads
+    assert key_reads > 0 and diagonal_reads > 0
+
+    # The keys and diagonals of the first evaluation are all cached.
+    net(vec_ctxt)
+    assert lt_evaluator.rotation_key_reads == key_reads
+    assert lt_evaluator.diagonal_reads == diagonal_reads
+
+    orion.delete_scheme()
@@ -0,0 +1,84 @@
+import h5py
+import pytest
+import torch
+import orion
+import orion.nn as on
+from orion.core.orion import scheme
+
+
+class TwoLayers(on.Module):
+    def __init__(self):
+        super().__init__()
+        self.fc1 = on.Linear(64, 64)
+        self.fc2 = on.Linear(64, 32)
+
+    def forward(self, x):
+        return self.fc2(self.fc1(x))
+
+
+def get_config(tmp_path, io_mode, plan_rotation_keys=True):
+    return {
+        "ckks_params": {
+            "LogN": 13,
+            "LogQ": [29, 26, 26, 26, 26],
+            "LogP": [29, 29],
+            "LogScale": 26,
+            "H": 8192,
+            "RingType": "ConjugateInvariant",
+        },
+        "orion": {
+            "backend": "lattigo",
+            "debug": False,
+            "io_mode": io_mode,
+            "diags_path": str(tmp_path / "diagonals.h5"),
+            "keys_path": str(tmp_path / "keys.h5"),
+            "plan_rotation_keys": plan_rotation_keys,
+        },
+    }
+
+
+def run_network(config):
+    # Compiles the network, which plans its rotation keys unless told not
+    # to, and returns its cleartext and FHE outputs.
+    torch.manual_seed(42)
+    orion.init_scheme(config)
+    net = TwoLayers()
+    inp = torch.randn(1, 64)
+
+    net.eval()
+    out_clear = net(inp)
+
+    orion.fit(net, inp)
+    input_level = orion.compile(net)
+    assert not scheme.lt_evaluator.planning
+
+    net.he()
+    vec_ctxt = orion.encrypt(orion.encode(inp, input_level))
+    out_fhe = net(vec_ctxt).decrypt().decode()
+    orion.delete_scheme()
+    return out_clear, out_fhe
+
+
+@pytest.mark.parametrize("plan_rotation_keys", [True, False])
+def test_compile_in_memory(tmp_path, plan_rotation_keys):
+    out_clear, out_fhe = run_network(
+        get_config(tmp_path, "none", plan_rotation_keys))
+    assert torch.allclose(out_clear, out_fhe, atol=1e-2)
+
+
+def test_compile_saves_planned_keys(tmp_path):
+    # Keys planned while compiling in "save" mode are all written to the
+    # keys file, and a "load" run evaluates from them.
+    run_network(get_config(tmp_path, "save"))
+    with h5py.File(tmp_path / "keys.h5", "r") as f:
+        saved = {name for name in f if name.isdigit()}
+    assert saved
+
+    out_clear, out_fhe = run_network(get_config(tmp_path, "load"))
+    assert torch.allclose(out_clear, out_fhe, atol=1e-2)
+
+    unplanned = tmp_path / "unplanned"
+    unplanned.mkdir()
+    run_network(get_config(unplanned, "save", plan_rotation_keys=False))
+    with h5py.File(unplanned / "keys.h5", "r") as f:
+        assert {name for name in f if name.isdigit()} == saved
@@ -0,0 +1,91 @@
+import torch
+import orion
+import orion.nn as on
+from orion.core.orion import scheme
+
+
+class SingleLayer(on.Module):
+    def __init__(self):
+        super().__init__()
+        self.fc = on.Linear(64, 64)
+
+    def forward(self, x):
+        return self.fc(x)
+
+
+def get_config(tmp_path, io_mode, storage="hdf5"):
+    return {
+        "ckks_params": {
+            "LogN": 13,
+            "LogQ": [29, 26, 26, 26],
+            "LogP": [29, 29],
+            "LogScale": 26,
+            "H": 8192,
+            "RingType": "ConjugateInvariant",
+        },
+        "orion": {
+            "backend": "lattigo",
+            "debug": False,
+            "io_mode": io_mode,
+            "diags_path": str(tmp_path / "diagonals.h5"),
+            "keys_path": str(tmp_path / "keys.h5"),
+            "storage": storage,
+            "store_path": str(tmp_path / "store"),
+        },
+    }
+
+
+def compile_layer(config):
+    torch.manual_seed(42)
+    orion.init_scheme(config)
+    net = SingleLayer()
+    inp = torch.randn(1, 64)
+
+    orion.fit(net, inp)
+    input_level = orion.compile(net)
+    return net, inp, input_level
+
+
+def run_layer(config):
+    net, inp, input_level = compile_layer(config)
+    net.he()
+
+    vec_ctxt = orion.encrypt(orion.encode(inp, input_level))
+    out = net(vec_ctxt).decrypt().decode()
+    orion.delete_scheme()
+    return out
+
+
+def test_file_storage_matches_hdf5(tmp_path):
+    # Save the layer with each storage, then evaluate it from each.
+    outputs = {}
+    for storage in ("hdf5", "file"):
+        (tmp_path / storage).mkdir()
+        compile_layer(get_config(tmp_path / storage, "save", storage))
+        orion.delete_scheme()
+        outputs[storage] = run_layer(get_config(tmp_path / storage, "load", storage))
+
+    assert (tmp_path / "file" / "store" / "diagonals").is_dir()
+    assert (tmp_path / "file" / "store" / "rotation_keys").is_dir()
+    assert torch.allclose(outputs["hdf5"], outputs["file"], atol=1e-2)
+
+
+def test_file_storage_reads_each_block_once(tmp_path):
+    compile_layer(get_config(tmp_path, "save", "file"))
+    orion.delete_scheme()
+    net, inp, input_level = compile_layer(get_config(tmp_path, "load", "file"))
+    net.he()
+
+    lt_evaluator = scheme.lt_evaluator
+    vec_ctxt = orion.encrypt(orion.encode(inp, input_level))
+    net(vec_ctxt)
+    key_reads = lt_evaluator.rotation_key_reads
+    diagonal_reads = lt_evaluator.diagonal_reads
+    assert key_reads > 0 and diagonal_reads > 0
+
+    # As with HDF5, loaded keys and diagonals are cached.
+    net(vec_ctxt)
+    assert lt_evaluator.rotation_key_reads == key_reads
+    assert lt_evaluator.diagonal_reads == diagonal_reads
+
+    orion.delete_scheme()
@@ -0,0 +1,89 @@
+import torch
+import orion
+import orion.nn as on
+from orion.core.orion import scheme
+
+
+class SingleLayer(on.Module):
+    def __init__(self):
+        super().__init__()
+        self.fc = on.Linear(64, 64)
+
+    def forward(self, x):
+        return self.fc(x)
+
+
+def get_config(tmp_path, io_mode, stream_diagonals=False):
+    return {
+        "ckks_params": {
+            "LogN": 13,
+            "LogQ": [29, 26, 26, 26],
+            "LogP": [29, 29],
+            "LogScale": 26,
+            "H": 8192,
+            "RingType": "ConjugateInvariant",
+        },
+        "orion": {
+            "backend": "lattigo",
+            "debug": False,
+            "io_mode": io_mode,
+            "diags_path": str(tmp_path / "diagonals.h5"),
+            "keys_path": str(tmp_path / "keys.h5"),
+            "stream_diagonals": stream_diagonals,
+        },
+    }
+
+
+def compile_layer(config):
+    torch.manual_seed(42)
+    orion.init_scheme(config)
+    net = SingleLayer()
+    inp = torch.randn(1, 64)
+
+    orion.fit(net, inp)
+    input_level = orion.compile(net)
+    return net, inp, input_level
+
+
+def save_layer(tmp_path):
+    compile_layer(get_config(tmp_path, "save"))
+    orion.delete_scheme()
+
+
+def run_layer(config):
+    net, inp, input_level = compile_layer(config)
+    net.he()
+
+    vec_ctxt = orion.encrypt(orion.encode(inp, input_level))
+    out = net(vec_ctxt).decrypt().decode()
+    orion.delete_scheme()
+    return out
+
+
+def test_streamed_diagonals_match_loaded_ones(tmp_path):
+    # Evaluate the saved layer with whole blocks loaded, and with its
+    # diagonals streamed by giant step.
+    save_layer(tmp_path)
+    loaded = run_layer(get_config(tmp_path, "load"))
+    streamed = run_layer(get_config(tmp_path, "load", stream_diagonals=True))
+
+    assert torch.allclose(loaded, streamed, atol=1e-2)
+
+
+def test_streamed_diagonals_bypass_the_diagonal_cache(tmp_path):
+    # Every evaluation reads the blocks it streams from disk again.
+    save_layer(tmp_path)
+    net, inp, input_level = compile_layer(
+        get_config(tmp_path, "load", stream_diagonals=True))
+    net.he()
+
+    lt_evaluator = scheme.lt_evaluator
+    vec_ctxt = orion.encrypt(orion.encode(inp, input_level))
+    net(vec_ctxt)
+    diagonal_reads = lt_evaluator.diagonal_reads
+    assert diagonal_reads > 0
+
+    net(vec_ctxt)
+    assert lt_evaluator.diagonal_reads == 2 * diagonal_reads
+
+    orion.delete_scheme()
@@ -2,6 +2,8 @@ import time
 import math
 from pathlib import Path
 
+import yaml
+import pytest
 import torch 
 import orion 
 import orion.models as models
@@ -11,11 +13,16 @@ def get_config_path(yml_str):
     orion_path = Path(__file__).parent.parent
     return str(orion_path / "configs" / f"{yml_str}")
 
-def test_mlp():
+@pytest.mark.parametrize("ring_type", ["ConjugateInvariant", "Standard"])
+def test_mlp(ring_type):
     torch.manual_seed(42) # set seed
 
+    with open(get_config_path("mlp.yml"), "r") as f:
+        config = yaml.safe_load(f)
+    config["ckks_params"]["RingType"] = ring_type
+
     # Initialize the Orion scheme and model
-    orion.init_scheme(get_config_path("mlp.yml"))
+    orion.init_scheme(config)
     trainloader, testloader = get_mnist_datasets(data_dir="./data", batch_size=1)
     net = models.MLP()
 
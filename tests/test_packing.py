@@ -0,0 +1,22 @@
+import pytest
+import torch
+import scipy.sparse as sp
+
+from orion.core.packing import diagonalize
+
+
+@pytest.mark.parametrize("dtype", [torch.float32, torch.float64])
+def test_diagonalize_keeps_weight_precision(dtype):
+    # Diagonals carry the weights exactly as given, so float64 weights
+    # are not rounded to float32 before reaching the backend.
+    torch.manual_seed(42)
+    slots = 8
+    matrix = 1 + 1e-9 * torch.randn(slots, slots, dtype=dtype)
+
+    diagonals = diagonalize(
+        sp.csr_matrix(matrix.numpy()), slots, "square", False)[0]
+
+    assert set(diagonals) == {(0, 0)}
+    for k, diag in diagonals[(0, 0)].items():
+        expected = [matrix[i, (i + k) % slots].item() for i in range(slots)]
+        assert diag == expected